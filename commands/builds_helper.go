@@ -208,6 +208,20 @@ func (b *buildsHelper) removeBuild(deleteBuild *common.Build) bool {
 	return false
 }
 
+// isRunning returns whether the runner is running the job
+func (b *buildsHelper) isRunning(runner *common.RunnerConfig, jobID int) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for _, build := range b.builds {
+		if build.Runner.Token == runner.Token && build.ID == jobID {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (b *buildsHelper) buildsCount() int {
 	b.lock.Lock()
 	defer b.lock.Unlock()
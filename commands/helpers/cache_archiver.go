@@ -77,6 +77,14 @@ func (c *CacheArchiverCommand) Execute(*cli.Context) {
 		logrus.Fatalln(err)
 	}
 
+	// Concurrent jobs can share the cache file
+	unlock, err := lockCacheFile(c.File, true)
+	if err != nil {
+		logrus.Warningln("Failed to lock the cache file:", err)
+	} else {
+		defer unlock()
+	}
+
 	// Check if list of files changed
 	if !c.isFileChanged(c.File) {
 		logrus.Infoln("Archive is up to date!")
@@ -2,14 +2,18 @@ package helpers
 
 import (
 	"bytes"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"gitlab.com/gitlab-org/gitlab-runner/helpers"
 )
@@ -22,6 +26,7 @@ func TestCacheArchiverIsUpToDate(t *testing.T) {
 	defer os.Remove(cacheArchiverTestArchivedFile)
 
 	defer os.Remove(cacheArchiverArchive)
+	defer os.Remove(cacheArchiverArchive + ".lock")
 	cmd := CacheArchiverCommand{
 		File: cacheArchiverArchive,
 		fileArchiver: fileArchiver{
@@ -77,6 +82,7 @@ func TestCacheArchiverRemoteServerNotFound(t *testing.T) {
 	removeHook := helpers.MakeFatalToPanic()
 	defer removeHook()
 	os.Remove(cacheExtractorArchive)
+	defer os.Remove(cacheExtractorArchive + ".lock")
 	cmd := CacheArchiverCommand{
 		File:    cacheExtractorArchive,
 		URL:     ts.URL + "/invalid-file.zip",
@@ -94,6 +100,7 @@ func TestCacheArchiverRemoteServer(t *testing.T) {
 	removeHook := helpers.MakeFatalToPanic()
 	defer removeHook()
 	os.Remove(cacheExtractorArchive)
+	defer os.Remove(cacheExtractorArchive + ".lock")
 	cmd := CacheArchiverCommand{
 		File:    cacheExtractorArchive,
 		URL:     ts.URL + "/cache.zip",
@@ -116,6 +123,7 @@ func TestCacheArchiverRemoteServerTimedOut(t *testing.T) {
 	defer removeHook()
 
 	os.Remove(cacheExtractorArchive)
+	defer os.Remove(cacheExtractorArchive + ".lock")
 	cmd := CacheArchiverCommand{
 		File: cacheExtractorArchive,
 		URL:  ts.URL + "/timeout",
@@ -132,6 +140,7 @@ func TestCacheArchiverRemoteServerFailOnInvalidServer(t *testing.T) {
 	removeHook := helpers.MakeFatalToPanic()
 	defer removeHook()
 	os.Remove(cacheExtractorArchive)
+	defer os.Remove(cacheExtractorArchive + ".lock")
 	cmd := CacheArchiverCommand{
 		File:    cacheExtractorArchive,
 		URL:     "http://localhost:65333/cache.zip",
@@ -144,3 +153,47 @@ func TestCacheArchiverRemoteServerFailOnInvalidServer(t *testing.T) {
 	_, err := os.Stat(cacheExtractorTestArchivedFile)
 	assert.Error(t, err)
 }
+
+func TestLockCacheFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the cache file isn't locked on Windows")
+	}
+
+	dir, err := ioutil.TempDir("", "cache-lock")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "key", "cache.zip")
+
+	unlockShared, err := lockCacheFile(file, false)
+	require.NoError(t, err)
+	assert.FileExists(t, file+".lock")
+
+	unlockSecondShared, err := lockCacheFile(file, false)
+	require.NoError(t, err)
+	unlockSecondShared()
+
+	locked := make(chan struct{})
+	go func() {
+		unlockSecond, err := lockCacheFile(file, true)
+		assert.NoError(t, err)
+		close(locked)
+		if unlockSecond != nil {
+			unlockSecond()
+		}
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("cache file locked twice")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	unlockShared()
+
+	select {
+	case <-locked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("cache file not unlocked")
+	}
+}
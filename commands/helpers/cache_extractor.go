@@ -123,6 +123,16 @@ func (c *CacheExtractorCommand) Execute(context *cli.Context) {
 				"Instead a local version of cache will be extracted.")
 	}
 
+	// Concurrent jobs can update the cache file
+	if _, err := os.Stat(c.File); err == nil {
+		unlock, err := lockCacheFile(c.File, false)
+		if err != nil {
+			logrus.Warningln("Failed to lock the cache file:", err)
+		} else {
+			defer unlock()
+		}
+	}
+
 	err := archives.ExtractZipFile(c.File)
 	if err != nil && !os.IsNotExist(err) {
 		logrus.Fatalln(err)
@@ -50,6 +50,7 @@ func TestCacheExtractorForInvalidArchive(t *testing.T) {
 	defer removeHook()
 	writeTestFile(t, cacheExtractorArchive)
 	defer os.Remove(cacheExtractorArchive)
+	defer os.Remove(cacheExtractorArchive + ".lock")
 
 	cmd := CacheExtractorCommand{
 		File: cacheExtractorArchive,
@@ -147,6 +148,7 @@ func TestCacheExtractorRemoteServer(t *testing.T) {
 	defer ts.Close()
 
 	defer os.Remove(cacheExtractorArchive)
+	defer os.Remove(cacheExtractorArchive + ".lock")
 	defer os.Remove(cacheExtractorTestArchivedFile)
 	os.Remove(cacheExtractorArchive)
 	os.Remove(cacheExtractorTestArchivedFile)
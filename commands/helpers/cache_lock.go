@@ -0,0 +1,36 @@
+package helpers
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// lockCacheFile locks the cache file, to let the jobs sharing the cache
+// directory, e.g. on a shared volume, update it one at a time and read it
+// once updated. It returns the function releasing the lock
+func lockCacheFile(file string, exclusive bool) (func(), error) {
+	err := os.MkdirAll(filepath.Dir(file), 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	lockFile, err := os.OpenFile(file+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	if exclusive {
+		err = lockExclusive(lockFile)
+	} else {
+		err = lockShared(lockFile)
+	}
+	if err != nil {
+		_ = lockFile.Close()
+		return nil, err
+	}
+
+	return func() {
+		_ = unlock(lockFile)
+		_ = lockFile.Close()
+	}, nil
+}
@@ -0,0 +1,20 @@
+// +build linux darwin freebsd openbsd
+
+package helpers
+
+import (
+	"os"
+	"syscall"
+)
+
+func lockExclusive(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+}
+
+func lockShared(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_SH)
+}
+
+func unlock(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
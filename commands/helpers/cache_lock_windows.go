@@ -0,0 +1,18 @@
+package helpers
+
+import (
+	"os"
+)
+
+// The cache directory isn't shared by the jobs on Windows
+func lockExclusive(file *os.File) error {
+	return nil
+}
+
+func lockShared(file *os.File) error {
+	return nil
+}
+
+func unlock(file *os.File) error {
+	return nil
+}
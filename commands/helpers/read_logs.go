@@ -35,6 +35,13 @@ type readSeekCloser interface {
 	io.Closer
 }
 
+// statFile is implemented by the log streams backed by a file, which can be
+// rotated while being read
+type statFile interface {
+	Name() string
+	Stat() (os.FileInfo, error)
+}
+
 // checkedFile checks whether a file exists when the underlying
 // File's Read method returns io.EOF. If a file is deleted from
 // the outside the Go file descriptor isn't invalidated and we
@@ -128,13 +135,14 @@ func (c *ReadLogsCommand) execute() error {
 }
 
 func (c *ReadLogsCommand) readLogs() error {
-	s, r, err := c.openFileReader()
+	s, r, offset, err := c.openFileReader(c.Offset)
 	if err != nil {
 		return err
 	}
-	defer s.Close()
+	defer func() {
+		_ = s.Close()
+	}()
 
-	offset := c.Offset
 	for {
 		buf, err := r.ReadSlice('\n')
 		if len(buf) > 0 {
@@ -154,6 +162,20 @@ func (c *ReadLogsCommand) readLogs() error {
 		// bufio.ErrBufferFull means that the message was larger than the buffer
 		// we print the message so far along with a new line character
 		// and continue reading the rest of it from the stream
+		// once the whole file is read, it's replaced by the new one when
+		// it was rotated, and its new contents are read from the start
+		// when it was truncated
+		if errors.Is(err, io.EOF) && isRotated(s, offset) {
+			_ = s.Close()
+
+			s, r, offset, err = c.openFileReader(0)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
 		if errors.Is(err, io.EOF) {
 			time.Sleep(pollFileContentsTimeout)
 		} else if err != nil && !errors.Is(err, bufio.ErrBufferFull) {
@@ -162,19 +184,55 @@ func (c *ReadLogsCommand) readLogs() error {
 	}
 }
 
-func (c *ReadLogsCommand) openFileReader() (readSeekCloser, *bufio.Reader, error) {
+// openFileReader opens the log stream at the offset, or at its start when the
+// offset is past its end, i.e. when the file was rotated since the offset was
+// read
+func (c *ReadLogsCommand) openFileReader(offset int64) (readSeekCloser, *bufio.Reader, int64, error) {
 	s, err := c.logStreamProvider.Open()
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, 0, err
+	}
+
+	if f, ok := s.(statFile); ok {
+		info, err := f.Stat()
+		if err == nil && info.Size() < offset {
+			offset = 0
+		}
 	}
 
-	_, err = s.Seek(c.Offset, 0)
+	_, err = s.Seek(offset, 0)
 	if err != nil {
 		_ = s.Close()
-		return nil, nil, err
+		return nil, nil, 0, err
+	}
+
+	return s, bufio.NewReaderSize(s, c.readerBufferSize), offset, nil
+}
+
+// isRotated checks whether the file read up to the offset was truncated, or
+// replaced by another file at its path
+func isRotated(s readSeekCloser, offset int64) bool {
+	f, ok := s.(statFile)
+	if !ok {
+		return false
+	}
+
+	current, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	if current.Size() < offset {
+		return true
+	}
+
+	latest, err := os.Stat(f.Name())
+	if err != nil {
+		// the new file isn't created yet
+		return false
 	}
 
-	return s, bufio.NewReaderSize(s, c.readerBufferSize), nil
+	return !os.SameFile(current, latest)
 }
 
 func init() {
@@ -246,3 +246,92 @@ func TestSeek(t *testing.T) {
 	var expectedErr *os.PathError
 	assert.True(t, errors.As(err, &expectedErr), "expected err %T, but got %T", expectedErr, err)
 }
+
+func TestReadLogsRotatedFile(t *testing.T) {
+	test.SkipIfGitLabCIOn(t, test.OSWindows)
+
+	tests := map[string]struct {
+		rotate func(t *testing.T, f *os.File)
+	}{
+		"replaced": {
+			rotate: func(t *testing.T, f *os.File) {
+				require.NoError(t, ioutil.WriteFile(f.Name()+".new", nil, 0600))
+				require.NoError(t, os.Rename(f.Name()+".new", f.Name()))
+			},
+		},
+		"truncated": {
+			rotate: func(t *testing.T, f *os.File) {
+				require.NoError(t, os.Truncate(f.Name(), 0))
+				// the truncation is only noticed before the file grows back
+				time.Sleep(2 * pollFileContentsTimeout)
+			},
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			f, cleanup := setupTestFile(t)
+			defer cleanup()
+			appendToFile(t, f, []string{"1", "2"})
+
+			cmd := newReadLogsCommand()
+			cmd.logStreamProvider = &fileLogStreamProvider{
+				waitFileTimeout: time.Second,
+				path:            f.Name(),
+			}
+
+			mockLogOutputWriter := new(mockLogOutputWriter)
+			defer mockLogOutputWriter.AssertExpectations(t)
+			offset, wg := setupMockLogOutputWriterFromLines(mockLogOutputWriter, []string{"1", "2"}, 0)
+			cmd.logOutputWriter = mockLogOutputWriter
+
+			errCh := make(chan error, 1)
+			go func() {
+				errCh <- cmd.readLogs()
+			}()
+
+			wg.Wait()
+			assert.Equal(t, 3, offset)
+
+			tt.rotate(t, f)
+
+			// the lines of the new file are read from its start
+			_, wg = setupMockLogOutputWriterFromLines(mockLogOutputWriter, []string{"3", "4"}, 0)
+			appendToFile(t, f, []string{"3", "4"})
+			wg.Wait()
+
+			require.NoError(t, os.Remove(f.Name()))
+
+			var expectedErr *os.PathError
+			assert.True(t, errors.As(<-errCh, &expectedErr))
+		})
+	}
+}
+
+func TestReadLogsOffsetPastRotatedFile(t *testing.T) {
+	f, cleanup := setupTestFile(t)
+	defer cleanup()
+	appendToFile(t, f, []string{"1"})
+
+	cmd := newReadLogsCommand()
+	cmd.Offset = 100
+
+	mockLogOutputWriter := new(mockLogOutputWriter)
+	defer mockLogOutputWriter.AssertExpectations(t)
+	_, wg := setupMockLogOutputWriterFromLines(mockLogOutputWriter, []string{"1"}, 0)
+	cmd.logOutputWriter = mockLogOutputWriter
+
+	mockLogStreamProvider := new(mockLogStreamProvider)
+	defer mockLogStreamProvider.AssertExpectations(t)
+	mockLogStreamProvider.On("Open").Return(f, nil)
+	cmd.logStreamProvider = mockLogStreamProvider
+
+	go func() {
+		wg.Wait()
+		_ = f.Close()
+	}()
+
+	err := cmd.readLogs()
+	var expectedErr *os.PathError
+	assert.True(t, errors.As(err, &expectedErr), "expected err %T, but got %T", expectedErr, err)
+}
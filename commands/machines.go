@@ -0,0 +1,353 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+	clihelpers "gitlab.com/ayufan/golang-cli-helpers"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+const machinesClientTimeout = 30 * time.Second
+
+type runnerMachines struct {
+	Runner   string               `json:"runner"`
+	Name     string               `json:"name"`
+	Machines []common.MachineInfo `json:"machines"`
+}
+
+type machinesActionResponse struct {
+	Runner  string `json:"runner"`
+	Machine string `json:"machine,omitempty"`
+	Created int    `json:"created,omitempty"`
+}
+
+type machinePool struct {
+	config *common.RunnerConfig
+	pool   common.MachinePoolManager
+}
+
+// machinePools returns the runners using an executor managing a pool of
+// machines, matching the runner name or short token when it's given
+func (mr *RunCommand) machinePools(runner string) []machinePool {
+	var pools []machinePool
+
+	config := mr.config
+	for _, runnerConfig := range config.Runners {
+		if runner != "" && runner != runnerConfig.Name && runner != runnerConfig.ShortDescription() {
+			continue
+		}
+
+		pool, ok := common.GetExecutorProvider(runnerConfig.Executor).(common.MachinePoolManager)
+		if !ok {
+			continue
+		}
+
+		pools = append(pools, machinePool{config: runnerConfig, pool: pool})
+	}
+
+	return pools
+}
+
+func writeMachinesJSON(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(data)
+}
+
+func (mr *RunCommand) ListMachinesHandler(w http.ResponseWriter, r *http.Request) {
+	list := make([]runnerMachines, 0)
+	for _, p := range mr.machinePools(r.URL.Query().Get("runner")) {
+		list = append(list, runnerMachines{
+			Runner:   p.config.ShortDescription(),
+			Name:     p.config.Name,
+			Machines: p.pool.ListMachines(p.config),
+		})
+	}
+
+	writeMachinesJSON(w, list)
+}
+
+// machineControlAllowed rejects the requests changing the machines unless
+// they are POST requests and allow_machine_control is enabled, as the
+// metrics server doesn't authenticate its clients
+func (mr *RunCommand) machineControlAllowed(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+
+	if !mr.config.AllowMachineControl {
+		http.Error(w, "machine control is disabled, set allow_machine_control in config.toml", http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+func (mr *RunCommand) machineActionHandler(
+	action func(pool common.MachinePoolManager, config *common.RunnerConfig, name string) error,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !mr.machineControlAllowed(w, r) {
+			return
+		}
+
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			http.Error(w, "missing machine name", http.StatusBadRequest)
+			return
+		}
+
+		for _, p := range mr.machinePools(r.URL.Query().Get("runner")) {
+			err := action(p.pool, p.config, name)
+			if errors.Is(err, common.ErrMachineNotFound) {
+				continue
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			writeMachinesJSON(w, machinesActionResponse{Runner: p.config.ShortDescription(), Machine: name})
+			return
+		}
+
+		http.Error(w, common.ErrMachineNotFound.Error(), http.StatusNotFound)
+	}
+}
+
+func (mr *RunCommand) PrewarmMachinesHandler(w http.ResponseWriter, r *http.Request) {
+	if !mr.machineControlAllowed(w, r) {
+		return
+	}
+
+	runner := r.URL.Query().Get("runner")
+	count, err := strconv.Atoi(r.URL.Query().Get("count"))
+	if runner == "" || err != nil || count <= 0 {
+		http.Error(w, "runner and a positive count are required", http.StatusBadRequest)
+		return
+	}
+
+	pools := mr.machinePools(runner)
+	if len(pools) != 1 {
+		http.Error(w, fmt.Sprintf("found %d runners matching %q", len(pools), runner), http.StatusNotFound)
+		return
+	}
+
+	p := pools[0]
+	created, err := p.pool.PrewarmMachines(p.config, count)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeMachinesJSON(w, machinesActionResponse{Runner: p.config.ShortDescription(), Created: created})
+}
+
+func (mr *RunCommand) serveMachines(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/machines/list", mr.ListMachinesHandler)
+	mux.HandleFunc("/debug/machines/remove", mr.machineActionHandler(
+		func(pool common.MachinePoolManager, config *common.RunnerConfig, name string) error {
+			return pool.RemoveMachine(config, name)
+		},
+	))
+	mux.HandleFunc("/debug/machines/retire", mr.machineActionHandler(
+		func(pool common.MachinePoolManager, config *common.RunnerConfig, name string) error {
+			return pool.RetireMachine(config, name)
+		},
+	))
+	mux.HandleFunc("/debug/machines/prewarm", mr.PrewarmMachinesHandler)
+}
+
+// MachinesCommand inspects and controls the machines of the running
+// gitlab-runner process through its metrics server
+type MachinesCommand struct {
+	configOptionsWithListenAddress
+
+	Runner string `long:"runner" description:"Name or short token of the runner"`
+	Count  int    `long:"count" description:"Number of machines to pre-warm"`
+
+	client *http.Client
+}
+
+func (c *MachinesCommand) request(method string, path string, query url.Values, data interface{}) error {
+	err := c.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	return c.doRequest(method, path, query, data)
+}
+
+func (c *MachinesCommand) doRequest(method string, path string, query url.Values, data interface{}) error {
+	address, err := c.listenAddress()
+	if err != nil {
+		return err
+	}
+	if address == "" {
+		return errors.New("listen_address isn't configured, the machines can't be reached")
+	}
+
+	if query == nil {
+		query = url.Values{}
+	}
+	if c.Runner != "" {
+		query.Set("runner", c.Runner)
+	}
+
+	u := url.URL{Scheme: "http", Host: address, Path: path, RawQuery: query.Encode()}
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("request failed with %s: %s", resp.Status, body)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(data)
+}
+
+func (c *MachinesCommand) machineName(context *cli.Context) string {
+	if len(context.Args()) != 1 {
+		_ = cli.ShowSubcommandHelp(context)
+		os.Exit(1)
+	}
+
+	return context.Args().Get(0)
+}
+
+func (c *MachinesCommand) List(context *cli.Context) {
+	var list []runnerMachines
+	err := c.request(http.MethodGet, "/debug/machines/list", nil, &list)
+	if err != nil {
+		logrus.Fatalln(err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "RUNNER\tNAME\tSTATE\tUSED COUNT\tAGE\tLAST USED\tREASON")
+	for _, runner := range list {
+		for _, machine := range runner.Machines {
+			state := machine.State
+			if machine.Retired {
+				state += " (retired)"
+			}
+
+			_, _ = fmt.Fprintf(
+				w,
+				"%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+				runner.Runner,
+				machine.Name,
+				state,
+				machine.UsedCount,
+				time.Since(machine.Created).Round(time.Second),
+				time.Since(machine.Used).Round(time.Second),
+				machine.Reason,
+			)
+		}
+	}
+	_ = w.Flush()
+}
+
+func (c *MachinesCommand) Remove(context *cli.Context) {
+	c.machineAction(context, "/debug/machines/remove", "Machine removal requested")
+}
+
+func (c *MachinesCommand) Retire(context *cli.Context) {
+	c.machineAction(context, "/debug/machines/retire", "Machine retired")
+}
+
+func (c *MachinesCommand) machineAction(context *cli.Context, path string, message string) {
+	query := url.Values{}
+	query.Set("name", c.machineName(context))
+
+	var resp machinesActionResponse
+	err := c.request(http.MethodPost, path, query, &resp)
+	if err != nil {
+		logrus.Fatalln(err)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"runner":  resp.Runner,
+		"machine": resp.Machine,
+	}).Println(message)
+}
+
+func (c *MachinesCommand) Prewarm(context *cli.Context) {
+	if c.Runner == "" || c.Count <= 0 {
+		logrus.Fatalln("--runner and a positive --count are required")
+	}
+
+	query := url.Values{}
+	query.Set("count", strconv.Itoa(c.Count))
+
+	var resp machinesActionResponse
+	err := c.request(http.MethodPost, "/debug/machines/prewarm", query, &resp)
+	if err != nil {
+		logrus.Fatalln(err)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"runner":  resp.Runner,
+		"created": resp.Created,
+	}).Println("Machines pre-warmed")
+}
+
+func init() {
+	cmd := &MachinesCommand{
+		client: &http.Client{Timeout: machinesClientTimeout},
+	}
+	flags := clihelpers.GetFlagsFromStruct(cmd)
+
+	common.RegisterCommand(cli.Command{
+		Name:  "machines",
+		Usage: "inspect and control the machines of the autoscaled runners",
+		Subcommands: []cli.Command{
+			{
+				Name:   "list",
+				Usage:  "list the machines",
+				Action: cmd.List,
+				Flags:  flags,
+			},
+			{
+				Name:      "remove",
+				Usage:     "remove a machine, even when it's running a job",
+				ArgsUsage: "NAME",
+				Action:    cmd.Remove,
+				Flags:     flags,
+			},
+			{
+				Name:      "retire",
+				Usage:     "remove a machine once it's not running a job anymore",
+				ArgsUsage: "NAME",
+				Action:    cmd.Retire,
+				Flags:     flags,
+			},
+			{
+				Name:   "prewarm",
+				Usage:  "create idle machines for a runner",
+				Action: cmd.Prewarm,
+				Flags:  flags,
+			},
+		},
+	})
+}
@@ -0,0 +1,332 @@
+package commands
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+const machinesTestExecutor = "machines-test-executor"
+
+type fakeMachinePool struct {
+	common.MockExecutorProvider
+
+	lock     sync.Mutex
+	machines map[string][]common.MachineInfo
+	removed  []string
+	retired  []string
+}
+
+func (f *fakeMachinePool) ListMachines(config *common.RunnerConfig) []common.MachineInfo {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.machines[config.Token]
+}
+
+func (f *fakeMachinePool) find(config *common.RunnerConfig, name string) error {
+	for _, machine := range f.machines[config.Token] {
+		if machine.Name == name {
+			return nil
+		}
+	}
+
+	return common.ErrMachineNotFound
+}
+
+func (f *fakeMachinePool) RemoveMachine(config *common.RunnerConfig, name string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	err := f.find(config, name)
+	if err == nil {
+		f.removed = append(f.removed, name)
+	}
+
+	return err
+}
+
+func (f *fakeMachinePool) RetireMachine(config *common.RunnerConfig, name string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	err := f.find(config, name)
+	if err == nil {
+		f.retired = append(f.retired, name)
+	}
+
+	return err
+}
+
+func (f *fakeMachinePool) PrewarmMachines(config *common.RunnerConfig, count int) (int, error) {
+	return count - 1, nil
+}
+
+var (
+	machinesTestPool     *fakeMachinePool
+	machinesTestPoolOnce sync.Once
+)
+
+func newMachinesTestCommand(t *testing.T) (*RunCommand, *fakeMachinePool) {
+	machinesTestPoolOnce.Do(func() {
+		machinesTestPool = new(fakeMachinePool)
+		machinesTestPool.On("GetDefaultShell").Return("bash")
+		machinesTestPool.On("CanCreate").Return(true)
+		machinesTestPool.On("GetFeatures", mock.Anything).Return(nil)
+
+		common.RegisterExecutorProvider(machinesTestExecutor, machinesTestPool)
+	})
+
+	machinesTestPool.lock.Lock()
+	machinesTestPool.machines = map[string][]common.MachineInfo{
+		"runner1-token": {{Name: "machine-1", State: "Idle", Created: time.Now()}},
+		"runner2-token": {{Name: "machine-2", State: "Used", UsedCount: 2}},
+	}
+	machinesTestPool.removed = nil
+	machinesTestPool.retired = nil
+	machinesTestPool.lock.Unlock()
+
+	mr := &RunCommand{}
+	mr.config = &common.Config{
+		AllowMachineControl: true,
+		Runners: []*common.RunnerConfig{
+			{
+				Name:              "runner1",
+				RunnerCredentials: common.RunnerCredentials{Token: "runner1-token"},
+				RunnerSettings:    common.RunnerSettings{Executor: machinesTestExecutor},
+			},
+			{
+				Name:              "runner2",
+				RunnerCredentials: common.RunnerCredentials{Token: "runner2-token"},
+				RunnerSettings:    common.RunnerSettings{Executor: machinesTestExecutor},
+			},
+			{
+				Name:              "shell",
+				RunnerCredentials: common.RunnerCredentials{Token: "shell-token"},
+				RunnerSettings:    common.RunnerSettings{Executor: "shell"},
+			},
+		},
+	}
+
+	return mr, machinesTestPool
+}
+
+func serveMachinesRequest(mr *RunCommand, method string, url string) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	mr.serveMachines(mux)
+
+	rw := httptest.NewRecorder()
+	mux.ServeHTTP(rw, httptest.NewRequest(method, url, nil))
+
+	return rw
+}
+
+func TestListMachinesHandler(t *testing.T) {
+	tests := map[string]struct {
+		url             string
+		expectedRunners []string
+	}{
+		"all runners": {
+			url:             "/debug/machines/list",
+			expectedRunners: []string{"runner1", "runner2"},
+		},
+		"runner by name": {
+			url:             "/debug/machines/list?runner=runner2",
+			expectedRunners: []string{"runner2"},
+		},
+		"runner by short token": {
+			url:             "/debug/machines/list?runner=runner1-",
+			expectedRunners: []string{"runner1"},
+		},
+		"unknown runner": {
+			url:             "/debug/machines/list?runner=unknown",
+			expectedRunners: []string{},
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			mr, _ := newMachinesTestCommand(t)
+
+			rw := serveMachinesRequest(mr, http.MethodGet, tt.url)
+			require.Equal(t, http.StatusOK, rw.Code)
+			assert.Equal(t, "application/json", rw.Header().Get("Content-Type"))
+
+			var list []runnerMachines
+			require.NoError(t, json.NewDecoder(rw.Body).Decode(&list))
+
+			runners := make([]string, 0)
+			for _, runner := range list {
+				runners = append(runners, runner.Name)
+				assert.Len(t, runner.Machines, 1)
+			}
+			assert.Equal(t, tt.expectedRunners, runners)
+		})
+	}
+}
+
+func TestMachineActionHandlers(t *testing.T) {
+	tests := map[string]struct {
+		method          string
+		url             string
+		expectedCode    int
+		expectedRemoved []string
+		expectedRetired []string
+	}{
+		"remove": {
+			method:          http.MethodPost,
+			url:             "/debug/machines/remove?name=machine-2",
+			expectedCode:    http.StatusOK,
+			expectedRemoved: []string{"machine-2"},
+		},
+		"retire": {
+			method:          http.MethodPost,
+			url:             "/debug/machines/retire?name=machine-1&runner=runner1",
+			expectedCode:    http.StatusOK,
+			expectedRetired: []string{"machine-1"},
+		},
+		"machine of another runner": {
+			method:       http.MethodPost,
+			url:          "/debug/machines/remove?name=machine-1&runner=runner2",
+			expectedCode: http.StatusNotFound,
+		},
+		"unknown machine": {
+			method:       http.MethodPost,
+			url:          "/debug/machines/retire?name=unknown",
+			expectedCode: http.StatusNotFound,
+		},
+		"missing name": {
+			method:       http.MethodPost,
+			url:          "/debug/machines/remove",
+			expectedCode: http.StatusBadRequest,
+		},
+		"not a POST": {
+			method:       http.MethodGet,
+			url:          "/debug/machines/remove?name=machine-1",
+			expectedCode: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			mr, pool := newMachinesTestCommand(t)
+
+			rw := serveMachinesRequest(mr, tt.method, tt.url)
+			assert.Equal(t, tt.expectedCode, rw.Code)
+			assert.Equal(t, tt.expectedRemoved, pool.removed)
+			assert.Equal(t, tt.expectedRetired, pool.retired)
+		})
+	}
+}
+
+func TestMachineControlDisabled(t *testing.T) {
+	urls := []string{
+		"/debug/machines/remove?name=machine-1",
+		"/debug/machines/retire?name=machine-1",
+		"/debug/machines/prewarm?runner=runner1&count=3",
+	}
+
+	for _, url := range urls {
+		t.Run(url, func(t *testing.T) {
+			mr, pool := newMachinesTestCommand(t)
+			mr.config.AllowMachineControl = false
+
+			rw := serveMachinesRequest(mr, http.MethodPost, url)
+			assert.Equal(t, http.StatusForbidden, rw.Code)
+			assert.Contains(t, rw.Body.String(), "allow_machine_control")
+			assert.Empty(t, pool.removed)
+			assert.Empty(t, pool.retired)
+		})
+	}
+
+	mr, _ := newMachinesTestCommand(t)
+	mr.config.AllowMachineControl = false
+
+	rw := serveMachinesRequest(mr, http.MethodGet, "/debug/machines/list")
+	assert.Equal(t, http.StatusOK, rw.Code, "listing the machines is always allowed")
+}
+
+func TestPrewarmMachinesHandler(t *testing.T) {
+	tests := map[string]struct {
+		method          string
+		url             string
+		expectedCode    int
+		expectedCreated int
+	}{
+		"prewarm": {
+			method:          http.MethodPost,
+			url:             "/debug/machines/prewarm?runner=runner1&count=3",
+			expectedCode:    http.StatusOK,
+			expectedCreated: 2,
+		},
+		"missing runner": {
+			method:       http.MethodPost,
+			url:          "/debug/machines/prewarm?count=3",
+			expectedCode: http.StatusBadRequest,
+		},
+		"invalid count": {
+			method:       http.MethodPost,
+			url:          "/debug/machines/prewarm?runner=runner1&count=0",
+			expectedCode: http.StatusBadRequest,
+		},
+		"runner without machines": {
+			method:       http.MethodPost,
+			url:          "/debug/machines/prewarm?runner=shell&count=3",
+			expectedCode: http.StatusNotFound,
+		},
+		"not a POST": {
+			method:       http.MethodGet,
+			url:          "/debug/machines/prewarm?runner=runner1&count=3",
+			expectedCode: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			mr, _ := newMachinesTestCommand(t)
+
+			rw := serveMachinesRequest(mr, tt.method, tt.url)
+			require.Equal(t, tt.expectedCode, rw.Code)
+			if tt.expectedCode != http.StatusOK {
+				return
+			}
+
+			var resp machinesActionResponse
+			require.NoError(t, json.NewDecoder(rw.Body).Decode(&resp))
+			assert.Equal(t, "runner1-", resp.Runner)
+			assert.Equal(t, tt.expectedCreated, resp.Created)
+		})
+	}
+}
+
+func TestMachinesCommandRequest(t *testing.T) {
+	mr, _ := newMachinesTestCommand(t)
+
+	mux := http.NewServeMux()
+	mr.serveMachines(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	cmd := &MachinesCommand{client: server.Client()}
+	cmd.config = &common.Config{ListenAddress: server.Listener.Addr().String()}
+	cmd.Runner = "runner2"
+
+	var list []runnerMachines
+	err := cmd.doRequest(http.MethodGet, "/debug/machines/list", nil, &list)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "machine-2", list[0].Machines[0].Name)
+
+	var resp machinesActionResponse
+	err = cmd.doRequest(http.MethodPost, "/debug/machines/remove", map[string][]string{"name": {"unknown"}}, &resp)
+	assert.EqualError(t, err, "request failed with 404 Not Found: machine not found\n")
+}
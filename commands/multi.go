@@ -29,6 +29,8 @@ import (
 	"gitlab.com/gitlab-org/gitlab-runner/session"
 )
 
+const orphanedResourcesCleanupInterval = 5 * time.Minute
+
 var (
 	concurrentDesc = prometheus.NewDesc(
 		"gitlab_runner_concurrent",
@@ -201,6 +203,7 @@ func (mr *RunCommand) run() {
 
 	runners := make(chan *common.RunnerConfig)
 	go mr.feedRunners(runners)
+	go mr.cleanupOrphanedResources()
 
 	signal.Notify(mr.stopSignals, syscall.SIGQUIT, syscall.SIGTERM, os.Interrupt)
 	signal.Notify(mr.reloadSignal, syscall.SIGHUP)
@@ -304,6 +307,7 @@ func (mr *RunCommand) serveMetrics(mux *http.ServeMux) {
 
 func (mr *RunCommand) serveDebugData(mux *http.ServeMux) {
 	mux.HandleFunc("/debug/jobs/list", mr.buildsHelper.ListJobsHandler)
+	mr.serveMachines(mux)
 }
 
 func (mr *RunCommand) servePprof(mux *http.ServeMux) {
@@ -378,6 +382,37 @@ func (mr *RunCommand) feedRunners(runners chan *common.RunnerConfig) {
 		Debug("Stopping feeding runners to channel")
 }
 
+// cleanupOrphanedResources works until a stopSignal was saved.
+// It periodically deletes the resources left behind by the jobs the runners
+// aren't running anymore, e.g. when the process crashed in the middle of a job.
+func (mr *RunCommand) cleanupOrphanedResources() {
+	for mr.stopSignal == nil {
+		mr.cleanupRunnersOrphanedResources(mr.config)
+		time.Sleep(orphanedResourcesCleanupInterval)
+	}
+}
+
+func (mr *RunCommand) cleanupRunnersOrphanedResources(config *common.Config) {
+	for _, runner := range config.Runners {
+		cleaner, ok := common.GetExecutorProvider(runner.Executor).(common.OrphanedResourcesCleaner)
+		if !ok {
+			continue
+		}
+
+		running := func(jobID int) bool {
+			return mr.buildsHelper.isRunning(runner, jobID)
+		}
+
+		err := cleaner.CleanupOrphanedResources(runner, running)
+		if err != nil {
+			mr.log().
+				WithField("runner", runner.ShortDescription()).
+				WithError(err).
+				Warningln("Failed to clean up orphaned resources")
+		}
+	}
+}
+
 func (mr *RunCommand) feedRunner(runner *common.RunnerConfig, runners chan *common.RunnerConfig) {
 	if !mr.isHealthy(runner.UniqueID()) {
 		return
@@ -473,6 +508,10 @@ func (mr *RunCommand) processRunner(
 	}
 	defer func() { mr.traceOutcome(trace, err) }()
 
+	if observer, ok := provider.(common.JobRequestObserver); ok {
+		observer.ObserveJobRequest(runner)
+	}
+
 	// Create a new build
 	build, err := common.NewBuild(*jobData, runner, mr.abortBuilds, executorData)
 	if err != nil {
@@ -126,3 +126,48 @@ func TestProcessRunner_BuildLimit(t *testing.T) {
 
 	assert.Equal(t, 1, limitMetCount)
 }
+
+type fakeOrphanedResourcesCleaner struct {
+	common.MockExecutorProvider
+
+	jobs    []int
+	running map[int]bool
+}
+
+func (f *fakeOrphanedResourcesCleaner) CleanupOrphanedResources(
+	config *common.RunnerConfig,
+	running func(jobID int) bool,
+) error {
+	f.running = make(map[int]bool)
+	for _, jobID := range f.jobs {
+		f.running[jobID] = running(jobID)
+	}
+
+	return nil
+}
+
+func TestCleanupRunnersOrphanedResources(t *testing.T) {
+	p := &fakeOrphanedResourcesCleaner{jobs: []int{1, 2}}
+	p.On("GetDefaultShell").Return("bash").Once()
+	p.On("CanCreate").Return(true).Once()
+	p.On("GetFeatures", mock.Anything).Return(nil)
+	common.RegisterExecutorProvider("multi-runner-orphaned-resources", p)
+
+	runner := &common.RunnerConfig{
+		RunnerCredentials: common.RunnerCredentials{Token: "runner-token"},
+		RunnerSettings:    common.RunnerSettings{Executor: "multi-runner-orphaned-resources"},
+	}
+	otherRunner := &common.RunnerConfig{
+		RunnerCredentials: common.RunnerCredentials{Token: "other-token"},
+	}
+
+	cmd := RunCommand{buildsHelper: newBuildsHelper()}
+	cmd.buildsHelper.addBuild(&common.Build{JobResponse: common.JobResponse{ID: 1}, Runner: runner})
+	cmd.buildsHelper.addBuild(&common.Build{JobResponse: common.JobResponse{ID: 2}, Runner: otherRunner})
+
+	cmd.cleanupRunnersOrphanedResources(&common.Config{
+		Runners: []*common.RunnerConfig{runner, {RunnerSettings: common.RunnerSettings{Executor: "shell"}}},
+	})
+
+	assert.Equal(t, map[int]bool{1: true, 2: false}, p.running, "checks only the jobs of the runner")
+}
@@ -199,6 +199,16 @@ func (b *Build) ProjectUniqueDir(sharedDir bool) string {
 	return dir
 }
 
+// GetCacheKey returns the key of the cache, deduced from the name of the job
+// and the ref when the user doesn't set it
+func (b *Build) GetCacheKey(userKey string) string {
+	if userKey != "" {
+		return b.GetAllVariables().ExpandValue(userKey)
+	}
+
+	return path.Join(b.JobInfo.Name, b.GitInfo.Ref)
+}
+
 func (b *Build) FullProjectDir() string {
 	return helpers.ToSlash(b.BuildDir)
 }
@@ -910,6 +920,12 @@ func (b *Build) refreshAllVariables() {
 	b.allVariables = nil
 }
 
+// RefreshAllVariables invalidates the cached variables of the build, for the
+// variables added by the executor to be returned by GetAllVariables
+func (b *Build) RefreshAllVariables() {
+	b.refreshAllVariables()
+}
+
 func (b *Build) GetAllVariables() JobVariables {
 	if b.allVariables != nil {
 		return b.allVariables
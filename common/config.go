@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math/big"
@@ -14,8 +15,11 @@ import (
 
 	"github.com/BurntSushi/toml"
 	"github.com/docker/go-units"
+	jsonpatch "github.com/evanphx/json-patch"
 	"github.com/sirupsen/logrus"
 	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
 
 	"gitlab.com/gitlab-org/gitlab-runner/helpers"
 	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker"
@@ -26,6 +30,7 @@ import (
 
 type DockerPullPolicy string
 type DockerSysCtls map[string]string
+type DockerQuotaPolicy string
 
 const (
 	PullPolicyAlways       = "always"
@@ -33,6 +38,11 @@ const (
 	PullPolicyIfNotPresent = "if-not-present"
 )
 
+const (
+	DiskQuotaPolicyRefuse = "refuse"
+	DiskQuotaPolicyWarn   = "warn"
+)
+
 // InvalidTimePeriodsError represents that the time period specified is not valid.
 type InvalidTimePeriodsError struct {
 	periods []string
@@ -73,21 +83,39 @@ func (p DockerPullPolicy) Get() (DockerPullPolicy, error) {
 	return p, nil
 }
 
+// Get returns one of the predefined values or returns an error if the value can't match the predefined
+func (p DockerQuotaPolicy) Get() (DockerQuotaPolicy, error) {
+	// Default policy is refuse
+	if p == "" {
+		return DiskQuotaPolicyRefuse, nil
+	}
+
+	if p != DiskQuotaPolicyRefuse && p != DiskQuotaPolicyWarn {
+		return "", fmt.Errorf("unsupported docker-disk-quota-policy: %v", p)
+	}
+
+	return p, nil
+}
+
 //nolint:lll
 type DockerConfig struct {
 	docker.Credentials
 	Hostname                   string            `toml:"hostname,omitempty" json:"hostname" long:"hostname" env:"DOCKER_HOSTNAME" description:"Custom container hostname"`
 	Image                      string            `toml:"image" json:"image" long:"image" env:"DOCKER_IMAGE" description:"Docker image to be used"`
 	Runtime                    string            `toml:"runtime,omitempty" json:"runtime" long:"runtime" env:"DOCKER_RUNTIME" description:"Docker runtime to be used"`
+	RuntimeOverwriteAllowed    []string          `toml:"runtime_overwrite_allowed,omitempty" json:"runtime_overwrite_allowed" long:"runtime-overwrite-allowed" env:"DOCKER_RUNTIME_OVERWRITE_ALLOWED" description:"List of runtimes that can be requested with the DOCKER_RUNTIME variable in the build"`
 	Memory                     string            `toml:"memory,omitempty" json:"memory" long:"memory" env:"DOCKER_MEMORY" description:"Memory limit (format: <number>[<unit>]). Unit can be one of b, k, m, or g. Minimum is 4M."`
+	MemoryOverwriteMaxAllowed  string            `toml:"memory_overwrite_max_allowed,omitempty" json:"memory_overwrite_max_allowed" long:"memory-overwrite-max-allowed" env:"DOCKER_MEMORY_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the memory limit can be set to. Used with the DOCKER_MEMORY variable in the build."`
 	MemorySwap                 string            `toml:"memory_swap,omitempty" json:"memory_swap" long:"memory-swap" env:"DOCKER_MEMORY_SWAP" description:"Total memory limit (memory + swap, format: <number>[<unit>]). Unit can be one of b, k, m, or g."`
 	MemoryReservation          string            `toml:"memory_reservation,omitempty" json:"memory_reservation" long:"memory-reservation" env:"DOCKER_MEMORY_RESERVATION" description:"Memory soft limit (format: <number>[<unit>]). Unit can be one of b, k, m, or g."`
 	CPUSetCPUs                 string            `toml:"cpuset_cpus,omitempty" json:"cpuset_cpus" long:"cpuset-cpus" env:"DOCKER_CPUSET_CPUS" description:"String value containing the cgroups CpusetCpus to use"`
 	CPUS                       string            `toml:"cpus,omitempty" json:"cpus" long:"cpus" env:"DOCKER_CPUS" description:"Number of CPUs"`
+	CPUSOverwriteMaxAllowed    string            `toml:"cpus_overwrite_max_allowed,omitempty" json:"cpus_overwrite_max_allowed" long:"cpus-overwrite-max-allowed" env:"DOCKER_CPUS_OVERWRITE_MAX_ALLOWED" description:"If set, the max number of CPUs that can be requested. Used with the DOCKER_CPUS variable in the build."`
 	CPUShares                  int64             `toml:"cpu_shares,omitzero" json:"cpu_shares" long:"cpu-shares" env:"DOCKER_CPU_SHARES" description:"Number of CPU shares"`
 	DNS                        []string          `toml:"dns,omitempty" json:"dns" long:"dns" env:"DOCKER_DNS" description:"A list of DNS servers for the container to use"`
 	DNSSearch                  []string          `toml:"dns_search,omitempty" json:"dns_search" long:"dns-search" env:"DOCKER_DNS_SEARCH" description:"A list of DNS search domains"`
 	Privileged                 bool              `toml:"privileged,omitzero" json:"privileged" long:"privileged" env:"DOCKER_PRIVILEGED" description:"Give extended privileges to container"`
+	PrivilegedOverwriteAllowed bool              `toml:"privileged_overwrite_allowed,omitzero" json:"privileged_overwrite_allowed" long:"privileged-overwrite-allowed" env:"DOCKER_PRIVILEGED_OVERWRITE_ALLOWED" description:"Bool to authorize builds to request the privileged flag with the DOCKER_PRIVILEGED variable"`
 	DisableEntrypointOverwrite bool              `toml:"disable_entrypoint_overwrite,omitzero" json:"disable_entrypoint_overwrite" long:"disable-entrypoint-overwrite" env:"DOCKER_DISABLE_ENTRYPOINT_OVERWRITE" description:"Disable the possibility for a container to overwrite the default image entrypoint"`
 	UsernsMode                 string            `toml:"userns_mode,omitempty" json:"userns_mode" long:"userns" env:"DOCKER_USERNS_MODE" description:"User namespace to use"`
 	CapAdd                     []string          `toml:"cap_add" json:"cap_add" long:"cap-add" env:"DOCKER_CAP_ADD" description:"Add Linux capabilities"`
@@ -99,6 +127,7 @@ type DockerConfig struct {
 	DisableCache               bool              `toml:"disable_cache,omitzero" json:"disable_cache" long:"disable-cache" env:"DOCKER_DISABLE_CACHE" description:"Disable all container caching"`
 	Volumes                    []string          `toml:"volumes,omitempty" json:"volumes" long:"volumes" env:"DOCKER_VOLUMES" description:"Bind-mount a volume and create it if it doesn't exist prior to mounting. Can be specified multiple times once per mountpoint, e.g. --docker-volumes 'test0:/test0' --docker-volumes 'test1:/test1'"`
 	VolumeDriver               string            `toml:"volume_driver,omitempty" json:"volume_driver" long:"volume-driver" env:"DOCKER_VOLUME_DRIVER" description:"Volume driver to be used"`
+	VolumeDriverOps            map[string]string `toml:"volume_driver_ops,omitempty" json:"volume_driver_ops" long:"volume-driver-ops" env:"DOCKER_VOLUME_DRIVER_OPS" description:"A toml table/json object of driver specific options used when creating the build and cache volumes, e.g. size=10G"`
 	CacheDir                   string            `toml:"cache_dir,omitempty" json:"cache_dir" long:"cache-dir" env:"DOCKER_CACHE_DIR" description:"Directory where to store caches"`
 	ExtraHosts                 []string          `toml:"extra_hosts,omitempty" json:"extra_hosts" long:"extra-hosts" env:"DOCKER_EXTRA_HOSTS" description:"Add a custom host-to-IP mapping"`
 	VolumesFrom                []string          `toml:"volumes_from,omitempty" json:"volumes_from" long:"volumes-from" env:"DOCKER_VOLUMES_FROM" description:"A list of volumes to inherit from another container"`
@@ -110,10 +139,31 @@ type DockerConfig struct {
 	AllowedServices            []string          `toml:"allowed_services,omitempty" json:"allowed_services" long:"allowed-services" env:"DOCKER_ALLOWED_SERVICES" description:"Whitelist allowed services"`
 	PullPolicy                 DockerPullPolicy  `toml:"pull_policy,omitempty" json:"pull_policy" long:"pull-policy" env:"DOCKER_PULL_POLICY" description:"Image pull policy: never, if-not-present, always"`
 	ShmSize                    int64             `toml:"shm_size,omitempty" json:"shm_size" long:"shm-size" env:"DOCKER_SHM_SIZE" description:"Shared memory size for docker images (in bytes)"`
+	ShmSizeOverwriteMaxAllowed int64             `toml:"shm_size_overwrite_max_allowed,omitzero" json:"shm_size_overwrite_max_allowed" long:"shm-size-overwrite-max-allowed" env:"DOCKER_SHM_SIZE_OVERWRITE_MAX_ALLOWED" description:"If set, the max shared memory size (in bytes) that can be requested. Used with the DOCKER_SHM_SIZE variable in the build."`
 	Tmpfs                      map[string]string `toml:"tmpfs,omitempty" json:"tmpfs" long:"tmpfs" env:"DOCKER_TMPFS" description:"A toml table/json object with the format key=values. When set this will mount the specified path in the key as a tmpfs volume in the main container, using the options specified as key. For the supported options, see the documentation for the unix 'mount' command"`
 	ServicesTmpfs              map[string]string `toml:"services_tmpfs,omitempty" json:"services_tmpfs" long:"services-tmpfs" env:"DOCKER_SERVICES_TMPFS" description:"A toml table/json object with the format key=values. When set this will mount the specified path in the key as a tmpfs volume in all the service containers, using the options specified as key. For the supported options, see the documentation for the unix 'mount' command"`
+	ServiceMemory              string            `toml:"service_memory,omitempty" json:"service_memory" long:"service-memory" env:"DOCKER_SERVICE_MEMORY" description:"Service memory limit (format: <number>[<unit>]). Unit can be one of b, k, m, or g. Minimum is 4M."`
+	ServiceMemorySwap          string            `toml:"service_memory_swap,omitempty" json:"service_memory_swap" long:"service-memory-swap" env:"DOCKER_SERVICE_MEMORY_SWAP" description:"Service total memory limit (memory + swap, format: <number>[<unit>]). Unit can be one of b, k, m, or g."`
+	ServiceMemoryReservation   string            `toml:"service_memory_reservation,omitempty" json:"service_memory_reservation" long:"service-memory-reservation" env:"DOCKER_SERVICE_MEMORY_RESERVATION" description:"Service memory soft limit (format: <number>[<unit>]). Unit can be one of b, k, m, or g."`
+	ServiceCPUSetCPUs          string            `toml:"service_cpuset_cpus,omitempty" json:"service_cpuset_cpus" long:"service-cpuset-cpus" env:"DOCKER_SERVICE_CPUSET_CPUS" description:"String value containing the cgroups CpusetCpus to use for service containers"`
+	ServiceCPUS                string            `toml:"service_cpus,omitempty" json:"service_cpus" long:"service-cpus" env:"DOCKER_SERVICE_CPUS" description:"Number of CPUs for service containers"`
+	ServiceCPUShares           int64             `toml:"service_cpu_shares,omitzero" json:"service_cpu_shares" long:"service-cpu-shares" env:"DOCKER_SERVICE_CPU_SHARES" description:"Number of CPU shares for service containers"`
+	ServiceCapAdd              []string          `toml:"service_cap_add,omitempty" json:"service_cap_add" long:"service-cap-add" env:"DOCKER_SERVICE_CAP_ADD" description:"Add Linux capabilities to service containers"`
+	ServiceCapDrop             []string          `toml:"service_cap_drop,omitempty" json:"service_cap_drop" long:"service-cap-drop" env:"DOCKER_SERVICE_CAP_DROP" description:"Drop Linux capabilities from service containers"`
+	ServiceSecurityOpt         []string          `toml:"service_security_opt,omitempty" json:"service_security_opt" long:"service-security-opt" env:"DOCKER_SERVICE_SECURITY_OPT" description:"Security Options for service containers"`
+	ServiceOomKillDisable      bool              `toml:"service_oom_kill_disable,omitzero" json:"service_oom_kill_disable" long:"service-oom-kill-disable" env:"DOCKER_SERVICE_OOM_KILL_DISABLE" description:"Do not kill processes in a service container if an out-of-memory (OOM) error occurs"`
 	SysCtls                    DockerSysCtls     `toml:"sysctls,omitempty" json:"sysctls" long:"sysctls" env:"DOCKER_SYSCTLS" description:"Sysctl options, a toml table/json object of key=value. Value is expected to be a string."`
+	StorageOpt                 map[string]string `toml:"storage_opt,omitempty" json:"storage_opt" long:"storage-opt" env:"DOCKER_STORAGE_OPT" description:"Storage driver options for the build container, a toml table/json object of key=value, e.g. size=10G"`
+	DiskQuotaPolicy            DockerQuotaPolicy `toml:"disk_quota_policy,omitempty" json:"disk_quota_policy" long:"disk-quota-policy" env:"DOCKER_DISK_QUOTA_POLICY" description:"What to do when the storage or volume driver doesn't support disk quotas: refuse (default) or warn"`
 	HelperImage                string            `toml:"helper_image,omitempty" json:"helper_image" long:"helper-image" env:"DOCKER_HELPER_IMAGE" description:"[ADVANCED] Override the default helper image used to clone repos and upload artifacts"`
+
+	EgressProxy *DockerEgressProxy `toml:"egress_proxy,omitempty" json:"egress_proxy" namespace:"egress-proxy" description:"An HTTP proxy started for each build that allows outbound connections only to the allowed domains"`
+}
+
+//nolint:lll
+type DockerEgressProxy struct {
+	AllowedDomains []string `toml:"allowed_domains,omitempty" json:"allowed_domains" long:"allowed-domains" env:"DOCKER_EGRESS_PROXY_ALLOWED_DOMAINS" description:"List of hosts the build is allowed to connect to. Use *.example.com to allow all of the subdomains"`
+	AuditLogDir    string   `toml:"audit_log_dir,omitempty" json:"audit_log_dir" long:"audit-log-dir" env:"DOCKER_EGRESS_PROXY_AUDIT_LOG_DIR" description:"Directory where the per-job audit log of requested hosts is written"`
 }
 
 //nolint:lll
@@ -124,14 +174,24 @@ type DockerMachine struct {
 	MachineDriver  string   `long:"machine-driver" env:"MACHINE_DRIVER" description:"The driver to use when creating machine"`
 	MachineName    string   `long:"machine-name" env:"MACHINE_NAME" description:"The template for machine name (needs to include %s)"`
 	MachineOptions []string `long:"machine-options" env:"MACHINE_OPTIONS" description:"Additional machine creation options"`
+	Plugin         string   `long:"plugin" env:"MACHINE_PLUGIN" description:"Path to the autoscaler plugin managing the machines instead of docker-machine"`
+	PluginArgs     []string `long:"plugin-args" env:"MACHINE_PLUGIN_ARGS" description:"Arguments for the autoscaler plugin"`
+	StateFile      string   `toml:"StateFile,omitempty" long:"state-file" env:"MACHINE_STATE_FILE" description:"File storing the details of the machines, to keep honouring MaxBuilds and IdleTime after a restart"`
 
 	OffPeakPeriods   []string `long:"off-peak-periods" env:"MACHINE_OFF_PEAK_PERIODS" description:"Time periods when the scheduler is in the OffPeak mode. DEPRECATED"`                                    // DEPRECATED
 	OffPeakTimezone  string   `long:"off-peak-timezone" env:"MACHINE_OFF_PEAK_TIMEZONE" description:"Timezone for the OffPeak periods (defaults to Local). DEPRECATED"`                                    // DEPRECATED
 	OffPeakIdleCount int      `long:"off-peak-idle-count" env:"MACHINE_OFF_PEAK_IDLE_COUNT" description:"Maximum idle machines when the scheduler is in the OffPeak mode. DEPRECATED"`                     // DEPRECATED
 	OffPeakIdleTime  int      `long:"off-peak-idle-time" env:"MACHINE_OFF_PEAK_IDLE_TIME" description:"Minimum time after machine can be destroyed when the scheduler is in the OffPeak mode. DEPRECATED"` // DEPRECATED
 
+	IdleScaleFactor float64 `toml:"IdleScaleFactor,omitzero" long:"idle-scale-factor" env:"MACHINE_IDLE_SCALE_FACTOR" description:"Number of idle machines to keep as a factor of the machines in use, between IdleCountMin and IdleCount"`
+	IdleCountMin    int     `toml:"IdleCountMin,omitzero" long:"idle-count-min" env:"MACHINE_IDLE_COUNT_MIN" description:"Minimum number of idle machines when IdleScaleFactor or IdleRateWindow is set"`
+	IdleRateWindow  int     `toml:"IdleRateWindow,omitzero" long:"idle-rate-window" env:"MACHINE_IDLE_RATE_WINDOW" description:"Time window (in seconds) for which the idle machines should cover the rate of received jobs, between IdleCountMin and IdleCount"`
+
 	AutoscalingConfigs []*DockerMachineAutoscaling `toml:"autoscaling" description:"Ordered list of configurations for autoscaling periods (last match wins)"`
 
+	HealthCheck       *DockerMachineHealthCheck       `toml:"health_check,omitempty" description:"Health checks of the machines"`
+	InterruptionCheck *DockerMachineInterruptionCheck `toml:"interruption_check,omitempty" description:"Checks of the interruption notices of spot or preemptible machines"`
+
 	offPeakTimePeriods *timeperiod.TimePeriod // DEPRECATED
 }
 
@@ -141,9 +201,38 @@ type DockerMachineAutoscaling struct {
 	Timezone        string   `long:"timezone" description:"Timezone for the periods (defaults to Local)"`
 	IdleCount       int      `long:"idle-count" description:"Maximum idle machines when this configuration is active"`
 	IdleTime        int      `long:"idle-time" description:"Minimum time after which and idle machine can be destroyed when this configuration is active"`
+	IdleScaleFactor float64  `toml:"IdleScaleFactor,omitzero" long:"idle-scale-factor" description:"Number of idle machines to keep as a factor of the machines in use when this configuration is active"`
+	IdleCountMin    int      `toml:"IdleCountMin,omitzero" long:"idle-count-min" description:"Minimum number of idle machines when this configuration is active"`
 	compiledPeriods *timeperiod.TimePeriod
 }
 
+// DockerMachineHealthAction defines what happens to the unhealthy machines
+type DockerMachineHealthAction string
+
+const (
+	MachineHealthActionRemove     DockerMachineHealthAction = "remove"
+	MachineHealthActionQuarantine DockerMachineHealthAction = "quarantine"
+)
+
+//nolint:lll
+type DockerMachineHealthCheck struct {
+	Interval          int                       `long:"interval" description:"Time (in seconds) between the health checks of an idle machine, 0 disables the periodic checks"`
+	Timeout           int                       `toml:"Timeout,omitzero" long:"timeout" description:"Timeout (in seconds) of a health check. Defaults to 60"`
+	MinFreeDiskSpace  string                    `toml:"MinFreeDiskSpace,omitempty" long:"min-free-disk-space" description:"Minimum free space of the Docker root directory, like 10g"`
+	MinFreeInodes     int64                     `toml:"MinFreeInodes,omitzero" long:"min-free-inodes" description:"Minimum number of free inodes of the Docker root directory"`
+	Command           []string                  `toml:"Command,omitempty" long:"command" description:"Command run in a container on the machine, which is unhealthy when the command fails"`
+	Image             string                    `toml:"Image,omitempty" long:"image" description:"Image of the containers running the disk checks and the command. Defaults to busybox:latest"`
+	MaxSystemFailures int                       `toml:"MaxSystemFailures,omitzero" long:"max-system-failures" description:"Number of consecutive runner system failures after which the machine is unhealthy, 0 disables"`
+	Action            DockerMachineHealthAction `toml:"Action,omitempty" long:"action" description:"What happens to unhealthy machines: remove (default) or quarantine"`
+	QuarantineTime    int                       `toml:"QuarantineTime,omitzero" long:"quarantine-time" description:"Time (in seconds) a quarantined machine is kept for inspection before being removed. Defaults to 3600"`
+}
+
+//nolint:lll
+type DockerMachineInterruptionCheck struct {
+	URL      string `toml:"URL" long:"url" description:"URL polled for the interruption notice of a machine, %s is replaced with the machine name"`
+	Interval int    `toml:"Interval,omitzero" long:"interval" description:"Time (in seconds) between the checks of a machine running a job. Defaults to 5"`
+}
+
 //nolint:lll
 type ParallelsConfig struct {
 	BaseName         string `toml:"base_name" json:"base_name" long:"base-name" env:"PARALLELS_BASE_NAME" description:"VM name to be used"`
@@ -176,6 +265,17 @@ type CustomConfig struct {
 	CleanupArgs        []string `toml:"cleanup_args,omitempty" json:"cleanup_args" long:"cleanup-args" description:"Arguments for the cleanup executable"`
 	CleanupExecTimeout *int     `toml:"cleanup_exec_timeout,omitempty" json:"cleanup_exec_timeout" long:"cleanup-exec-timeout" env:"CUSTOM_CLEANUP_EXEC_TIMEOUT" description:"Timeout for the cleanup executable (in seconds)"`
 
+	CancelExec        string   `toml:"cancel_exec,omitempty" json:"cancel_exec" long:"cancel-exec" env:"CUSTOM_CANCEL_EXEC" description:"Executable that stops the running stage when the job is cancelled or times out, before the run executable is killed"`
+	CancelArgs        []string `toml:"cancel_args,omitempty" json:"cancel_args" long:"cancel-args" description:"Arguments for the cancel executable"`
+	CancelExecTimeout *int     `toml:"cancel_exec_timeout,omitempty" json:"cancel_exec_timeout" long:"cancel-exec-timeout" env:"CUSTOM_CANCEL_EXEC_TIMEOUT" description:"Timeout for the cancel executable (in seconds)"`
+
+	DriverExec      string   `toml:"driver_exec,omitempty" json:"driver_exec" long:"driver-exec" env:"CUSTOM_DRIVER_EXEC" description:"Executable of a driver running for the whole job, used instead of prepare_exec, run_exec and cleanup_exec"`
+	DriverArgs      []string `toml:"driver_args,omitempty" json:"driver_args" long:"driver-args" description:"Arguments for the driver executable"`
+	DriverTransport string   `toml:"driver_transport,omitempty" json:"driver_transport" long:"driver-transport" env:"CUSTOM_DRIVER_TRANSPORT" description:"Transport of the messages exchanged with the driver: stdio (default) or unix"`
+
+	TerminalExec string   `toml:"terminal_exec,omitempty" json:"terminal_exec" long:"terminal-exec" env:"CUSTOM_TERMINAL_EXEC" description:"Executable attached to a PTY to open the interactive web terminal of the job"`
+	TerminalArgs []string `toml:"terminal_args,omitempty" json:"terminal_args" long:"terminal-args" description:"Arguments for the terminal executable"`
+
 	GracefulKillTimeout *int `toml:"graceful_kill_timeout,omitempty" json:"graceful_kill_timeout" long:"graceful-kill-timeout" env:"CUSTOM_GRACEFUL_KILL_TIMEOUT" description:"Graceful timeout for scripts execution after SIGTERM is sent to the process (in seconds). This limits the time given for scripts to perform the cleanup before exiting"`
 	ForceKillTimeout    *int `toml:"force_kill_timeout,omitempty" json:"force_kill_timeout" long:"force-kill-timeout" env:"CUSTOM_FORCE_KILL_TIMEOUT" description:"Force timeout for scripts execution (in seconds). Counted from the force kill call; if process will be not terminated, Runner will abandon process termination and log an error"`
 }
@@ -200,48 +300,95 @@ func (p KubernetesPullPolicy) Get() (KubernetesPullPolicy, error) {
 
 //nolint:lll
 type KubernetesConfig struct {
-	Host                             string                       `toml:"host" json:"host" long:"host" env:"KUBERNETES_HOST" description:"Optional Kubernetes master host URL (auto-discovery attempted if not specified)"`
-	CertFile                         string                       `toml:"cert_file,omitempty" json:"cert_file" long:"cert-file" env:"KUBERNETES_CERT_FILE" description:"Optional Kubernetes master auth certificate"`
-	KeyFile                          string                       `toml:"key_file,omitempty" json:"key_file" long:"key-file" env:"KUBERNETES_KEY_FILE" description:"Optional Kubernetes master auth private key"`
-	CAFile                           string                       `toml:"ca_file,omitempty" json:"ca_file" long:"ca-file" env:"KUBERNETES_CA_FILE" description:"Optional Kubernetes master auth ca certificate"`
-	BearerTokenOverwriteAllowed      bool                         `toml:"bearer_token_overwrite_allowed" json:"bearer_token_overwrite_allowed" long:"bearer_token_overwrite_allowed" env:"KUBERNETES_BEARER_TOKEN_OVERWRITE_ALLOWED" description:"Bool to authorize builds to specify their own bearer token for creation."`
-	BearerToken                      string                       `toml:"bearer_token,omitempty" json:"bearer_token" long:"bearer_token" env:"KUBERNETES_BEARER_TOKEN" description:"Optional Kubernetes service account token used to start build pods."`
-	Image                            string                       `toml:"image" json:"image" long:"image" env:"KUBERNETES_IMAGE" description:"Default docker image to use for builds when none is specified"`
-	Namespace                        string                       `toml:"namespace" json:"namespace" long:"namespace" env:"KUBERNETES_NAMESPACE" description:"Namespace to run Kubernetes jobs in"`
-	NamespaceOverwriteAllowed        string                       `toml:"namespace_overwrite_allowed" json:"namespace_overwrite_allowed" long:"namespace_overwrite_allowed" env:"KUBERNETES_NAMESPACE_OVERWRITE_ALLOWED" description:"Regex to validate 'KUBERNETES_NAMESPACE_OVERWRITE' value"`
-	Privileged                       bool                         `toml:"privileged,omitzero" json:"privileged" long:"privileged" env:"KUBERNETES_PRIVILEGED" description:"Run all containers with the privileged flag enabled"`
-	CPULimit                         string                       `toml:"cpu_limit,omitempty" json:"cpu_limit" long:"cpu-limit" env:"KUBERNETES_CPU_LIMIT" description:"The CPU allocation given to build containers"`
-	CPULimitOverwriteMaxAllowed      string                       `toml:"cpu_limit_overwrite_max_allowed,omitempty" json:"cpu_limit_overwrite_max_allowed" long:"cpu-limit-overwrite-max-allowed" env:"KUBERNETES_CPU_LIMIT_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the cpu limit can be set to. Used with the KUBERNETES_CPU_LIMIT variable in the build."`
-	MemoryLimit                      string                       `toml:"memory_limit,omitempty" json:"memory_limit" long:"memory-limit" env:"KUBERNETES_MEMORY_LIMIT" description:"The amount of memory allocated to build containers"`
-	MemoryLimitOverwriteMaxAllowed   string                       `toml:"memory_limit_overwrite_max_allowed,omitempty" json:"memory_limit_overwrite_max_allowed" long:"memory-limit-overwrite-max-allowed" env:"KUBERNETES_MEMORY_LIMIT_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the memory limit can be set to. Used with the KUBERNETES_MEMORY_LIMIT variable in the build."`
-	ServiceCPULimit                  string                       `toml:"service_cpu_limit,omitempty" json:"service_cpu_limit" long:"service-cpu-limit" env:"KUBERNETES_SERVICE_CPU_LIMIT" description:"The CPU allocation given to build service containers"`
-	ServiceMemoryLimit               string                       `toml:"service_memory_limit,omitempty" json:"service_memory_limit" long:"service-memory-limit" env:"KUBERNETES_SERVICE_MEMORY_LIMIT" description:"The amount of memory allocated to build service containers"`
-	HelperCPULimit                   string                       `toml:"helper_cpu_limit,omitempty" json:"helper_cpu_limit" long:"helper-cpu-limit" env:"KUBERNETES_HELPER_CPU_LIMIT" description:"The CPU allocation given to build helper containers"`
-	HelperMemoryLimit                string                       `toml:"helper_memory_limit,omitempty" json:"helper_memory_limit" long:"helper-memory-limit" env:"KUBERNETES_HELPER_MEMORY_LIMIT" description:"The amount of memory allocated to build helper containers"`
-	CPURequest                       string                       `toml:"cpu_request,omitempty" json:"cpu_request" long:"cpu-request" env:"KUBERNETES_CPU_REQUEST" description:"The CPU allocation requested for build containers"`
-	CPURequestOverwriteMaxAllowed    string                       `toml:"cpu_request_overwrite_max_allowed,omitempty" json:"cpu_request_overwrite_max_allowed" long:"cpu-request-overwrite-max-allowed" env:"KUBERNETES_CPU_REQUEST_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the cpu request can be set to. Used with the KUBERNETES_CPU_REQUEST variable in the build."`
-	MemoryRequest                    string                       `toml:"memory_request,omitempty" json:"memory_request" long:"memory-request" env:"KUBERNETES_MEMORY_REQUEST" description:"The amount of memory requested from build containers"`
-	MemoryRequestOverwriteMaxAllowed string                       `toml:"memory_request_overwrite_max_allowed,omitempty" json:"memory_request_overwrite_max_allowed" long:"memory-request-overwrite-max-allowed" env:"KUBERNETES_MEMORY_REQUEST_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the memory request can be set to. Used with the KUBERNETES_MEMORY_REQUEST variable in the build."`
-	ServiceCPURequest                string                       `toml:"service_cpu_request,omitempty" json:"service_cpu_request" long:"service-cpu-request" env:"KUBERNETES_SERVICE_CPU_REQUEST" description:"The CPU allocation requested for build service containers"`
-	ServiceMemoryRequest             string                       `toml:"service_memory_request,omitempty" json:"service_memory_request" long:"service-memory-request" env:"KUBERNETES_SERVICE_MEMORY_REQUEST" description:"The amount of memory requested for build service containers"`
-	HelperCPURequest                 string                       `toml:"helper_cpu_request,omitempty" json:"helper_cpu_request" long:"helper-cpu-request" env:"KUBERNETES_HELPER_CPU_REQUEST" description:"The CPU allocation requested for build helper containers"`
-	HelperMemoryRequest              string                       `toml:"helper_memory_request,omitempty" json:"helper_memory_request" long:"helper-memory-request" env:"KUBERNETES_HELPER_MEMORY_REQUEST" description:"The amount of memory requested for build helper containers"`
-	PullPolicy                       KubernetesPullPolicy         `toml:"pull_policy,omitempty" json:"pull_policy" long:"pull-policy" env:"KUBERNETES_PULL_POLICY" description:"Policy for if/when to pull a container image (never, if-not-present, always). The cluster default will be used if not set"`
-	NodeSelector                     map[string]string            `toml:"node_selector,omitempty" json:"node_selector" long:"node-selector" env:"KUBERNETES_NODE_SELECTOR" description:"A toml table/json object of key=value. Value is expected to be a string. When set this will create pods on k8s nodes that match all the key=value pairs."`
-	NodeTolerations                  map[string]string            `toml:"node_tolerations,omitempty" json:"node_tolerations" long:"node-tolerations" env:"KUBERNETES_NODE_TOLERATIONS" description:"A toml table/json object of key=value:effect. Value and effect are expected to be strings. When set, pods will tolerate the given taints. Only one toleration is supported through environment variable configuration."`
-	ImagePullSecrets                 []string                     `toml:"image_pull_secrets,omitempty" json:"image_pull_secrets" long:"image-pull-secrets" env:"KUBERNETES_IMAGE_PULL_SECRETS" description:"A list of image pull secrets that are used for pulling docker image"`
-	HelperImage                      string                       `toml:"helper_image,omitempty" json:"helper_image" long:"helper-image" env:"KUBERNETES_HELPER_IMAGE" description:"[ADVANCED] Override the default helper image used to clone repos and upload artifacts"`
-	TerminationGracePeriodSeconds    int64                        `toml:"terminationGracePeriodSeconds,omitzero" json:"terminationGracePeriodSeconds" long:"terminationGracePeriodSeconds" env:"KUBERNETES_TERMINATIONGRACEPERIODSECONDS" description:"Duration after the processes running in the pod are sent a termination signal and the time when the processes are forcibly halted with a kill signal."`
-	PollInterval                     int                          `toml:"poll_interval,omitzero" json:"poll_interval" long:"poll-interval" env:"KUBERNETES_POLL_INTERVAL" description:"How frequently, in seconds, the runner will poll the Kubernetes pod it has just created to check its status"`
-	PollTimeout                      int                          `toml:"poll_timeout,omitzero" json:"poll_timeout" long:"poll-timeout" env:"KUBERNETES_POLL_TIMEOUT" description:"The total amount of time, in seconds, that needs to pass before the runner will timeout attempting to connect to the pod it has just created (useful for queueing more builds that the cluster can handle at a time)"`
-	PodLabels                        map[string]string            `toml:"pod_labels,omitempty" json:"pod_labels" long:"pod-labels" description:"A toml table/json object of key-value. Value is expected to be a string. When set, this will create pods with the given pod labels. Environment variables will be substituted for values here."`
-	ServiceAccount                   string                       `toml:"service_account,omitempty" json:"service_account" long:"service-account" env:"KUBERNETES_SERVICE_ACCOUNT" description:"Executor pods will use this Service Account to talk to kubernetes API"`
-	ServiceAccountOverwriteAllowed   string                       `toml:"service_account_overwrite_allowed" json:"service_account_overwrite_allowed" long:"service_account_overwrite_allowed" env:"KUBERNETES_SERVICE_ACCOUNT_OVERWRITE_ALLOWED" description:"Regex to validate 'KUBERNETES_SERVICE_ACCOUNT' value"`
-	PodAnnotations                   map[string]string            `toml:"pod_annotations,omitempty" json:"pod_annotations" long:"pod-annotations" description:"A toml table/json object of key-value. Value is expected to be a string. When set, this will create pods with the given annotations. Can be overwritten in build with KUBERNETES_POD_ANNOTATION_* variables"`
-	PodAnnotationsOverwriteAllowed   string                       `toml:"pod_annotations_overwrite_allowed" json:"pod_annotations_overwrite_allowed" long:"pod_annotations_overwrite_allowed" env:"KUBERNETES_POD_ANNOTATIONS_OVERWRITE_ALLOWED" description:"Regex to validate 'KUBERNETES_POD_ANNOTATIONS_*' values"`
-	PodSecurityContext               KubernetesPodSecurityContext `toml:"pod_security_context,omitempty" namespace:"pod-security-context" description:"A security context attached to each build pod"`
-	Volumes                          KubernetesVolumes            `toml:"volumes"`
-	Services                         []Service                    `toml:"services,omitempty" json:"services" description:"Add service that is started with container"`
+	Host                                              string                             `toml:"host" json:"host" long:"host" env:"KUBERNETES_HOST" description:"Optional Kubernetes master host URL (auto-discovery attempted if not specified)"`
+	CertFile                                          string                             `toml:"cert_file,omitempty" json:"cert_file" long:"cert-file" env:"KUBERNETES_CERT_FILE" description:"Optional Kubernetes master auth certificate"`
+	KeyFile                                           string                             `toml:"key_file,omitempty" json:"key_file" long:"key-file" env:"KUBERNETES_KEY_FILE" description:"Optional Kubernetes master auth private key"`
+	CAFile                                            string                             `toml:"ca_file,omitempty" json:"ca_file" long:"ca-file" env:"KUBERNETES_CA_FILE" description:"Optional Kubernetes master auth ca certificate"`
+	BearerTokenOverwriteAllowed                       bool                               `toml:"bearer_token_overwrite_allowed" json:"bearer_token_overwrite_allowed" long:"bearer_token_overwrite_allowed" env:"KUBERNETES_BEARER_TOKEN_OVERWRITE_ALLOWED" description:"Bool to authorize builds to specify their own bearer token for creation."`
+	BearerToken                                       string                             `toml:"bearer_token,omitempty" json:"bearer_token" long:"bearer_token" env:"KUBERNETES_BEARER_TOKEN" description:"Optional Kubernetes service account token used to start build pods."`
+	Image                                             string                             `toml:"image" json:"image" long:"image" env:"KUBERNETES_IMAGE" description:"Default docker image to use for builds when none is specified"`
+	Namespace                                         string                             `toml:"namespace" json:"namespace" long:"namespace" env:"KUBERNETES_NAMESPACE" description:"Namespace to run Kubernetes jobs in"`
+	NamespaceOverwriteAllowed                         string                             `toml:"namespace_overwrite_allowed" json:"namespace_overwrite_allowed" long:"namespace_overwrite_allowed" env:"KUBERNETES_NAMESPACE_OVERWRITE_ALLOWED" description:"Regex to validate 'KUBERNETES_NAMESPACE_OVERWRITE' value"`
+	Privileged                                        bool                               `toml:"privileged,omitzero" json:"privileged" long:"privileged" env:"KUBERNETES_PRIVILEGED" description:"Run all containers with the privileged flag enabled"`
+	CPULimit                                          string                             `toml:"cpu_limit,omitempty" json:"cpu_limit" long:"cpu-limit" env:"KUBERNETES_CPU_LIMIT" description:"The CPU allocation given to build containers"`
+	CPULimitOverwriteMaxAllowed                       string                             `toml:"cpu_limit_overwrite_max_allowed,omitempty" json:"cpu_limit_overwrite_max_allowed" long:"cpu-limit-overwrite-max-allowed" env:"KUBERNETES_CPU_LIMIT_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the cpu limit can be set to. Used with the KUBERNETES_CPU_LIMIT variable in the build."`
+	MemoryLimit                                       string                             `toml:"memory_limit,omitempty" json:"memory_limit" long:"memory-limit" env:"KUBERNETES_MEMORY_LIMIT" description:"The amount of memory allocated to build containers"`
+	MemoryLimitOverwriteMaxAllowed                    string                             `toml:"memory_limit_overwrite_max_allowed,omitempty" json:"memory_limit_overwrite_max_allowed" long:"memory-limit-overwrite-max-allowed" env:"KUBERNETES_MEMORY_LIMIT_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the memory limit can be set to. Used with the KUBERNETES_MEMORY_LIMIT variable in the build."`
+	ServiceCPULimit                                   string                             `toml:"service_cpu_limit,omitempty" json:"service_cpu_limit" long:"service-cpu-limit" env:"KUBERNETES_SERVICE_CPU_LIMIT" description:"The CPU allocation given to build service containers"`
+	ServiceCPULimitOverwriteMaxAllowed                string                             `toml:"service_cpu_limit_overwrite_max_allowed,omitempty" json:"service_cpu_limit_overwrite_max_allowed" long:"service-cpu-limit-overwrite-max-allowed" env:"KUBERNETES_SERVICE_CPU_LIMIT_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the service cpu limit can be set to. Used with the KUBERNETES_SERVICE_CPU_LIMIT variable in the build or the service."`
+	ServiceMemoryLimit                                string                             `toml:"service_memory_limit,omitempty" json:"service_memory_limit" long:"service-memory-limit" env:"KUBERNETES_SERVICE_MEMORY_LIMIT" description:"The amount of memory allocated to build service containers"`
+	ServiceMemoryLimitOverwriteMaxAllowed             string                             `toml:"service_memory_limit_overwrite_max_allowed,omitempty" json:"service_memory_limit_overwrite_max_allowed" long:"service-memory-limit-overwrite-max-allowed" env:"KUBERNETES_SERVICE_MEMORY_LIMIT_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the service memory limit can be set to. Used with the KUBERNETES_SERVICE_MEMORY_LIMIT variable in the build or the service."`
+	HelperCPULimit                                    string                             `toml:"helper_cpu_limit,omitempty" json:"helper_cpu_limit" long:"helper-cpu-limit" env:"KUBERNETES_HELPER_CPU_LIMIT" description:"The CPU allocation given to build helper containers"`
+	HelperMemoryLimit                                 string                             `toml:"helper_memory_limit,omitempty" json:"helper_memory_limit" long:"helper-memory-limit" env:"KUBERNETES_HELPER_MEMORY_LIMIT" description:"The amount of memory allocated to build helper containers"`
+	CPURequest                                        string                             `toml:"cpu_request,omitempty" json:"cpu_request" long:"cpu-request" env:"KUBERNETES_CPU_REQUEST" description:"The CPU allocation requested for build containers"`
+	CPURequestOverwriteMaxAllowed                     string                             `toml:"cpu_request_overwrite_max_allowed,omitempty" json:"cpu_request_overwrite_max_allowed" long:"cpu-request-overwrite-max-allowed" env:"KUBERNETES_CPU_REQUEST_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the cpu request can be set to. Used with the KUBERNETES_CPU_REQUEST variable in the build."`
+	MemoryRequest                                     string                             `toml:"memory_request,omitempty" json:"memory_request" long:"memory-request" env:"KUBERNETES_MEMORY_REQUEST" description:"The amount of memory requested from build containers"`
+	MemoryRequestOverwriteMaxAllowed                  string                             `toml:"memory_request_overwrite_max_allowed,omitempty" json:"memory_request_overwrite_max_allowed" long:"memory-request-overwrite-max-allowed" env:"KUBERNETES_MEMORY_REQUEST_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the memory request can be set to. Used with the KUBERNETES_MEMORY_REQUEST variable in the build."`
+	ServiceCPURequest                                 string                             `toml:"service_cpu_request,omitempty" json:"service_cpu_request" long:"service-cpu-request" env:"KUBERNETES_SERVICE_CPU_REQUEST" description:"The CPU allocation requested for build service containers"`
+	ServiceCPURequestOverwriteMaxAllowed              string                             `toml:"service_cpu_request_overwrite_max_allowed,omitempty" json:"service_cpu_request_overwrite_max_allowed" long:"service-cpu-request-overwrite-max-allowed" env:"KUBERNETES_SERVICE_CPU_REQUEST_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the service cpu request can be set to. Used with the KUBERNETES_SERVICE_CPU_REQUEST variable in the build or the service."`
+	ServiceMemoryRequest                              string                             `toml:"service_memory_request,omitempty" json:"service_memory_request" long:"service-memory-request" env:"KUBERNETES_SERVICE_MEMORY_REQUEST" description:"The amount of memory requested for build service containers"`
+	ServiceMemoryRequestOverwriteMaxAllowed           string                             `toml:"service_memory_request_overwrite_max_allowed,omitempty" json:"service_memory_request_overwrite_max_allowed" long:"service-memory-request-overwrite-max-allowed" env:"KUBERNETES_SERVICE_MEMORY_REQUEST_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the service memory request can be set to. Used with the KUBERNETES_SERVICE_MEMORY_REQUEST variable in the build or the service."`
+	HelperCPURequest                                  string                             `toml:"helper_cpu_request,omitempty" json:"helper_cpu_request" long:"helper-cpu-request" env:"KUBERNETES_HELPER_CPU_REQUEST" description:"The CPU allocation requested for build helper containers"`
+	HelperMemoryRequest                               string                             `toml:"helper_memory_request,omitempty" json:"helper_memory_request" long:"helper-memory-request" env:"KUBERNETES_HELPER_MEMORY_REQUEST" description:"The amount of memory requested for build helper containers"`
+	EphemeralStorageLimit                             string                             `toml:"ephemeral_storage_limit,omitempty" json:"ephemeral_storage_limit" long:"ephemeral-storage-limit" env:"KUBERNETES_EPHEMERAL_STORAGE_LIMIT" description:"The amount of ephemeral storage allocated to build containers"`
+	EphemeralStorageLimitOverwriteMaxAllowed          string                             `toml:"ephemeral_storage_limit_overwrite_max_allowed,omitempty" json:"ephemeral_storage_limit_overwrite_max_allowed" long:"ephemeral-storage-limit-overwrite-max-allowed" env:"KUBERNETES_EPHEMERAL_STORAGE_LIMIT_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the ephemeral storage limit can be set to. Used with the KUBERNETES_EPHEMERAL_STORAGE_LIMIT variable in the build."`
+	EphemeralStorageRequest                           string                             `toml:"ephemeral_storage_request,omitempty" json:"ephemeral_storage_request" long:"ephemeral-storage-request" env:"KUBERNETES_EPHEMERAL_STORAGE_REQUEST" description:"The amount of ephemeral storage requested from build containers"`
+	EphemeralStorageRequestOverwriteMaxAllowed        string                             `toml:"ephemeral_storage_request_overwrite_max_allowed,omitempty" json:"ephemeral_storage_request_overwrite_max_allowed" long:"ephemeral-storage-request-overwrite-max-allowed" env:"KUBERNETES_EPHEMERAL_STORAGE_REQUEST_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the ephemeral storage request can be set to. Used with the KUBERNETES_EPHEMERAL_STORAGE_REQUEST variable in the build."`
+	ServiceEphemeralStorageLimit                      string                             `toml:"service_ephemeral_storage_limit,omitempty" json:"service_ephemeral_storage_limit" long:"service-ephemeral-storage-limit" env:"KUBERNETES_SERVICE_EPHEMERAL_STORAGE_LIMIT" description:"The amount of ephemeral storage allocated to build service containers"`
+	ServiceEphemeralStorageLimitOverwriteMaxAllowed   string                             `toml:"service_ephemeral_storage_limit_overwrite_max_allowed,omitempty" json:"service_ephemeral_storage_limit_overwrite_max_allowed" long:"service-ephemeral-storage-limit-overwrite-max-allowed" env:"KUBERNETES_SERVICE_EPHEMERAL_STORAGE_LIMIT_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the service ephemeral storage limit can be set to. Used with the KUBERNETES_SERVICE_EPHEMERAL_STORAGE_LIMIT variable in the build or the service."`
+	ServiceEphemeralStorageRequest                    string                             `toml:"service_ephemeral_storage_request,omitempty" json:"service_ephemeral_storage_request" long:"service-ephemeral-storage-request" env:"KUBERNETES_SERVICE_EPHEMERAL_STORAGE_REQUEST" description:"The amount of ephemeral storage requested for build service containers"`
+	ServiceEphemeralStorageRequestOverwriteMaxAllowed string                             `toml:"service_ephemeral_storage_request_overwrite_max_allowed,omitempty" json:"service_ephemeral_storage_request_overwrite_max_allowed" long:"service-ephemeral-storage-request-overwrite-max-allowed" env:"KUBERNETES_SERVICE_EPHEMERAL_STORAGE_REQUEST_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the service ephemeral storage request can be set to. Used with the KUBERNETES_SERVICE_EPHEMERAL_STORAGE_REQUEST variable in the build or the service."`
+	HelperEphemeralStorageLimit                       string                             `toml:"helper_ephemeral_storage_limit,omitempty" json:"helper_ephemeral_storage_limit" long:"helper-ephemeral-storage-limit" env:"KUBERNETES_HELPER_EPHEMERAL_STORAGE_LIMIT" description:"The amount of ephemeral storage allocated to build helper containers"`
+	HelperEphemeralStorageRequest                     string                             `toml:"helper_ephemeral_storage_request,omitempty" json:"helper_ephemeral_storage_request" long:"helper-ephemeral-storage-request" env:"KUBERNETES_HELPER_EPHEMERAL_STORAGE_REQUEST" description:"The amount of ephemeral storage requested for build helper containers"`
+	PullPolicy                                        KubernetesPullPolicy               `toml:"pull_policy,omitempty" json:"pull_policy" long:"pull-policy" env:"KUBERNETES_PULL_POLICY" description:"Policy for if/when to pull a container image (never, if-not-present, always). The cluster default will be used if not set"`
+	NodeSelector                                      map[string]string                  `toml:"node_selector,omitempty" json:"node_selector" long:"node-selector" env:"KUBERNETES_NODE_SELECTOR" description:"A toml table/json object of key=value. Value is expected to be a string. When set this will create pods on k8s nodes that match all the key=value pairs."`
+	NodeTolerations                                   map[string]string                  `toml:"node_tolerations,omitempty" json:"node_tolerations" long:"node-tolerations" env:"KUBERNETES_NODE_TOLERATIONS" description:"A toml table/json object of key=value:effect. Value and effect are expected to be strings. When set, pods will tolerate the given taints. Only one toleration is supported through environment variable configuration."`
+	ImagePullSecrets                                  []string                           `toml:"image_pull_secrets,omitempty" json:"image_pull_secrets" long:"image-pull-secrets" env:"KUBERNETES_IMAGE_PULL_SECRETS" description:"A list of image pull secrets that are used for pulling docker image"`
+	HelperImage                                       string                             `toml:"helper_image,omitempty" json:"helper_image" long:"helper-image" env:"KUBERNETES_HELPER_IMAGE" description:"[ADVANCED] Override the default helper image used to clone repos and upload artifacts"`
+	TerminationGracePeriodSeconds                     int64                              `toml:"terminationGracePeriodSeconds,omitzero" json:"terminationGracePeriodSeconds" long:"terminationGracePeriodSeconds" env:"KUBERNETES_TERMINATIONGRACEPERIODSECONDS" description:"Duration after the processes running in the pod are sent a termination signal and the time when the processes are forcibly halted with a kill signal."`
+	PollInterval                                      int                                `toml:"poll_interval,omitzero" json:"poll_interval" long:"poll-interval" env:"KUBERNETES_POLL_INTERVAL" description:"How frequently, in seconds, the runner will poll the Kubernetes pod it has just created to check its status"`
+	PollTimeout                                       int                                `toml:"poll_timeout,omitzero" json:"poll_timeout" long:"poll-timeout" env:"KUBERNETES_POLL_TIMEOUT" description:"The total amount of time, in seconds, that needs to pass before the runner will timeout attempting to connect to the pod it has just created (useful for queueing more builds that the cluster can handle at a time)"`
+	CleanupOrphanedResources                          bool                               `toml:"cleanup_orphaned_resources,omitzero" json:"cleanup_orphaned_resources" long:"cleanup-orphaned-resources" env:"KUBERNETES_CLEANUP_ORPHANED_RESOURCES" description:"Periodically delete the pods, secrets, config maps and services of the runner left by jobs that aren't running anymore"`
+	PodLabels                                         map[string]string                  `toml:"pod_labels,omitempty" json:"pod_labels" long:"pod-labels" description:"A toml table/json object of key-value. Value is expected to be a string. When set, this will create pods with the given pod labels. Environment variables will be substituted for values here."`
+	ServiceAccount                                    string                             `toml:"service_account,omitempty" json:"service_account" long:"service-account" env:"KUBERNETES_SERVICE_ACCOUNT" description:"Executor pods will use this Service Account to talk to kubernetes API"`
+	ServiceAccountOverwriteAllowed                    string                             `toml:"service_account_overwrite_allowed" json:"service_account_overwrite_allowed" long:"service_account_overwrite_allowed" env:"KUBERNETES_SERVICE_ACCOUNT_OVERWRITE_ALLOWED" description:"Regex to validate 'KUBERNETES_SERVICE_ACCOUNT' value"`
+	PodAnnotations                                    map[string]string                  `toml:"pod_annotations,omitempty" json:"pod_annotations" long:"pod-annotations" description:"A toml table/json object of key-value. Value is expected to be a string. When set, this will create pods with the given annotations. Can be overwritten in build with KUBERNETES_POD_ANNOTATION_* variables"`
+	PodAnnotationsOverwriteAllowed                    string                             `toml:"pod_annotations_overwrite_allowed" json:"pod_annotations_overwrite_allowed" long:"pod_annotations_overwrite_allowed" env:"KUBERNETES_POD_ANNOTATIONS_OVERWRITE_ALLOWED" description:"Regex to validate 'KUBERNETES_POD_ANNOTATIONS_*' values"`
+	Tolerations                                       []KubernetesToleration             `toml:"tolerations,omitempty" json:"tolerations" description:"Tolerations of the build pods, with operators, effects and toleration seconds"`
+	Affinity                                          KubernetesAffinity                 `toml:"affinity,omitempty" json:"affinity" description:"Node affinity and pod (anti-)affinity of the build pods"`
+	TopologySpreadConstraints                         []KubernetesTopologySpread         `toml:"topology_spread_constraints,omitempty" json:"topology_spread_constraints" description:"How the build pods are spread across the topology domains, like zones"`
+	DNSPolicy                                         string                             `toml:"dns_policy,omitempty" json:"dns_policy" long:"dns-policy" env:"KUBERNETES_DNS_POLICY" description:"DNS policy of the build pods: ClusterFirst, ClusterFirstWithHostNet, Default or None. The cluster default will be used if not set"`
+	DNSPolicyOverwriteAllowed                         string                             `toml:"dns_policy_overwrite_allowed,omitempty" json:"dns_policy_overwrite_allowed" long:"dns-policy-overwrite-allowed" env:"KUBERNETES_DNS_POLICY_OVERWRITE_ALLOWED" description:"Regex to validate 'KUBERNETES_DNS_POLICY' value"`
+	DNSConfig                                         KubernetesDNSConfig                `toml:"dns_config,omitempty" json:"dns_config" description:"DNS nameservers, search domains and resolver options of the build pods"`
+	DNSConfigOverwriteAllowed                         string                             `toml:"dns_config_overwrite_allowed,omitempty" json:"dns_config_overwrite_allowed" long:"dns-config-overwrite-allowed" env:"KUBERNETES_DNS_CONFIG_OVERWRITE_ALLOWED" description:"Regex to validate 'KUBERNETES_DNS_NAMESERVERS', 'KUBERNETES_DNS_SEARCHES' and 'KUBERNETES_DNS_OPTIONS' values"`
+	HostAliases                                       []KubernetesHostAliases            `toml:"host_aliases,omitempty" json:"host_aliases" description:"Entries added to the hosts file of the build pods"`
+	HostAliasesOverwriteAllowed                       string                             `toml:"host_aliases_overwrite_allowed,omitempty" json:"host_aliases_overwrite_allowed" long:"host-aliases-overwrite-allowed" env:"KUBERNETES_HOST_ALIASES_OVERWRITE_ALLOWED" description:"Regex to validate 'KUBERNETES_HOST_ALIASES' value"`
+	PodSecurityContext                                KubernetesPodSecurityContext       `toml:"pod_security_context,omitempty" namespace:"pod-security-context" description:"A security context attached to each build pod"`
+	BuildContainerSecurityContext                     KubernetesContainerSecurityContext `toml:"build_container_security_context,omitempty" json:"build_container_security_context" description:"A security context attached to the build container"`
+	HelperContainerSecurityContext                    KubernetesContainerSecurityContext `toml:"helper_container_security_context,omitempty" json:"helper_container_security_context" description:"A security context attached to the helper container"`
+	ServiceContainerSecurityContext                   KubernetesContainerSecurityContext `toml:"service_container_security_context,omitempty" json:"service_container_security_context" description:"A security context attached to the service containers"`
+	Volumes                                           KubernetesVolumes                  `toml:"volumes"`
+	CacheVolume                                       KubernetesCacheVolume              `toml:"cache_volume,omitempty" json:"cache_volume" description:"Persistent volume claims storing the cache of the jobs"`
+	Services                                          []Service                          `toml:"services,omitempty" json:"services" description:"Add service that is started with container"`
+	PodSpec                                           []KubernetesPodSpec                `toml:"pod_spec,omitempty" json:"pod_spec" description:"Patches applied to the spec of the build pod before it's created"`
+	PodSpecPatchAllowedFields                         []string                           `toml:"pod_spec_patch_allowed_fields,omitempty" json:"pod_spec_patch_allowed_fields" long:"pod-spec-patch-allowed-fields" env:"KUBERNETES_POD_SPEC_PATCH_ALLOWED_FIELDS" description:"Top-level fields of the pod spec that jobs can patch with the KUBERNETES_POD_SPEC_PATCH variable. Job patches are disabled when empty"`
+}
+
+// KubernetesPodSpecPatchType defines how a patch is applied to the pod spec
+type KubernetesPodSpecPatchType string
+
+const (
+	PatchTypeJSONPatchType           KubernetesPodSpecPatchType = "json"
+	PatchTypeMergePatchType          KubernetesPodSpecPatchType = "merge"
+	PatchTypeStrategicMergePatchType KubernetesPodSpecPatchType = "strategic"
+)
+
+//nolint:lll
+type KubernetesPodSpec struct {
+	Name      string                     `toml:"name" json:"name" description:"Name of the patch, used in the logs"`
+	PatchPath string                     `toml:"patch_path,omitempty" json:"patch_path" description:"Path of a file containing the patch"`
+	Patch     string                     `toml:"patch,omitempty" json:"patch" description:"The patch in YAML or JSON format"`
+	PatchType KubernetesPodSpecPatchType `toml:"patch_type,omitempty" json:"patch_type" description:"Type of the patch: strategic (default), merge or json"`
 }
 
 type KubernetesVolumes struct {
@@ -273,6 +420,20 @@ type KubernetesPVC struct {
 	ReadOnly  bool   `toml:"read_only,omitempty" description:"If this volume should be mounted read only"`
 }
 
+//nolint:lll
+type KubernetesCacheVolume struct {
+	ClaimName    string   `toml:"claim_name,omitempty" json:"claim_name" description:"Name of a persistent volume claim, shared by the jobs, storing the cache"`
+	StorageClass string   `toml:"storage_class,omitempty" json:"storage_class" description:"Storage class of the persistent volume claims provisioned for each cache key"`
+	Size         string   `toml:"size,omitempty" json:"size" description:"Size of the persistent volume claims provisioned for each cache key (default 1Gi)"`
+	AccessModes  []string `toml:"access_modes,omitempty" json:"access_modes" description:"Access modes of the persistent volume claims provisioned for each cache key (default ReadWriteMany)"`
+}
+
+// Enabled returns whether the cache of the jobs is stored in persistent
+// volume claims
+func (c *KubernetesCacheVolume) Enabled() bool {
+	return c.ClaimName != "" || c.StorageClass != ""
+}
+
 //nolint:lll
 type KubernetesSecret struct {
 	Name      string            `toml:"name" json:"name" description:"The name of the volume and Secret to use"`
@@ -296,6 +457,115 @@ type KubernetesPodSecurityContext struct {
 	SupplementalGroups []int64 `toml:"supplemental_groups,omitempty" long:"supplemental-groups" description:"A list of groups applied to the first process run in each container, in addition to the container's primary GID"`
 }
 
+//nolint:lll
+type KubernetesToleration struct {
+	Key               string `toml:"key,omitempty" json:"key" description:"The taint key that the toleration applies to, empty matches all of the keys"`
+	Operator          string `toml:"operator,omitempty" json:"operator" description:"Exists or Equal (default)"`
+	Value             string `toml:"value,omitempty" json:"value" description:"The taint value the toleration matches to"`
+	Effect            string `toml:"effect,omitempty" json:"effect" description:"The taint effect to match: NoSchedule, PreferNoSchedule or NoExecute. Empty matches all of the effects"`
+	TolerationSeconds *int64 `toml:"toleration_seconds,omitempty" json:"toleration_seconds" description:"Time (in seconds) the pod stays bound to a node tainted with NoExecute"`
+}
+
+//nolint:lll
+type KubernetesAffinity struct {
+	NodeAffinity    *KubernetesNodeAffinity `toml:"node_affinity,omitempty" json:"node_affinity" description:"Node affinity scheduling rules"`
+	PodAffinity     *KubernetesPodAffinity  `toml:"pod_affinity,omitempty" json:"pod_affinity" description:"Rules co-locating the build pods with other pods"`
+	PodAntiAffinity *KubernetesPodAffinity  `toml:"pod_anti_affinity,omitempty" json:"pod_anti_affinity" description:"Rules keeping the build pods away from other pods"`
+}
+
+//nolint:lll
+type KubernetesNodeAffinity struct {
+	RequiredDuringSchedulingIgnoredDuringExecution  *KubernetesNodeSelector             `toml:"required_during_scheduling_ignored_during_execution,omitempty" json:"required_during_scheduling_ignored_during_execution" description:"Node selector terms, at least one of which must match the node"`
+	PreferredDuringSchedulingIgnoredDuringExecution []KubernetesPreferredSchedulingTerm `toml:"preferred_during_scheduling_ignored_during_execution,omitempty" json:"preferred_during_scheduling_ignored_during_execution" description:"Weighted node selector terms the scheduler prefers"`
+}
+
+type KubernetesNodeSelector struct {
+	NodeSelectorTerms []KubernetesNodeSelectorTerm `toml:"node_selector_terms" json:"node_selector_terms"`
+}
+
+type KubernetesPreferredSchedulingTerm struct {
+	Weight     int32                      `toml:"weight" json:"weight"`
+	Preference KubernetesNodeSelectorTerm `toml:"preference" json:"preference"`
+}
+
+type KubernetesNodeSelectorTerm struct {
+	MatchExpressions []KubernetesSelectorRequirement `toml:"match_expressions,omitempty" json:"match_expressions"`
+	MatchFields      []KubernetesSelectorRequirement `toml:"match_fields,omitempty" json:"match_fields"`
+}
+
+type KubernetesSelectorRequirement struct {
+	Key      string   `toml:"key" json:"key"`
+	Operator string   `toml:"operator" json:"operator"`
+	Values   []string `toml:"values,omitempty" json:"values"`
+}
+
+//nolint:lll
+type KubernetesPodAffinity struct {
+	RequiredDuringSchedulingIgnoredDuringExecution  []KubernetesPodAffinityTerm         `toml:"required_during_scheduling_ignored_during_execution,omitempty" json:"required_during_scheduling_ignored_during_execution" description:"Pod affinity terms which must all be met"`
+	PreferredDuringSchedulingIgnoredDuringExecution []KubernetesWeightedPodAffinityTerm `toml:"preferred_during_scheduling_ignored_during_execution,omitempty" json:"preferred_during_scheduling_ignored_during_execution" description:"Weighted pod affinity terms the scheduler prefers"`
+}
+
+type KubernetesPodAffinityTerm struct {
+	LabelSelector *KubernetesLabelSelector `toml:"label_selector,omitempty" json:"label_selector"`
+	Namespaces    []string                 `toml:"namespaces,omitempty" json:"namespaces"`
+	TopologyKey   string                   `toml:"topology_key" json:"topology_key"`
+}
+
+type KubernetesWeightedPodAffinityTerm struct {
+	Weight          int32                     `toml:"weight" json:"weight"`
+	PodAffinityTerm KubernetesPodAffinityTerm `toml:"pod_affinity_term" json:"pod_affinity_term"`
+}
+
+type KubernetesLabelSelector struct {
+	MatchLabels      map[string]string               `toml:"match_labels,omitempty" json:"match_labels"`
+	MatchExpressions []KubernetesSelectorRequirement `toml:"match_expressions,omitempty" json:"match_expressions"`
+}
+
+//nolint:lll
+type KubernetesTopologySpread struct {
+	MaxSkew           int32                    `toml:"max_skew" json:"max_skew" description:"Maximum difference of the number of matching pods between two topology domains"`
+	TopologyKey       string                   `toml:"topology_key" json:"topology_key" description:"Node label defining the topology domains, like topology.kubernetes.io/zone"`
+	WhenUnsatisfiable string                   `toml:"when_unsatisfiable,omitempty" json:"when_unsatisfiable" description:"DoNotSchedule (default) or ScheduleAnyway"`
+	LabelSelector     *KubernetesLabelSelector `toml:"label_selector,omitempty" json:"label_selector" description:"Selector of the pods counted in each topology domain"`
+}
+
+//nolint:lll
+type KubernetesDNSConfig struct {
+	Nameservers []string                    `toml:"nameservers,omitempty" json:"nameservers" description:"IP addresses of the DNS servers"`
+	Searches    []string                    `toml:"searches,omitempty" json:"searches" description:"DNS search domains used for the host name lookups"`
+	Options     []KubernetesDNSConfigOption `toml:"options,omitempty" json:"options" description:"Resolver options, like ndots"`
+}
+
+//nolint:lll
+type KubernetesDNSConfigOption struct {
+	Name  string  `toml:"name" json:"name" description:"Name of the resolver option"`
+	Value *string `toml:"value,omitempty" json:"value" description:"Value of the resolver option"`
+}
+
+//nolint:lll
+type KubernetesHostAliases struct {
+	IP        string   `toml:"ip" json:"ip" description:"IP address the host names resolve to"`
+	Hostnames []string `toml:"hostnames" json:"hostnames" description:"Host names resolving to the IP address"`
+}
+
+//nolint:lll
+type KubernetesContainerSecurityContext struct {
+	Capabilities             *KubernetesContainerCapabilities `toml:"capabilities,omitempty" json:"capabilities" description:"The capabilities to add or drop"`
+	Privileged               *bool                            `toml:"privileged,omitempty" json:"privileged" description:"Run the container as privileged, overrides the privileged setting of the runner"`
+	RunAsUser                *int64                           `toml:"run_as_user,omitempty" json:"run_as_user" description:"The UID to run the entrypoint of the container process"`
+	RunAsGroup               *int64                           `toml:"run_as_group,omitempty" json:"run_as_group" description:"The GID to run the entrypoint of the container process"`
+	RunAsNonRoot             *bool                            `toml:"run_as_non_root,omitempty" json:"run_as_non_root" description:"Indicates that the container must run as a non-root user"`
+	ReadOnlyRootFilesystem   *bool                            `toml:"read_only_root_filesystem,omitempty" json:"read_only_root_filesystem" description:"Mount the root filesystem of the container as read-only"`
+	AllowPrivilegeEscalation *bool                            `toml:"allow_privilege_escalation,omitempty" json:"allow_privilege_escalation" description:"Whether a process can gain more privileges than its parent process"`
+	SeccompProfile           string                           `toml:"seccomp_profile,omitempty" json:"seccomp_profile" description:"The seccomp profile of the container, like runtime/default or localhost/<profile>"`
+	AppArmorProfile          string                           `toml:"apparmor_profile,omitempty" json:"apparmor_profile" description:"The AppArmor profile of the container, like runtime/default or localhost/<profile>"`
+}
+
+type KubernetesContainerCapabilities struct {
+	Add  []string `toml:"add,omitempty" json:"add" description:"The capabilities to add to the container"`
+	Drop []string `toml:"drop,omitempty" json:"drop" description:"The capabilities to drop from the container"`
+}
+
 type Service struct {
 	Name  string `toml:"name" long:"name" description:"The image path for the service"`
 	Alias string `toml:"alias,omitempty" long:"alias" description:"The alias of the service"`
@@ -398,8 +668,9 @@ type SessionServer struct {
 
 //nolint:lll
 type Config struct {
-	ListenAddress string        `toml:"listen_address,omitempty" json:"listen_address"`
-	SessionServer SessionServer `toml:"session_server,omitempty" json:"session_server"`
+	ListenAddress       string        `toml:"listen_address,omitempty" json:"listen_address"`
+	AllowMachineControl bool          `toml:"allow_machine_control,omitempty" json:"allow_machine_control" description:"Enable the endpoints removing, retiring and pre-warming machines on the metrics server"`
+	SessionServer       SessionServer `toml:"session_server,omitempty" json:"session_server"`
 
 	Concurrent    int             `toml:"concurrent" json:"concurrent"`
 	CheckInterval int             `toml:"check_interval" json:"check_interval" description:"Define active checking interval of jobs"`
@@ -438,13 +709,21 @@ func (c *SessionServer) GetSessionTimeout() time.Duration {
 }
 
 func (c *DockerConfig) GetNanoCPUs() (int64, error) {
-	if c.CPUS == "" {
+	return c.getNanoCPUs(c.CPUS)
+}
+
+func (c *DockerConfig) GetServiceNanoCPUs() (int64, error) {
+	return c.getNanoCPUs(c.ServiceCPUS)
+}
+
+func (c *DockerConfig) getNanoCPUs(cpus string) (int64, error) {
+	if cpus == "" {
 		return 0, nil
 	}
 
-	cpu, ok := new(big.Rat).SetString(c.CPUS)
+	cpu, ok := new(big.Rat).SetString(cpus)
 	if !ok {
-		return 0, fmt.Errorf("failed to parse %v as a rational number", c.CPUS)
+		return 0, fmt.Errorf("failed to parse %v as a rational number", cpus)
 	}
 
 	nano, _ := cpu.Mul(cpu, big.NewRat(1e9, 1)).Float64()
@@ -481,6 +760,22 @@ func (c *DockerConfig) GetOomKillDisable() *bool {
 	return &c.OomKillDisable
 }
 
+func (c *DockerConfig) GetServiceMemory() int64 {
+	return c.getMemoryBytes(c.ServiceMemory, "service_memory")
+}
+
+func (c *DockerConfig) GetServiceMemorySwap() int64 {
+	return c.getMemoryBytes(c.ServiceMemorySwap, "service_memory_swap")
+}
+
+func (c *DockerConfig) GetServiceMemoryReservation() int64 {
+	return c.getMemoryBytes(c.ServiceMemoryReservation, "service_memory_reservation")
+}
+
+func (c *DockerConfig) GetServiceOomKillDisable() *bool {
+	return &c.ServiceOomKillDisable
+}
+
 func (c *KubernetesConfig) GetPollAttempts() int {
 	if c.PollTimeout <= 0 {
 		c.PollTimeout = KubernetesPollTimeout
@@ -520,9 +815,228 @@ func (c *KubernetesConfig) GetNodeTolerations() []api.Toleration {
 		tolerations = append(tolerations, newToleration)
 	}
 
+	for _, toleration := range c.Tolerations {
+		operator := api.TolerationOpEqual
+		if toleration.Operator != "" {
+			operator = api.TolerationOperator(toleration.Operator)
+		}
+
+		tolerations = append(tolerations, api.Toleration{
+			Key:               toleration.Key,
+			Operator:          operator,
+			Value:             toleration.Value,
+			Effect:            api.TaintEffect(toleration.Effect),
+			TolerationSeconds: toleration.TolerationSeconds,
+		})
+	}
+
 	return tolerations
 }
 
+// GetContainerSecurityContext returns the security context of a container,
+// which is privileged depending on the privileged setting of the runner
+// unless it's set for the container
+func (c *KubernetesConfig) GetContainerSecurityContext(
+	securityContext KubernetesContainerSecurityContext,
+) *api.SecurityContext {
+	privileged := c.Privileged
+	if securityContext.Privileged != nil {
+		privileged = *securityContext.Privileged
+	}
+
+	var capabilities *api.Capabilities
+	if securityContext.Capabilities != nil {
+		capabilities = &api.Capabilities{}
+		for _, capability := range securityContext.Capabilities.Add {
+			capabilities.Add = append(capabilities.Add, api.Capability(capability))
+		}
+		for _, capability := range securityContext.Capabilities.Drop {
+			capabilities.Drop = append(capabilities.Drop, api.Capability(capability))
+		}
+	}
+
+	return &api.SecurityContext{
+		Capabilities:             capabilities,
+		Privileged:               &privileged,
+		RunAsUser:                securityContext.RunAsUser,
+		RunAsGroup:               securityContext.RunAsGroup,
+		RunAsNonRoot:             securityContext.RunAsNonRoot,
+		ReadOnlyRootFilesystem:   securityContext.ReadOnlyRootFilesystem,
+		AllowPrivilegeEscalation: securityContext.AllowPrivilegeEscalation,
+	}
+}
+
+func (c *KubernetesConfig) GetAffinity() *api.Affinity {
+	affinity := c.Affinity
+	if affinity.NodeAffinity == nil && affinity.PodAffinity == nil && affinity.PodAntiAffinity == nil {
+		return nil
+	}
+
+	result := &api.Affinity{}
+
+	if affinity.NodeAffinity != nil {
+		result.NodeAffinity = affinity.NodeAffinity.toAPI()
+	}
+
+	if affinity.PodAffinity != nil {
+		required, preferred := affinity.PodAffinity.toAPI()
+		result.PodAffinity = &api.PodAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution:  required,
+			PreferredDuringSchedulingIgnoredDuringExecution: preferred,
+		}
+	}
+
+	if affinity.PodAntiAffinity != nil {
+		required, preferred := affinity.PodAntiAffinity.toAPI()
+		result.PodAntiAffinity = &api.PodAntiAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution:  required,
+			PreferredDuringSchedulingIgnoredDuringExecution: preferred,
+		}
+	}
+
+	return result
+}
+
+func (c *KubernetesConfig) GetTopologySpreadConstraints() []api.TopologySpreadConstraint {
+	var constraints []api.TopologySpreadConstraint
+
+	for _, spread := range c.TopologySpreadConstraints {
+		whenUnsatisfiable := api.DoNotSchedule
+		if spread.WhenUnsatisfiable != "" {
+			whenUnsatisfiable = api.UnsatisfiableConstraintAction(spread.WhenUnsatisfiable)
+		}
+
+		constraints = append(constraints, api.TopologySpreadConstraint{
+			MaxSkew:           spread.MaxSkew,
+			TopologyKey:       spread.TopologyKey,
+			WhenUnsatisfiable: whenUnsatisfiable,
+			LabelSelector:     spread.LabelSelector.toAPI(),
+		})
+	}
+
+	return constraints
+}
+
+// GetDNSConfig returns the DNS config of the build pods, or nil when it isn't
+// configured
+func (c *KubernetesConfig) GetDNSConfig() *api.PodDNSConfig {
+	if len(c.DNSConfig.Nameservers) == 0 && len(c.DNSConfig.Searches) == 0 && len(c.DNSConfig.Options) == 0 {
+		return nil
+	}
+
+	config := &api.PodDNSConfig{
+		Nameservers: c.DNSConfig.Nameservers,
+		Searches:    c.DNSConfig.Searches,
+	}
+	for _, option := range c.DNSConfig.Options {
+		config.Options = append(config.Options, api.PodDNSConfigOption{
+			Name:  option.Name,
+			Value: option.Value,
+		})
+	}
+
+	return config
+}
+
+func (c *KubernetesConfig) GetHostAliases() []api.HostAlias {
+	var hostAliases []api.HostAlias
+
+	for _, alias := range c.HostAliases {
+		hostAliases = append(hostAliases, api.HostAlias{
+			IP:        alias.IP,
+			Hostnames: alias.Hostnames,
+		})
+	}
+
+	return hostAliases
+}
+
+func (a *KubernetesNodeAffinity) toAPI() *api.NodeAffinity {
+	nodeAffinity := &api.NodeAffinity{}
+
+	if a.RequiredDuringSchedulingIgnoredDuringExecution != nil {
+		selector := &api.NodeSelector{}
+		for _, term := range a.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+			selector.NodeSelectorTerms = append(selector.NodeSelectorTerms, term.toAPI())
+		}
+		nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = selector
+	}
+
+	for _, term := range a.PreferredDuringSchedulingIgnoredDuringExecution {
+		nodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(
+			nodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution,
+			api.PreferredSchedulingTerm{Weight: term.Weight, Preference: term.Preference.toAPI()},
+		)
+	}
+
+	return nodeAffinity
+}
+
+func (t *KubernetesNodeSelectorTerm) toAPI() api.NodeSelectorTerm {
+	term := api.NodeSelectorTerm{}
+
+	for _, requirement := range t.MatchExpressions {
+		term.MatchExpressions = append(term.MatchExpressions, requirement.toNodeSelectorRequirement())
+	}
+
+	for _, requirement := range t.MatchFields {
+		term.MatchFields = append(term.MatchFields, requirement.toNodeSelectorRequirement())
+	}
+
+	return term
+}
+
+func (r *KubernetesSelectorRequirement) toNodeSelectorRequirement() api.NodeSelectorRequirement {
+	return api.NodeSelectorRequirement{
+		Key:      r.Key,
+		Operator: api.NodeSelectorOperator(r.Operator),
+		Values:   r.Values,
+	}
+}
+
+func (a *KubernetesPodAffinity) toAPI() ([]api.PodAffinityTerm, []api.WeightedPodAffinityTerm) {
+	var required []api.PodAffinityTerm
+	var preferred []api.WeightedPodAffinityTerm
+
+	for _, term := range a.RequiredDuringSchedulingIgnoredDuringExecution {
+		required = append(required, term.toAPI())
+	}
+
+	for _, term := range a.PreferredDuringSchedulingIgnoredDuringExecution {
+		preferred = append(preferred, api.WeightedPodAffinityTerm{
+			Weight:          term.Weight,
+			PodAffinityTerm: term.PodAffinityTerm.toAPI(),
+		})
+	}
+
+	return required, preferred
+}
+
+func (t *KubernetesPodAffinityTerm) toAPI() api.PodAffinityTerm {
+	return api.PodAffinityTerm{
+		LabelSelector: t.LabelSelector.toAPI(),
+		Namespaces:    t.Namespaces,
+		TopologyKey:   t.TopologyKey,
+	}
+}
+
+func (s *KubernetesLabelSelector) toAPI() *metav1.LabelSelector {
+	if s == nil {
+		return nil
+	}
+
+	selector := &metav1.LabelSelector{MatchLabels: s.MatchLabels}
+	for _, requirement := range s.MatchExpressions {
+		selector.MatchExpressions = append(selector.MatchExpressions, metav1.LabelSelectorRequirement{
+			Key:      requirement.Key,
+			Operator: metav1.LabelSelectorOperator(requirement.Operator),
+			Values:   requirement.Values,
+		})
+	}
+
+	return selector
+}
+
 func (c *KubernetesConfig) GetPodSecurityContext() *api.PodSecurityContext {
 	podSecurityContext := c.PodSecurityContext
 
@@ -543,6 +1057,68 @@ func (c *KubernetesConfig) GetPodSecurityContext() *api.PodSecurityContext {
 	}
 }
 
+// ValidatePodSpecPatches checks that all of the pod spec patches can be read
+// and parsed
+func (c *KubernetesConfig) ValidatePodSpecPatches() error {
+	for _, spec := range c.PodSpec {
+		if _, _, err := spec.PatchAttrs(); err != nil {
+			return fmt.Errorf("invalid pod spec patch %q: %w", spec.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// PatchAttrs returns the patch in the JSON format and its type
+func (s *KubernetesPodSpec) PatchAttrs() ([]byte, KubernetesPodSpecPatchType, error) {
+	if s.PatchPath != "" && s.Patch != "" {
+		return nil, "", errors.New("patch_path and patch can't be set at the same time")
+	}
+
+	patch := []byte(s.Patch)
+	if s.PatchPath != "" {
+		var err error
+		patch, err = ioutil.ReadFile(s.PatchPath)
+		if err != nil {
+			return nil, "", fmt.Errorf("reading the patch file: %w", err)
+		}
+	}
+
+	return ParsePodSpecPatch(patch, s.PatchType)
+}
+
+// ParsePodSpecPatch converts the YAML or JSON patch to JSON and validates it
+// against its type, which defaults to a strategic merge patch
+func ParsePodSpecPatch(patch []byte, patchType KubernetesPodSpecPatchType) ([]byte, KubernetesPodSpecPatchType, error) {
+	if patchType == "" {
+		patchType = PatchTypeStrategicMergePatchType
+	}
+
+	data, err := yaml.YAMLToJSON(patch)
+	if err != nil {
+		return nil, "", fmt.Errorf("parsing the patch: %w", err)
+	}
+
+	switch patchType {
+	case PatchTypeJSONPatchType:
+		_, err = jsonpatch.DecodePatch(data)
+	case PatchTypeMergePatchType, PatchTypeStrategicMergePatchType:
+		var document map[string]interface{}
+		err = json.Unmarshal(data, &document)
+		if err == nil && document == nil {
+			err = errors.New("patch is empty")
+		}
+	default:
+		return nil, "", fmt.Errorf("unsupported patch type %q", patchType)
+	}
+
+	if err != nil {
+		return nil, "", fmt.Errorf("parsing the %s patch: %w", patchType, err)
+	}
+
+	return data, patchType, nil
+}
+
 func (c *DockerMachine) GetIdleCount() int {
 	autoscaling := c.getActiveAutoscalingConfig()
 	if autoscaling != nil {
@@ -552,6 +1128,82 @@ func (c *DockerMachine) GetIdleCount() int {
 	return c.IdleCount
 }
 
+func (c *DockerMachine) GetIdleScaleFactor() float64 {
+	autoscaling := c.getActiveAutoscalingConfig()
+	if autoscaling != nil {
+		return autoscaling.IdleScaleFactor
+	}
+
+	return c.IdleScaleFactor
+}
+
+func (c *DockerMachine) GetIdleCountMin() int {
+	autoscaling := c.getActiveAutoscalingConfig()
+	if autoscaling != nil {
+		return autoscaling.IdleCountMin
+	}
+
+	return c.IdleCountMin
+}
+
+func (c *DockerMachineHealthCheck) GetTimeout() time.Duration {
+	if c.Timeout <= 0 {
+		return DefaultMachineHealthCheckTimeout
+	}
+
+	return time.Duration(c.Timeout) * time.Second
+}
+
+func (c *DockerMachineHealthCheck) GetImage() string {
+	if c.Image == "" {
+		return DefaultMachineHealthCheckImage
+	}
+
+	return c.Image
+}
+
+func (c *DockerMachineHealthCheck) GetMinFreeDiskSpace() (int64, error) {
+	if c.MinFreeDiskSpace == "" {
+		return 0, nil
+	}
+
+	size, err := units.RAMInBytes(c.MinFreeDiskSpace)
+	if err != nil {
+		return 0, fmt.Errorf("invalid min free disk space %q: %w", c.MinFreeDiskSpace, err)
+	}
+
+	return size, nil
+}
+
+func (c *DockerMachineHealthCheck) GetAction() DockerMachineHealthAction {
+	if c == nil || c.Action == "" {
+		return MachineHealthActionRemove
+	}
+
+	return c.Action
+}
+
+func (c *DockerMachineHealthCheck) GetQuarantineTime() time.Duration {
+	if c == nil || c.QuarantineTime <= 0 {
+		return DefaultMachineQuarantineTime
+	}
+
+	return time.Duration(c.QuarantineTime) * time.Second
+}
+
+func (c *DockerMachineInterruptionCheck) GetInterval() time.Duration {
+	if c.Interval <= 0 {
+		return DefaultMachineInterruptionCheckInterval
+	}
+
+	return time.Duration(c.Interval) * time.Second
+}
+
+// GetURL returns the URL of the interruption notice of the machine
+func (c *DockerMachineInterruptionCheck) GetURL(machineName string) string {
+	return strings.ReplaceAll(c.URL, "%s", machineName)
+}
+
 func (c *DockerMachine) GetIdleTime() int {
 	autoscaling := c.getActiveAutoscalingConfig()
 	if autoscaling != nil {
@@ -761,6 +1413,13 @@ func (c *Config) LoadConfig(configFile string) error {
 	}
 
 	for _, runner := range c.Runners {
+		if runner.Kubernetes != nil {
+			err := runner.Kubernetes.ValidatePodSpecPatches()
+			if err != nil {
+				return err
+			}
+		}
+
 		if runner.Machine == nil {
 			continue
 		}
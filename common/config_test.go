@@ -3,6 +3,8 @@ package common
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"testing"
 	"time"
 
@@ -197,6 +199,74 @@ func TestConfigParse(t *testing.T) {
 				assert.Equal(t, "image", config.Runners[0].Docker.Image)
 			},
 		},
+		"parse kubernetes affinity, tolerations and topology spread constraints": {
+			config: `
+				[[runners]]
+				[runners.kubernetes]
+				[[runners.kubernetes.tolerations]]
+				key = "node.kubernetes.io/unreachable"
+				operator = "Exists"
+				effect = "NoExecute"
+				toleration_seconds = 60
+				[runners.kubernetes.affinity]
+				[runners.kubernetes.affinity.node_affinity]
+				[[runners.kubernetes.affinity.node_affinity.required_during_scheduling_ignored_during_execution.node_selector_terms]]
+				[[runners.kubernetes.affinity.node_affinity.required_during_scheduling_ignored_during_execution.node_selector_terms.match_expressions]]
+				key = "kubernetes.io/os"
+				operator = "In"
+				values = ["linux"]
+				[[runners.kubernetes.affinity.node_affinity.preferred_during_scheduling_ignored_during_execution]]
+				weight = 100
+				[[runners.kubernetes.affinity.node_affinity.preferred_during_scheduling_ignored_during_execution.preference.match_expressions]]
+				key = "node-pool"
+				operator = "In"
+				values = ["ci"]
+				[runners.kubernetes.affinity.pod_anti_affinity]
+				[[runners.kubernetes.affinity.pod_anti_affinity.required_during_scheduling_ignored_during_execution]]
+				topology_key = "kubernetes.io/hostname"
+				[runners.kubernetes.affinity.pod_anti_affinity.required_during_scheduling_ignored_during_execution.label_selector]
+				match_labels = { app = "latency-sensitive" }
+				[[runners.kubernetes.topology_spread_constraints]]
+				max_skew = 1
+				topology_key = "topology.kubernetes.io/zone"
+				[runners.kubernetes.topology_spread_constraints.label_selector]
+				[[runners.kubernetes.topology_spread_constraints.label_selector.match_expressions]]
+				key = "pod"
+				operator = "Exists"
+			`,
+			validateConfig: func(t *testing.T, config *Config) {
+				require.Equal(t, 1, len(config.Runners))
+				k8s := config.Runners[0].Kubernetes
+
+				tolerations := k8s.GetNodeTolerations()
+				require.Len(t, tolerations, 1)
+				assert.Equal(t, int64(60), *tolerations[0].TolerationSeconds)
+
+				affinity := k8s.GetAffinity()
+				require.NotNil(t, affinity)
+				nodeAffinity := affinity.NodeAffinity
+				require.Len(t, nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms, 1)
+				assert.Equal(
+					t,
+					"kubernetes.io/os",
+					nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0].MatchExpressions[0].Key,
+				)
+				require.Len(t, nodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution, 1)
+				assert.Equal(t, int32(100), nodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution[0].Weight)
+				assert.Nil(t, affinity.PodAffinity)
+				require.Len(t, affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution, 1)
+				assert.Equal(
+					t,
+					map[string]string{"app": "latency-sensitive"},
+					affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution[0].LabelSelector.MatchLabels,
+				)
+
+				constraints := k8s.GetTopologySpreadConstraints()
+				require.Len(t, constraints, 1)
+				assert.Equal(t, int32(1), constraints[0].MaxSkew)
+				assert.Equal(t, "pod", constraints[0].LabelSelector.MatchExpressions[0].Key)
+			},
+		},
 	}
 
 	for tn, tt := range tests {
@@ -414,3 +484,189 @@ func TestDockerMachine(t *testing.T) {
 		})
 	}
 }
+
+func TestDockerMachineIdleScaling(t *testing.T) {
+	timeNow := func() time.Time {
+		return time.Date(2020, 05, 05, 20, 00, 00, 0, time.Local)
+	}
+	activeTimePeriod := []string{fmt.Sprintf("* * %d * * * *", timeNow().Hour())}
+	inactiveTimePeriod := []string{fmt.Sprintf("* * %d * * * *", timeNow().Add(2*time.Hour).Hour())}
+
+	oldPeriodTimer := periodTimer
+	defer func() {
+		periodTimer = oldPeriodTimer
+	}()
+	periodTimer = timeNow
+
+	tests := map[string]struct {
+		periods                 []string
+		expectedIdleScaleFactor float64
+		expectedIdleCountMin    int
+	}{
+		"autoscaling config active": {
+			periods:                 activeTimePeriod,
+			expectedIdleScaleFactor: 0.5,
+			expectedIdleCountMin:    2,
+		},
+		"autoscaling config inactive": {
+			periods:                 inactiveTimePeriod,
+			expectedIdleScaleFactor: 1.5,
+			expectedIdleCountMin:    5,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			config := &DockerMachine{
+				IdleScaleFactor: 1.5,
+				IdleCountMin:    5,
+				AutoscalingConfigs: []*DockerMachineAutoscaling{
+					{
+						Periods:         tt.periods,
+						IdleScaleFactor: 0.5,
+						IdleCountMin:    2,
+					},
+				},
+			}
+			require.NoError(t, config.CompilePeriods())
+
+			assert.Equal(t, tt.expectedIdleScaleFactor, config.GetIdleScaleFactor())
+			assert.Equal(t, tt.expectedIdleCountMin, config.GetIdleCountMin())
+		})
+	}
+}
+
+func TestDockerMachineHealthCheckDefaults(t *testing.T) {
+	var nilCheck *DockerMachineHealthCheck
+	assert.Equal(t, MachineHealthActionRemove, nilCheck.GetAction())
+	assert.Equal(t, DefaultMachineQuarantineTime, nilCheck.GetQuarantineTime())
+
+	check := &DockerMachineHealthCheck{}
+	assert.Equal(t, DefaultMachineHealthCheckTimeout, check.GetTimeout())
+	assert.Equal(t, DefaultMachineHealthCheckImage, check.GetImage())
+
+	size, err := check.GetMinFreeDiskSpace()
+	assert.NoError(t, err)
+	assert.Zero(t, size)
+
+	check = &DockerMachineHealthCheck{
+		Timeout:          10,
+		Image:            "alpine:3.12",
+		MinFreeDiskSpace: "10g",
+		Action:           MachineHealthActionQuarantine,
+		QuarantineTime:   60,
+	}
+	assert.Equal(t, 10*time.Second, check.GetTimeout())
+	assert.Equal(t, "alpine:3.12", check.GetImage())
+	assert.Equal(t, MachineHealthActionQuarantine, check.GetAction())
+	assert.Equal(t, time.Minute, check.GetQuarantineTime())
+
+	size, err = check.GetMinFreeDiskSpace()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10*1024*1024*1024), size)
+
+	check.MinFreeDiskSpace = "lots"
+	_, err = check.GetMinFreeDiskSpace()
+	assert.Error(t, err)
+}
+
+func TestKubernetesPodSpecPatchAttrs(t *testing.T) {
+	patchFile, err := ioutil.TempFile("", "pod-spec-patch")
+	require.NoError(t, err)
+	defer os.Remove(patchFile.Name())
+
+	_, err = patchFile.WriteString("priorityClassName: high\n")
+	require.NoError(t, err)
+	require.NoError(t, patchFile.Close())
+
+	tests := map[string]struct {
+		spec              KubernetesPodSpec
+		expectedPatch     string
+		expectedPatchType KubernetesPodSpecPatchType
+		expectedErr       bool
+	}{
+		"YAML strategic merge patch by default": {
+			spec:              KubernetesPodSpec{Patch: "runtimeClassName: gvisor"},
+			expectedPatch:     `{"runtimeClassName":"gvisor"}`,
+			expectedPatchType: PatchTypeStrategicMergePatchType,
+		},
+		"JSON merge patch": {
+			spec:              KubernetesPodSpec{Patch: `{"hostname": "build"}`, PatchType: PatchTypeMergePatchType},
+			expectedPatch:     `{"hostname":"build"}`,
+			expectedPatchType: PatchTypeMergePatchType,
+		},
+		"JSON patch": {
+			spec: KubernetesPodSpec{
+				Patch:     `[{"op": "add", "path": "/priorityClassName", "value": "high"}]`,
+				PatchType: PatchTypeJSONPatchType,
+			},
+			expectedPatch:     `[{"op":"add","path":"/priorityClassName","value":"high"}]`,
+			expectedPatchType: PatchTypeJSONPatchType,
+		},
+		"patch file": {
+			spec:              KubernetesPodSpec{PatchPath: patchFile.Name()},
+			expectedPatch:     `{"priorityClassName":"high"}`,
+			expectedPatchType: PatchTypeStrategicMergePatchType,
+		},
+		"missing patch file": {
+			spec:        KubernetesPodSpec{PatchPath: patchFile.Name() + ".missing"},
+			expectedErr: true,
+		},
+		"patch and patch file": {
+			spec:        KubernetesPodSpec{Patch: "hostname: build", PatchPath: patchFile.Name()},
+			expectedErr: true,
+		},
+		"empty patch": {
+			spec:        KubernetesPodSpec{},
+			expectedErr: true,
+		},
+		"merge patch isn't an object": {
+			spec:        KubernetesPodSpec{Patch: "[1, 2]", PatchType: PatchTypeMergePatchType},
+			expectedErr: true,
+		},
+		"JSON patch isn't a list": {
+			spec:        KubernetesPodSpec{Patch: "hostname: build", PatchType: PatchTypeJSONPatchType},
+			expectedErr: true,
+		},
+		"unsupported patch type": {
+			spec:        KubernetesPodSpec{Patch: "hostname: build", PatchType: "unknown"},
+			expectedErr: true,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			patch, patchType, err := tt.spec.PatchAttrs()
+			if tt.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.expectedPatch, string(patch))
+			assert.Equal(t, tt.expectedPatchType, patchType)
+		})
+	}
+}
+
+func TestLoadConfigValidatesPodSpecPatches(t *testing.T) {
+	configFile, err := ioutil.TempFile("", "config.toml")
+	require.NoError(t, err)
+	defer os.Remove(configFile.Name())
+
+	_, err = configFile.WriteString(`
+		[[runners]]
+		name = "kubernetes"
+		[runners.kubernetes]
+		[[runners.kubernetes.pod_spec]]
+		name = "invalid"
+		patch_type = "json"
+		patch = "hostname: build"
+	`)
+	require.NoError(t, err)
+	require.NoError(t, configFile.Close())
+
+	err = NewConfig().LoadConfig(configFile.Name())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid pod spec patch "invalid"`)
+}
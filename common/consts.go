@@ -24,6 +24,10 @@ const DefaultCacheRequestTimeout = 10
 const DefaultNetworkClientTimeout = 60 * time.Minute
 const DefaultSessionTimeout = 30 * time.Minute
 const WaitForBuildFinishTimeout = 5 * time.Minute
+const DefaultMachineHealthCheckTimeout = time.Minute
+const DefaultMachineHealthCheckImage = "busybox:latest"
+const DefaultMachineQuarantineTime = time.Hour
+const DefaultMachineInterruptionCheckInterval = 5 * time.Second
 
 const (
 	DefaultTraceOutputLimit    = 4 * 1024 * 1024 // in bytes
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -82,6 +83,49 @@ type ExecutorProvider interface {
 	GetDefaultShell() string
 }
 
+// JobRequestObserver is implemented by the executor providers that size their
+// resources with the rate of jobs received by the runners using them.
+type JobRequestObserver interface {
+	// ObserveJobRequest is called every time a job is received for the runner.
+	ObserveJobRequest(config *RunnerConfig)
+}
+
+var ErrMachineNotFound = errors.New("machine not found")
+
+// MachineInfo describes a machine of a pool managed by an executor provider.
+type MachineInfo struct {
+	Name      string    `json:"name"`
+	State     string    `json:"state"`
+	UsedCount int       `json:"used_count"`
+	Created   time.Time `json:"created"`
+	Used      time.Time `json:"used"`
+	Reason    string    `json:"reason,omitempty"`
+	Retired   bool      `json:"retired,omitempty"`
+}
+
+// MachinePoolManager is implemented by the executor providers managing a pool
+// of machines, to let operators inspect and control the pool of a runner.
+type MachinePoolManager interface {
+	// ListMachines returns the machines of the runner.
+	ListMachines(config *RunnerConfig) []MachineInfo
+	// RemoveMachine removes the machine, even when it's running a job.
+	RemoveMachine(config *RunnerConfig, name string) error
+	// RetireMachine removes the machine once it's not running a job anymore.
+	RetireMachine(config *RunnerConfig, name string) error
+	// PrewarmMachines creates up to count idle machines and returns how many
+	// were created.
+	PrewarmMachines(config *RunnerConfig, count int) (int, error)
+}
+
+// OrphanedResourcesCleaner is implemented by the executor providers creating
+// resources that are left behind when the runner process crashes or loses
+// access to them before the end of the job.
+type OrphanedResourcesCleaner interface {
+	// CleanupOrphanedResources deletes the resources of the runner created for
+	// the jobs that running reports as not running anymore.
+	CleanupOrphanedResources(config *RunnerConfig, running func(jobID int) bool) error
+}
+
 // BuildError represents an error during build execution, not related to
 // the job script, e.g. failed to create container, establish ssh connection.
 type BuildError struct {
@@ -68,6 +68,7 @@ type FeaturesInfo struct {
 	RawVariables            bool `json:"raw_variables"`
 	ArtifactsExclude        bool `json:"artifacts_exclude"`
 	MultiBuildSteps         bool `json:"multi_build_steps"`
+	ServiceVariables        bool `json:"service_variables"`
 }
 
 type RegisterRunnerParameters struct {
@@ -187,11 +188,12 @@ type Step struct {
 type Steps []Step
 
 type Image struct {
-	Name       string   `json:"name"`
-	Alias      string   `json:"alias,omitempty"`
-	Command    []string `json:"command,omitempty"`
-	Entrypoint []string `json:"entrypoint,omitempty"`
-	Ports      []Port   `json:"ports,omitempty"`
+	Name       string       `json:"name"`
+	Alias      string       `json:"alias,omitempty"`
+	Command    []string     `json:"command,omitempty"`
+	Entrypoint []string     `json:"entrypoint,omitempty"`
+	Ports      []Port       `json:"ports,omitempty"`
+	Variables  JobVariables `json:"variables,omitempty"`
 }
 
 type Port struct {
@@ -12,6 +12,55 @@ type ConfigExecOutput struct {
 	CacheDir  *string `json:"cache_dir,omitempty"`
 
 	BuildsDirIsShared *bool `json:"builds_dir_is_shared,omitempty"`
+
+	Terminal *TerminalInfo `json:"terminal,omitempty"`
+	Services []ServiceInfo `json:"services,omitempty"`
+
+	// Variables are added to the job variables, so they're passed to the
+	// next stages and to the job script
+	Variables []Variable `json:"variables,omitempty"`
+	// Shell overwrites the shell the scripts are generated for
+	Shell *string `json:"shell,omitempty"`
+	// StageTimeouts limits the duration of the stages, in seconds
+	StageTimeouts map[string]int `json:"stage_timeouts,omitempty"`
+	// SkipStages lists the stages that aren't run
+	SkipStages []string `json:"skip_stages,omitempty"`
+	// Metadata is printed in the job log and exposed in the metrics while
+	// the job is running
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Variable defines a job variable set by the driver. The values of the masked
+// variables are hidden in the job log
+type Variable struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Masked bool   `json:"masked,omitempty"`
+}
+
+// TerminalInfo defines the address the Runner connects to for the
+// interactive web terminal of the job. The connection is expected to be
+// attached to a TTY in the job environment
+type TerminalInfo struct {
+	// Network is either tcp (default) or unix
+	Network string `json:"network,omitempty"`
+	Address string `json:"address"`
+}
+
+// ServiceInfo defines a service of the job the Runner proxies the session
+// server requests to
+type ServiceInfo struct {
+	Name  string        `json:"name"`
+	Host  string        `json:"host"`
+	Ports []ServicePort `json:"ports"`
+}
+
+// ServicePort defines a port of a service. The protocol is either http or
+// https
+type ServicePort struct {
+	Number   int    `json:"number"`
+	Protocol string `json:"protocol,omitempty"`
+	Name     string `json:"name,omitempty"`
 }
 
 // DriverInfo wraps the information about Custom Executor driver details
@@ -9,3 +9,21 @@ const (
 	// that should be returned from Custom executor driver
 	SystemFailureExitCodeVariable = "SYSTEM_FAILURE_EXIT_CODE"
 )
+
+const (
+	// The name of the variable used to pass the reason of the cancellation
+	// to cancel_exec: cancel or timeout
+	CancelReasonVariable = "CANCEL_REASON"
+
+	// The name of the variable used to pass the reason of the cleanup to
+	// cleanup_exec: success, failure, cancel or timeout
+	CleanupReasonVariable = "CLEANUP_REASON"
+)
+
+// The reasons a stage is cancelled or the job is cleaned up for
+const (
+	ReasonSuccess = "success"
+	ReasonFailure = "failure"
+	ReasonCancel  = "cancel"
+	ReasonTimeout = "timeout"
+)
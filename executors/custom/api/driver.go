@@ -0,0 +1,130 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// DriverProtocolVersion is the version of the protocol spoken between the
+// Runner and a long-lived Custom Executor driver, started with driver_exec.
+//
+// The driver runs for the whole job. The Runner and the driver exchange
+// JSON-RPC 2.0 messages, one message per line, either on the standard input
+// and output of the driver or on a Unix socket.
+const DriverProtocolVersion = 1
+
+// The name of the variable used to pass the path of the Unix socket the driver
+// should connect to, when the unix transport is used
+const DriverSocketVariable = "CUSTOM_DRIVER_SOCKET"
+
+const (
+	// DriverTransportStdio exchanges the messages on the standard input and
+	// output of the driver. Anything the driver wants to log must be written
+	// to its standard error
+	DriverTransportStdio = "stdio"
+	// DriverTransportUnix exchanges the messages on the Unix socket passed
+	// with the CUSTOM_DRIVER_SOCKET variable
+	DriverTransportUnix = "unix"
+)
+
+// Methods called by the Runner
+const (
+	// DriverMethodInitialize is the first call, with InitializeParams,
+	// returning InitializeResult
+	DriverMethodInitialize = "initialize"
+	// DriverMethodPrepare prepares the environment of the job, like
+	// prepare_exec
+	DriverMethodPrepare = "prepare"
+	// DriverMethodRunStage runs the script of a stage, with RunStageParams,
+	// like run_exec
+	DriverMethodRunStage = "run_stage"
+	// DriverMethodCancel is a notification, with CancelParams, asking the
+	// driver to stop the running stage when the job is cancelled
+	DriverMethodCancel = "cancel"
+	// DriverMethodCleanup cleans up the environment of the job, with
+	// CleanupParams, like cleanup_exec. The driver should exit when its input
+	// is closed afterwards
+	DriverMethodCleanup = "cleanup"
+)
+
+// Notifications sent by the driver
+const (
+	// DriverMethodLog writes the LogParams data to the job log
+	DriverMethodLog = "log"
+	// DriverMethodProgress reports the ProgressParams progress of a long
+	// running call in the job log
+	DriverMethodProgress = "progress"
+)
+
+// The error codes the driver should use for failed calls, matching the
+// values of the BUILD_FAILURE_EXIT_CODE and SYSTEM_FAILURE_EXIT_CODE variables
+// used by the executables
+const (
+	DriverBuildFailureErrorCode  = 1
+	DriverSystemFailureErrorCode = 2
+)
+
+// DriverMessage is a JSON-RPC 2.0 request, notification or response
+type DriverMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int64          `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *DriverError    `json:"error,omitempty"`
+}
+
+// DriverError is the error of a failed call
+type DriverError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *DriverError) Error() string {
+	return fmt.Sprintf("driver error %d: %s", e.Code, e.Message)
+}
+
+// InitializeParams are the parameters of the initialize call
+type InitializeParams struct {
+	ProtocolVersion int `json:"protocol_version"`
+	JobID           int `json:"job_id"`
+}
+
+// InitializeResult is the result of the initialize call. The driver must
+// answer with the protocol version it implements, and can return the same
+// configuration as config_exec
+type InitializeResult struct {
+	ProtocolVersion int               `json:"protocol_version"`
+	Config          *ConfigExecOutput `json:"config,omitempty"`
+}
+
+// RunStageParams are the parameters of the run_stage call, the same as the
+// arguments of run_exec
+type RunStageParams struct {
+	Stage  string `json:"stage"`
+	Script string `json:"script"`
+}
+
+// CancelParams are the parameters of the cancel notification. The reason is
+// either cancel or timeout
+type CancelParams struct {
+	Stage  string `json:"stage"`
+	Reason string `json:"reason"`
+}
+
+// CleanupParams are the parameters of the cleanup call. The reason is one of
+// success, failure, cancel or timeout
+type CleanupParams struct {
+	Reason string `json:"reason"`
+}
+
+// LogParams are the parameters of the log notification
+type LogParams struct {
+	Data string `json:"data"`
+}
+
+// ProgressParams are the parameters of the progress notification
+type ProgressParams struct {
+	Message string `json:"message"`
+	Percent *int   `json:"percent,omitempty"`
+}
@@ -0,0 +1,98 @@
+package custom
+
+import (
+	"context"
+	"fmt"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/api"
+)
+
+// runCancellableStage runs the stage with run_exec. When the job is cancelled
+// or the stage times out, cancel_exec is run before run_exec is killed, so
+// the driver can stop the remote workload cleanly
+func (e *executor) runCancellableStage(ctx context.Context, stage common.BuildStage, opts prepareCommandOpts) error {
+	runCtx, cancelRun := context.WithCancel(context.Background())
+	defer cancelRun()
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- e.prepareCommand(runCtx, opts).Run()
+	}()
+
+	select {
+	case err := <-runErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	e.cancelStage(ctx, stage)
+	cancelRun()
+
+	err := <-runErr
+	if err != nil {
+		return err
+	}
+
+	return ctx.Err()
+}
+
+func (e *executor) cancelStage(ctx context.Context, stage common.BuildStage) {
+	reason := e.cancelReason(ctx)
+	e.Println(fmt.Sprintf("Cancelling the %s stage (%s)...", stage, reason))
+
+	cancelCtx, cancelFunc := context.WithTimeout(context.Background(), e.config.GetCancelExecTimeout())
+	defer cancelFunc()
+
+	opts := prepareCommandOpts{
+		executable: e.config.CancelExec,
+		args:       append(e.config.CancelArgs, string(stage)),
+		out:        e.defaultCommandOutputs(),
+		env:        []string{fmt.Sprintf("%s=%s", api.CancelReasonVariable, reason)},
+	}
+
+	err := e.prepareCommand(cancelCtx, opts).Run()
+	if err != nil {
+		e.Warningln("Cancel script failed:", err)
+	}
+}
+
+// cancelReason returns why the context of a stage is done: the stage or the
+// job timed out, or the job was cancelled
+func (e *executor) cancelReason(ctx context.Context) string {
+	if ctx.Err() == context.DeadlineExceeded {
+		return api.ReasonTimeout
+	}
+
+	if e.Build != nil && e.Build.CurrentState == common.BuildRunRuntimeTimedout {
+		return api.ReasonTimeout
+	}
+
+	return api.ReasonCancel
+}
+
+// cleanupReason returns how the job ended. A job that failed before it
+// finished, like during the prepare stage, is a failure
+func (e *executor) cleanupReason() string {
+	if e.Build != nil {
+		switch e.Build.CurrentState {
+		case common.BuildRunRuntimeTimedout:
+			return api.ReasonTimeout
+		case common.BuildRunRuntimeCanceled, common.BuildRunRuntimeTerminated:
+			return api.ReasonCancel
+		}
+	}
+
+	if e.finished && e.finishErr == nil {
+		return api.ReasonSuccess
+	}
+
+	return api.ReasonFailure
+}
+
+func (e *executor) Finish(err error) {
+	e.AbstractExecutor.Finish(err)
+
+	e.finished = true
+	e.finishErr = err
+}
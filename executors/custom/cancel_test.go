@@ -0,0 +1,228 @@
+package custom
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/api"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/command"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/process"
+)
+
+func TestExecutor_RunCancelExec(t *testing.T) {
+	tests := map[string]struct {
+		buildState     common.BuildRuntimeState
+		stageTimeout   time.Duration
+		expectedReason string
+		expectedErr    func(t *testing.T, err error)
+	}{
+		"job cancelled": {
+			buildState:     common.BuildRunRuntimeCanceled,
+			expectedReason: api.ReasonCancel,
+			expectedErr: func(t *testing.T, err error) {
+				assert.EqualError(t, err, "killed")
+			},
+		},
+		"job timed out": {
+			buildState:     common.BuildRunRuntimeTimedout,
+			expectedReason: api.ReasonTimeout,
+			expectedErr: func(t *testing.T, err error) {
+				assert.EqualError(t, err, "killed")
+			},
+		},
+		"stage timed out": {
+			buildState:     common.BuildRunRuntimeRunning,
+			stageTimeout:   10 * time.Millisecond,
+			expectedReason: api.ReasonTimeout,
+			expectedErr: func(t *testing.T, err error) {
+				buildErr, ok := err.(*common.BuildError)
+				require.True(t, ok, "expected *common.BuildError, got %T", err)
+				assert.Equal(t, common.JobExecutionTimeout, buildErr.FailureReason)
+			},
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			var lock sync.Mutex
+			var calls []string
+			var runCtx context.Context
+
+			oldFactory := commandFactory
+			defer func() { commandFactory = oldFactory }()
+			commandFactory = func(
+				ctx context.Context,
+				executable string,
+				args []string,
+				options process.CommandOptions,
+			) command.Command {
+				cmd := new(command.MockCommand)
+
+				lock.Lock()
+				defer lock.Unlock()
+				calls = append(calls, executable)
+
+				switch executable {
+				case "run":
+					runCtx = ctx
+					cmd.On("Run").
+						Run(func(_ mock.Arguments) { <-ctx.Done() }).
+						Return(errors.New("killed"))
+				case "cancel":
+					assert.Equal(t, []string{"--vm", string(common.BuildStageGetSources)}, args)
+					assert.Contains(t, options.Env, api.CancelReasonVariable+"="+tt.expectedReason)
+					assert.NoError(t, runCtx.Err(), "run_exec killed before cancel_exec")
+					cmd.On("Run").Return(nil)
+				}
+
+				return cmd
+			}
+
+			e, options, out := prepareExecutor(t, executorTestCase{
+				config: getRunnerConfig(&common.CustomConfig{
+					RunExec:    "run",
+					CancelExec: "cancel",
+					CancelArgs: []string{"--vm"},
+				}),
+			})
+			require.NoError(t, e.Prepare(options))
+
+			if tt.stageTimeout > 0 {
+				e.stageTimeouts[common.BuildStageGetSources] = tt.stageTimeout
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			go func() {
+				time.Sleep(10 * time.Millisecond)
+				if tt.stageTimeout > 0 {
+					return
+				}
+
+				e.Build.CurrentState = tt.buildState
+				cancel()
+			}()
+
+			err := e.Run(common.ExecutorCommand{
+				Context: ctx,
+				Stage:   common.BuildStageGetSources,
+			})
+			tt.expectedErr(t, err)
+
+			assert.Equal(t, []string{"run", "cancel"}, calls)
+			assert.Contains(t, out.String(), "Cancelling the get_sources stage ("+tt.expectedReason+")...")
+		})
+	}
+}
+
+func TestExecutor_RunCancelExecNotCalled(t *testing.T) {
+	var calls []string
+
+	oldFactory := commandFactory
+	defer func() { commandFactory = oldFactory }()
+	commandFactory = func(_ context.Context, executable string, _ []string, _ process.CommandOptions) command.Command {
+		calls = append(calls, executable)
+
+		cmd := new(command.MockCommand)
+		cmd.On("Run").Return(nil)
+
+		return cmd
+	}
+
+	e, options, _ := prepareExecutor(t, executorTestCase{
+		config: getRunnerConfig(&common.CustomConfig{
+			RunExec:    "run",
+			CancelExec: "cancel",
+		}),
+	})
+	require.NoError(t, e.Prepare(options))
+
+	err := e.Run(common.ExecutorCommand{
+		Context: context.Background(),
+		Stage:   common.BuildStageGetSources,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"run"}, calls)
+}
+
+func TestExecutor_CleanupReason(t *testing.T) {
+	tests := map[string]struct {
+		finish         bool
+		finishErr      error
+		buildState     common.BuildRuntimeState
+		expectedReason string
+	}{
+		"job succeeded": {
+			finish:         true,
+			buildState:     common.BuildRunRuntimeFinished,
+			expectedReason: api.ReasonSuccess,
+		},
+		"job failed": {
+			finish:         true,
+			finishErr:      &common.BuildError{Inner: errors.New("exit status 1")},
+			buildState:     common.BuildRunRuntimeFinished,
+			expectedReason: api.ReasonFailure,
+		},
+		"job failed before running": {
+			buildState:     common.BuildRunStatePending,
+			expectedReason: api.ReasonFailure,
+		},
+		"job cancelled": {
+			finish:         true,
+			finishErr:      &common.BuildError{Inner: errors.New("canceled")},
+			buildState:     common.BuildRunRuntimeCanceled,
+			expectedReason: api.ReasonCancel,
+		},
+		"job aborted": {
+			finish:         true,
+			finishErr:      errors.New("aborted: interrupt"),
+			buildState:     common.BuildRunRuntimeTerminated,
+			expectedReason: api.ReasonCancel,
+		},
+		"job timed out": {
+			finish:         true,
+			finishErr:      &common.BuildError{Inner: errors.New("execution took longer than 1h0m0s seconds")},
+			buildState:     common.BuildRunRuntimeTimedout,
+			expectedReason: api.ReasonTimeout,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			tc := executorTestCase{
+				config: getRunnerConfig(&common.CustomConfig{
+					RunExec:     "bash",
+					CleanupExec: "cleanup",
+				}),
+				assertCommandFactory: func(
+					t *testing.T,
+					_ executorTestCase,
+					_ context.Context,
+					_ string,
+					_ []string,
+					options process.CommandOptions,
+				) {
+					assert.Contains(t, options.Env, api.CleanupReasonVariable+"="+tt.expectedReason)
+				},
+			}
+			defer mockCommandFactory(t, tc)()
+
+			e, _ := prepareExecutorForCleanup(t, tc)
+			e.Build.CurrentState = tt.buildState
+			if tt.finish {
+				e.Finish(tt.finishErr)
+			}
+
+			e.Cleanup()
+		})
+	}
+}
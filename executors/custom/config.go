@@ -23,6 +23,10 @@ func (c *config) GetCleanupScriptTimeout() time.Duration {
 	return getDuration(c.CleanupExecTimeout, defaultCleanupExecTimeout)
 }
 
+func (c *config) GetCancelExecTimeout() time.Duration {
+	return getDuration(c.CancelExecTimeout, defaultCancelExecTimeout)
+}
+
 func (c *config) GetGracefulKillTimeout() time.Duration {
 	return getDuration(c.GracefulKillTimeout, process.GracefulTimeout)
 }
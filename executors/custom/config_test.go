@@ -73,6 +73,18 @@ func TestConfig_GetCleanupExecTimeout(t *testing.T) {
 	})
 }
 
+func TestConfig_GetCancelExecTimeout(t *testing.T) {
+	testGetDuration(t, defaultCancelExecTimeout, func(t *testing.T, tt getDurationTestCase) {
+		c := &config{
+			CustomConfig: &common.CustomConfig{
+				CancelExecTimeout: tt.source,
+			},
+		}
+
+		assert.Equal(t, tt.expectedValue, c.GetCancelExecTimeout())
+	})
+}
+
 func TestConfig_GetTerminateTimeout(t *testing.T) {
 	testGetDuration(t, process.GracefulTimeout, func(t *testing.T, tt getDurationTestCase) {
 		c := &config{
@@ -9,6 +9,10 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 
@@ -16,6 +20,7 @@ import (
 	"gitlab.com/gitlab-org/gitlab-runner/executors"
 	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/api"
 	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/command"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/driver"
 	"gitlab.com/gitlab-org/gitlab-runner/helpers/process"
 )
 
@@ -28,6 +33,7 @@ type prepareCommandOpts struct {
 	executable string
 	args       []string
 	out        commandOutputs
+	env        []string
 }
 
 type ConfigExecOutput struct {
@@ -52,6 +58,67 @@ func (c *ConfigExecOutput) InjectInto(executor *executor) {
 	}
 
 	executor.driverInfo = c.Driver
+	executor.terminal = c.Terminal
+
+	for _, service := range c.Services {
+		executor.ProxyPool[service.Name] = newServiceProxy(service)
+	}
+
+	if c.Shell != nil {
+		executor.Config.Shell = *c.Shell
+	}
+
+	c.injectVariables(executor)
+
+	for stage, timeout := range c.StageTimeouts {
+		executor.stageTimeouts[common.BuildStage(stage)] = time.Duration(timeout) * time.Second
+	}
+
+	for _, stage := range c.SkipStages {
+		executor.skipStages[common.BuildStage(stage)] = true
+	}
+
+	for key, value := range c.Metadata {
+		executor.metadata[key] = value
+	}
+}
+
+func (c *ConfigExecOutput) injectVariables(executor *executor) {
+	if len(c.Variables) == 0 {
+		return
+	}
+
+	hasMasked := false
+	for _, variable := range c.Variables {
+		executor.Build.Variables = append(executor.Build.Variables, common.JobVariable{
+			Key:    variable.Key,
+			Value:  variable.Value,
+			Public: !variable.Masked,
+			Masked: variable.Masked,
+		})
+
+		hasMasked = hasMasked || variable.Masked
+	}
+
+	// the variables are cached since the job started, the new ones must be
+	// passed to the driver and to the following commands
+	executor.Build.RefreshAllVariables()
+
+	if !hasMasked {
+		return
+	}
+
+	masked := make(map[string]bool)
+	for _, value := range executor.Build.GetAllVariables().Masked() {
+		masked[value] = true
+	}
+
+	values := make([]string, 0, len(masked))
+	for value := range masked {
+		values = append(values, value)
+	}
+
+	executor.Trace.SetMasked(values)
 }
 
 type executor struct {
@@ -61,6 +128,16 @@ type executor struct {
 	tempDir string
 
 	driverInfo *api.DriverInfo
+	terminal   *api.TerminalInfo
+
+	stageTimeouts map[common.BuildStage]time.Duration
+	skipStages    map[common.BuildStage]bool
+	metadata      map[string]string
+
+	driver driver.Driver
+
+	finished  bool
+	finishErr error
 }
 
 func (e *executor) Prepare(options common.ExecutorPrepareOptions) error {
@@ -76,18 +153,33 @@ func (e *executor) Prepare(options common.ExecutorPrepareOptions) error {
 		return err
 	}
 
+	e.stageTimeouts = make(map[common.BuildStage]time.Duration)
+	e.skipStages = make(map[common.BuildStage]bool)
+	e.metadata = make(map[string]string)
+
 	err = e.dynamicConfig()
 	if err != nil {
 		return err
 	}
 
+	err = e.startDriver()
+	if err != nil {
+		return err
+	}
+
 	e.logStartupMessage()
+	e.logMetadata()
+	jobsMetadata.add(e.Build, e.metadata)
 
 	err = e.AbstractExecutor.PrepareBuildAndShell()
 	if err != nil {
 		return err
 	}
 
+	if e.driver != nil {
+		return e.prepareDriver()
+	}
+
 	// nothing to do, as there's no prepare_script
 	if e.config.PrepareExec == "" {
 		return nil
@@ -114,7 +206,7 @@ func (e *executor) prepareConfig() error {
 		CustomConfig: e.Config.Custom,
 	}
 
-	if e.config.RunExec == "" {
+	if e.config.RunExec == "" && e.config.DriverExec == "" {
 		return common.MakeBuildError("custom executor is missing RunExec")
 	}
 
@@ -180,6 +272,25 @@ func (e *executor) logStartupMessage() {
 	e.Println(fmt.Sprintf("%s with driver %s %s...", usageLine, *info.Name, *info.Version))
 }
 
+func (e *executor) logMetadata() {
+	if len(e.metadata) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(e.metadata))
+	for key := range e.metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = fmt.Sprintf("%s=%s", key, e.metadata[key])
+	}
+
+	e.Println("Driver metadata:", strings.Join(pairs, ", "))
+}
+
 func (e *executor) defaultCommandOutputs() commandOutputs {
 	return commandOutputs{
 		stdout: e.Trace,
@@ -190,13 +301,20 @@ func (e *executor) defaultCommandOutputs() commandOutputs {
 var commandFactory = command.New
 
 func (e *executor) prepareCommand(ctx context.Context, opts prepareCommandOpts) command.Command {
+	options := e.commandOptions(opts.out)
+	options.Env = append(options.Env, opts.env...)
+
+	return commandFactory(ctx, opts.executable, opts.args, options)
+}
+
+func (e *executor) commandOptions(out commandOutputs) process.CommandOptions {
 	logger := common.NewProcessLoggerAdapter(e.BuildLogger)
 
 	cmdOpts := process.CommandOptions{
 		Dir:                 e.tempDir,
 		Env:                 make([]string, 0),
-		Stdout:              opts.out.stdout,
-		Stderr:              opts.out.stderr,
+		Stdout:              out.stdout,
+		Stderr:              out.stderr,
 		Logger:              logger,
 		GracefulKillTimeout: e.config.GetGracefulKillTimeout(),
 		ForceKillTimeout:    e.config.GetForceKillTimeout(),
@@ -206,10 +324,38 @@ func (e *executor) prepareCommand(ctx context.Context, opts prepareCommandOpts)
 		cmdOpts.Env = append(cmdOpts.Env, fmt.Sprintf("CUSTOM_ENV_%s=%s", variable.Key, variable.Value))
 	}
 
-	return commandFactory(ctx, opts.executable, opts.args, cmdOpts)
+	return cmdOpts
 }
 
 func (e *executor) Run(cmd common.ExecutorCommand) error {
+	if e.skipStages[cmd.Stage] {
+		e.Println(fmt.Sprintf("Skipping the %s stage, as requested by the driver", cmd.Stage))
+		return nil
+	}
+
+	timeout, ok := e.stageTimeouts[cmd.Stage]
+	if !ok || timeout <= 0 {
+		return e.runStage(cmd)
+	}
+
+	ctx, cancel := context.WithTimeout(cmd.Context, timeout)
+	defer cancel()
+
+	parentCtx := cmd.Context
+	cmd.Context = ctx
+
+	err := e.runStage(cmd)
+	if err != nil && ctx.Err() == context.DeadlineExceeded && parentCtx.Err() == nil {
+		return &common.BuildError{
+			Inner:         fmt.Errorf("the %s stage timed out after %v: %w", cmd.Stage, timeout, err),
+			FailureReason: common.JobExecutionTimeout,
+		}
+	}
+
+	return err
+}
+
+func (e *executor) runStage(cmd common.ExecutorCommand) error {
 	scriptDir, err := ioutil.TempDir(e.tempDir, "script")
 	if err != nil {
 		return err
@@ -221,6 +367,10 @@ func (e *executor) Run(cmd common.ExecutorCommand) error {
 		return err
 	}
 
+	if e.driver != nil {
+		return e.runDriverStage(cmd.Context, cmd.Stage, scriptFile)
+	}
+
 	args := append(e.config.RunArgs, scriptFile, string(cmd.Stage))
 
 	opts := prepareCommandOpts{
@@ -229,11 +379,16 @@ func (e *executor) Run(cmd common.ExecutorCommand) error {
 		out:        e.defaultCommandOutputs(),
 	}
 
+	if e.config.CancelExec != "" {
+		return e.runCancellableStage(cmd.Context, cmd.Stage, opts)
+	}
+
 	return e.prepareCommand(cmd.Context, opts).Run()
 }
 
 func (e *executor) Cleanup() {
 	e.AbstractExecutor.Cleanup()
+	jobsMetadata.remove(e.Build)
 
 	err := e.prepareConfig()
 	if err != nil {
@@ -245,6 +400,11 @@ func (e *executor) Cleanup() {
 
 	defer func() { _ = os.RemoveAll(e.tempDir) }()
 
+	if e.driver != nil {
+		e.cleanupDriver()
+		return
+	}
+
 	// nothing to do, as there's no cleanup_script
 	if e.config.CleanupExec == "" {
 		return
@@ -265,6 +425,7 @@ func (e *executor) Cleanup() {
 		executable: e.config.CleanupExec,
 		args:       e.config.CleanupArgs,
 		out:        outputs,
+		env:        []string{fmt.Sprintf("%s=%s", api.CleanupReasonVariable, e.cleanupReason())},
 	}
 
 	err = e.prepareCommand(ctx, opts).Run()
@@ -295,11 +456,20 @@ func init() {
 	featuresUpdater := func(features *common.FeaturesInfo) {
 		features.Variables = true
 		features.Shared = true
+		features.Session = true
+		features.Proxy = true
+
+		if runtime.GOOS != "windows" {
+			features.Terminal = true
+		}
 	}
 
-	common.RegisterExecutorProvider("custom", executors.DefaultExecutorProvider{
-		Creator:          creator,
-		FeaturesUpdater:  featuresUpdater,
-		DefaultShellName: options.Shell.Shell,
+	common.RegisterExecutorProvider("custom", executorProvider{
+		DefaultExecutorProvider: executors.DefaultExecutorProvider{
+			Creator:          creator,
+			FeaturesUpdater:  featuresUpdater,
+			DefaultShellName: options.Shell.Shell,
+		},
+		metadataCollector: jobsMetadata,
 	})
 }
@@ -10,6 +10,7 @@ import (
 	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
@@ -17,6 +18,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/api"
 	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/command"
 	"gitlab.com/gitlab-org/gitlab-runner/helpers/process"
 )
@@ -96,6 +98,8 @@ func prepareExecutor(t *testing.T, tt executorTestCase) (*executor, common.Execu
 	trace.On("IsStdout").
 		Return(false).
 		Maybe()
+	trace.On("SetMasked", mock.Anything).
+		Maybe()
 
 	options := common.ExecutorPrepareOptions{
 		Build: &common.Build{
@@ -376,6 +380,32 @@ func TestExecutor_Prepare(t *testing.T) {
 				assert.Equal(t, "/some/cache/directory/project-0", b.CacheDir)
 			},
 		},
+		"custom executor set with ConfigExec returning variables and metadata": {
+			config: getRunnerConfig(&common.CustomConfig{
+				RunExec:    "bash",
+				ConfigExec: "echo",
+			}),
+			commandStdoutContent: `{
+				"variables": [
+					{"key": "VM_IP", "value": "10.0.0.2"},
+					{"key": "VM_PASSWORD", "value": "secret", "masked": true}
+				],
+				"metadata": {
+					"vm": "vm-1",
+					"pool": "default"
+				}
+			}`,
+			assertOutput: func(t *testing.T, output string) {
+				assert.Contains(t, output, "Driver metadata: pool=default, vm=vm-1")
+			},
+			assertBuild: func(t *testing.T, b *common.Build) {
+				variables := b.GetAllVariables()
+				assert.Equal(t, "10.0.0.2", variables.Get("VM_IP"))
+				assert.Equal(t, "secret", variables.Get("VM_PASSWORD"))
+				assert.Contains(t, variables.Masked(), "secret")
+				assert.NotContains(t, variables.Masked(), "10.0.0.2")
+			},
+		},
 		"custom executor set with PrepareExec": {
 			config: getRunnerConfig(&common.CustomConfig{
 				RunExec:     "bash",
@@ -611,6 +641,94 @@ func TestExecutor_Run(t *testing.T) {
 	}
 }
 
+func TestExecutor_RunStageOverrides(t *testing.T) {
+	tests := map[string]struct {
+		stage            common.BuildStage
+		expectedRun      bool
+		expectedOutput   string
+		expectedErr      func(t *testing.T, err error)
+		expectedDeadline bool
+	}{
+		"skipped stage": {
+			stage:          common.BuildStageDownloadArtifacts,
+			expectedOutput: "Skipping the download_artifacts stage, as requested by the driver",
+			expectedErr: func(t *testing.T, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		"stage with timeout": {
+			stage:            common.BuildStageGetSources,
+			expectedRun:      true,
+			expectedDeadline: true,
+			expectedErr: func(t *testing.T, err error) {
+				buildErr, ok := err.(*common.BuildError)
+				require.True(t, ok, "expected *common.BuildError, got %T", err)
+				assert.Equal(t, common.JobExecutionTimeout, buildErr.FailureReason)
+				assert.EqualError(t, err, "the get_sources stage timed out after 10ms: killed")
+			},
+		},
+		"stage without override": {
+			stage:       common.BuildStageRestoreCache,
+			expectedRun: true,
+			expectedErr: func(t *testing.T, err error) {
+				assert.NoError(t, err)
+			},
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			var ran bool
+
+			oldFactory := commandFactory
+			defer func() { commandFactory = oldFactory }()
+			commandFactory = func(ctx context.Context, _ string, args []string, _ process.CommandOptions) command.Command {
+				cmd := new(command.MockCommand)
+				if args[len(args)-1] != string(tt.stage) {
+					cmd.On("Run").Return(nil)
+					return cmd
+				}
+
+				ran = true
+				_, hasDeadline := ctx.Deadline()
+				assert.Equal(t, tt.expectedDeadline, hasDeadline)
+
+				if !hasDeadline {
+					cmd.On("Run").Return(nil)
+					return cmd
+				}
+
+				cmd.On("Run").
+					Run(func(_ mock.Arguments) { <-ctx.Done() }).
+					Return(errors.New("killed"))
+
+				return cmd
+			}
+
+			e, options, out := prepareExecutor(t, executorTestCase{
+				config: getRunnerConfig(&common.CustomConfig{
+					RunExec: "bash",
+				}),
+			})
+			require.NoError(t, e.Prepare(options))
+
+			e.skipStages[common.BuildStageDownloadArtifacts] = true
+			e.stageTimeouts[common.BuildStageGetSources] = 10 * time.Millisecond
+
+			err := e.Run(common.ExecutorCommand{
+				Context: context.Background(),
+				Stage:   tt.stage,
+			})
+			tt.expectedErr(t, err)
+			assert.Equal(t, tt.expectedRun, ran)
+
+			if tt.expectedOutput != "" {
+				assert.Contains(t, out.String(), tt.expectedOutput)
+			}
+		})
+	}
+}
+
 func TestExecutor_Env(t *testing.T) {
 	ciJobImageEnv := "CUSTOM_ENV_CI_JOB_IMAGE"
 
@@ -708,3 +826,56 @@ func TestExecutor_Env(t *testing.T) {
 		})
 	}
 }
+
+func TestConfigExecOutput_InjectInto(t *testing.T) {
+	trace := new(common.MockJobTrace)
+	defer trace.AssertExpectations(t)
+
+	build := &common.Build{
+		JobResponse: common.JobResponse{
+			Variables: common.JobVariables{{Key: "JOB_SECRET", Value: "job-secret", Masked: true}},
+		},
+	}
+	trace.On("SetMasked", mock.MatchedBy(func(masked []string) bool {
+		return assert.ElementsMatch(t, []string{"job-secret", "driver-secret"}, masked)
+	})).Once()
+
+	e := &executor{
+		stageTimeouts: make(map[common.BuildStage]time.Duration),
+		skipStages:    make(map[common.BuildStage]bool),
+		metadata:      make(map[string]string),
+	}
+	e.Build = build
+	e.Trace = trace
+
+	// the variables are cached before config_exec runs
+	assert.Empty(t, build.GetAllVariables().Get("DRIVER_IP"))
+
+	shell := "sh"
+	output := ConfigExecOutput{ConfigExecOutput: api.ConfigExecOutput{
+		Variables: []api.Variable{
+			{Key: "DRIVER_SECRET", Value: "driver-secret", Masked: true},
+			{Key: "DRIVER_IP", Value: "10.0.0.2"},
+		},
+		Shell:         &shell,
+		StageTimeouts: map[string]int{"get_sources": 60},
+		SkipStages:    []string{"restore_cache"},
+		Metadata:      map[string]string{"vm": "vm-1"},
+	}}
+	output.InjectInto(e)
+
+	assert.Equal(t, "sh", e.Config.Shell)
+	assert.Equal(t, map[common.BuildStage]time.Duration{common.BuildStageGetSources: time.Minute}, e.stageTimeouts)
+	assert.Equal(t, map[common.BuildStage]bool{common.BuildStageRestoreCache: true}, e.skipStages)
+	assert.Equal(t, map[string]string{"vm": "vm-1"}, e.metadata)
+	assert.Equal(
+		t,
+		common.JobVariables{
+			{Key: "JOB_SECRET", Value: "job-secret", Masked: true},
+			{Key: "DRIVER_SECRET", Value: "driver-secret", Masked: true},
+			{Key: "DRIVER_IP", Value: "10.0.0.2", Public: true},
+		},
+		build.Variables,
+	)
+	assert.Equal(t, "10.0.0.2", build.GetAllVariables().Get("DRIVER_IP"))
+}
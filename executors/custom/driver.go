@@ -0,0 +1,169 @@
+package custom
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/api"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/driver"
+)
+
+var driverFactory = driver.Start
+
+// startDriver starts the driver running for the whole job, when driver_exec
+// is set, and initializes it. The configuration returned by the driver is
+// injected like the one of config_exec
+func (e *executor) startDriver() error {
+	if e.config.DriverExec == "" {
+		return nil
+	}
+
+	ctx, cancelFunc := context.WithTimeout(e.Context, e.config.GetConfigExecTimeout())
+	defer cancelFunc()
+
+	d, err := driverFactory(ctx, driver.Options{
+		Executable: e.config.DriverExec,
+		Args:       e.config.DriverArgs,
+		Transport:  e.config.DriverTransport,
+		Handler:    e.handleDriverNotification,
+		Command:    e.commandOptions(e.defaultCommandOutputs()),
+	})
+	if err != nil {
+		return err
+	}
+
+	e.driver = d
+
+	var result api.InitializeResult
+	params := api.InitializeParams{
+		ProtocolVersion: api.DriverProtocolVersion,
+		JobID:           e.Build.ID,
+	}
+
+	err = e.driver.Call(ctx, api.DriverMethodInitialize, params, &result)
+	if err != nil {
+		return driverError(err)
+	}
+
+	if result.ProtocolVersion != api.DriverProtocolVersion {
+		return fmt.Errorf(
+			"unsupported driver protocol version %d, expected %d",
+			result.ProtocolVersion,
+			api.DriverProtocolVersion,
+		)
+	}
+
+	if result.Config != nil {
+		config := &ConfigExecOutput{ConfigExecOutput: *result.Config}
+		config.InjectInto(e)
+	}
+
+	return nil
+}
+
+func (e *executor) prepareDriver() error {
+	ctx, cancelFunc := context.WithTimeout(e.Context, e.config.GetPrepareExecTimeout())
+	defer cancelFunc()
+
+	return driverError(e.driver.Call(ctx, api.DriverMethodPrepare, nil, nil))
+}
+
+// runDriverStage runs the script of the stage with the driver. When the job
+// is cancelled, the driver is asked to stop the stage and given the graceful
+// kill timeout to do so
+func (e *executor) runDriverStage(ctx context.Context, stage common.BuildStage, script string) error {
+	call, err := e.driver.Go(api.DriverMethodRunStage, api.RunStageParams{
+		Stage:  string(stage),
+		Script: script,
+	})
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-call.Done:
+		return driverError(call.Decode(nil))
+	case <-ctx.Done():
+	}
+
+	err = e.driver.Notify(api.DriverMethodCancel, api.CancelParams{
+		Stage:  string(stage),
+		Reason: e.cancelReason(ctx),
+	})
+	if err != nil {
+		e.Warningln("Failed to cancel the stage:", err)
+		return ctx.Err()
+	}
+
+	select {
+	case <-call.Done:
+		err = call.Decode(nil)
+		if err != nil {
+			return driverError(err)
+		}
+
+		return ctx.Err()
+	case <-time.After(e.config.GetGracefulKillTimeout()):
+		return fmt.Errorf("driver didn't stop the %s stage: %w", stage, ctx.Err())
+	}
+}
+
+func (e *executor) cleanupDriver() {
+	defer func() {
+		err := e.driver.Close()
+		if err != nil {
+			e.Warningln("Driver exited with:", err)
+		}
+	}()
+
+	ctx, cancelFunc := context.WithTimeout(context.Background(), e.config.GetCleanupScriptTimeout())
+	defer cancelFunc()
+
+	err := e.driver.Call(ctx, api.DriverMethodCleanup, api.CleanupParams{Reason: e.cleanupReason()}, nil)
+	if err != nil {
+		e.Warningln("Cleanup failed:", err)
+	}
+}
+
+func (e *executor) handleDriverNotification(method string, params json.RawMessage) {
+	switch method {
+	case api.DriverMethodLog:
+		var log api.LogParams
+		if err := json.Unmarshal(params, &log); err != nil {
+			e.Debugln("Invalid driver log:", err)
+			return
+		}
+
+		_, _ = e.Trace.Write([]byte(log.Data))
+	case api.DriverMethodProgress:
+		var progress api.ProgressParams
+		if err := json.Unmarshal(params, &progress); err != nil {
+			e.Debugln("Invalid driver progress:", err)
+			return
+		}
+
+		if progress.Percent != nil {
+			e.Println(fmt.Sprintf("%s (%d%%)", progress.Message, *progress.Percent))
+			return
+		}
+
+		e.Println(progress.Message)
+	default:
+		e.Debugln("Ignoring unknown driver notification:", method)
+	}
+}
+
+// driverError turns the build failures reported by the driver into build
+// errors, like the build failure exit code of the executables
+func driverError(err error) error {
+	var driverErr *api.DriverError
+	if errors.As(err, &driverErr) && driverErr.Code == api.DriverBuildFailureErrorCode {
+		return &common.BuildError{Inner: err}
+	}
+
+	return err
+}
@@ -0,0 +1,248 @@
+package driver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/api"
+)
+
+const jsonRPCVersion = "2.0"
+
+// maxMessageSize limits the size of a single message sent by the driver
+const maxMessageSize = 16 * 1024 * 1024
+
+var ErrConnectionClosed = errors.New("driver connection closed")
+
+// NotificationHandler handles the notifications sent by the driver, like the
+// log and progress ones
+type NotificationHandler func(method string, params json.RawMessage)
+
+// Call is a call sent to the driver. Done is closed once the driver answered
+// or the connection is closed
+type Call struct {
+	Method string
+	Done   chan struct{}
+
+	result json.RawMessage
+	err    error
+}
+
+// Decode returns the error of the call or decodes its result
+func (c *Call) Decode(result interface{}) error {
+	if c.err != nil {
+		return c.err
+	}
+
+	if result == nil || len(c.result) == 0 {
+		return nil
+	}
+
+	err := json.Unmarshal(c.result, result)
+	if err != nil {
+		return fmt.Errorf("error while parsing the result of %s: %w", c.Method, err)
+	}
+
+	return nil
+}
+
+func (c *Call) finish(result json.RawMessage, err error) {
+	c.result = result
+	c.err = err
+	close(c.Done)
+}
+
+// Client sends the calls and notifications of the Runner on a connection to
+// the driver and dispatches the messages of the driver
+type Client struct {
+	conn    io.ReadWriteCloser
+	handler NotificationHandler
+
+	writeLock sync.Mutex
+
+	lock    sync.Mutex
+	nextID  int64
+	pending map[int64]*Call
+	err     error
+
+	closed chan struct{}
+}
+
+func NewClient(conn io.ReadWriteCloser, handler NotificationHandler) *Client {
+	c := &Client{
+		conn:    conn,
+		handler: handler,
+		pending: make(map[int64]*Call),
+		closed:  make(chan struct{}),
+	}
+
+	go c.read()
+
+	return c
+}
+
+// Go sends the call without waiting for the answer of the driver
+func (c *Client) Go(method string, params interface{}) (*Call, error) {
+	call := &Call{Method: method, Done: make(chan struct{})}
+
+	c.lock.Lock()
+	if c.err != nil {
+		c.lock.Unlock()
+		return nil, c.err
+	}
+
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = call
+	c.lock.Unlock()
+
+	err := c.send(&id, method, params)
+	if err != nil {
+		c.lock.Lock()
+		delete(c.pending, id)
+		c.lock.Unlock()
+
+		return nil, err
+	}
+
+	return call, nil
+}
+
+// Call sends the call and waits for the answer of the driver, decoded into
+// result
+func (c *Client) Call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	call, err := c.Go(method, params)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-call.Done:
+		return call.Decode(result)
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for %s: %w", method, ctx.Err())
+	}
+}
+
+// Notify sends a notification, which the driver doesn't answer
+func (c *Client) Notify(method string, params interface{}) error {
+	return c.send(nil, method, params)
+}
+
+func (c *Client) send(id *int64, method string, params interface{}) error {
+	msg := api.DriverMessage{
+		JSONRPC: jsonRPCVersion,
+		ID:      id,
+		Method:  method,
+	}
+
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return fmt.Errorf("error while creating the parameters of %s: %w", method, err)
+		}
+		msg.Params = data
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("error while creating the %s message: %w", method, err)
+	}
+
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	_, err = c.conn.Write(append(data, '\n'))
+	if err != nil {
+		return fmt.Errorf("%w: error while sending %s: %v", ErrConnectionClosed, method, err)
+	}
+
+	return nil
+}
+
+func (c *Client) read() {
+	scanner := bufio.NewScanner(c.conn)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxMessageSize)
+
+	err := ErrConnectionClosed
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var msg api.DriverMessage
+		if jsonErr := json.Unmarshal(scanner.Bytes(), &msg); jsonErr != nil {
+			err = fmt.Errorf("invalid message from the driver %q: %w", scanner.Text(), jsonErr)
+			break
+		}
+
+		c.dispatch(msg)
+	}
+
+	if scanner.Err() != nil {
+		err = fmt.Errorf("%w: %v", ErrConnectionClosed, scanner.Err())
+	}
+
+	c.fail(err)
+}
+
+func (c *Client) dispatch(msg api.DriverMessage) {
+	if msg.ID == nil {
+		if c.handler != nil && msg.Method != "" {
+			c.handler(msg.Method, msg.Params)
+		}
+		return
+	}
+
+	c.lock.Lock()
+	call, ok := c.pending[*msg.ID]
+	delete(c.pending, *msg.ID)
+	c.lock.Unlock()
+
+	// answers to calls given up on are dropped
+	if !ok {
+		return
+	}
+
+	if msg.Error != nil {
+		call.finish(nil, msg.Error)
+		return
+	}
+
+	call.finish(msg.Result, nil)
+}
+
+func (c *Client) fail(err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.err != nil {
+		return
+	}
+
+	c.err = err
+	for id, call := range c.pending {
+		call.finish(nil, err)
+		delete(c.pending, id)
+	}
+
+	close(c.closed)
+}
+
+// Closed is closed once the connection to the driver is closed
+func (c *Client) Closed() <-chan struct{} {
+	return c.closed
+}
+
+// Close closes the connection to the driver, failing the pending calls
+func (c *Client) Close() error {
+	err := c.conn.Close()
+	c.fail(ErrConnectionClosed)
+
+	return err
+}
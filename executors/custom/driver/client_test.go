@@ -0,0 +1,190 @@
+package driver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/api"
+)
+
+// fakeServer answers the calls of the client with the answer function, which
+// also gets to send the notifications of the driver before answering
+type fakeServer struct {
+	conn net.Conn
+	lock sync.Mutex
+}
+
+func newFakeServer(t *testing.T, answer func(s *fakeServer, msg api.DriverMessage)) (*fakeServer, net.Conn) {
+	clientConn, serverConn := net.Pipe()
+	s := &fakeServer{conn: serverConn}
+
+	go func() {
+		scanner := bufio.NewScanner(serverConn)
+		for scanner.Scan() {
+			var msg api.DriverMessage
+			if !assert.NoError(t, json.Unmarshal(scanner.Bytes(), &msg)) {
+				return
+			}
+
+			assert.Equal(t, "2.0", msg.JSONRPC)
+			go answer(s, msg)
+		}
+	}()
+
+	return s, clientConn
+}
+
+func (s *fakeServer) send(msg api.DriverMessage) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	msg.JSONRPC = "2.0"
+	data, _ := json.Marshal(msg)
+	_, _ = s.conn.Write(append(data, '\n'))
+}
+
+func (s *fakeServer) result(id *int64, result string) {
+	s.send(api.DriverMessage{ID: id, Result: json.RawMessage(result)})
+}
+
+func (s *fakeServer) error(id *int64, code int, message string) {
+	s.send(api.DriverMessage{ID: id, Error: &api.DriverError{Code: code, Message: message}})
+}
+
+func (s *fakeServer) notify(method string, params string) {
+	s.send(api.DriverMessage{Method: method, Params: json.RawMessage(params)})
+}
+
+func TestClientCall(t *testing.T) {
+	var notifications []string
+	var notificationsLock sync.Mutex
+
+	handler := func(method string, params json.RawMessage) {
+		notificationsLock.Lock()
+		defer notificationsLock.Unlock()
+
+		notifications = append(notifications, method+" "+string(params))
+	}
+
+	_, conn := newFakeServer(t, func(s *fakeServer, msg api.DriverMessage) {
+		switch msg.Method {
+		case api.DriverMethodInitialize:
+			var params api.InitializeParams
+			assert.NoError(t, json.Unmarshal(msg.Params, &params))
+
+			s.notify(api.DriverMethodLog, `{"data":"initializing"}`)
+			s.result(msg.ID, `{"protocol_version":1,"config":{"hostname":"vm"}}`)
+		case api.DriverMethodPrepare:
+			s.error(msg.ID, api.DriverBuildFailureErrorCode, "no VM available")
+		}
+	})
+
+	c := NewClient(conn, handler)
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var result api.InitializeResult
+	err := c.Call(ctx, api.DriverMethodInitialize, api.InitializeParams{ProtocolVersion: 1}, &result)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.ProtocolVersion)
+	require.NotNil(t, result.Config)
+	assert.Equal(t, "vm", *result.Config.Hostname)
+
+	notificationsLock.Lock()
+	assert.Equal(t, []string{`log {"data":"initializing"}`}, notifications)
+	notificationsLock.Unlock()
+
+	err = c.Call(ctx, api.DriverMethodPrepare, nil, nil)
+	var driverErr *api.DriverError
+	require.True(t, errors.As(err, &driverErr), "expected %T, got %T", driverErr, err)
+	assert.Equal(t, api.DriverBuildFailureErrorCode, driverErr.Code)
+	assert.Equal(t, "no VM available", driverErr.Message)
+}
+
+func TestClientConcurrentCalls(t *testing.T) {
+	_, conn := newFakeServer(t, func(s *fakeServer, msg api.DriverMessage) {
+		var params api.RunStageParams
+		assert.NoError(t, json.Unmarshal(msg.Params, &params))
+
+		// the answers come in the reverse order
+		if params.Stage == "first" {
+			time.Sleep(50 * time.Millisecond)
+		}
+
+		data, _ := json.Marshal(params.Stage)
+		s.result(msg.ID, string(data))
+	})
+
+	c := NewClient(conn, nil)
+	defer c.Close()
+
+	first, err := c.Go(api.DriverMethodRunStage, api.RunStageParams{Stage: "first"})
+	require.NoError(t, err)
+	second, err := c.Go(api.DriverMethodRunStage, api.RunStageParams{Stage: "second"})
+	require.NoError(t, err)
+
+	for stage, call := range map[string]*Call{"first": first, "second": second} {
+		<-call.Done
+
+		var result string
+		require.NoError(t, call.Decode(&result))
+		assert.Equal(t, stage, result)
+	}
+}
+
+func TestClientContextCanceled(t *testing.T) {
+	_, conn := newFakeServer(t, func(s *fakeServer, msg api.DriverMessage) {})
+
+	c := NewClient(conn, nil)
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := c.Call(ctx, api.DriverMethodPrepare, nil, nil)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "expected %v, got %v", context.DeadlineExceeded, err)
+}
+
+func TestClientConnectionClosed(t *testing.T) {
+	_, conn := newFakeServer(t, func(s *fakeServer, msg api.DriverMessage) {
+		_ = s.conn.Close()
+	})
+
+	c := NewClient(conn, nil)
+	defer c.Close()
+
+	err := c.Call(context.Background(), api.DriverMethodPrepare, nil, nil)
+	assert.True(t, errors.Is(err, ErrConnectionClosed), "expected %v, got %v", ErrConnectionClosed, err)
+
+	<-c.Closed()
+
+	_, err = c.Go(api.DriverMethodCleanup, nil)
+	assert.True(t, errors.Is(err, ErrConnectionClosed), "expected %v, got %v", ErrConnectionClosed, err)
+}
+
+func TestClientInvalidMessage(t *testing.T) {
+	_, conn := newFakeServer(t, func(s *fakeServer, msg api.DriverMessage) {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+
+		_, _ = s.conn.Write([]byte("PREPARE doesn't accept any arguments\n"))
+	})
+
+	c := NewClient(conn, nil)
+	defer c.Close()
+
+	err := c.Call(context.Background(), api.DriverMethodPrepare, nil, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid message from the driver")
+}
@@ -0,0 +1,217 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/api"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/process"
+)
+
+const socketName = "driver.sock"
+
+// Driver is the connection to a driver running for the whole job
+type Driver interface {
+	Go(method string, params interface{}) (*Call, error)
+	Call(ctx context.Context, method string, params interface{}, result interface{}) error
+	Notify(method string, params interface{}) error
+	Close() error
+}
+
+type Options struct {
+	Executable string
+	Args       []string
+	Transport  string
+
+	Handler NotificationHandler
+
+	// Command defines the environment and the outputs of the driver process.
+	// The standard output is used for the messages with the stdio transport
+	Command process.CommandOptions
+}
+
+// exitTimeout is how long the driver is given to exit once its connection is
+// closed, before it's killed
+var exitTimeout = 10 * time.Second
+
+var newProcessKillWaiter = process.NewOSKillWait
+var newCommander = process.NewOSCmd
+
+type processDriver struct {
+	*Client
+
+	cmd    process.Commander
+	waitCh chan error
+
+	logger              process.Logger
+	gracefulKillTimeout time.Duration
+	forceKillTimeout    time.Duration
+}
+
+// Start starts the driver process and connects to it with the transport of
+// the options. The context limits the time given to the driver to connect
+func Start(ctx context.Context, options Options) (Driver, error) {
+	options.Command.Env = append(
+		append(os.Environ(), fmt.Sprintf("TMPDIR=%s", options.Command.Dir)),
+		options.Command.Env...,
+	)
+
+	switch options.Transport {
+	case "", api.DriverTransportStdio:
+		return startStdio(options)
+	case api.DriverTransportUnix:
+		return startUnix(ctx, options)
+	default:
+		return nil, fmt.Errorf("unsupported driver transport %q", options.Transport)
+	}
+}
+
+func startStdio(options Options) (Driver, error) {
+	stdinReader, stdinWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdoutReader, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		_ = stdinReader.Close()
+		_ = stdinWriter.Close()
+		return nil, err
+	}
+
+	options.Command.Stdin = stdinReader
+	options.Command.Stdout = stdoutWriter
+
+	d, err := start(options)
+
+	// the ends of the pipes used by the driver are kept open by the process
+	_ = stdinReader.Close()
+	_ = stdoutWriter.Close()
+
+	if err != nil {
+		_ = stdinWriter.Close()
+		_ = stdoutReader.Close()
+		return nil, err
+	}
+
+	d.Client = NewClient(&pipeConn{reader: stdoutReader, writer: stdinWriter}, options.Handler)
+
+	return d, nil
+}
+
+func startUnix(ctx context.Context, options Options) (Driver, error) {
+	socket := filepath.Join(options.Command.Dir, socketName)
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("listening for the driver: %w", err)
+	}
+	defer func() { _ = listener.Close() }()
+
+	options.Command.Env = append(options.Command.Env, fmt.Sprintf("%s=%s", api.DriverSocketVariable, socket))
+
+	d, err := start(options)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := d.accept(ctx, listener)
+	if err != nil {
+		_ = d.kill()
+		return nil, err
+	}
+
+	d.Client = NewClient(conn, options.Handler)
+
+	return d, nil
+}
+
+func start(options Options) (*processDriver, error) {
+	d := &processDriver{
+		cmd:                 newCommander(options.Executable, options.Args, options.Command),
+		waitCh:              make(chan error, 1),
+		logger:              options.Command.Logger,
+		gracefulKillTimeout: options.Command.GracefulKillTimeout,
+		forceKillTimeout:    options.Command.ForceKillTimeout,
+	}
+
+	err := d.cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start driver: %w", err)
+	}
+
+	go func() {
+		d.waitCh <- d.cmd.Wait()
+	}()
+
+	return d, nil
+}
+
+func (d *processDriver) accept(ctx context.Context, listener net.Listener) (net.Conn, error) {
+	type accepted struct {
+		conn net.Conn
+		err  error
+	}
+
+	acceptCh := make(chan accepted, 1)
+	go func() {
+		conn, err := listener.Accept()
+		acceptCh <- accepted{conn: conn, err: err}
+	}()
+
+	select {
+	case a := <-acceptCh:
+		if a.err != nil {
+			return nil, fmt.Errorf("accepting the driver connection: %w", a.err)
+		}
+		return a.conn, nil
+	case err := <-d.waitCh:
+		// the status is kept for kill
+		d.waitCh <- err
+		return nil, fmt.Errorf("driver exited before connecting: %v", err)
+	case <-ctx.Done():
+		return nil, fmt.Errorf("waiting for the driver to connect: %w", ctx.Err())
+	}
+}
+
+// Close closes the connection to the driver, which should exit. The driver
+// is killed when it doesn't exit within the exit timeout
+func (d *processDriver) Close() error {
+	_ = d.Client.Close()
+
+	select {
+	case err := <-d.waitCh:
+		return err
+	case <-time.After(exitTimeout):
+		return d.kill()
+	}
+}
+
+func (d *processDriver) kill() error {
+	return newProcessKillWaiter(d.logger, d.gracefulKillTimeout, d.forceKillTimeout).
+		KillAndWait(d.cmd, d.waitCh)
+}
+
+type pipeConn struct {
+	reader *os.File
+	writer *os.File
+}
+
+func (c *pipeConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+func (c *pipeConn) Write(p []byte) (int, error) {
+	return c.writer.Write(p)
+}
+
+func (c *pipeConn) Close() error {
+	err := c.writer.Close()
+	_ = c.reader.Close()
+
+	return err
+}
@@ -0,0 +1,97 @@
+// +build !windows
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/api"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/process"
+)
+
+// echoDriver answers every call with its params, until its input is closed
+const echoDriver = `
+while read -r line; do
+	id=$(echo "$line" | sed -n 's/.*"id":\([0-9]*\).*/\1/p')
+	params=$(echo "$line" | sed -n 's/.*"params":\({[^}]*}\).*/\1/p')
+	echo "driver log on stderr" >&2
+	echo "{\"jsonrpc\":\"2.0\",\"id\":$id,\"result\":$params}"
+done
+`
+
+func startTestDriver(t *testing.T, transport string, script string) (Driver, func(), error) {
+	dir, err := ioutil.TempDir("", "custom-executor-driver")
+	require.NoError(t, err)
+
+	cleanup := func() { _ = os.RemoveAll(dir) }
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	logger := common.NewBuildLogger(nil, logrus.WithFields(logrus.Fields{}))
+
+	d, err := Start(ctx, Options{
+		Executable: "bash",
+		Args:       []string{"-c", script},
+		Transport:  transport,
+		Command: process.CommandOptions{
+			Dir:                 dir,
+			Stdout:              ioutil.Discard,
+			Stderr:              ioutil.Discard,
+			Logger:              common.NewProcessLoggerAdapter(logger),
+			GracefulKillTimeout: time.Second,
+			ForceKillTimeout:    time.Second,
+		},
+	})
+
+	return d, cleanup, err
+}
+
+func TestStartStdio(t *testing.T) {
+	d, cleanup, err := startTestDriver(t, api.DriverTransportStdio, echoDriver)
+	defer cleanup()
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var result api.RunStageParams
+	err = d.Call(ctx, api.DriverMethodRunStage, api.RunStageParams{Stage: "build_script"}, &result)
+	require.NoError(t, err)
+	assert.Equal(t, "build_script", result.Stage)
+
+	assert.NoError(t, d.Close())
+}
+
+func TestStartStdioDriverExited(t *testing.T) {
+	d, cleanup, err := startTestDriver(t, api.DriverTransportStdio, "exit 0")
+	defer cleanup()
+	require.NoError(t, err)
+	defer d.Close()
+
+	err = d.Call(context.Background(), api.DriverMethodPrepare, nil, nil)
+	assert.True(t, errors.Is(err, ErrConnectionClosed), "expected %v, got %v", ErrConnectionClosed, err)
+}
+
+func TestStartUnixDriverExitedBeforeConnecting(t *testing.T) {
+	_, cleanup, err := startTestDriver(t, api.DriverTransportUnix, `test -S "$CUSTOM_DRIVER_SOCKET" && exit 3`)
+	defer cleanup()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "driver exited before connecting: exit status 3")
+}
+
+func TestStartUnsupportedTransport(t *testing.T) {
+	_, cleanup, err := startTestDriver(t, "tcp", echoDriver)
+	defer cleanup()
+	assert.EqualError(t, err, `unsupported driver transport "tcp"`)
+}
@@ -0,0 +1,378 @@
+package custom
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/api"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/driver"
+)
+
+// fakeDriver answers the calls of the executor in the process of the test,
+// through the same client as the real drivers
+type fakeDriver struct {
+	t    *testing.T
+	conn net.Conn
+
+	answer func(d *fakeDriver, msg api.DriverMessage)
+
+	lock     sync.Mutex
+	methods  []string
+	canceled chan api.CancelParams
+}
+
+func (d *fakeDriver) serve() {
+	scanner := bufio.NewScanner(d.conn)
+	for scanner.Scan() {
+		var msg api.DriverMessage
+		if !assert.NoError(d.t, json.Unmarshal(scanner.Bytes(), &msg)) {
+			return
+		}
+
+		d.lock.Lock()
+		d.methods = append(d.methods, msg.Method)
+		d.lock.Unlock()
+
+		if msg.Method == api.DriverMethodCancel {
+			var params api.CancelParams
+			assert.NoError(d.t, json.Unmarshal(msg.Params, &params))
+			d.canceled <- params
+			continue
+		}
+
+		go d.answer(d, msg)
+	}
+}
+
+func (d *fakeDriver) send(msg api.DriverMessage) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	msg.JSONRPC = "2.0"
+	data, err := json.Marshal(msg)
+	require.NoError(d.t, err)
+
+	_, _ = d.conn.Write(append(data, '\n'))
+}
+
+func (d *fakeDriver) result(id *int64, result interface{}) {
+	data, err := json.Marshal(result)
+	require.NoError(d.t, err)
+
+	d.send(api.DriverMessage{ID: id, Result: data})
+}
+
+func (d *fakeDriver) error(id *int64, code int, message string) {
+	d.send(api.DriverMessage{ID: id, Error: &api.DriverError{Code: code, Message: message}})
+}
+
+func (d *fakeDriver) notify(method string, params interface{}) {
+	data, err := json.Marshal(params)
+	require.NoError(d.t, err)
+
+	d.send(api.DriverMessage{Method: method, Params: data})
+}
+
+func (d *fakeDriver) calledMethods() []string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return append([]string{}, d.methods...)
+}
+
+// initialized answers the initialize call like a driver of the current
+// protocol version, and the other calls with the answer function
+func initialized(answer func(d *fakeDriver, msg api.DriverMessage)) func(d *fakeDriver, msg api.DriverMessage) {
+	return func(d *fakeDriver, msg api.DriverMessage) {
+		if msg.Method != api.DriverMethodInitialize {
+			answer(d, msg)
+			return
+		}
+
+		d.result(msg.ID, api.InitializeResult{ProtocolVersion: api.DriverProtocolVersion})
+	}
+}
+
+func mockDriverFactory(t *testing.T, answer func(d *fakeDriver, msg api.DriverMessage)) (*fakeDriver, func()) {
+	clientConn, driverConn := net.Pipe()
+
+	d := &fakeDriver{
+		t:        t,
+		conn:     driverConn,
+		answer:   answer,
+		canceled: make(chan api.CancelParams, 1),
+	}
+	go d.serve()
+
+	oldFactory := driverFactory
+	driverFactory = func(ctx context.Context, options driver.Options) (driver.Driver, error) {
+		assert.Equal(t, "driver", options.Executable)
+		assert.Equal(t, []string{"--job"}, options.Args)
+
+		return driver.NewClient(clientConn, options.Handler), nil
+	}
+
+	return d, func() {
+		driverFactory = oldFactory
+		_ = driverConn.Close()
+	}
+}
+
+func getDriverRunnerConfig() common.RunnerConfig {
+	gracefulKillTimeout := 1
+
+	return getRunnerConfig(&common.CustomConfig{
+		DriverExec:          "driver",
+		DriverArgs:          []string{"--job"},
+		GracefulKillTimeout: &gracefulKillTimeout,
+	})
+}
+
+func TestExecutor_Driver(t *testing.T) {
+	fd, cleanup := mockDriverFactory(t, func(d *fakeDriver, msg api.DriverMessage) {
+		switch msg.Method {
+		case api.DriverMethodInitialize:
+			var params api.InitializeParams
+			assert.NoError(t, json.Unmarshal(msg.Params, &params))
+			assert.Equal(t, api.DriverProtocolVersion, params.ProtocolVersion)
+
+			name, version, hostname := "test-driver", "1.0", "vm-1"
+			d.result(msg.ID, api.InitializeResult{
+				ProtocolVersion: api.DriverProtocolVersion,
+				Config: &api.ConfigExecOutput{
+					Driver:   &api.DriverInfo{Name: &name, Version: &version},
+					Hostname: &hostname,
+				},
+			})
+		case api.DriverMethodPrepare:
+			percent := 50
+			d.notify(api.DriverMethodProgress, api.ProgressParams{Message: "Starting the VM", Percent: &percent})
+			d.notify(api.DriverMethodLog, api.LogParams{Data: "VM started\n"})
+			d.result(msg.ID, nil)
+		case api.DriverMethodRunStage:
+			var params api.RunStageParams
+			assert.NoError(t, json.Unmarshal(msg.Params, &params))
+			assert.Equal(t, string(common.BuildStageGetSources), params.Stage)
+
+			script, err := ioutil.ReadFile(params.Script)
+			assert.NoError(t, err)
+			d.notify(api.DriverMethodLog, api.LogParams{Data: string(script) + "\n"})
+			d.result(msg.ID, nil)
+		case api.DriverMethodCleanup:
+			var params api.CleanupParams
+			assert.NoError(t, json.Unmarshal(msg.Params, &params))
+			assert.Equal(t, api.ReasonSuccess, params.Reason)
+
+			d.result(msg.ID, nil)
+		}
+	})
+	defer cleanup()
+
+	e, options, out := prepareExecutor(t, executorTestCase{config: getDriverRunnerConfig()})
+
+	err := e.Prepare(options)
+	require.NoError(t, err)
+	assert.Equal(t, "vm-1", e.Build.Hostname)
+
+	err = e.Run(common.ExecutorCommand{
+		Context: context.Background(),
+		Script:  "echo job script",
+		Stage:   common.BuildStageGetSources,
+	})
+	require.NoError(t, err)
+
+	e.Finish(nil)
+	e.Cleanup()
+
+	assert.Equal(
+		t,
+		[]string{
+			api.DriverMethodInitialize,
+			api.DriverMethodPrepare,
+			api.DriverMethodRunStage,
+			api.DriverMethodCleanup,
+		},
+		fd.calledMethods(),
+	)
+
+	output := out.String()
+	assert.Contains(t, output, "Using Custom executor with driver test-driver 1.0...")
+	assert.Contains(t, output, "Starting the VM (50%)")
+	assert.Contains(t, output, "VM started")
+	assert.Contains(t, output, "echo job script")
+	assert.NotContains(t, output, "WARNING")
+}
+
+func TestExecutor_DriverEnvWithConfigExecVariables(t *testing.T) {
+	_, cleanup := mockDriverFactory(t, initialized(func(d *fakeDriver, msg api.DriverMessage) {
+		d.result(msg.ID, nil)
+	}))
+	defer cleanup()
+
+	var env []string
+	factory := driverFactory
+	driverFactory = func(ctx context.Context, options driver.Options) (driver.Driver, error) {
+		env = options.Command.Env
+		return factory(ctx, options)
+	}
+
+	config := getDriverRunnerConfig()
+	config.Custom.ConfigExec = "config"
+
+	tt := executorTestCase{
+		config:               config,
+		commandStdoutContent: `{"variables": [{"key": "VM_IP", "value": "10.0.0.2"}]}`,
+	}
+	defer mockCommandFactory(t, tt)()
+
+	e, options, _ := prepareExecutor(t, tt)
+
+	err := e.Prepare(options)
+	require.NoError(t, err)
+
+	e.Finish(nil)
+	e.Cleanup()
+
+	assert.Contains(t, env, "CUSTOM_ENV_VM_IP=10.0.0.2")
+}
+
+func TestExecutor_DriverErrors(t *testing.T) {
+	tests := map[string]struct {
+		answer           func(d *fakeDriver, msg api.DriverMessage)
+		expectedPrepare  string
+		expectedRunError func(t *testing.T, err error)
+	}{
+		"unsupported protocol version": {
+			answer: func(d *fakeDriver, msg api.DriverMessage) {
+				d.result(msg.ID, api.InitializeResult{ProtocolVersion: 2})
+			},
+			expectedPrepare: "unsupported driver protocol version 2, expected 1",
+		},
+		"prepare failure": {
+			answer: initialized(func(d *fakeDriver, msg api.DriverMessage) {
+				d.error(msg.ID, api.DriverSystemFailureErrorCode, "no VM available")
+			}),
+			expectedPrepare: "driver error 2: no VM available",
+		},
+		"build failure": {
+			answer: initialized(func(d *fakeDriver, msg api.DriverMessage) {
+				if msg.Method == api.DriverMethodRunStage {
+					d.error(msg.ID, api.DriverBuildFailureErrorCode, "exit status 1")
+					return
+				}
+
+				d.result(msg.ID, nil)
+			}),
+			expectedRunError: func(t *testing.T, err error) {
+				var buildErr *common.BuildError
+				assert.True(t, errors.As(err, &buildErr), "expected %T, got %T", buildErr, err)
+			},
+		},
+		"system failure": {
+			answer: initialized(func(d *fakeDriver, msg api.DriverMessage) {
+				if msg.Method == api.DriverMethodRunStage {
+					d.error(msg.ID, api.DriverSystemFailureErrorCode, "VM lost")
+					return
+				}
+
+				d.result(msg.ID, nil)
+			}),
+			expectedRunError: func(t *testing.T, err error) {
+				var buildErr *common.BuildError
+				assert.False(t, errors.As(err, &buildErr), "unexpected %T", err)
+				assert.EqualError(t, err, "driver error 2: VM lost")
+			},
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			_, cleanup := mockDriverFactory(t, tt.answer)
+			defer cleanup()
+
+			e, options, _ := prepareExecutor(t, executorTestCase{config: getDriverRunnerConfig()})
+
+			err := e.Prepare(options)
+			if tt.expectedPrepare != "" {
+				assert.EqualError(t, err, tt.expectedPrepare)
+				return
+			}
+			require.NoError(t, err)
+
+			err = e.Run(common.ExecutorCommand{
+				Context: context.Background(),
+				Stage:   common.BuildStageGetSources,
+			})
+			tt.expectedRunError(t, err)
+		})
+	}
+}
+
+func TestExecutor_DriverCancel(t *testing.T) {
+	tests := map[string]struct {
+		stopStage     bool
+		expectedError string
+	}{
+		"stage stopped by the driver": {
+			stopStage:     true,
+			expectedError: "driver error 2: canceled",
+		},
+		"stage not stopped by the driver": {
+			expectedError: "driver didn't stop the get_sources stage: context canceled",
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			var runStageID *int64
+			runStageCalled := make(chan struct{})
+
+			fd, cleanup := mockDriverFactory(t, initialized(func(d *fakeDriver, msg api.DriverMessage) {
+				if msg.Method == api.DriverMethodRunStage {
+					runStageID = msg.ID
+					close(runStageCalled)
+					return
+				}
+
+				d.result(msg.ID, nil)
+			}))
+			defer cleanup()
+
+			e, options, _ := prepareExecutor(t, executorTestCase{config: getDriverRunnerConfig()})
+			require.NoError(t, e.Prepare(options))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				<-runStageCalled
+				cancel()
+
+				params := <-fd.canceled
+				assert.Equal(t, string(common.BuildStageGetSources), params.Stage)
+				assert.Equal(t, api.ReasonCancel, params.Reason)
+
+				if tt.stopStage {
+					fd.error(runStageID, api.DriverSystemFailureErrorCode, "canceled")
+				}
+			}()
+
+			started := time.Now()
+			err := e.Run(common.ExecutorCommand{
+				Context: ctx,
+				Stage:   common.BuildStageGetSources,
+			})
+			assert.EqualError(t, err, tt.expectedError)
+			assert.True(t, time.Since(started) < 5*time.Second)
+		})
+	}
+}
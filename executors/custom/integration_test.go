@@ -16,6 +16,7 @@ import (
 
 	"gitlab.com/gitlab-org/gitlab-runner/common"
 	"gitlab.com/gitlab-org/gitlab-runner/common/buildtest"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/api"
 	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/command"
 	"gitlab.com/gitlab-org/gitlab-runner/helpers"
 	"gitlab.com/gitlab-org/gitlab-runner/session"
@@ -557,3 +558,86 @@ func TestBuildOnCustomDirectory(t *testing.T) {
 		}
 	})
 }
+
+func useDriver(build *common.Build, shell string, transport string) {
+	build.Runner.Custom = &common.CustomConfig{
+		DriverExec:          testExecutorFile,
+		DriverArgs:          []string{shell, "driver"},
+		DriverTransport:     transport,
+		GracefulKillTimeout: timeoutInSeconds(10 * time.Second),
+		ForceKillTimeout:    timeoutInSeconds(10 * time.Second),
+	}
+}
+
+func TestBuildWithDriver(t *testing.T) {
+	transports := []string{api.DriverTransportStdio}
+	if runtime.GOOS != "windows" {
+		transports = append(transports, api.DriverTransportUnix)
+	}
+
+	shellstest.OnEachShell(t, func(t *testing.T, shell string) {
+		for _, transport := range transports {
+			t.Run(transport, func(t *testing.T) {
+				successfulBuild, err := common.GetSuccessfulBuild()
+				require.NoError(t, err)
+
+				build, cleanup := newBuild(t, successfulBuild, shell)
+				defer cleanup()
+
+				useDriver(build, shell, transport)
+
+				out, err := buildtest.RunBuildReturningOutput(t, build)
+				assert.NoError(t, err)
+				assert.Contains(t, out, "PREPARE doesn't accept any arguments")
+				assert.Contains(t, out, "Job succeeded")
+			})
+		}
+	})
+}
+
+func TestBuildWithDriverBuildFailure(t *testing.T) {
+	shellstest.OnEachShell(t, func(t *testing.T, shell string) {
+		successfulBuild, err := common.GetSuccessfulBuild()
+		require.NoError(t, err)
+
+		build, cleanup := newBuild(t, successfulBuild, shell)
+		defer cleanup()
+
+		useDriver(build, shell, api.DriverTransportStdio)
+
+		build.Variables = append(build.Variables, common.JobVariable{
+			Key:    "IS_BUILD_ERROR",
+			Value:  "true",
+			Public: true,
+		})
+
+		err = buildtest.RunBuild(t, build)
+		assert.Error(t, err)
+		var buildErr *common.BuildError
+		assert.True(t, errors.As(err, &buildErr), "expected %T, got %T", buildErr, err)
+	})
+}
+
+func TestBuildWithDriverCancel(t *testing.T) {
+	shellstest.OnEachShell(t, func(t *testing.T, shell string) {
+		longRunningBuild, err := common.GetLongRunningBuild()
+		require.NoError(t, err)
+
+		build, cleanup := newBuild(t, longRunningBuild, shell)
+		defer cleanup()
+
+		useDriver(build, shell, api.DriverTransportStdio)
+
+		trace := &common.Trace{Writer: os.Stdout}
+
+		cancelTimer := time.AfterFunc(2*time.Second, func() {
+			t.Log("Cancel")
+			trace.Cancel()
+		})
+		defer cancelTimer.Stop()
+
+		err = buildtest.RunBuildWithTrace(t, build, trace)
+		assert.EqualError(t, err, "canceled")
+		assert.IsType(t, err, &common.BuildError{})
+	})
+}
@@ -0,0 +1,97 @@
+package custom
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors"
+)
+
+var jobMetadataDesc = prometheus.NewDesc(
+	"gitlab_runner_custom_executor_job_metadata",
+	"The metadata returned by the Custom executor driver for the running jobs",
+	[]string{"runner", "job", "key", "value"},
+	nil,
+)
+
+type jobMetadataKey struct {
+	runner string
+	job    string
+}
+
+// metadataCollector exposes the metadata of the running jobs, from the end of
+// the config stage until the end of the cleanup
+type metadataCollector struct {
+	lock sync.RWMutex
+	jobs map[jobMetadataKey]map[string]string
+}
+
+var jobsMetadata = &metadataCollector{
+	jobs: make(map[jobMetadataKey]map[string]string),
+}
+
+func newJobMetadataKey(build *common.Build) jobMetadataKey {
+	key := jobMetadataKey{job: strconv.Itoa(build.ID)}
+	if build.Runner != nil {
+		key.runner = build.Runner.ShortDescription()
+	}
+
+	return key
+}
+
+func (c *metadataCollector) add(build *common.Build, metadata map[string]string) {
+	if build == nil || len(metadata) == 0 {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.jobs[newJobMetadataKey(build)] = metadata
+}
+
+func (c *metadataCollector) remove(build *common.Build) {
+	if build == nil {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.jobs, newJobMetadataKey(build))
+}
+
+// Describe implements prometheus.Collector.
+func (c *metadataCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- jobMetadataDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *metadataCollector) Collect(ch chan<- prometheus.Metric) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	for job, metadata := range c.jobs {
+		for key, value := range metadata {
+			ch <- prometheus.MustNewConstMetric(
+				jobMetadataDesc,
+				prometheus.GaugeValue,
+				1,
+				job.runner,
+				job.job,
+				key,
+				value,
+			)
+		}
+	}
+}
+
+// executorProvider registers the metrics of the Custom executor with the
+// ones of the other executor providers
+type executorProvider struct {
+	executors.DefaultExecutorProvider
+	*metadataCollector
+}
@@ -0,0 +1,56 @@
+package custom
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	prometheus_go "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+func TestMetadataCollector(t *testing.T) {
+	collector := &metadataCollector{jobs: make(map[jobMetadataKey]map[string]string)}
+
+	build := &common.Build{
+		JobResponse: common.JobResponse{ID: 1234},
+		Runner:      &common.RunnerConfig{RunnerCredentials: common.RunnerCredentials{Token: "abcdefghijkl"}},
+	}
+
+	collector.add(build, map[string]string{"vm": "vm-1"})
+	collector.add(&common.Build{JobResponse: common.JobResponse{ID: 5678}}, nil)
+
+	ch := make(chan prometheus.Metric, 50)
+	collector.Collect(ch)
+	require.Len(t, ch, 1)
+
+	metric := &prometheus_go.Metric{}
+	m := <-ch
+	_ = m.Write(metric)
+
+	labels := make(map[string]string)
+	for _, labelPair := range metric.Label {
+		labels[*labelPair.Name] = *labelPair.Value
+	}
+
+	assert.Equal(t, float64(1), *metric.Gauge.Value)
+	assert.Equal(
+		t,
+		map[string]string{"runner": "abcdefgh", "job": "1234", "key": "vm", "value": "vm-1"},
+		labels,
+	)
+
+	collector.remove(build)
+
+	collector.Collect(ch)
+	assert.Len(t, ch, 0)
+}
+
+func TestExecutorProviderIsCollector(t *testing.T) {
+	provider := common.GetExecutorProvider("custom")
+
+	_, ok := provider.(prometheus.Collector)
+	assert.True(t, ok)
+}
@@ -0,0 +1,86 @@
+package custom
+
+import (
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/api"
+	"gitlab.com/gitlab-org/gitlab-runner/session/proxy"
+)
+
+func (e *executor) Pool() proxy.Pool {
+	return e.ProxyPool
+}
+
+// serviceProxy proxies the session server requests to a service reported by
+// config_exec or the driver, reachable by the Runner on its host
+type serviceProxy struct {
+	host string
+}
+
+func newServiceProxy(service api.ServiceInfo) *proxy.Proxy {
+	ports := make([]proxy.Port, len(service.Ports))
+	for i, port := range service.Ports {
+		ports[i] = proxy.Port{Number: port.Number, Protocol: port.Protocol, Name: port.Name}
+	}
+
+	return &proxy.Proxy{
+		Settings:          proxy.NewProxySettings(service.Name, ports),
+		ConnectionHandler: &serviceProxy{host: service.Host},
+	}
+}
+
+func (p *serviceProxy) ProxyRequest(
+	w http.ResponseWriter,
+	r *http.Request,
+	requestedURI string,
+	port string,
+	settings *proxy.Settings,
+) {
+	logger := logrus.WithFields(logrus.Fields{
+		"uri":      r.RequestURI,
+		"method":   r.Method,
+		"port":     port,
+		"settings": settings,
+	})
+
+	portSettings, err := settings.PortByNameOrNumber(port)
+	if err != nil {
+		logger.WithError(err).Errorf("port proxy %q not found", port)
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	scheme, err := portSettings.Scheme()
+	if err != nil {
+		logger.WithError(err).Errorf("service proxy: error proxying request")
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+
+	host := net.JoinHostPort(p.host, strconv.Itoa(portSettings.Number))
+
+	// the reverse proxy handles the WebSocket upgrades as well
+	reverseProxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = scheme
+			req.URL.Host = host
+			req.URL.Path = "/" + requestedURI
+			req.URL.RawPath = ""
+			req.Host = host
+
+			// the session token must not leak to the service
+			req.Header.Del("Authorization")
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			logger.WithError(err).Errorf("service proxy: error proxying request")
+			http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		},
+	}
+
+	reverseProxy.ServeHTTP(w, r)
+}
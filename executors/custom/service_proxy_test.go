@@ -0,0 +1,141 @@
+package custom
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/executors"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/api"
+	"gitlab.com/gitlab-org/gitlab-runner/session"
+	"gitlab.com/gitlab-org/gitlab-runner/session/proxy"
+)
+
+func TestPoolGetter(t *testing.T) {
+	pool := proxy.Pool{"test": newServiceProxy(api.ServiceInfo{Name: "test"})}
+	e := executor{
+		AbstractExecutor: executors.AbstractExecutor{
+			ProxyPool: pool,
+		},
+	}
+
+	assert.Equal(t, pool, e.Pool())
+}
+
+func TestConfigExecOutput_InjectIntoServices(t *testing.T) {
+	e := &executor{
+		AbstractExecutor: executors.AbstractExecutor{
+			ProxyPool: proxy.NewPool(),
+		},
+	}
+
+	output := ConfigExecOutput{ConfigExecOutput: api.ConfigExecOutput{
+		Services: []api.ServiceInfo{
+			{
+				Name:  "web",
+				Host:  "10.0.0.2",
+				Ports: []api.ServicePort{{Number: 80, Protocol: "http", Name: "web"}},
+			},
+		},
+	}}
+	output.InjectInto(e)
+
+	require.Contains(t, e.ProxyPool, "web")
+	assert.Equal(
+		t,
+		proxy.NewProxySettings("web", []proxy.Port{{Number: 80, Protocol: "http", Name: "web"}}),
+		e.ProxyPool["web"].Settings,
+	)
+	assert.Equal(t, &serviceProxy{host: "10.0.0.2"}, e.ProxyPool["web"].ConnectionHandler)
+}
+
+func TestServiceProxyRequest(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "%s %s authorization=%q", r.Method, r.URL.RequestURI(), r.Header.Get("Authorization"))
+	}))
+	defer backend.Close()
+
+	backendURL, err := url.Parse(backend.URL)
+	require.NoError(t, err)
+	host, portString, err := net.SplitHostPort(backendURL.Host)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(portString)
+	require.NoError(t, err)
+
+	sess, err := session.NewSession(nil)
+	require.NoError(t, err)
+
+	e := &executor{
+		AbstractExecutor: executors.AbstractExecutor{
+			ProxyPool: proxy.Pool{
+				"web": newServiceProxy(api.ServiceInfo{
+					Name: "web",
+					Host: host,
+					Ports: []api.ServicePort{
+						{Number: port, Protocol: "http", Name: "web"},
+						{Number: 5432, Protocol: "tcp", Name: "db"},
+					},
+				}),
+			},
+		},
+	}
+	sess.SetProxyPool(e)
+
+	srv := httptest.NewServer(sess.Mux())
+	defer srv.Close()
+
+	tests := map[string]struct {
+		port             string
+		expectedCode     int
+		expectedResponse string
+	}{
+		"port by number": {
+			port:             portString,
+			expectedCode:     http.StatusOK,
+			expectedResponse: `GET /path/to/page?query=1 authorization=""`,
+		},
+		"port by name": {
+			port:             "web",
+			expectedCode:     http.StatusOK,
+			expectedResponse: `GET /path/to/page?query=1 authorization=""`,
+		},
+		"unknown port": {
+			port:         "81",
+			expectedCode: http.StatusNotFound,
+		},
+		"unsupported protocol": {
+			port:         "db",
+			expectedCode: http.StatusServiceUnavailable,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			u := fmt.Sprintf("%s%s/proxy/web/%s/path/to/page?query=1", srv.URL, sess.Endpoint, tt.port)
+			req, err := http.NewRequest(http.MethodGet, u, nil)
+			require.NoError(t, err)
+			req.Header.Set("Authorization", sess.Token)
+
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.expectedCode, resp.StatusCode)
+			if tt.expectedResponse == "" {
+				return
+			}
+
+			body, err := ioutil.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedResponse, string(body))
+		})
+	}
+}
@@ -4,10 +4,111 @@ package custom
 
 import (
 	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/kr/pty"
+	terminal "gitlab.com/gitlab-org/gitlab-terminal"
 
 	terminalsession "gitlab.com/gitlab-org/gitlab-runner/session/terminal"
 )
 
+const terminalDialTimeout = 10 * time.Second
+
+var errTerminalNotConfigured = errors.New("interactive terminal not configured: set terminal_exec or return a terminal address from the driver")
+
+// execTerminalConn is a terminal opened by attaching a PTY to terminal_exec
+type execTerminalConn struct {
+	cmd *exec.Cmd
+	fd  *os.File
+}
+
+func (t execTerminalConn) Start(w http.ResponseWriter, r *http.Request, timeoutCh, disconnectCh chan error) {
+	proxy := terminal.NewFileDescriptorProxy(1) // one stopper: terminal exit handler
+
+	terminalsession.ProxyTerminal(
+		timeoutCh,
+		disconnectCh,
+		proxy.StopCh,
+		func() {
+			terminal.ProxyFileDescriptor(w, r, t.fd, proxy)
+		},
+	)
+}
+
+func (t execTerminalConn) Close() error {
+	err := t.fd.Close()
+
+	if t.cmd.Process != nil {
+		_ = t.cmd.Process.Kill()
+		go func() { _ = t.cmd.Wait() }()
+	}
+
+	return err
+}
+
+// streamTerminalConn is a terminal opened by connecting to the address
+// returned by config_exec or the driver
+type streamTerminalConn struct {
+	conn net.Conn
+}
+
+func (t streamTerminalConn) Start(w http.ResponseWriter, r *http.Request, timeoutCh, disconnectCh chan error) {
+	proxy := terminal.NewStreamProxy(1) // one stopper: terminal exit handler
+
+	terminalsession.ProxyTerminal(
+		timeoutCh,
+		disconnectCh,
+		proxy.StopCh,
+		func() {
+			terminal.ProxyStream(w, r, t.conn, proxy)
+		},
+	)
+}
+
+func (t streamTerminalConn) Close() error {
+	return t.conn.Close()
+}
+
 func (e *executor) Connect() (terminalsession.Conn, error) {
-	return nil, errors.New("not yet supported")
+	if e.config != nil && e.config.TerminalExec != "" {
+		return e.connectTerminalExec()
+	}
+
+	if e.terminal != nil && e.terminal.Address != "" {
+		return e.connectTerminalAddress()
+	}
+
+	return nil, errTerminalNotConfigured
+}
+
+func (e *executor) connectTerminalExec() (terminalsession.Conn, error) {
+	cmd := exec.Command(e.config.TerminalExec, e.config.TerminalArgs...)
+	cmd.Dir = e.tempDir
+	cmd.Env = append(os.Environ(), "TMPDIR="+e.tempDir)
+	cmd.Env = append(cmd.Env, e.commandOptions(commandOutputs{}).Env...)
+
+	fd, err := pty.Start(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	return execTerminalConn{cmd: cmd, fd: fd}, nil
+}
+
+func (e *executor) connectTerminalAddress() (terminalsession.Conn, error) {
+	network := e.terminal.Network
+	if network == "" {
+		network = "tcp"
+	}
+
+	conn, err := net.DialTimeout(network, e.terminal.Address, terminalDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return streamTerminalConn{conn: conn}, nil
 }
@@ -3,9 +3,23 @@
 package custom
 
 import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/api"
+	"gitlab.com/gitlab-org/gitlab-runner/session"
 )
 
 func TestExecutor_Connect(t *testing.T) {
@@ -13,5 +27,122 @@ func TestExecutor_Connect(t *testing.T) {
 	connection, err := e.Connect()
 
 	assert.Nil(t, connection)
-	assert.EqualError(t, err, "not yet supported")
+	assert.Equal(t, errTerminalNotConfigured, err)
+}
+
+// dialTerminal opens the web terminal of the executor through the session
+// server, like GitLab does
+func dialTerminal(t *testing.T, e *executor) (*websocket.Conn, func()) {
+	sess, err := session.NewSession(nil)
+	require.NoError(t, err)
+	sess.SetInteractiveTerminal(e)
+
+	srv := httptest.NewServer(sess.Mux())
+
+	u := url.URL{
+		Scheme: "ws",
+		Host:   srv.Listener.Addr().String(),
+		Path:   sess.Endpoint + "/exec",
+	}
+	headers := http.Header{
+		"Authorization": []string{sess.Token},
+	}
+
+	conn, resp, err := websocket.DefaultDialer.Dial(u.String(), headers)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+	return conn, func() {
+		_ = conn.Close()
+		srv.Close()
+	}
+}
+
+func readTerminalUntil(t *testing.T, conn *websocket.Conn, expected string) {
+	var output strings.Builder
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(10*time.Second)))
+	for !strings.Contains(output.String(), expected) {
+		_, message, err := conn.ReadMessage()
+		require.NoError(t, err, "output so far: %q", output.String())
+		output.Write(message)
+	}
+}
+
+func TestExecutor_ConnectTerminalExec(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "custom-executor-terminal")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	e := &executor{
+		config: &config{CustomConfig: &common.CustomConfig{
+			TerminalExec: "bash",
+			TerminalArgs: []string{"-c", `echo "job $CUSTOM_ENV_CI_JOB_ID in $PWD"; cat`},
+		}},
+		tempDir: tempDir,
+	}
+	e.Build = &common.Build{}
+	e.Build.Variables = common.JobVariables{{Key: "CI_JOB_ID", Value: "1234"}}
+
+	conn, cleanup := dialTerminal(t, e)
+	defer cleanup()
+
+	readTerminalUntil(t, conn, "job 1234 in "+tempDir)
+
+	require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, []byte("hello\n")))
+	readTerminalUntil(t, conn, "hello")
+}
+
+func TestExecutor_ConnectTerminalAddress(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "custom-executor-terminal")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	// the fake driver's terminal echoes what it receives
+	listener, err := net.Listen("unix", tempDir+"/terminal.sock")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		_, _ = conn.Write([]byte("driver terminal\n"))
+
+		buf := make([]byte, 1024)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write(buf[:n])
+		}
+	}()
+
+	e := &executor{
+		config:   &config{CustomConfig: &common.CustomConfig{}},
+		terminal: &api.TerminalInfo{Network: "unix", Address: listener.Addr().String()},
+	}
+
+	conn, cleanup := dialTerminal(t, e)
+	defer cleanup()
+
+	readTerminalUntil(t, conn, "driver terminal")
+
+	require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, []byte("hello\n")))
+	readTerminalUntil(t, conn, "hello")
+}
+
+func TestExecutor_ConnectTerminalAddressUnreachable(t *testing.T) {
+	e := &executor{
+		terminal: &api.TerminalInfo{Network: "unix", Address: "/non/existing/terminal.sock"},
+	}
+
+	connection, err := e.Connect()
+	assert.Nil(t, connection)
+	assert.Error(t, err)
 }
@@ -1,13 +1,17 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
+	"sync"
 
 	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/api"
 )
@@ -24,6 +28,7 @@ const (
 	stagePrepare = "prepare"
 	stageRun     = "run"
 	stageCleanup = "cleanup"
+	stageDriver  = "driver"
 )
 
 func setBuildFailure(msg string, args ...interface{}) {
@@ -78,6 +83,7 @@ func main() {
 		stagePrepare: prepare,
 		stageRun:     run,
 		stageCleanup: cleanup,
+		stageDriver:  driver,
 	}
 
 	stageFn, ok := stages[stage]
@@ -93,16 +99,11 @@ func main() {
 }
 
 func config(shell string, args []string) {
-	customDir := os.Getenv(isRunOnCustomDir)
-	if customDir == "" {
+	dir := customBuildsDir()
+	if dir == "" {
 		return
 	}
 
-	concurrentID := os.Getenv("CUSTOM_ENV_CI_CONCURRENT_PROJECT_ID")
-	projectSlug := os.Getenv("CUSTOM_ENV_CI_PROJECT_PATH_SLUG")
-
-	dir := filepath.Join(customDir, concurrentID, projectSlug)
-
 	type output struct {
 		BuildsDir string `json:"builds_dir"`
 	}
@@ -115,6 +116,18 @@ func config(shell string, args []string) {
 	fmt.Print(string(jsonOutput))
 }
 
+func customBuildsDir() string {
+	customDir := os.Getenv(isRunOnCustomDir)
+	if customDir == "" {
+		return ""
+	}
+
+	concurrentID := os.Getenv("CUSTOM_ENV_CI_CONCURRENT_PROJECT_ID")
+	projectSlug := os.Getenv("CUSTOM_ENV_CI_PROJECT_PATH_SLUG")
+
+	return filepath.Join(customDir, concurrentID, projectSlug)
+}
+
 func prepare(shell string, args []string) {
 	fmt.Println("PREPARE doesn't accept any arguments. It just does its job")
 	fmt.Println()
@@ -208,3 +221,147 @@ func cleanup(shell string, args []string) {
 	fmt.Println("CLEANUP doesn't accept any arguments. It just does its job")
 	fmt.Println()
 }
+
+// testDriver implements the protocol of the drivers started with driver_exec,
+// running the stages like the executables above
+type testDriver struct {
+	shell string
+
+	lock sync.Mutex
+	out  io.Writer
+
+	running *exec.Cmd
+}
+
+func driver(shell string, args []string) {
+	conn := io.ReadWriter(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout})
+
+	if socket := os.Getenv(api.DriverSocketVariable); socket != "" {
+		c, err := net.Dial("unix", socket)
+		if err != nil {
+			panic(fmt.Errorf("error while connecting to the runner: %w", err))
+		}
+		defer c.Close()
+
+		conn = c
+	}
+
+	d := &testDriver{shell: shell, out: conn}
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var msg api.DriverMessage
+		err := json.Unmarshal(scanner.Bytes(), &msg)
+		if err != nil {
+			panic(fmt.Errorf("error while parsing message: %w", err))
+		}
+
+		d.handle(msg)
+	}
+}
+
+func (d *testDriver) handle(msg api.DriverMessage) {
+	switch msg.Method {
+	case api.DriverMethodInitialize:
+		result := api.InitializeResult{ProtocolVersion: api.DriverProtocolVersion}
+		if dir := customBuildsDir(); dir != "" {
+			result.Config = &api.ConfigExecOutput{BuildsDir: &dir}
+		}
+
+		d.result(msg.ID, result)
+	case api.DriverMethodPrepare:
+		d.log("PREPARE doesn't accept any arguments. It just does its job\n\n")
+		d.result(msg.ID, nil)
+	case api.DriverMethodRunStage:
+		var params api.RunStageParams
+		err := json.Unmarshal(msg.Params, &params)
+		if err != nil {
+			panic(fmt.Errorf("error while parsing run_stage params: %w", err))
+		}
+
+		go d.runStage(msg.ID, params)
+	case api.DriverMethodCancel:
+		d.lock.Lock()
+		if d.running != nil && d.running.Process != nil {
+			_ = d.running.Process.Kill()
+		}
+		d.lock.Unlock()
+	case api.DriverMethodCleanup:
+		d.log("CLEANUP doesn't accept any arguments. It just does its job\n\n")
+		d.result(msg.ID, nil)
+	}
+}
+
+func (d *testDriver) runStage(id *int64, params api.RunStageParams) {
+	switch {
+	case len(os.Getenv(isBuildError)) > 0:
+		d.error(id, api.DriverBuildFailureErrorCode, "mocked build failure")
+		return
+	case len(os.Getenv(isSystemError)) > 0:
+		d.error(id, api.DriverSystemFailureErrorCode, "mocked system failure")
+		return
+	case len(os.Getenv(isUnknownError)) > 0:
+		d.error(id, 255, "mocked unknown failure")
+		return
+	}
+
+	output := bytes.NewBuffer(nil)
+
+	cmd := createCommand(d.shell, params.Script, params.Stage)
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	d.lock.Lock()
+	d.running = cmd
+	err := cmd.Start()
+	d.lock.Unlock()
+
+	if err == nil {
+		err = cmd.Wait()
+	}
+
+	d.log(fmt.Sprintf(">>>>>>>>>>\n%s\n<<<<<<<<<<\n\n", output.String()))
+
+	if err != nil {
+		d.error(id, api.DriverBuildFailureErrorCode, fmt.Sprintf("Job script exited with: %v", err))
+		return
+	}
+
+	d.result(id, nil)
+}
+
+func (d *testDriver) log(data string) {
+	d.send(api.DriverMessage{Method: api.DriverMethodLog, Params: marshal(api.LogParams{Data: data})})
+}
+
+func (d *testDriver) result(id *int64, result interface{}) {
+	d.send(api.DriverMessage{ID: id, Result: marshal(result)})
+}
+
+func (d *testDriver) error(id *int64, code int, message string) {
+	d.send(api.DriverMessage{ID: id, Error: &api.DriverError{Code: code, Message: message}})
+}
+
+func (d *testDriver) send(msg api.DriverMessage) {
+	msg.JSONRPC = "2.0"
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	_, err := fmt.Fprintf(d.out, "%s\n", marshal(msg))
+	if err != nil {
+		panic(fmt.Errorf("error while sending message: %w", err))
+	}
+}
+
+func marshal(v interface{}) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Errorf("error while creating JSON output: %w", err))
+	}
+
+	return data
+}
@@ -26,6 +26,7 @@ import (
 
 	"gitlab.com/gitlab-org/gitlab-runner/common"
 	"gitlab.com/gitlab-org/gitlab-runner/executors"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/egress"
 	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/labels"
 	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/networks"
 	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/volumes"
@@ -91,6 +92,14 @@ type executor struct {
 	labeler         labels.Labeler
 
 	networkMode container.NetworkMode
+	storageOpt  map[string]string
+
+	egressProxy    *egress.Proxy
+	egressAuditLog io.Closer
+	egressProxyEnv []string
+
+	capabilities      docker.Capabilities
+	serviceExtraHosts []string
 
 	projectUniqRandomizedName string
 }
@@ -427,14 +436,19 @@ func (e *executor) createService(
 		Labels: e.labeler.Labels(labels),
 		Env:    append(e.getServiceVariables(), e.BuildShell.Environment...),
 	}
+	config.Env = append(config.Env, e.egressProxyEnv...)
 
 	if len(serviceDefinition.Command) > 0 {
 		config.Cmd = serviceDefinition.Command
 	}
 	config.Entrypoint = e.overwriteEntrypoint(&serviceDefinition)
 
-	hostConfig := e.createHostConfigForService()
-	networkConfig := e.networkConfig(linkNames)
+	hostConfig, err := e.createHostConfigForService()
+	if err != nil {
+		return nil, err
+	}
+
+	networkConfig := e.networkConfig(e.serviceNetworkAliases(linkNames))
 
 	e.Debugln("Creating service container", containerName, "...")
 	resp, err := e.client.ContainerCreate(e.Context, config, hostConfig, networkConfig, containerName)
@@ -452,13 +466,30 @@ func (e *executor) createService(
 	return fakeContainer(resp.ID, containerName), nil
 }
 
-func (e *executor) createHostConfigForService() *container.HostConfig {
+func (e *executor) createHostConfigForService() (*container.HostConfig, error) {
+	nanoCPUs, err := e.Config.Docker.GetServiceNanoCPUs()
+	if err != nil {
+		return nil, err
+	}
+
 	return &container.HostConfig{
+		Resources: container.Resources{
+			Memory:            e.Config.Docker.GetServiceMemory(),
+			MemorySwap:        e.Config.Docker.GetServiceMemorySwap(),
+			MemoryReservation: e.Config.Docker.GetServiceMemoryReservation(),
+			CpusetCpus:        e.Config.Docker.ServiceCPUSetCPUs,
+			CPUShares:         e.Config.Docker.ServiceCPUShares,
+			NanoCPUs:          nanoCPUs,
+			OomKillDisable:    e.Config.Docker.GetServiceOomKillDisable(),
+		},
 		DNS:           e.Config.Docker.DNS,
 		DNSSearch:     e.Config.Docker.DNSSearch,
 		RestartPolicy: neverRestartPolicy,
 		ExtraHosts:    e.Config.Docker.ExtraHosts,
 		Privileged:    e.Config.Docker.Privileged,
+		CapAdd:        e.Config.Docker.ServiceCapAdd,
+		CapDrop:       e.Config.Docker.ServiceCapDrop,
+		SecurityOpt:   e.Config.Docker.ServiceSecurityOpt,
 		NetworkMode:   e.networkMode,
 		Binds:         e.volumesManager.Binds(),
 		ShmSize:       e.Config.Docker.ShmSize,
@@ -466,7 +497,7 @@ func (e *executor) createHostConfigForService() *container.HostConfig {
 		LogConfig: container.LogConfig{
 			Type: "json-file",
 		},
-	}
+	}, nil
 }
 
 func (e *executor) networkConfig(aliases []string) *network.NetworkingConfig {
@@ -651,6 +682,11 @@ func (e *executor) createServices() (err error) {
 
 	e.waitForServices()
 
+	if e.usesServiceExtraHosts() {
+		e.Debugln("Building service extra hosts...")
+		e.serviceExtraHosts = e.buildServiceExtraHosts(linksMap)
+	}
+
 	if e.networkMode.IsBridge() || e.networkMode.NetworkName() == "" {
 		e.Debugln("Building service links...")
 		e.links = e.buildServiceLinks(linksMap)
@@ -736,6 +772,7 @@ func (e *executor) createContainerConfig(
 		StdinOnce:    true,
 		Env:          append(e.Build.GetAllVariables().StringList(), e.BuildShell.Environment...),
 	}
+	config.Env = append(config.Env, e.egressProxyEnv...)
 	config.Entrypoint = e.overwriteEntrypoint(&imageDefinition)
 
 	return config
@@ -767,7 +804,7 @@ func (e *executor) createHostConfig() (*container.HostConfig, error) {
 		CapDrop:       e.Config.Docker.CapDrop,
 		SecurityOpt:   e.Config.Docker.SecurityOpt,
 		RestartPolicy: neverRestartPolicy,
-		ExtraHosts:    e.Config.Docker.ExtraHosts,
+		ExtraHosts:    e.extraHosts(),
 		NetworkMode:   e.networkMode,
 		Links:         append(e.Config.Docker.Links, e.links...),
 		Binds:         e.volumesManager.Binds(),
@@ -778,8 +815,9 @@ func (e *executor) createHostConfig() (*container.HostConfig, error) {
 		LogConfig: container.LogConfig{
 			Type: "json-file",
 		},
-		Tmpfs:   e.Config.Docker.Tmpfs,
-		Sysctls: e.Config.Docker.SysCtls,
+		Tmpfs:      e.Config.Docker.Tmpfs,
+		Sysctls:    e.Config.Docker.SysCtls,
+		StorageOpt: e.storageOpt,
 	}, nil
 }
 
@@ -972,6 +1010,11 @@ func (e *executor) connectDocker() error {
 		return err
 	}
 
+	err = e.detectCapabilities()
+	if err != nil {
+		return err
+	}
+
 	err = e.validateOSType()
 	if err != nil {
 		return err
@@ -1010,7 +1053,9 @@ func (e *executor) createDependencies() error {
 		e.createLabeler,
 		e.createNetworksManager,
 		e.createBuildNetwork,
+		e.startEgressProxy,
 		e.bindDevices,
+		e.prepareStorageOpt,
 		e.createVolumesManager,
 		e.createVolumes,
 		e.createBuildVolume,
@@ -1097,7 +1142,12 @@ func (e *executor) Prepare(options common.ExecutorPrepareOptions) error {
 
 	e.AbstractExecutor.PrepareConfiguration(options)
 
-	err := e.connectDocker()
+	err := e.prepareOverwrites(options.Build.GetAllVariables())
+	if err != nil {
+		return fmt.Errorf("couldn't prepare overwrites: %w", err)
+	}
+
+	err = e.connectDocker()
 	if err != nil {
 		return err
 	}
@@ -1130,6 +1180,16 @@ func (e *executor) Prepare(options common.ExecutorPrepareOptions) error {
 	return nil
 }
 
+func (e *executor) prepareOverwrites(variables common.JobVariables) error {
+	values, err := createOverwrites(e.Config.Docker, variables, e.BuildLogger)
+	if err != nil {
+		return err
+	}
+
+	e.Config.Docker = values.apply(e.Config.Docker)
+	return nil
+}
+
 func (e *executor) prepareBuildsDir(options common.ExecutorPrepareOptions) error {
 	if e.volumeParser == nil {
 		return common.MakeBuildError("missing volume parser")
@@ -1183,6 +1243,8 @@ func (e *executor) Cleanup() {
 		volumeLogger.Errorln("Failed to cleanup volumes")
 	}
 
+	e.stopEgressProxy()
+
 	err = e.cleanupNetwork(ctx)
 	if err != nil {
 		networkLogger := e.WithFields(logrus.Fields{
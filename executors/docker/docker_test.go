@@ -1445,6 +1445,80 @@ func TestDockerCPUSetCPUsSetting(t *testing.T) {
 	testDockerConfigurationWithJobContainer(t, dockerConfig, cce)
 }
 
+func TestDockerServiceResourcesSetting(t *testing.T) {
+	dockerConfig := &common.DockerConfig{
+		ServiceMemory:            "128m",
+		ServiceMemorySwap:        "256m",
+		ServiceMemoryReservation: "64m",
+		ServiceCPUSetCPUs:        "0-1",
+		ServiceCPUS:              "1/2",
+		ServiceCPUShares:         512,
+		ServiceOomKillDisable:    true,
+	}
+
+	cce := func(t *testing.T, config *container.Config, hostConfig *container.HostConfig) {
+		assert.Equal(t, int64(134217728), hostConfig.Memory)
+		assert.Equal(t, int64(268435456), hostConfig.MemorySwap)
+		assert.Equal(t, int64(67108864), hostConfig.MemoryReservation)
+		assert.Equal(t, "0-1", hostConfig.CpusetCpus)
+		assert.Equal(t, int64(500000000), hostConfig.NanoCPUs)
+		assert.Equal(t, int64(512), hostConfig.CPUShares)
+		require.NotNil(t, hostConfig.OomKillDisable)
+		assert.True(t, *hostConfig.OomKillDisable)
+	}
+
+	testDockerConfigurationWithServiceContainer(t, dockerConfig, cce)
+}
+
+func TestDockerServiceResourcesNotInheritedFromBuildContainer(t *testing.T) {
+	dockerConfig := &common.DockerConfig{
+		Memory:      "128m",
+		CPUS:        "2",
+		CapAdd:      []string{"NET_ADMIN"},
+		SecurityOpt: []string{"seccomp:unconfined"},
+	}
+
+	cce := func(t *testing.T, config *container.Config, hostConfig *container.HostConfig) {
+		assert.Zero(t, hostConfig.Memory)
+		assert.Zero(t, hostConfig.NanoCPUs)
+		assert.Empty(t, hostConfig.CapAdd)
+		assert.Empty(t, hostConfig.SecurityOpt)
+	}
+
+	testDockerConfigurationWithServiceContainer(t, dockerConfig, cce)
+}
+
+func TestDockerServiceSecuritySetting(t *testing.T) {
+	dockerConfig := &common.DockerConfig{
+		ServiceCapAdd:      []string{"NET_ADMIN"},
+		ServiceCapDrop:     []string{"ALL"},
+		ServiceSecurityOpt: []string{"no-new-privileges"},
+	}
+
+	cce := func(t *testing.T, config *container.Config, hostConfig *container.HostConfig) {
+		assert.Equal(t, []string{"NET_ADMIN"}, []string(hostConfig.CapAdd))
+		assert.Equal(t, []string{"ALL"}, []string(hostConfig.CapDrop))
+		assert.Equal(t, []string{"no-new-privileges"}, hostConfig.SecurityOpt)
+	}
+
+	testDockerConfigurationWithServiceContainer(t, dockerConfig, cce)
+}
+
+func TestDockerServiceInvalidCPUSSetting(t *testing.T) {
+	e := &executor{
+		AbstractExecutor: executors.AbstractExecutor{
+			Config: common.RunnerConfig{
+				RunnerSettings: common.RunnerSettings{
+					Docker: &common.DockerConfig{ServiceCPUS: "invalid"},
+				},
+			},
+		},
+	}
+
+	_, err := e.createHostConfigForService()
+	assert.Error(t, err)
+}
+
 func TestDockerServicesTmpfsSetting(t *testing.T) {
 	dockerConfig := &common.DockerConfig{
 		ServicesTmpfs: map[string]string{
@@ -0,0 +1,166 @@
+package docker
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/egress"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/container/services"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/featureflags"
+)
+
+func (e *executor) startEgressProxy() error {
+	config := e.Config.Docker.EgressProxy
+	if config == nil {
+		return nil
+	}
+
+	if e.networksManager == nil {
+		return errNetworksManagerUndefined
+	}
+
+	network, err := e.networksManager.Inspect(e.Context)
+	if err != nil {
+		return fmt.Errorf("inspecting build network: %w", err)
+	}
+
+	gateway := networkGateway(network)
+	if gateway == "" {
+		return common.MakeBuildError(
+			"egress proxy requires a network created for each build, enable the %s feature flag",
+			featureflags.NetworkPerBuild,
+		)
+	}
+
+	auditLog, err := e.openEgressAuditLog(config.AuditLogDir)
+	if err != nil {
+		return err
+	}
+
+	var allowedDomains []string
+	allowedDomains = append(allowedDomains, config.AllowedDomains...)
+	allowedDomains = append(allowedDomains, e.egressRunnerHosts()...)
+
+	proxy := egress.NewProxy(&e.BuildLogger, egress.Config{
+		AllowedDomains: allowedDomains,
+		AuditLog:       auditLog,
+	})
+
+	err = proxy.Start(net.JoinHostPort(gateway, "0"))
+	if err != nil {
+		if auditLog != nil {
+			_ = auditLog.Close()
+		}
+		return fmt.Errorf("starting egress proxy: %w", err)
+	}
+
+	e.egressProxy = proxy
+	e.egressAuditLog = auditLog
+
+	noProxy, err := e.egressNoProxyHosts()
+	if err != nil {
+		return err
+	}
+
+	proxyURL := "http://" + proxy.Addr()
+	e.egressProxyEnv = []string{
+		"HTTP_PROXY=" + proxyURL,
+		"HTTPS_PROXY=" + proxyURL,
+		"NO_PROXY=" + noProxy,
+		"http_proxy=" + proxyURL,
+		"https_proxy=" + proxyURL,
+		"no_proxy=" + noProxy,
+	}
+
+	e.Println("Using egress proxy", proxyURL, "...")
+
+	return nil
+}
+
+func networkGateway(network types.NetworkResource) string {
+	for _, config := range network.IPAM.Config {
+		if config.Gateway != "" {
+			return config.Gateway
+		}
+	}
+
+	return ""
+}
+
+func (e *executor) openEgressAuditLog(dir string) (io.WriteCloser, error) {
+	if dir == "" {
+		return nil, nil
+	}
+
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("creating egress audit log directory: %w", err)
+	}
+
+	name := filepath.Join(dir, fmt.Sprintf("%s-job-%d-egress.log", e.Build.ProjectUniqueName(), e.Build.ID))
+
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("opening egress audit log: %w", err)
+	}
+
+	return file, nil
+}
+
+// egressRunnerHosts returns the hosts of the GitLab instance, which always need
+// to be reachable for the job to clone the repository and upload artifacts
+func (e *executor) egressRunnerHosts() []string {
+	var hosts []string
+
+	for _, rawURL := range []string{e.Config.URL, e.Config.CloneURL} {
+		u, err := url.Parse(rawURL)
+		if err != nil || u.Hostname() == "" {
+			continue
+		}
+
+		hosts = append(hosts, u.Hostname())
+	}
+
+	return hosts
+}
+
+// egressNoProxyHosts returns the hosts that must be reached directly, without
+// the egress proxy: the loopback interface and the services of the build
+func (e *executor) egressNoProxyHosts() (string, error) {
+	hosts := []string{"localhost", "127.0.0.1"}
+
+	definitions, err := e.getServicesDefinitions()
+	if err != nil {
+		return "", err
+	}
+
+	for _, definition := range definitions {
+		hosts = append(hosts, services.SplitNameAndVersion(definition.Name).Aliases...)
+		if definition.Alias != "" {
+			hosts = append(hosts, definition.Alias)
+		}
+	}
+
+	return strings.Join(hosts, ","), nil
+}
+
+func (e *executor) stopEgressProxy() {
+	if e.egressProxy != nil {
+		err := e.egressProxy.Close()
+		if err != nil {
+			e.Debugln("Failed to stop egress proxy:", err)
+		}
+	}
+
+	if e.egressAuditLog != nil {
+		_ = e.egressAuditLog.Close()
+	}
+}
@@ -0,0 +1,112 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/networks"
+)
+
+func newEgressTestExecutor(egressConfig *common.DockerEgressProxy, gateway string) (*executor, *networks.MockManager) {
+	networksManager := new(networks.MockManager)
+	networksManager.On("Inspect", mock.Anything).
+		Return(types.NetworkResource{
+			IPAM: network.IPAM{
+				Config: []network.IPAMConfig{{Gateway: gateway}},
+			},
+		}, nil).
+		Maybe()
+
+	e := &executor{
+		AbstractExecutor: executors.AbstractExecutor{
+			Context: context.Background(),
+			Config: common.RunnerConfig{
+				RunnerCredentials: common.RunnerCredentials{
+					URL: "https://gitlab.example.com/",
+				},
+				RunnerSettings: common.RunnerSettings{
+					Docker: &common.DockerConfig{
+						EgressProxy: egressConfig,
+					},
+				},
+			},
+			Build: &common.Build{
+				JobResponse: common.JobResponse{
+					ID: 1234,
+					Services: common.Services{
+						{Name: "postgres:11", Alias: "db"},
+					},
+				},
+				Runner: &common.RunnerConfig{},
+			},
+		},
+		networksManager: networksManager,
+	}
+
+	return e, networksManager
+}
+
+func TestStartEgressProxyNotConfigured(t *testing.T) {
+	e, networksManager := newEgressTestExecutor(nil, "127.0.0.1")
+	defer networksManager.AssertExpectations(t)
+
+	require.NoError(t, e.startEgressProxy())
+	assert.Nil(t, e.egressProxy)
+	assert.Empty(t, e.egressProxyEnv)
+	networksManager.AssertNotCalled(t, "Inspect", mock.Anything)
+}
+
+func TestStartEgressProxyRequiresBuildNetwork(t *testing.T) {
+	e, _ := newEgressTestExecutor(&common.DockerEgressProxy{}, "")
+
+	err := e.startEgressProxy()
+
+	var buildErr *common.BuildError
+	assert.True(t, errors.As(err, &buildErr), "expected build error, got %v", err)
+	assert.Nil(t, e.egressProxy)
+}
+
+func TestStartEgressProxy(t *testing.T) {
+	auditLogDir, err := ioutil.TempDir("", "egress-audit")
+	require.NoError(t, err)
+	defer os.RemoveAll(auditLogDir)
+
+	e, _ := newEgressTestExecutor(&common.DockerEgressProxy{
+		AllowedDomains: []string{"*.rubygems.org"},
+		AuditLogDir:    auditLogDir,
+	}, "127.0.0.1")
+
+	require.NoError(t, e.startEgressProxy())
+	defer e.stopEgressProxy()
+
+	require.NotNil(t, e.egressProxy)
+	proxyURL := "http://" + e.egressProxy.Addr()
+
+	assert.Contains(t, e.egressProxyEnv, "HTTP_PROXY="+proxyURL)
+	assert.Contains(t, e.egressProxyEnv, "HTTPS_PROXY="+proxyURL)
+	assert.Contains(t, e.egressProxyEnv, "https_proxy="+proxyURL)
+	assert.Contains(t, e.egressProxyEnv, "NO_PROXY=localhost,127.0.0.1,postgres,db")
+
+	matches, err := filepath.Glob(filepath.Join(auditLogDir, "*-job-1234-egress.log"))
+	require.NoError(t, err)
+	assert.Len(t, matches, 1)
+}
+
+func TestEgressRunnerHosts(t *testing.T) {
+	e, _ := newEgressTestExecutor(&common.DockerEgressProxy{}, "")
+	e.Config.CloneURL = "https://clone.example.com:8443"
+
+	assert.Equal(t, []string{"gitlab.example.com", "clone.example.com"}, e.egressRunnerHosts())
+}
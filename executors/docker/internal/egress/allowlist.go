@@ -0,0 +1,62 @@
+package egress
+
+import (
+	"strings"
+)
+
+const wildcardPrefix = "*."
+
+// allowlist matches host names against a list of allowed domains. An entry
+// can be an exact host name (example.com), a wildcard matching all of the
+// subdomains (*.example.com) or a single "*" matching every host.
+type allowlist struct {
+	all      bool
+	exact    map[string]bool
+	suffixes []string
+}
+
+func newAllowlist(domains []string) *allowlist {
+	a := &allowlist{
+		exact: make(map[string]bool),
+	}
+
+	for _, domain := range domains {
+		domain = normalizeHost(domain)
+
+		switch {
+		case domain == "":
+			continue
+		case domain == "*":
+			a.all = true
+		case strings.HasPrefix(domain, wildcardPrefix):
+			a.suffixes = append(a.suffixes, domain[len(wildcardPrefix)-1:])
+		default:
+			a.exact[domain] = true
+		}
+	}
+
+	return a
+}
+
+func (a *allowlist) Allows(host string) bool {
+	if a.all {
+		return true
+	}
+
+	host = normalizeHost(host)
+	if a.exact[host] {
+		return true
+	}
+
+	for _, suffix := range a.suffixes {
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
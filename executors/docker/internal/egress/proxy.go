@@ -0,0 +1,276 @@
+package egress
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const dialTimeout = 30 * time.Second
+
+var errProxyNotStarted = errors.New("egress proxy is not started")
+
+// hopHeaders are removed from the forwarded requests and responses,
+// as they are meaningful only for a single transport-level connection
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+type Config struct {
+	// AllowedDomains is the list of hosts the build may connect to
+	AllowedDomains []string
+	// AuditLog receives one JSON document per requested host. It's optional
+	AuditLog io.Writer
+}
+
+type auditEntry struct {
+	Time    time.Time `json:"time"`
+	Method  string    `json:"method"`
+	Host    string    `json:"host"`
+	Allowed bool      `json:"allowed"`
+}
+
+// Proxy is an HTTP proxy, supporting both plain HTTP requests and HTTPS
+// tunnels created with CONNECT, that allows connections only to the
+// allowlisted hosts
+type Proxy struct {
+	logger    logger
+	allowlist *allowlist
+	transport http.RoundTripper
+	dialer    *net.Dialer
+
+	auditLog  io.Writer
+	auditLock sync.Mutex
+
+	listener net.Listener
+	server   *http.Server
+
+	tunnels     map[net.Conn]struct{}
+	tunnelsLock sync.Mutex
+}
+
+func NewProxy(logger logger, config Config) *Proxy {
+	dialer := &net.Dialer{Timeout: dialTimeout}
+
+	return &Proxy{
+		logger:    logger,
+		allowlist: newAllowlist(config.AllowedDomains),
+		auditLog:  config.AuditLog,
+		dialer:    dialer,
+		transport: &http.Transport{
+			Proxy:       nil,
+			DialContext: dialer.DialContext,
+		},
+		tunnels: make(map[net.Conn]struct{}),
+	}
+}
+
+// Start starts listening on the provided address. Use port 0 to
+// get a random port assigned, which can be read with Addr()
+func (p *Proxy) Start(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("listening on %q: %w", address, err)
+	}
+
+	p.listener = listener
+	p.server = &http.Server{Handler: p}
+
+	go func() {
+		err := p.server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			p.logger.Debugln("Egress proxy stopped with error:", err)
+		}
+	}()
+
+	return nil
+}
+
+func (p *Proxy) Addr() string {
+	if p.listener == nil {
+		return ""
+	}
+
+	return p.listener.Addr().String()
+}
+
+// Close stops the proxy and terminates all of the open tunnels
+func (p *Proxy) Close() error {
+	if p.server == nil {
+		return errProxyNotStarted
+	}
+
+	err := p.server.Close()
+
+	p.tunnelsLock.Lock()
+	defer p.tunnelsLock.Unlock()
+
+	for conn := range p.tunnels {
+		_ = conn.Close()
+	}
+
+	return err
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if r.Method != http.MethodConnect {
+		host = r.URL.Host
+	}
+
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+
+	allowed := p.allowlist.Allows(hostname)
+	p.audit(r.Method, host, allowed)
+
+	if !allowed {
+		p.logger.Warningln(fmt.Sprintf("Egress proxy denied connection to %q", host))
+		http.Error(w, fmt.Sprintf("connection to %q is not allowed", host), http.StatusForbidden)
+		return
+	}
+
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, host)
+		return
+	}
+
+	if !r.URL.IsAbs() {
+		http.Error(w, "only proxy requests are supported", http.StatusBadRequest)
+		return
+	}
+
+	p.forward(w, r)
+}
+
+func (p *Proxy) audit(method string, host string, allowed bool) {
+	if p.auditLog == nil {
+		return
+	}
+
+	entry, err := json.Marshal(auditEntry{
+		Time:    time.Now().UTC(),
+		Method:  method,
+		Host:    host,
+		Allowed: allowed,
+	})
+	if err != nil {
+		return
+	}
+
+	p.auditLock.Lock()
+	defer p.auditLock.Unlock()
+
+	_, err = p.auditLog.Write(append(entry, '\n'))
+	if err != nil {
+		p.logger.Debugln("Failed to write egress audit log entry:", err)
+	}
+}
+
+func (p *Proxy) tunnel(w http.ResponseWriter, host string) {
+	upstream, err := p.dialer.Dial("tcp", host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		_ = upstream.Close()
+		http.Error(w, "connection hijacking is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	client, buf, err := hijacker.Hijack()
+	if err != nil {
+		_ = upstream.Close()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_, err = client.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+	if err != nil {
+		_ = upstream.Close()
+		_ = client.Close()
+		return
+	}
+
+	p.trackTunnel(client, upstream)
+
+	go func() {
+		// the client could have sent data together with the CONNECT request
+		_, _ = io.Copy(upstream, buf)
+		_ = upstream.Close()
+	}()
+
+	go func() {
+		_, _ = io.Copy(client, upstream)
+		_ = client.Close()
+		p.untrackTunnel(client, upstream)
+	}()
+}
+
+func (p *Proxy) trackTunnel(conns ...net.Conn) {
+	p.tunnelsLock.Lock()
+	defer p.tunnelsLock.Unlock()
+
+	for _, conn := range conns {
+		p.tunnels[conn] = struct{}{}
+	}
+}
+
+func (p *Proxy) untrackTunnel(conns ...net.Conn) {
+	p.tunnelsLock.Lock()
+	defer p.tunnelsLock.Unlock()
+
+	for _, conn := range conns {
+		delete(p.tunnels, conn)
+	}
+}
+
+func (p *Proxy) forward(w http.ResponseWriter, r *http.Request) {
+	outReq := r.Clone(r.Context())
+	outReq.RequestURI = ""
+	// the Host header must match the allowed host, or the job could reach
+	// any virtual host of a shared front end
+	outReq.Host = r.URL.Host
+	removeHopHeaders(outReq.Header)
+
+	resp, err := p.transport.RoundTrip(outReq)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	removeHopHeaders(resp.Header)
+	for key, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
+}
+
+func removeHopHeaders(header http.Header) {
+	for _, h := range hopHeaders {
+		header.Del(h)
+	}
+}
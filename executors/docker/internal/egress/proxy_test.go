@@ -0,0 +1,244 @@
+package egress
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllowlist(t *testing.T) {
+	a := newAllowlist([]string{"gitlab.example.com", "*.rubygems.org", " Registry.NPMjs.org. ", ""})
+
+	tests := map[string]bool{
+		"gitlab.example.com":       true,
+		"GITLAB.example.com":       true,
+		"other.gitlab.example.com": false,
+		"example.com":              false,
+		"index.rubygems.org":       true,
+		"a.b.rubygems.org":         true,
+		"rubygems.org":             false,
+		"evilrubygems.org":         false,
+		"registry.npmjs.org":       true,
+		"":                         false,
+	}
+
+	for host, expected := range tests {
+		t.Run(host, func(t *testing.T) {
+			assert.Equal(t, expected, a.Allows(host))
+		})
+	}
+}
+
+func TestAllowlistAll(t *testing.T) {
+	a := newAllowlist([]string{"*"})
+
+	assert.True(t, a.Allows("anything.example.com"))
+}
+
+type syncBuffer struct {
+	buf  bytes.Buffer
+	lock sync.Mutex
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) entries(t *testing.T) []auditEntry {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	var entries []auditEntry
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+
+		var entry auditEntry
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+func startTestProxy(t *testing.T, allowed ...string) (*Proxy, *syncBuffer, *mockLogger) {
+	logger := new(mockLogger)
+	logger.On("Debugln", mock.Anything, mock.Anything).Maybe()
+	logger.On("Warningln", mock.Anything).Maybe()
+
+	auditLog := new(syncBuffer)
+
+	p := NewProxy(logger, Config{AllowedDomains: allowed, AuditLog: auditLog})
+	require.NoError(t, p.Start("127.0.0.1:0"))
+
+	return p, auditLog, logger
+}
+
+func newProxiedClient(t *testing.T, p *Proxy) *http.Client {
+	proxyURL, err := url.Parse("http://" + p.Addr())
+	require.NoError(t, err)
+
+	return &http.Client{
+		Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)},
+	}
+}
+
+func TestProxyForwardsAllowedRequests(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("Proxy-Connection"))
+		_, _ = fmt.Fprint(w, "hello")
+	}))
+	defer upstream.Close()
+
+	p, auditLog, _ := startTestProxy(t, "127.0.0.1")
+	defer p.Close()
+
+	resp, err := newProxiedClient(t, p).Get(upstream.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "hello", string(body))
+
+	entries := auditLog.entries(t)
+	require.Len(t, entries, 1)
+	assert.Equal(t, http.MethodGet, entries[0].Method)
+	assert.Equal(t, strings.TrimPrefix(upstream.URL, "http://"), entries[0].Host)
+	assert.True(t, entries[0].Allowed)
+}
+
+func TestProxyOverwritesHostHeader(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, r.Host)
+	}))
+	defer upstream.Close()
+
+	p, _, _ := startTestProxy(t, "127.0.0.1")
+	defer p.Close()
+
+	// the HTTP client would use the Host header in the request line, so the
+	// request is written by hand
+	conn, err := net.Dial("tcp", p.Addr())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = fmt.Fprintf(conn, "GET %s/ HTTP/1.1\r\nHost: blocked.example.com\r\n\r\n", upstream.URL)
+	require.NoError(t, err)
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, strings.TrimPrefix(upstream.URL, "http://"), string(body))
+}
+
+func TestProxyDeniesNotAllowedRequests(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request should not reach the upstream server")
+	}))
+	defer upstream.Close()
+
+	p, auditLog, logger := startTestProxy(t, "gitlab.example.com")
+	defer p.Close()
+
+	resp, err := newProxiedClient(t, p).Get(upstream.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	entries := auditLog.entries(t)
+	require.Len(t, entries, 1)
+	assert.False(t, entries[0].Allowed)
+	logger.AssertCalled(t, "Warningln", mock.Anything)
+}
+
+func TestProxyTunnelsAllowedConnect(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, "secure hello")
+	}))
+	defer upstream.Close()
+
+	p, auditLog, _ := startTestProxy(t, "127.0.0.1")
+	defer p.Close()
+
+	client := upstream.Client()
+	proxyURL, err := url.Parse("http://" + p.Addr())
+	require.NoError(t, err)
+	client.Transport.(*http.Transport).Proxy = http.ProxyURL(proxyURL)
+
+	resp, err := client.Get(upstream.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "secure hello", string(body))
+
+	entries := auditLog.entries(t)
+	require.Len(t, entries, 1)
+	assert.Equal(t, http.MethodConnect, entries[0].Method)
+	assert.True(t, entries[0].Allowed)
+}
+
+func TestProxyDeniesNotAllowedConnect(t *testing.T) {
+	p, auditLog, _ := startTestProxy(t, "gitlab.example.com")
+	defer p.Close()
+
+	conn, err := net.Dial("tcp", p.Addr())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = fmt.Fprint(conn, "CONNECT evil.example.com:443 HTTP/1.1\r\nHost: evil.example.com:443\r\n\r\n")
+	require.NoError(t, err)
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	entries := auditLog.entries(t)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "evil.example.com:443", entries[0].Host)
+	assert.False(t, entries[0].Allowed)
+}
+
+func TestProxyRejectsNonProxyRequests(t *testing.T) {
+	p, _, _ := startTestProxy(t, "*")
+	defer p.Close()
+
+	resp, err := http.Get("http://" + p.Addr() + "/path")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestProxyCloseNotStarted(t *testing.T) {
+	p := NewProxy(new(mockLogger), Config{})
+
+	assert.Equal(t, errProxyNotStarted, p.Close())
+	assert.Empty(t, p.Addr())
+}
@@ -0,0 +1,6 @@
+package egress
+
+type logger interface {
+	Debugln(args ...interface{})
+	Warningln(args ...interface{})
+}
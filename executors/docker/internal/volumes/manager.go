@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/volume"
 
 	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/volumes/parser"
@@ -27,11 +28,19 @@ type ManagerConfig struct {
 	UniqueName       string
 	DisableCache     bool
 	PermissionSetter permission.Setter
+
+	// Driver and DriverOpts are used when creating the cache and build volumes,
+	// e.g. to limit their size when the volume driver supports it
+	Driver     string
+	DriverOpts map[string]string
+	// IgnoreUnsupportedDriverOpts makes the manager fall back to creating the volume
+	// without DriverOpts, instead of failing, when the driver rejects them
+	IgnoreUnsupportedDriverOpts bool
 }
 
 type manager struct {
 	config           ManagerConfig
-	logger           debugLogger
+	logger           logger
 	parser           parser.Parser
 	client           docker.Client
 	permissionSetter permission.Setter
@@ -41,7 +50,7 @@ type manager struct {
 	managedVolumes   pathList
 }
 
-func NewManager(logger debugLogger, volumeParser parser.Parser, c docker.Client, config ManagerConfig) Manager {
+func NewManager(logger logger, volumeParser parser.Parser, c docker.Client, config ManagerConfig) Manager {
 	return &manager{
 		config:           config,
 		logger:           logger,
@@ -173,10 +182,12 @@ func (m *manager) createCacheVolume(ctx context.Context, destination string) (st
 
 	volumeName := fmt.Sprintf("%s-cache-%s", m.config.UniqueName, hashPath(destination))
 	vBody := volume.VolumeCreateBody{
-		Name: volumeName,
+		Name:       volumeName,
+		Driver:     m.config.Driver,
+		DriverOpts: m.config.DriverOpts,
 	}
 
-	v, err := m.client.VolumeCreate(ctx, vBody)
+	v, err := m.createVolume(ctx, vBody)
 	if err != nil {
 		return "", fmt.Errorf("creating docker volume: %w", err)
 	}
@@ -197,6 +208,27 @@ func (m *manager) createCacheVolume(ctx context.Context, destination string) (st
 	return volumeName, nil
 }
 
+func (m *manager) createVolume(ctx context.Context, vBody volume.VolumeCreateBody) (types.Volume, error) {
+	v, err := m.client.VolumeCreate(ctx, vBody)
+	if err == nil || len(vBody.DriverOpts) == 0 || !isUnsupportedDriverOptsError(err) {
+		return v, err
+	}
+
+	if !m.config.IgnoreUnsupportedDriverOpts {
+		return v, &ErrUnsupportedDriverOpts{driver: vBody.Driver, inner: err}
+	}
+
+	m.logger.Warningln(fmt.Sprintf(
+		"Volume driver options are not supported, creating volume %q without them: %v",
+		vBody.Name,
+		err,
+	))
+
+	vBody.DriverOpts = nil
+
+	return m.client.VolumeCreate(ctx, vBody)
+}
+
 // CreateTemporary will create a volume, and mark it as temporary. When a volume
 // is marked as temporary it means that it should be cleaned up at some point.
 // It's up to the caller to clean up the temporary volumes by calling
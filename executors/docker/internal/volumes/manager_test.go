@@ -17,8 +17,8 @@ import (
 	"gitlab.com/gitlab-org/gitlab-runner/helpers/path"
 )
 
-func newDebugLoggerMock() *mockDebugLogger {
-	loggerMock := new(mockDebugLogger)
+func newLoggerMock() *mockLogger {
+	loggerMock := new(mockLogger)
 	loggerMock.On("Debugln", mock.Anything)
 
 	return loggerMock
@@ -30,7 +30,7 @@ func TestErrVolumeAlreadyDefined(t *testing.T) {
 }
 
 func TestNewDefaultManager(t *testing.T) {
-	logger := newDebugLoggerMock()
+	logger := newLoggerMock()
 
 	m := NewManager(logger, nil, nil, ManagerConfig{})
 	assert.IsType(t, &manager{}, m)
@@ -38,7 +38,7 @@ func TestNewDefaultManager(t *testing.T) {
 
 func newDefaultManager(config ManagerConfig) *manager {
 	m := &manager{
-		logger:         newDebugLoggerMock(),
+		logger:         newLoggerMock(),
 		config:         config,
 		managedVolumes: make(map[string]bool),
 	}
@@ -462,6 +462,108 @@ func TestDefaultManager_CreateUserVolumes_CacheVolume_VolumeBased_WithError(t *t
 	assert.True(t, errors.Is(err, testErr), "expected err %T, but got %T", testErr, err)
 }
 
+func TestDefaultManager_CreateUserVolumes_CacheVolume_DriverOpts(t *testing.T) {
+	unsupportedErr := errors.New("Error response from daemon: create volume: invalid option key: \"size\"")
+	daemonErr := errors.New("Error response from daemon: connection refused")
+	driverOpts := map[string]string{"size": "10G"}
+
+	testCases := map[string]struct {
+		ignoreUnsupported bool
+		volumeCreateErr   error
+		expectedError     error
+		expectedFallback  bool
+	}{
+		"driver options supported": {},
+		"driver options unsupported": {
+			volumeCreateErr: unsupportedErr,
+			expectedError:   new(ErrUnsupportedDriverOpts),
+		},
+		"driver options unsupported and ignored": {
+			ignoreUnsupported: true,
+			volumeCreateErr:   unsupportedErr,
+			expectedFallback:  true,
+		},
+		"volume creation failed for another reason": {
+			volumeCreateErr: daemonErr,
+			expectedError:   daemonErr,
+		},
+		"volume creation failed for another reason with unsupported ignored": {
+			ignoreUnsupported: true,
+			volumeCreateErr:   context.Canceled,
+			expectedError:     context.Canceled,
+		},
+	}
+
+	for testName, testCase := range testCases {
+		t.Run(testName, func(t *testing.T) {
+			config := ManagerConfig{
+				BasePath:                    "/builds/project",
+				UniqueName:                  "unique",
+				Driver:                      "quota-driver",
+				DriverOpts:                  driverOpts,
+				IgnoreUnsupportedDriverOpts: testCase.ignoreUnsupported,
+			}
+
+			m := newDefaultManager(config)
+			logger := new(mockLogger)
+			logger.On("Debugln", mock.Anything).Maybe()
+			m.logger = logger
+			volumeParser := addParser(m)
+			mClient := new(docker.MockClient)
+			m.client = mClient
+
+			defer func() {
+				mClient.AssertExpectations(t)
+				volumeParser.AssertExpectations(t)
+				logger.AssertExpectations(t)
+			}()
+
+			mClient.On(
+				"VolumeCreate",
+				mock.Anything,
+				mock.MatchedBy(func(v volume.VolumeCreateBody) bool {
+					return v.Driver == "quota-driver" && v.DriverOpts["size"] == "10G"
+				}),
+			).
+				Return(types.Volume{Name: "unique-cache-f69aef9fb01e88e6213362a04877452d"}, testCase.volumeCreateErr).
+				Once()
+
+			if testCase.expectedFallback {
+				logger.On("Warningln", mock.Anything).Once()
+				mClient.On(
+					"VolumeCreate",
+					mock.Anything,
+					mock.MatchedBy(func(v volume.VolumeCreateBody) bool {
+						return v.Driver == "quota-driver" && v.DriverOpts == nil
+					}),
+				).
+					Return(types.Volume{Name: "unique-cache-f69aef9fb01e88e6213362a04877452d"}, nil).
+					Once()
+			}
+
+			volumeParser.On("ParseVolume", "volume").
+				Return(&parser.Volume{Destination: "volume"}, nil).
+				Once()
+
+			err := m.Create(context.Background(), "volume")
+			if testCase.expectedError != nil {
+				assert.True(
+					t,
+					errors.Is(err, testCase.expectedError),
+					"expected err %T, but got %T",
+					testCase.expectedError,
+					err,
+				)
+				assert.True(t, errors.Is(err, testCase.volumeCreateErr))
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"unique-cache-f69aef9fb01e88e6213362a04877452d:/builds/project/volume"}, m.Binds())
+		})
+	}
+}
+
 func TestDefaultManager_CreateUserVolumes_ParserError(t *testing.T) {
 	testErr := errors.New("parser-test-error")
 	m := newDefaultManager(ManagerConfig{})
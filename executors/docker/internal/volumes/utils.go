@@ -5,6 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/errdefs"
 
 	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/volumes/parser"
 )
@@ -14,8 +17,9 @@ var (
 	errDirectoryIsRootPath  = errors.New("build directory needs to be a non-root path")
 )
 
-type debugLogger interface {
+type logger interface {
 	Debugln(args ...interface{})
+	Warningln(args ...interface{})
 }
 
 func IsHostMountedVolume(volumeParser parser.Parser, dir string, volumes ...string) (bool, error) {
@@ -67,6 +71,57 @@ func NewErrVolumeAlreadyDefined(containerPath string) *ErrVolumeAlreadyDefined {
 	}
 }
 
+// ErrUnsupportedDriverOpts is returned when the volume driver rejected
+// the configured driver options
+type ErrUnsupportedDriverOpts struct {
+	driver string
+	inner  error
+}
+
+func (e *ErrUnsupportedDriverOpts) Error() string {
+	driver := e.driver
+	if driver == "" {
+		driver = "default"
+	}
+
+	return fmt.Sprintf("volume driver options not supported by the %s volume driver: %v", driver, e.inner)
+}
+
+func (e *ErrUnsupportedDriverOpts) Is(err error) bool {
+	_, ok := err.(*ErrUnsupportedDriverOpts)
+	return ok
+}
+
+func (e *ErrUnsupportedDriverOpts) Unwrap() error {
+	return e.inner
+}
+
+// unsupportedDriverOptsMessages are the messages with which the volume drivers
+// reject driver options they don't support, e.g. the local driver's
+// `invalid option key: "size"`
+var unsupportedDriverOptsMessages = []string{
+	"invalid option",
+	"options are not supported",
+	"not supported. filesystem does not support project quota",
+}
+
+// isUnsupportedDriverOptsError checks whether the daemon refused to create
+// a volume because the driver doesn't support the given driver options
+func isUnsupportedDriverOptsError(err error) bool {
+	if errdefs.IsInvalidParameter(err) {
+		return true
+	}
+
+	message := strings.ToLower(err.Error())
+	for _, m := range unsupportedDriverOptsMessages {
+		if strings.Contains(message, m) {
+			return true
+		}
+	}
+
+	return false
+}
+
 type pathList map[string]bool
 
 func (m pathList) Add(path string) error {
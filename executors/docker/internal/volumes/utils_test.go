@@ -1,9 +1,12 @@
 package volumes
 
 import (
+	"context"
+	"errors"
 	"path/filepath"
 	"testing"
 
+	"github.com/docker/docker/errdefs"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -97,3 +100,38 @@ func TestManagedList_Add(t *testing.T) {
 		})
 	}
 }
+
+func TestIsUnsupportedDriverOptsError(t *testing.T) {
+	tests := map[string]struct {
+		err      error
+		expected bool
+	}{
+		"local driver invalid option": {
+			err:      errors.New(`Error response from daemon: create volume: invalid option key: "size"`),
+			expected: true,
+		},
+		"options not supported on platform": {
+			err:      errors.New("Error response from daemon: options are not supported on this platform"),
+			expected: true,
+		},
+		"invalid parameter": {
+			err:      errdefs.InvalidParameter(errors.New("size is not valid")),
+			expected: true,
+		},
+		"conflict": {
+			err: errors.New("Error response from daemon: volume name conflict"),
+		},
+		"daemon unreachable": {
+			err: errors.New("Cannot connect to the Docker daemon at unix:///var/run/docker.sock"),
+		},
+		"context canceled": {
+			err: context.Canceled,
+		},
+	}
+
+	for testName, test := range tests {
+		t.Run(testName, func(t *testing.T) {
+			assert.Equal(t, test.expected, isUnsupportedDriverOptsError(test.err))
+		})
+	}
+}
@@ -62,6 +62,12 @@ func (m *machineProvider) Collect(ch chan<- prometheus.Metric) {
 		float64(data.StuckOnRemoving),
 		"stuck-on-removing",
 	)
+	ch <- prometheus.MustNewConstMetric(
+		m.currentStatesDesc,
+		prometheus.GaugeValue,
+		float64(data.Quarantined),
+		"quarantined",
+	)
 
 	m.totalActions.Collect(ch)
 	m.creationHistogram.Collect(ch)
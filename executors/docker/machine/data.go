@@ -16,6 +16,7 @@ type machinesData struct {
 	Used            int
 	Removing        int
 	StuckOnRemoving int
+	Quarantined     int
 }
 
 func (d *machinesData) Available() int {
@@ -23,7 +24,7 @@ func (d *machinesData) Available() int {
 }
 
 func (d *machinesData) Total() int {
-	return d.Acquired + d.Creating + d.Idle + d.Used + d.Removing + d.StuckOnRemoving
+	return d.Acquired + d.Creating + d.Idle + d.Used + d.Removing + d.StuckOnRemoving + d.Quarantined
 }
 
 func (d *machinesData) Add(details *machineDetails) {
@@ -46,17 +47,21 @@ func (d *machinesData) Add(details *machineDetails) {
 		} else {
 			d.Removing++
 		}
+
+	case machineStateQuarantined:
+		d.Quarantined++
 	}
 }
 
 func (d *machinesData) Fields() logrus.Fields {
 	return logrus.Fields{
-		"runner":   d.Runner,
-		"used":     d.Used,
-		"idle":     d.Idle,
-		"total":    d.Total(),
-		"creating": d.Creating,
-		"removing": d.Removing,
+		"runner":      d.Runner,
+		"used":        d.Used,
+		"idle":        d.Idle,
+		"total":       d.Total(),
+		"creating":    d.Creating,
+		"removing":    d.Removing,
+		"quarantined": d.Quarantined,
 	}
 }
 
@@ -79,5 +84,6 @@ func (d *machinesData) writeDebugInformation() {
 		"idle", d.Idle,
 		"used", d.Used,
 		"removing", d.Removing,
+		"quarantined", d.Quarantined,
 	)
 }
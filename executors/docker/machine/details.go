@@ -19,6 +19,15 @@ type machineDetails struct {
 	Reason     string
 	RetryCount int
 	LastSeen   time.Time
+
+	LastHealthCheck       time.Time `yaml:"-"`
+	LastInterruptionCheck time.Time `yaml:"-"`
+	SystemFailures        int
+	Retired               bool
+	Interrupted           bool
+
+	// interrupted is closed when the machine is interrupted
+	interrupted chan struct{}
 }
 
 func (m *machineDetails) isPersistedOnDisk() bool {
@@ -0,0 +1,351 @@
+package machine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-units"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker"
+)
+
+const (
+	healthCheckLabel   = "com.gitlab.gitlab-runner.type"
+	healthCheckRootDir = "/docker-root"
+)
+
+// machineHealthChecker checks whether a machine can keep running jobs
+type machineHealthChecker interface {
+	Check(ctx context.Context, credentials docker.Credentials, config *common.DockerMachineHealthCheck) error
+}
+
+type dockerHealthChecker struct {
+	newClient func(credentials docker.Credentials) (docker.Client, error)
+}
+
+func newDockerHealthChecker() *dockerHealthChecker {
+	return &dockerHealthChecker{
+		newClient: func(credentials docker.Credentials) (docker.Client, error) {
+			return docker.New(credentials, "")
+		},
+	}
+}
+
+func (c *dockerHealthChecker) Check(
+	ctx context.Context,
+	credentials docker.Credentials,
+	config *common.DockerMachineHealthCheck,
+) error {
+	client, err := c.newClient(credentials)
+	if err != nil {
+		return fmt.Errorf("connecting to Docker: %w", err)
+	}
+	defer func() { _ = client.Close() }()
+
+	info, err := client.Info(ctx)
+	if err != nil {
+		return fmt.Errorf("docker is not responding: %w", err)
+	}
+
+	err = c.checkFreeDiskSpace(ctx, client, config, info.DockerRootDir)
+	if err != nil {
+		return err
+	}
+
+	err = c.checkFreeInodes(ctx, client, config, info.DockerRootDir)
+	if err != nil {
+		return err
+	}
+
+	if len(config.Command) == 0 {
+		return nil
+	}
+
+	exitCode, output, err := runHealthCheckContainer(ctx, client, config.GetImage(), config.Command, nil)
+	if err != nil {
+		return fmt.Errorf("running health check command: %w", err)
+	}
+
+	if exitCode != 0 {
+		return fmt.Errorf("health check command exited with code %d: %s", exitCode, strings.TrimSpace(output))
+	}
+
+	return nil
+}
+
+func (c *dockerHealthChecker) checkFreeDiskSpace(
+	ctx context.Context,
+	client docker.Client,
+	config *common.DockerMachineHealthCheck,
+	rootDir string,
+) error {
+	minFreeDiskSpace, err := config.GetMinFreeDiskSpace()
+	if err != nil || minFreeDiskSpace <= 0 {
+		return err
+	}
+
+	freeKB, err := availableInRootDir(ctx, client, config, rootDir, "-Pk")
+	if err != nil {
+		return fmt.Errorf("checking free disk space: %w", err)
+	}
+
+	if free := freeKB * 1024; free < minFreeDiskSpace {
+		return fmt.Errorf(
+			"only %s of free disk space left, below %s",
+			units.BytesSize(float64(free)),
+			units.BytesSize(float64(minFreeDiskSpace)),
+		)
+	}
+
+	return nil
+}
+
+func (c *dockerHealthChecker) checkFreeInodes(
+	ctx context.Context,
+	client docker.Client,
+	config *common.DockerMachineHealthCheck,
+	rootDir string,
+) error {
+	if config.MinFreeInodes <= 0 {
+		return nil
+	}
+
+	free, err := availableInRootDir(ctx, client, config, rootDir, "-Pi")
+	if err != nil {
+		return fmt.Errorf("checking free inodes: %w", err)
+	}
+
+	if free < config.MinFreeInodes {
+		return fmt.Errorf("only %d free inodes left, below %d", free, config.MinFreeInodes)
+	}
+
+	return nil
+}
+
+// availableInRootDir runs df in a container mounting the Docker root
+// directory and returns the available column of its output
+func availableInRootDir(
+	ctx context.Context,
+	client docker.Client,
+	config *common.DockerMachineHealthCheck,
+	rootDir string,
+	dfFlags string,
+) (int64, error) {
+	if rootDir == "" {
+		return 0, errors.New("unknown Docker root directory")
+	}
+
+	binds := []string{rootDir + ":" + healthCheckRootDir + ":ro"}
+	cmd := []string{"df", dfFlags, healthCheckRootDir}
+
+	exitCode, output, err := runHealthCheckContainer(ctx, client, config.GetImage(), cmd, binds)
+	if err != nil {
+		return 0, err
+	}
+
+	if exitCode != 0 {
+		return 0, fmt.Errorf("df exited with code %d: %s", exitCode, strings.TrimSpace(output))
+	}
+
+	return parseDfAvailable(output)
+}
+
+// parseDfAvailable returns the fourth column of the POSIX output of df,
+// which is the available space or the free inodes
+func parseDfAvailable(output string) (int64, error) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) < 2 {
+		return 0, fmt.Errorf("unexpected df output: %q", output)
+	}
+
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(fields) < 4 {
+		return 0, fmt.Errorf("unexpected df output: %q", output)
+	}
+
+	return strconv.ParseInt(fields[3], 10, 64)
+}
+
+func runHealthCheckContainer(
+	ctx context.Context,
+	client docker.Client,
+	image string,
+	cmd []string,
+	binds []string,
+) (int64, string, error) {
+	_, _, err := client.ImageInspectWithRaw(ctx, image)
+	if docker.IsErrNotFound(err) {
+		err = client.ImagePullBlocking(ctx, image, types.ImagePullOptions{})
+	}
+	if err != nil {
+		return 0, "", err
+	}
+
+	config := &container.Config{
+		Image:  image,
+		Cmd:    cmd,
+		Labels: map[string]string{healthCheckLabel: "health-check"},
+	}
+
+	resp, err := client.ContainerCreate(ctx, config, &container.HostConfig{Binds: binds}, nil, "")
+	if err != nil {
+		return 0, "", err
+	}
+	defer func() {
+		removeCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		_ = client.ContainerRemove(removeCtx, resp.ID, types.ContainerRemoveOptions{Force: true, RemoveVolumes: true})
+	}()
+
+	err = client.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{})
+	if err != nil {
+		return 0, "", err
+	}
+
+	var exitCode int64
+
+	statusCh, errCh := client.ContainerWait(ctx, resp.ID, container.WaitConditionNotRunning)
+	select {
+	case err = <-errCh:
+		return 0, "", err
+	case status := <-statusCh:
+		exitCode = status.StatusCode
+	}
+
+	logs, err := client.ContainerLogs(ctx, resp.ID, types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true})
+	if err != nil {
+		return 0, "", err
+	}
+	defer func() { _ = logs.Close() }()
+
+	var output bytes.Buffer
+	_, err = stdcopy.StdCopy(&output, &output, logs)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return exitCode, output.String(), nil
+}
+
+// checkMachinesHealth starts the health checks of the idle machines that
+// weren't checked for longer than the health check interval. The machines
+// are acquired for the time of the check, so that no job can use them
+func (m *machineProvider) checkMachinesHealth(config *common.RunnerConfig, machines []string) {
+	healthCheck := config.Machine.HealthCheck
+	if healthCheck == nil || healthCheck.Interval <= 0 {
+		return
+	}
+
+	interval := time.Duration(healthCheck.Interval) * time.Second
+
+	for _, name := range machines {
+		m.lock.RLock()
+		details := m.details[name]
+		due := details != nil && details.State == machineStateIdle && time.Since(details.LastHealthCheck) > interval
+		m.lock.RUnlock()
+
+		if !due {
+			continue
+		}
+
+		details = m.machineDetails(name, true)
+		if details == nil {
+			continue
+		}
+
+		m.lock.Lock()
+		details.LastHealthCheck = time.Now()
+		m.lock.Unlock()
+
+		go m.checkMachineHealth(config, details)
+	}
+}
+
+func (m *machineProvider) checkMachineHealth(config *common.RunnerConfig, details *machineDetails) {
+	healthCheck := config.Machine.HealthCheck
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheck.GetTimeout())
+	defer cancel()
+
+	credentials, err := m.machineFor(config).Credentials(details.Name)
+	if err == nil {
+		err = m.healthChecker.Check(ctx, credentials, healthCheck)
+	}
+
+	if err != nil {
+		m.handleUnhealthyMachine(config, details, fmt.Sprint("health check failed: ", err))
+		return
+	}
+
+	details.logger().Debugln("Machine is healthy")
+	m.lock.Lock()
+	details.State = machineStateIdle
+	m.lock.Unlock()
+}
+
+// recordJobResult counts the consecutive runner system failures of the jobs
+// that ran on the machine
+func (m *machineProvider) recordJobResult(details *machineDetails, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if !isSystemFailure(err) {
+		details.SystemFailures = 0
+		return
+	}
+
+	details.SystemFailures++
+}
+
+func isSystemFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var buildErr *common.BuildError
+	if errors.As(err, &buildErr) {
+		return buildErr.FailureReason == common.RunnerSystemFailure
+	}
+
+	return true
+}
+
+func hasTooManySystemFailures(config *common.RunnerConfig, details *machineDetails) bool {
+	if config == nil || config.Machine == nil || config.Machine.HealthCheck == nil {
+		return false
+	}
+
+	maxSystemFailures := config.Machine.HealthCheck.MaxSystemFailures
+
+	return maxSystemFailures > 0 && details.SystemFailures >= maxSystemFailures
+}
+
+// handleUnhealthyMachine removes or quarantines the machine, depending on the
+// configured health check action
+func (m *machineProvider) handleUnhealthyMachine(config *common.RunnerConfig, details *machineDetails, reason string) {
+	if config.Machine.HealthCheck.GetAction() != common.MachineHealthActionQuarantine {
+		details.logger().WithField("reason", reason).Warningln("Removing unhealthy machine")
+		_ = m.remove(config, details.Name, reason)
+		return
+	}
+
+	m.lock.Lock()
+	details.State = machineStateQuarantined
+	details.Reason = reason
+	details.Used = time.Now()
+	m.lock.Unlock()
+
+	details.logger().Warningln("Quarantining unhealthy machine")
+	details.writeDebugInformation()
+	m.totalActions.WithLabelValues("quarantined").Inc()
+}
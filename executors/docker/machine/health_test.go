@@ -0,0 +1,326 @@
+package machine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker/test"
+)
+
+func TestParseDfAvailable(t *testing.T) {
+	tests := map[string]struct {
+		output        string
+		expected      int64
+		expectedError bool
+	}{
+		"available blocks": {
+			output:   "Filesystem 1024-blocks Used Available Capacity Mounted on\n/dev/sda1 100 60 40 60% /\n",
+			expected: 40,
+		},
+		"wrapped filesystem name": {
+			output:        "Filesystem Inodes IUsed IFree IUse% Mounted on\n/dev/mapper/long\n 100 10 90 10% /\n",
+			expectedError: true,
+		},
+		"missing values": {
+			output:        "Filesystem 1024-blocks Used Available Capacity Mounted on\n",
+			expectedError: true,
+		},
+		"invalid value": {
+			output:        "Filesystem 1024-blocks Used Available Capacity Mounted on\n/dev/sda1 100 60 n/a 60% /\n",
+			expectedError: true,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			available, err := parseDfAvailable(tt.output)
+			if tt.expectedError {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, available)
+		})
+	}
+}
+
+func muxedLogs(t *testing.T, output string) *bytes.Buffer {
+	buf := new(bytes.Buffer)
+	_, err := stdcopy.NewStdWriter(buf, stdcopy.Stdout).Write([]byte(output))
+	require.NoError(t, err)
+
+	return buf
+}
+
+func mockHealthCheckContainer(t *testing.T, c *docker.MockClient, id string, cmd string, exitCode int64, output string) {
+	c.On("ContainerCreate", mock.Anything, mock.MatchedBy(func(config *container.Config) bool {
+		return len(config.Cmd) > 0 && config.Cmd[len(config.Cmd)-2] == cmd
+	}), mock.Anything, mock.Anything, "").
+		Return(container.ContainerCreateCreatedBody{ID: id}, nil).
+		Once()
+	c.On("ContainerStart", mock.Anything, id, mock.Anything).Return(nil).Once()
+	c.On("ContainerWait", mock.Anything, id, container.WaitConditionNotRunning).
+		Return(func(context.Context, string, container.WaitCondition) <-chan container.ContainerWaitOKBody {
+			bodyCh := make(chan container.ContainerWaitOKBody, 1)
+			bodyCh <- container.ContainerWaitOKBody{StatusCode: exitCode}
+			return bodyCh
+		}, nil).
+		Once()
+	c.On("ContainerLogs", mock.Anything, id, mock.Anything).
+		Return(ioutil.NopCloser(muxedLogs(t, output)), nil).
+		Once()
+	c.On("ContainerRemove", mock.Anything, id, types.ContainerRemoveOptions{Force: true, RemoveVolumes: true}).
+		Return(nil).
+		Once()
+}
+
+func TestDockerHealthChecker(t *testing.T) {
+	tests := map[string]struct {
+		config        common.DockerMachineHealthCheck
+		setup         func(t *testing.T, c *docker.MockClient)
+		expectedError string
+	}{
+		"docker not responding": {
+			setup: func(t *testing.T, c *docker.MockClient) {
+				c.On("Info", mock.Anything).Return(types.Info{}, errors.New("connection refused")).Once()
+			},
+			expectedError: "docker is not responding: connection refused",
+		},
+		"only ping": {
+			setup: func(t *testing.T, c *docker.MockClient) {
+				c.On("Info", mock.Anything).Return(types.Info{DockerRootDir: "/var/lib/docker"}, nil).Once()
+			},
+		},
+		"enough free disk space": {
+			config: common.DockerMachineHealthCheck{MinFreeDiskSpace: "1GB"},
+			setup: func(t *testing.T, c *docker.MockClient) {
+				c.On("Info", mock.Anything).Return(types.Info{DockerRootDir: "/var/lib/docker"}, nil).Once()
+				c.On("ImageInspectWithRaw", mock.Anything, common.DefaultMachineHealthCheckImage).
+					Return(types.ImageInspect{}, nil, nil).
+					Once()
+				mockHealthCheckContainer(t, c, "df", "-Pk", 0, "header\n/dev/sda1 10000000 9000000 2000000 90% /docker-root\n")
+			},
+		},
+		"not enough free disk space": {
+			config: common.DockerMachineHealthCheck{MinFreeDiskSpace: "1GB"},
+			setup: func(t *testing.T, c *docker.MockClient) {
+				c.On("Info", mock.Anything).Return(types.Info{DockerRootDir: "/var/lib/docker"}, nil).Once()
+				c.On("ImageInspectWithRaw", mock.Anything, common.DefaultMachineHealthCheckImage).
+					Return(types.ImageInspect{}, nil, nil).
+					Once()
+				mockHealthCheckContainer(t, c, "df", "-Pk", 0, "header\n/dev/sda1 10000000 9000000 1000 90% /docker-root\n")
+			},
+			expectedError: "only 1000 KiB of free disk space left, below 1 GiB",
+		},
+		"not enough free inodes": {
+			config: common.DockerMachineHealthCheck{MinFreeInodes: 1000},
+			setup: func(t *testing.T, c *docker.MockClient) {
+				c.On("Info", mock.Anything).Return(types.Info{DockerRootDir: "/var/lib/docker"}, nil).Once()
+				c.On("ImageInspectWithRaw", mock.Anything, common.DefaultMachineHealthCheckImage).
+					Return(types.ImageInspect{}, nil, nil).
+					Once()
+				mockHealthCheckContainer(t, c, "df", "-Pi", 0, "header\n/dev/sda1 100000 99900 100 99% /docker-root\n")
+			},
+			expectedError: "only 100 free inodes left, below 1000",
+		},
+		"failed command with pulled image": {
+			config: common.DockerMachineHealthCheck{Image: "alpine:3.12", Command: []string{"sh", "-c", "exit 1"}},
+			setup: func(t *testing.T, c *docker.MockClient) {
+				c.On("Info", mock.Anything).Return(types.Info{DockerRootDir: "/var/lib/docker"}, nil).Once()
+				c.On("ImageInspectWithRaw", mock.Anything, "alpine:3.12").
+					Return(types.ImageInspect{}, nil, new(test.NotFoundError)).
+					Once()
+				c.On("ImagePullBlocking", mock.Anything, "alpine:3.12", types.ImagePullOptions{}).
+					Return(nil).
+					Once()
+				mockHealthCheckContainer(t, c, "command", "-c", 1, "out of memory\n")
+			},
+			expectedError: "health check command exited with code 1: out of memory",
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			c := new(docker.MockClient)
+			defer c.AssertExpectations(t)
+
+			c.On("Close").Return(nil).Once()
+			tt.setup(t, c)
+
+			checker := &dockerHealthChecker{
+				newClient: func(docker.Credentials) (docker.Client, error) {
+					return c, nil
+				},
+			}
+
+			err := checker.Check(context.Background(), docker.Credentials{}, &tt.config)
+			if tt.expectedError == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.EqualError(t, err, tt.expectedError)
+		})
+	}
+}
+
+type fakeHealthChecker struct {
+	err     error
+	checked chan string
+}
+
+func (f *fakeHealthChecker) Check(
+	ctx context.Context,
+	credentials docker.Credentials,
+	config *common.DockerMachineHealthCheck,
+) error {
+	defer func() { f.checked <- credentials.Host }()
+	return f.err
+}
+
+func newHealthCheckConfig(t *testing.T, action common.DockerMachineHealthAction) *common.RunnerConfig {
+	config := createMachineConfig(t, 1, 3600)
+	config.Machine.HealthCheck = &common.DockerMachineHealthCheck{
+		Interval: 60,
+		Action:   action,
+	}
+
+	return config
+}
+
+func stateOf(p *machineProvider, details *machineDetails) machineState {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return details.State
+}
+
+func TestMachineHealthCheck(t *testing.T) {
+	tests := map[string]struct {
+		action        common.DockerMachineHealthAction
+		checkErr      error
+		expectedState machineState
+		removed       bool
+	}{
+		"healthy machine": {
+			expectedState: machineStateIdle,
+		},
+		"unhealthy machine removed": {
+			checkErr:      errors.New("disk full"),
+			expectedState: machineStateRemoving,
+			removed:       true,
+		},
+		"unhealthy machine quarantined": {
+			action:        common.MachineHealthActionQuarantine,
+			checkErr:      errors.New("disk full"),
+			expectedState: machineStateQuarantined,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			p, m := testMachineProvider("test-machine-checked", "test-machine-recent")
+			checker := &fakeHealthChecker{err: tt.checkErr, checked: make(chan string, 10)}
+			p.healthChecker = checker
+
+			config := newHealthCheckConfig(t, tt.action)
+			checked := p.machineDetails("test-machine-checked", false)
+			checked.LastHealthCheck = time.Now().Add(-time.Hour)
+			recent := p.machineDetails("test-machine-recent", false)
+			recent.LastHealthCheck = time.Now()
+
+			p.checkMachinesHealth(config, m.machines)
+			<-checker.checked
+
+			if tt.removed {
+				<-m.Removed
+			} else {
+				// wait for the check to update the state of the machine
+				assert.Eventually(t, func() bool {
+					return stateOf(p, checked) == tt.expectedState
+				}, time.Second, 10*time.Millisecond)
+			}
+
+			assert.Equal(t, tt.expectedState, stateOf(p, checked))
+			assert.Equal(t, machineStateIdle, stateOf(p, recent), "skips recently checked machines")
+			assert.Len(t, checker.checked, 0)
+		})
+	}
+}
+
+func TestMachineHealthCheckDisabled(t *testing.T) {
+	p, m := testMachineProvider("test-machine-1")
+	checker := &fakeHealthChecker{checked: make(chan string, 10)}
+	p.healthChecker = checker
+	details := p.machineDetails("test-machine-1", false)
+
+	config := createMachineConfig(t, 1, 3600)
+	p.checkMachinesHealth(config, m.machines)
+
+	config.Machine.HealthCheck = &common.DockerMachineHealthCheck{}
+	p.checkMachinesHealth(config, m.machines)
+
+	assert.Len(t, checker.checked, 0)
+	assert.Equal(t, machineStateIdle, stateOf(p, details))
+}
+
+func TestMachineQuarantineTime(t *testing.T) {
+	p, _ := testMachineProvider()
+
+	config := newHealthCheckConfig(t, common.MachineHealthActionQuarantine)
+	config.Machine.HealthCheck.QuarantineTime = 60
+
+	d := &machineDetails{State: machineStateQuarantined, Used: time.Now().Add(-30 * time.Second)}
+	assert.NoError(t, p.updateMachine(config, &machinesData{}, d, 1), "keeps the machine in quarantine")
+
+	d.Used = time.Now().Add(-2 * time.Minute)
+	assert.Error(t, p.updateMachine(config, &machinesData{}, d, 1), "removes the machine after the quarantine")
+}
+
+func TestMachineReleaseAfterSystemFailures(t *testing.T) {
+	p, m := testMachineProvider("test-machine-1")
+
+	config := newHealthCheckConfig(t, "")
+	config.Machine.HealthCheck.MaxSystemFailures = 2
+
+	details := p.machineDetails("test-machine-1", false)
+	details.State = machineStateUsed
+
+	p.recordJobResult(details, errors.New("system failure"))
+	p.Release(config, details)
+	assert.Equal(t, machineStateIdle, details.State)
+
+	details.State = machineStateUsed
+	p.recordJobResult(details, &common.BuildError{FailureReason: common.ScriptFailure})
+	assert.Equal(t, 0, details.SystemFailures, "resets the failures after a job without system failure")
+
+	for i := 0; i < 2; i++ {
+		p.recordJobResult(details, &common.BuildError{FailureReason: common.RunnerSystemFailure})
+	}
+	p.Release(config, details)
+	<-m.Removed
+
+	assert.Equal(t, machineStateRemoving, stateOf(p, details))
+}
+
+func TestIsSystemFailure(t *testing.T) {
+	assert.False(t, isSystemFailure(nil))
+	assert.False(t, isSystemFailure(&common.BuildError{}))
+	assert.False(t, isSystemFailure(&common.BuildError{FailureReason: common.JobExecutionTimeout}))
+	assert.True(t, isSystemFailure(&common.BuildError{FailureReason: common.RunnerSystemFailure}))
+	assert.True(t, isSystemFailure(errors.New("docker daemon unavailable")))
+}
@@ -0,0 +1,199 @@
+package machine
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+// interruptionChecker checks whether a spot or preemptible machine received
+// an interruption notice from its cloud provider
+type interruptionChecker interface {
+	Interrupted(ctx context.Context, config *common.DockerMachineInterruptionCheck, name string) (bool, error)
+}
+
+// urlInterruptionChecker polls an URL returning the interruption notice of
+// the machine, like the instance metadata endpoints of the cloud providers.
+// No notice is signaled with a 404 or with an empty or "false" body
+type urlInterruptionChecker struct {
+	client *http.Client
+}
+
+func (c *urlInterruptionChecker) Interrupted(
+	ctx context.Context,
+	config *common.DockerMachineInterruptionCheck,
+	name string,
+) (bool, error) {
+	req, err := http.NewRequest(http.MethodGet, config.GetURL(name), nil)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return false, nil
+	case http.StatusOK:
+	default:
+		return false, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+
+	notice := strings.TrimSpace(string(body))
+
+	return notice != "" && !strings.EqualFold(notice, "false"), nil
+}
+
+// checkInterruption checks the interruption notice of the machine and handles
+// it, returning whether the machine is interrupted
+func (m *machineProvider) checkInterruption(config *common.RunnerConfig, details *machineDetails) bool {
+	if config.Machine == nil || config.Machine.InterruptionCheck == nil {
+		return false
+	}
+
+	check := config.Machine.InterruptionCheck
+
+	ctx, cancel := context.WithTimeout(context.Background(), check.GetInterval())
+	defer cancel()
+
+	interrupted, err := m.interruptionChecker.Interrupted(ctx, check, details.Name)
+	if err != nil {
+		details.logger().WithError(err).Debugln("Failed to check the interruption notice")
+		return false
+	}
+
+	if interrupted {
+		m.interrupt(config, details)
+	}
+
+	return interrupted
+}
+
+// checkMachinesInterruption starts the interruption checks of the idle machines
+// that weren't checked for longer than the check interval, so that the
+// interrupted machines are taken out of the rotation before a job uses them
+func (m *machineProvider) checkMachinesInterruption(config *common.RunnerConfig, machines []string) {
+	if config.Machine == nil || config.Machine.InterruptionCheck == nil {
+		return
+	}
+
+	interval := config.Machine.InterruptionCheck.GetInterval()
+
+	for _, name := range machines {
+		m.lock.Lock()
+		details := m.details[name]
+		due := details != nil &&
+			details.State == machineStateIdle &&
+			!details.Interrupted &&
+			time.Since(details.LastInterruptionCheck) > interval
+		if due {
+			details.LastInterruptionCheck = time.Now()
+		}
+		m.lock.Unlock()
+
+		if due {
+			go m.checkInterruption(config, details)
+		}
+	}
+}
+
+// interruptedChannel returns a channel closed when the machine is interrupted
+func (m *machineProvider) interruptedChannel(details *machineDetails) <-chan struct{} {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if details.interrupted == nil {
+		details.interrupted = make(chan struct{})
+		if details.Interrupted {
+			close(details.interrupted)
+		}
+	}
+
+	return details.interrupted
+}
+
+// interrupt takes the machine out of the rotation, aborts its job and
+// creates its replacement ahead of its removal
+func (m *machineProvider) interrupt(config *common.RunnerConfig, details *machineDetails) {
+	m.lock.Lock()
+	if details.Interrupted {
+		m.lock.Unlock()
+		return
+	}
+
+	details.Interrupted = true
+	details.Reason = "interrupted by the cloud provider"
+	if details.interrupted != nil {
+		close(details.interrupted)
+	}
+	// the machines running jobs are removed once released
+	unused := details.State == machineStateIdle
+	if unused {
+		details.State = machineStateAcquired
+	}
+
+	replace := config.Limit <= 0 || m.activeMachines(config) < config.Limit
+	m.lock.Unlock()
+
+	details.logger().Warningln("Machine received an interruption notice")
+	m.totalActions.WithLabelValues("interrupted").Inc()
+
+	if replace {
+		m.create(config, machineStateIdle)
+	}
+
+	if unused {
+		_ = m.remove(config, details.Name, details.Reason)
+	}
+}
+
+// activeMachines counts the machines of the runner that aren't being removed.
+// It must be called with the lock held
+func (m *machineProvider) activeMachines(config *common.RunnerConfig) int {
+	filter := machineFilter(config)
+
+	count := 0
+	for _, details := range m.details {
+		if details.match(filter) && details.State != machineStateRemoving && !details.Interrupted {
+			count++
+		}
+	}
+
+	return count
+}
+
+// watchInterruption checks the interruption notice of the machine running a
+// job until the context is done or the machine is interrupted
+func (m *machineProvider) watchInterruption(ctx context.Context, config *common.RunnerConfig, details *machineDetails) {
+	if config.Machine == nil || config.Machine.InterruptionCheck == nil {
+		return
+	}
+
+	ticker := time.NewTicker(config.Machine.InterruptionCheck.GetInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if m.checkInterruption(config, details) {
+				return
+			}
+		}
+	}
+}
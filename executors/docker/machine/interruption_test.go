@@ -0,0 +1,299 @@
+package machine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+func TestURLInterruptionChecker(t *testing.T) {
+	tests := map[string]struct {
+		status              int
+		body                string
+		expectedInterrupted bool
+		expectedError       bool
+	}{
+		"no notice": {
+			status: http.StatusNotFound,
+		},
+		"empty notice": {
+			status: http.StatusOK,
+		},
+		"false notice": {
+			status: http.StatusOK,
+			body:   "FALSE\n",
+		},
+		"notice": {
+			status:              http.StatusOK,
+			body:                `{"action": "terminate", "time": "2020-09-18T08:22:00Z"}`,
+			expectedInterrupted: true,
+		},
+		"true notice": {
+			status:              http.StatusOK,
+			body:                "TRUE",
+			expectedInterrupted: true,
+		},
+		"server error": {
+			status:        http.StatusInternalServerError,
+			expectedError: true,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/machines/test-machine-1/notice", r.URL.Path)
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			checker := &urlInterruptionChecker{client: server.Client()}
+			config := &common.DockerMachineInterruptionCheck{URL: server.URL + "/machines/%s/notice"}
+
+			interrupted, err := checker.Interrupted(context.Background(), config, "test-machine-1")
+			if tt.expectedError {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedInterrupted, interrupted)
+		})
+	}
+}
+
+type fakeInterruptionChecker struct {
+	interrupted map[string]bool
+	err         error
+}
+
+func (f *fakeInterruptionChecker) Interrupted(
+	ctx context.Context,
+	config *common.DockerMachineInterruptionCheck,
+	name string,
+) (bool, error) {
+	return f.interrupted[name], f.err
+}
+
+func newInterruptionCheckConfig(t *testing.T) *common.RunnerConfig {
+	config := createMachineConfig(t, 1, 3600)
+	config.Machine.InterruptionCheck = &common.DockerMachineInterruptionCheck{
+		URL:      "http://metadata/%s",
+		Interval: 1,
+	}
+
+	return config
+}
+
+func TestInterruptIdleMachine(t *testing.T) {
+	p, m := testMachineProvider("test-machine-1")
+	config := newInterruptionCheckConfig(t)
+
+	details := p.machineDetails("test-machine-1", false)
+	p.interrupt(config, details)
+
+	<-m.Created
+	<-m.Removed
+	assert.True(t, details.Interrupted)
+	assert.Equal(t, machineStateRemoving, stateOf(p, details))
+
+	p.interrupt(config, details)
+	assert.Len(t, m.Created, 0, "handles the notice once")
+}
+
+func TestInterruptMachineRunningJob(t *testing.T) {
+	p, m := testMachineProvider("test-machine-1")
+	config := newInterruptionCheckConfig(t)
+	config.Limit = 1
+
+	details := p.machineDetails("test-machine-1", false)
+	details.State = machineStateUsed
+	interrupted := p.interruptedChannel(details)
+
+	p.interrupt(config, details)
+
+	select {
+	case <-interrupted:
+	default:
+		assert.Fail(t, "signals the interruption")
+	}
+	assert.Equal(t, machineStateUsed, stateOf(p, details), "keeps the machine until the job is aborted")
+	assert.Len(t, p.details, 2, "replaces the interrupted machine within the limit")
+	<-m.Created
+
+	p.Release(config, details)
+	<-m.Removed
+	assert.Equal(t, machineStateRemoving, stateOf(p, details))
+}
+
+func TestFindFreeMachineSkipsInterrupted(t *testing.T) {
+	p, m := testMachineProvider("test-machine-1", "test-machine-2")
+	config := newInterruptionCheckConfig(t)
+	p.interruptionChecker = &fakeInterruptionChecker{err: errors.New("not expected to be called")}
+
+	p.machineDetails("test-machine-2", false).Interrupted = true
+
+	details := p.findFreeMachine(config, false, m.machines...)
+	require.NotNil(t, details)
+	assert.Equal(t, "test-machine-1", details.Name)
+}
+
+func TestCheckMachinesInterruption(t *testing.T) {
+	p, m := testMachineProvider("test-machine-1", "test-machine-2")
+	config := newInterruptionCheckConfig(t)
+	config.Limit = 2
+	p.interruptionChecker = &fakeInterruptionChecker{
+		interrupted: map[string]bool{"test-machine-2": true},
+	}
+
+	healthy := p.machineDetails("test-machine-1", false)
+	interrupted := p.machineDetails("test-machine-2", false)
+
+	p.checkMachinesInterruption(config, m.machines)
+
+	<-m.Created
+	<-m.Removed
+
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	assert.True(t, interrupted.Interrupted)
+	assert.Equal(t, machineStateRemoving, interrupted.State)
+	assert.False(t, healthy.LastInterruptionCheck.IsZero(), "checks the idle machines")
+	assert.Equal(t, machineStateIdle, healthy.State)
+}
+
+func TestInterruptionCheckErrorIgnored(t *testing.T) {
+	p, _ := testMachineProvider("test-machine-1")
+	config := newInterruptionCheckConfig(t)
+	p.interruptionChecker = &fakeInterruptionChecker{err: errors.New("metadata unavailable")}
+
+	details := p.machineDetails("test-machine-1", false)
+	assert.False(t, p.checkInterruption(config, details))
+	assert.False(t, details.Interrupted)
+}
+
+func TestMachineExecutorRunInterrupted(t *testing.T) {
+	jobErr := errors.New("job error")
+
+	tests := map[string]struct {
+		interrupt      bool
+		runErr         error
+		expectedReason common.JobFailureReason
+		expectedErr    error
+	}{
+		"interrupted": {
+			interrupt:      true,
+			runErr:         context.Canceled,
+			expectedReason: common.RunnerSystemFailure,
+		},
+		"interrupted but succeeded": {
+			interrupt: true,
+		},
+		"failed without interruption": {
+			runErr:      jobErr,
+			expectedErr: jobErr,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			p, m := testMachineProvider("test-machine-1")
+			config := newInterruptionCheckConfig(t)
+
+			details := p.machineDetails("test-machine-1", false)
+			details.State = machineStateUsed
+
+			executor := new(common.MockExecutor)
+			defer executor.AssertExpectations(t)
+
+			executor.On("Run", mock.Anything).
+				Run(func(args mock.Arguments) {
+					if !tt.interrupt {
+						return
+					}
+
+					cmd := args.Get(0).(common.ExecutorCommand)
+					p.interrupt(config, details)
+
+					select {
+					case <-cmd.Context.Done():
+					case <-time.After(time.Second):
+						assert.Fail(t, "aborts the command")
+					}
+				}).
+				Return(tt.runErr).
+				Once()
+
+			trace := new(bytes.Buffer)
+			e := &machineExecutor{
+				provider: p,
+				executor: executor,
+				data:     details,
+				trace:    &common.Trace{Writer: trace},
+			}
+			err := e.Run(common.ExecutorCommand{Context: context.Background()})
+
+			if tt.interrupt {
+				<-m.Created
+			}
+
+			if tt.expectedReason == "" {
+				assert.Equal(t, tt.expectedErr, err)
+				assert.NotContains(t, trace.String(), "Machine interrupted")
+				return
+			}
+
+			assert.Contains(
+				t,
+				trace.String(),
+				"Machine interrupted: test-machine-1 received an interruption notice from the cloud provider",
+			)
+
+			var buildErr *common.BuildError
+			require.True(t, errors.As(err, &buildErr))
+			assert.Equal(t, tt.expectedReason, buildErr.FailureReason)
+			assert.Contains(t, err.Error(), "machine test-machine-1 was interrupted by the cloud provider")
+		})
+	}
+}
+
+func TestWatchInterruption(t *testing.T) {
+	p, _ := testMachineProvider("test-machine-1")
+	config := newInterruptionCheckConfig(t)
+	p.interruptionChecker = &fakeInterruptionChecker{
+		interrupted: map[string]bool{"test-machine-1": true},
+	}
+
+	details := p.machineDetails("test-machine-1", false)
+	details.State = machineStateUsed
+
+	done := make(chan struct{})
+	go func() {
+		p.watchInterruption(context.Background(), config, details)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "stops watching after the interruption")
+	}
+
+	select {
+	case <-p.interruptedChannel(details):
+	default:
+		assert.Fail(t, "signals the interruption")
+	}
+}
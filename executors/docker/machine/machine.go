@@ -1,7 +1,9 @@
 package machine
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -20,9 +22,13 @@ type machineExecutor struct {
 	provider *machineProvider
 	executor common.Executor
 	build    *common.Build
+	trace    common.JobTrace
 	data     common.ExecutorData
 	config   common.RunnerConfig
 
+	// stopInterruptionWatch stops checking the interruption notice of the machine
+	stopInterruptionWatch context.CancelFunc
+
 	currentStage common.ExecutorStage
 }
 
@@ -57,6 +63,7 @@ func (e *machineExecutor) Shell() *common.ShellScriptInfo {
 
 func (e *machineExecutor) Prepare(options common.ExecutorPrepareOptions) (err error) {
 	e.build = options.Build
+	e.trace = options.Trace
 
 	if options.Config.Docker == nil {
 		options.Config.Docker = &common.DockerConfig{}
@@ -86,6 +93,12 @@ func (e *machineExecutor) Prepare(options common.ExecutorPrepareOptions) (err er
 		return errors.New("failed to create an executor")
 	}
 
+	if details := e.machine(); details != nil {
+		var ctx context.Context
+		ctx, e.stopInterruptionWatch = context.WithCancel(context.Background())
+		go e.provider.watchInterruption(ctx, &e.config, details)
+	}
+
 	return e.executor.Prepare(options)
 }
 
@@ -93,17 +106,91 @@ func (e *machineExecutor) Run(cmd common.ExecutorCommand) error {
 	if e.executor == nil {
 		return errors.New("missing executor")
 	}
-	return e.executor.Run(cmd)
+
+	details := e.machine()
+	if details == nil {
+		return e.executor.Run(cmd)
+	}
+
+	// Abort the command when the machine is interrupted
+	interrupted := e.provider.interruptedChannel(details)
+
+	parentCtx := cmd.Context
+	if parentCtx == nil {
+		parentCtx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(parentCtx)
+	defer cancel()
+
+	// aborted is closed before the command is cancelled because of the interruption
+	aborted := make(chan struct{})
+	go func() {
+		select {
+		case <-interrupted:
+			close(aborted)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	cmd.Context = ctx
+	err := e.executor.Run(cmd)
+	if err == nil {
+		return nil
+	}
+
+	select {
+	case <-aborted:
+		// GitLab doesn't know a failure reason specific to the interruptions,
+		// so they are told apart from the other system failures in the job log
+		logger := common.NewBuildLogger(e.trace, details.logger().WithError(err))
+		logger.Warningln(fmt.Sprintf(
+			"Machine interrupted: %s received an interruption notice from the cloud provider, the job was aborted",
+			details.Name,
+		))
+		return &common.BuildError{
+			Inner:         fmt.Errorf("machine %s was interrupted by the cloud provider: %w", details.Name, err),
+			FailureReason: common.RunnerSystemFailure,
+		}
+	default:
+		return err
+	}
 }
 
 func (e *machineExecutor) Finish(err error) {
 	if e.executor != nil {
 		e.executor.Finish(err)
+		e.recordJobResult(err)
 	}
 	e.log().Infoln("Finished docker-machine build:", err)
 }
 
+// recordJobResult tracks the system failures of the machine used by the job,
+// for the health check to take the machine out of the rotation
+func (e *machineExecutor) recordJobResult(err error) {
+	details := e.machine()
+	if details == nil {
+		return
+	}
+
+	e.provider.recordJobResult(details, err)
+}
+
+// machine returns the details of the machine used by the job
+func (e *machineExecutor) machine() *machineDetails {
+	details, _ := e.data.(*machineDetails)
+	if details == nil && e.build != nil {
+		details, _ = e.build.ExecutorData.(*machineDetails)
+	}
+
+	return details
+}
+
 func (e *machineExecutor) Cleanup() {
+	if e.stopInterruptionWatch != nil {
+		e.stopInterruptionWatch()
+	}
+
 	// Cleanup executor if were created
 	if e.executor != nil {
 		e.executor.Cleanup()
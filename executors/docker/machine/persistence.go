@@ -0,0 +1,216 @@
+package machine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+const persistedStateVersion = 1
+
+type persistedState struct {
+	Version  int                `json:"version"`
+	Machines []persistedMachine `json:"machines"`
+}
+
+type persistedMachine struct {
+	Name       string       `json:"name"`
+	Created    time.Time    `json:"created"`
+	Used       time.Time    `json:"used"`
+	UsedCount  int          `json:"used_count"`
+	State      machineState `json:"state"`
+	Reason     string       `json:"reason,omitempty"`
+	RetryCount int          `json:"retry_count,omitempty"`
+
+	SystemFailures int  `json:"system_failures,omitempty"`
+	Retired        bool `json:"retired,omitempty"`
+}
+
+// restoredState returns the state of a machine found in the state file after
+// a restart. Machines that were in use or being created become idle, as the
+// jobs and creations of the previous process are gone. The ones that are
+// broken fail the connection check before being used again
+func (p persistedMachine) restoredState() machineState {
+	if p.State == machineStateRemoving || p.State == machineStateQuarantined {
+		return p.State
+	}
+
+	return machineStateIdle
+}
+
+func readStateFile(path string) (persistedState, error) {
+	var state persistedState
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return state, err
+	}
+
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return state, fmt.Errorf("decoding %s: %w", path, err)
+	}
+
+	if state.Version != persistedStateVersion {
+		return state, fmt.Errorf("unsupported version %d of %s", state.Version, path)
+	}
+
+	return state, nil
+}
+
+func writeStateFile(path string, data []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first, to not leave a truncated state file behind
+	tmpPath := path + ".tmp"
+	err = ioutil.WriteFile(tmpPath, data, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// restoreState loads the details of the machines saved by a previous run of
+// the runner, the first time it's called for the state file of the runner.
+// Only the details of the machines that still exist are restored
+func (m *machineProvider) restoreState(config *common.RunnerConfig, machines []string) {
+	path := config.Machine.StateFile
+	if path == "" {
+		return
+	}
+
+	m.stateLock.Lock()
+	restored := m.restoredStates[path]
+	m.restoredStates[path] = true
+	m.stateLock.Unlock()
+
+	if restored {
+		return
+	}
+
+	logger := logrus.WithField("runner", config.ShortDescription()).WithField("path", path)
+
+	state, err := readStateFile(path)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		logger.WithError(err).Warningln("Failed to restore the machines state")
+		return
+	}
+
+	existing := make(map[string]bool, len(machines))
+	for _, name := range machines {
+		existing[name] = true
+	}
+
+	var toRemove []*machineDetails
+
+	m.lock.Lock()
+	for _, saved := range state.Machines {
+		if !existing[saved.Name] || m.details[saved.Name] != nil {
+			continue
+		}
+
+		details := &machineDetails{
+			Name:       saved.Name,
+			Created:    saved.Created,
+			Used:       saved.Used,
+			UsedCount:  saved.UsedCount,
+			State:      saved.restoredState(),
+			Reason:     saved.Reason,
+			RetryCount: saved.RetryCount,
+			LastSeen:   time.Now(),
+
+			SystemFailures: saved.SystemFailures,
+			Retired:        saved.Retired,
+		}
+		m.details[saved.Name] = details
+
+		if details.State == machineStateRemoving {
+			toRemove = append(toRemove, details)
+		}
+	}
+	m.lock.Unlock()
+
+	logger.WithField("machines", len(state.Machines)).Infoln("Restored the machines state")
+
+	for _, details := range toRemove {
+		_ = m.remove(config, details.Name, details.Reason)
+	}
+}
+
+// saveState writes the details of the machines of the runner to its state
+// file, when they changed since they were last written
+func (m *machineProvider) saveState(config *common.RunnerConfig) {
+	if config == nil || config.Machine == nil || config.Machine.StateFile == "" {
+		return
+	}
+	path := config.Machine.StateFile
+
+	state := persistedState{
+		Version:  persistedStateVersion,
+		Machines: make([]persistedMachine, 0),
+	}
+
+	filter := machineFilter(config)
+
+	m.lock.RLock()
+	for _, details := range m.details {
+		if !details.match(filter) {
+			continue
+		}
+
+		state.Machines = append(state.Machines, persistedMachine{
+			Name:       details.Name,
+			Created:    details.Created,
+			Used:       details.Used,
+			UsedCount:  details.UsedCount,
+			State:      details.State,
+			Reason:     details.Reason,
+			RetryCount: details.RetryCount,
+
+			SystemFailures: details.SystemFailures,
+			Retired:        details.Retired,
+		})
+	}
+	m.lock.RUnlock()
+
+	sort.Slice(state.Machines, func(i, j int) bool {
+		return state.Machines[i].Name < state.Machines[j].Name
+	})
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		logrus.WithError(err).Warningln("Failed to encode the machines state")
+		return
+	}
+
+	m.stateLock.Lock()
+	defer m.stateLock.Unlock()
+
+	if bytes.Equal(m.savedStates[path], data) {
+		return
+	}
+
+	err = writeStateFile(path, data)
+	if err != nil {
+		logrus.WithField("path", path).WithError(err).Warningln("Failed to save the machines state")
+		return
+	}
+
+	m.savedStates[path] = data
+}
@@ -0,0 +1,141 @@
+package machine
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+func newStateFileConfig(t *testing.T, maxBuilds int) (*common.RunnerConfig, func()) {
+	dir, err := ioutil.TempDir("", "machines-state")
+	require.NoError(t, err)
+
+	config := createMachineConfig(t, 0, 3600)
+	config.Machine.MaxBuilds = maxBuilds
+	config.Machine.StateFile = filepath.Join(dir, "state", "machines.json")
+
+	return config, func() {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestMachineStateTextRoundTrip(t *testing.T) {
+	for state := machineStateIdle; state <= machineStateQuarantined; state++ {
+		text, err := state.MarshalText()
+		require.NoError(t, err)
+
+		var restored machineState
+		require.NoError(t, restored.UnmarshalText(text))
+		assert.Equal(t, state, restored)
+	}
+
+	var state machineState
+	assert.Error(t, state.UnmarshalText([]byte("Unknown")))
+}
+
+func TestMachineStatePersistence(t *testing.T) {
+	config, cleanup := newStateFileConfig(t, 0)
+	defer cleanup()
+
+	created := time.Now().Add(-time.Hour).Round(time.Second)
+	usedTime := time.Now().Add(-time.Minute).Round(time.Second)
+
+	p1, _ := testMachineProvider()
+	for name, state := range map[string]machineState{
+		"test-machine-idle":     machineStateIdle,
+		"test-machine-used":     machineStateUsed,
+		"test-machine-removing": machineStateRemoving,
+		"test-machine-gone":     machineStateIdle,
+	} {
+		details := p1.machineDetails(name, false)
+		details.Created = created
+		details.Used = usedTime
+		details.UsedCount = 3
+		details.State = state
+		details.Reason = "reason of " + name
+	}
+	p1.machineDetails("other-runner-machine", false)
+
+	p1.saveState(config)
+
+	state, err := readStateFile(config.Machine.StateFile)
+	require.NoError(t, err)
+	assert.Len(t, state.Machines, 4, "saves only the machines of the runner")
+
+	p2, m := testMachineProvider("test-machine-idle", "test-machine-used", "test-machine-removing")
+	p2.restoreState(config, m.machines)
+
+	p2.lock.RLock()
+	idle := p2.details["test-machine-idle"]
+	used := p2.details["test-machine-used"]
+	removing := p2.details["test-machine-removing"]
+	_, gone := p2.details["test-machine-gone"]
+	p2.lock.RUnlock()
+
+	require.NotNil(t, idle)
+	assert.Equal(t, machineStateIdle, idle.State)
+	assert.Equal(t, 3, idle.UsedCount)
+	assert.True(t, created.Equal(idle.Created))
+	assert.True(t, usedTime.Equal(idle.Used))
+
+	require.NotNil(t, used)
+	assert.Equal(t, machineStateIdle, used.State, "jobs didn't survive the restart")
+
+	require.NotNil(t, removing)
+	assert.Equal(t, machineStateRemoving, removing.State)
+	<-m.Removed
+
+	assert.False(t, gone, "skips machines that don't exist anymore")
+}
+
+func TestMachineStateRestoredOnce(t *testing.T) {
+	config, cleanup := newStateFileConfig(t, 0)
+	defer cleanup()
+
+	p1, _ := testMachineProvider()
+	p1.machineDetails("test-machine-1", false).UsedCount = 5
+	p1.saveState(config)
+
+	p2, m := testMachineProvider("test-machine-1")
+	p2.restoreState(config, m.machines)
+	p2.details["test-machine-1"].UsedCount = 6
+
+	p2.restoreState(config, m.machines)
+	assert.Equal(t, 6, p2.details["test-machine-1"].UsedCount)
+}
+
+func TestMachineMaxBuildsAfterRestart(t *testing.T) {
+	config, cleanup := newStateFileConfig(t, 3)
+	defer cleanup()
+
+	p1, _ := testMachineProvider()
+	details := p1.machineDetails("test-machine-1", false)
+	details.UsedCount = 3
+	p1.saveState(config)
+
+	p2, m := testMachineProvider("test-machine-1")
+	d, err := p2.Acquire(config)
+	assert.NoError(t, err)
+	assert.Nil(t, d, "doesn't acquire the machine past its build limit")
+
+	<-m.Removed
+}
+
+func TestMachineStateInvalidFile(t *testing.T) {
+	config, cleanup := newStateFileConfig(t, 0)
+	defer cleanup()
+
+	require.NoError(t, writeStateFile(config.Machine.StateFile, []byte("invalid")))
+
+	p, m := testMachineProvider("test-machine-1")
+	p.restoreState(config, m.machines)
+
+	assert.Empty(t, p.details)
+}
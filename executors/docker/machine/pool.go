@@ -0,0 +1,143 @@
+package machine
+
+import (
+	"errors"
+	"sort"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+// runnerMachine returns the details of the machine, when it belongs to the runner
+func (m *machineProvider) runnerMachine(config *common.RunnerConfig, name string) *machineDetails {
+	details := m.details[name]
+	if details == nil || !details.match(machineFilter(config)) {
+		return nil
+	}
+
+	return details
+}
+
+func (m *machineProvider) ListMachines(config *common.RunnerConfig) []common.MachineInfo {
+	if config.Machine == nil {
+		return nil
+	}
+
+	filter := machineFilter(config)
+	machines := make([]common.MachineInfo, 0)
+
+	m.lock.RLock()
+	for _, details := range m.details {
+		if !details.match(filter) {
+			continue
+		}
+
+		machines = append(machines, common.MachineInfo{
+			Name:      details.Name,
+			State:     details.State.String(),
+			UsedCount: details.UsedCount,
+			Created:   details.Created,
+			Used:      details.Used,
+			Reason:    details.Reason,
+			Retired:   details.Retired,
+		})
+	}
+	m.lock.RUnlock()
+
+	sort.Slice(machines, func(i, j int) bool {
+		return machines[i].Created.Before(machines[j].Created)
+	})
+
+	return machines
+}
+
+func (m *machineProvider) RemoveMachine(config *common.RunnerConfig, name string) error {
+	if config.Machine == nil {
+		return common.ErrMachineNotFound
+	}
+
+	m.lock.Lock()
+	details := m.runnerMachine(config, name)
+	if details == nil {
+		m.lock.Unlock()
+		return common.ErrMachineNotFound
+	}
+	if details.State == machineStateRemoving {
+		m.lock.Unlock()
+		return nil
+	}
+
+	// like on retirement, unused machines are claimed before releasing the
+	// lock, so that no job acquires them while they're being removed
+	if details.State == machineStateIdle || details.State == machineStateQuarantined {
+		details.State = machineStateAcquired
+	}
+	m.lock.Unlock()
+
+	details.logger().Warningln("Machine removal requested by an operator")
+	defer m.saveState(config)
+
+	return m.remove(config, name, "Removed by an operator")
+}
+
+func (m *machineProvider) RetireMachine(config *common.RunnerConfig, name string) error {
+	if config.Machine == nil {
+		return common.ErrMachineNotFound
+	}
+
+	m.lock.Lock()
+	details := m.runnerMachine(config, name)
+	if details == nil {
+		m.lock.Unlock()
+		return common.ErrMachineNotFound
+	}
+
+	details.Retired = true
+
+	// machines not running jobs are claimed right away, so that no job
+	// acquires them before their removal
+	unused := details.State == machineStateIdle || details.State == machineStateQuarantined
+	if unused {
+		details.State = machineStateAcquired
+	}
+	m.lock.Unlock()
+
+	details.logger().Warningln("Machine retirement requested by an operator")
+	defer m.saveState(config)
+
+	if !unused {
+		return nil
+	}
+
+	return m.remove(config, name, "Retired")
+}
+
+func (m *machineProvider) PrewarmMachines(config *common.RunnerConfig, count int) (int, error) {
+	if config.Machine == nil || config.Machine.MachineName == "" {
+		return 0, errors.New("missing Machine options")
+	}
+
+	m.acquireLock.Lock()
+	defer m.acquireLock.Unlock()
+
+	machines, err := m.loadMachines(config)
+	if err != nil {
+		return 0, err
+	}
+
+	var data machinesData
+	for _, name := range machines {
+		data.Add(m.machineDetails(name, false))
+	}
+
+	created := 0
+	for ; created < count; created++ {
+		if data.Total() >= config.Limit && config.Limit > 0 {
+			// Limit maximum number of machines
+			break
+		}
+		m.create(config, machineStateIdle)
+		data.Creating++
+	}
+
+	return created, nil
+}
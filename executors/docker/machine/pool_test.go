@@ -0,0 +1,103 @@
+package machine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+func TestListMachines(t *testing.T) {
+	p, _ := testMachineProvider()
+	config := createMachineConfig(t, 1, 3600)
+
+	older := p.machineDetails("test-machine-older", false)
+	older.Created = time.Now().Add(-time.Hour)
+	older.UsedCount = 3
+	older.State = machineStateUsed
+
+	newer := p.machineDetails("test-machine-newer", false)
+	newer.Retired = true
+	p.machineDetails("other-runner-machine", false)
+
+	machines := p.ListMachines(config)
+	require.Len(t, machines, 2, "lists only the machines of the runner")
+
+	assert.Equal(t, "test-machine-older", machines[0].Name)
+	assert.Equal(t, "Used", machines[0].State)
+	assert.Equal(t, 3, machines[0].UsedCount)
+	assert.Equal(t, "test-machine-newer", machines[1].Name)
+	assert.True(t, machines[1].Retired)
+}
+
+func TestRemoveMachine(t *testing.T) {
+	p, m := testMachineProvider("test-machine-1", "test-machine-idle")
+	config := createMachineConfig(t, 1, 3600)
+
+	details := p.machineDetails("test-machine-1", false)
+	details.State = machineStateUsed
+	idle := p.machineDetails("test-machine-idle", false)
+	p.machineDetails("other-runner-machine", false)
+
+	assert.Equal(t, common.ErrMachineNotFound, p.RemoveMachine(config, "other-runner-machine"))
+	assert.Equal(t, common.ErrMachineNotFound, p.RemoveMachine(config, "test-machine-unknown"))
+
+	require.NoError(t, p.RemoveMachine(config, "test-machine-1"))
+	assert.Equal(t, machineStateRemoving, stateOf(p, details), "removes machines running jobs")
+	<-m.Removed
+
+	require.NoError(t, p.RemoveMachine(config, "test-machine-idle"))
+	assert.Equal(t, machineStateRemoving, stateOf(p, idle), "removes idle machines")
+	<-m.Removed
+}
+
+func TestRetireMachine(t *testing.T) {
+	p, m := testMachineProvider("test-machine-idle", "test-machine-used")
+	config := createMachineConfig(t, 1, 3600)
+
+	idle := p.machineDetails("test-machine-idle", false)
+	used := p.machineDetails("test-machine-used", false)
+	used.State = machineStateUsed
+
+	assert.Equal(t, common.ErrMachineNotFound, p.RetireMachine(config, "test-machine-unknown"))
+
+	require.NoError(t, p.RetireMachine(config, "test-machine-idle"))
+	assert.Equal(t, machineStateRemoving, stateOf(p, idle), "removes idle machines right away")
+	<-m.Removed
+
+	require.NoError(t, p.RetireMachine(config, "test-machine-used"))
+	assert.Equal(t, machineStateUsed, stateOf(p, used), "keeps running the job")
+	assert.True(t, used.Retired)
+
+	p.Release(config, used)
+	assert.Equal(t, machineStateRemoving, stateOf(p, used), "removes the machine after the job")
+	<-m.Removed
+}
+
+func TestRetiredMachineNotUsed(t *testing.T) {
+	p, _ := testMachineProvider()
+	config := createMachineConfig(t, 1, 3600)
+
+	d := &machineDetails{State: machineStateIdle, Retired: true}
+	assert.EqualError(t, p.updateMachine(config, &machinesData{}, d, 1), "retired")
+}
+
+func TestPrewarmMachines(t *testing.T) {
+	p, m := testMachineProvider("test-machine-1")
+	config := createMachineConfig(t, 1, 3600)
+	config.Limit = 3
+
+	created, err := p.PrewarmMachines(config, 5)
+	require.NoError(t, err)
+	assert.Equal(t, 2, created, "doesn't create machines above the limit")
+
+	for i := 0; i < created; i++ {
+		<-m.Created
+	}
+
+	_, err = p.PrewarmMachines(&common.RunnerConfig{}, 1)
+	assert.Error(t, err)
+}
@@ -3,6 +3,8 @@ package machine
 import (
 	"errors"
 	"fmt"
+	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -10,6 +12,7 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/autoscaler"
 	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker"
 )
 
@@ -19,17 +22,54 @@ type machineProvider struct {
 	details     machinesDetails
 	lock        sync.RWMutex
 	acquireLock sync.Mutex
+
+	// plugins stores the machines managed by autoscaler plugins, per plugin command
+	plugins          map[string]docker.Machine
+	pluginsLock      sync.Mutex
+	newPluginMachine func(path string, args ...string) docker.Machine
+
 	// provider stores a real executor that is used to start run the builds
 	provider common.ExecutorProvider
 
 	stuckRemoveLock sync.Mutex
 
+	jobRates *jobRates
+
+	healthChecker       machineHealthChecker
+	interruptionChecker interruptionChecker
+
+	// restoredStates and savedStates track the state files, per path
+	restoredStates map[string]bool
+	savedStates    map[string][]byte
+	stateLock      sync.Mutex
+
 	// metrics
 	totalActions      *prometheus.CounterVec
 	currentStatesDesc *prometheus.Desc
 	creationHistogram prometheus.Histogram
 }
 
+// machineFor returns the machine managing the machines of the runner, which
+// is backed by docker-machine unless an autoscaler plugin is configured
+func (m *machineProvider) machineFor(config *common.RunnerConfig) docker.Machine {
+	if config == nil || config.Machine == nil || config.Machine.Plugin == "" {
+		return m.machine
+	}
+
+	m.pluginsLock.Lock()
+	defer m.pluginsLock.Unlock()
+
+	key := strings.Join(append([]string{config.Machine.Plugin}, config.Machine.PluginArgs...), " ")
+
+	machine, ok := m.plugins[key]
+	if !ok {
+		machine = m.newPluginMachine(config.Machine.Plugin, config.Machine.PluginArgs...)
+		m.plugins[key] = machine
+	}
+
+	return machine
+}
+
 func (m *machineProvider) machineDetails(name string, acquire bool) *machineDetails {
 	m.lock.Lock()
 	defer m.lock.Unlock()
@@ -49,7 +89,8 @@ func (m *machineProvider) machineDetails(name string, acquire bool) *machineDeta
 	}
 
 	if acquire {
-		if details.isUsed() {
+		// interrupted machines are removed once they aren't used anymore
+		if details.isUsed() || details.Interrupted {
 			return nil
 		}
 		details.State = machineStateAcquired
@@ -66,18 +107,19 @@ func (m *machineProvider) create(config *common.RunnerConfig, state machineState
 	details.RetryCount = 0
 	details.LastSeen = time.Now()
 	errCh := make(chan error, 1)
+	machine := m.machineFor(config)
 
 	// Create machine asynchronously
 	go func() {
 		started := time.Now()
-		err := m.machine.Create(config.Machine.MachineDriver, details.Name, config.Machine.MachineOptions...)
+		err := machine.Create(config.Machine.MachineDriver, details.Name, config.Machine.MachineOptions...)
 		for i := 0; i < 3 && err != nil; i++ {
 			details.RetryCount++
 			logrus.WithField("name", details.Name).
 				WithError(err).
 				Warningln("Machine creation failed, trying to provision")
 			time.Sleep(provisionRetryInterval)
-			err = m.machine.Provision(details.Name)
+			err = machine.Provision(details.Name)
 		}
 
 		if err != nil {
@@ -85,10 +127,11 @@ func (m *machineProvider) create(config *common.RunnerConfig, state machineState
 				WithField("time", time.Since(started)).
 				WithError(err).
 				Errorln("Machine creation failed")
-			_ = m.remove(details.Name, "Failed to create")
+			_ = m.remove(config, details.Name, "Failed to create")
 		} else {
 			details.State = state
 			details.Used = time.Now()
+			details.LastHealthCheck = details.Used
 			creationTime := time.Since(started)
 			logrus.WithField("duration", creationTime).
 				WithField("name", details.Name).
@@ -104,7 +147,11 @@ func (m *machineProvider) create(config *common.RunnerConfig, state machineState
 	return details, errCh
 }
 
-func (m *machineProvider) findFreeMachine(skipCache bool, machines ...string) (details *machineDetails) {
+func (m *machineProvider) findFreeMachine(
+	config *common.RunnerConfig,
+	skipCache bool,
+	machines ...string,
+) (details *machineDetails) {
 	// Enumerate all machines in reverse order, to always take the newest machines first
 	for idx := range machines {
 		name := machines[len(machines)-idx-1]
@@ -114,9 +161,9 @@ func (m *machineProvider) findFreeMachine(skipCache bool, machines ...string) (d
 		}
 
 		// Check if node is running
-		canConnect := m.machine.CanConnect(name, skipCache)
+		canConnect := m.machineFor(config).CanConnect(name, skipCache)
 		if !canConnect {
-			_ = m.remove(name, "machine is unavailable")
+			_ = m.remove(config, name, "machine is unavailable")
 			continue
 		}
 		return details
@@ -130,7 +177,7 @@ func (m *machineProvider) useMachine(config *common.RunnerConfig) (details *mach
 	if err != nil {
 		return
 	}
-	details = m.findFreeMachine(true, machines...)
+	details = m.findFreeMachine(config, true, machines...)
 	if details == nil {
 		var errCh chan error
 		details, errCh = m.create(config, machineStateAcquired)
@@ -151,8 +198,8 @@ func (m *machineProvider) retryUseMachine(config *common.RunnerConfig) (details
 	return
 }
 
-func (m *machineProvider) removeMachine(details *machineDetails) (err error) {
-	if !m.machine.Exist(details.Name) {
+func (m *machineProvider) removeMachine(machine docker.Machine, details *machineDetails) (err error) {
+	if !machine.Exist(details.Name) {
 		details.logger().
 			Warningln("Skipping machine removal, because it doesn't exist")
 		return nil
@@ -166,7 +213,7 @@ func (m *machineProvider) removeMachine(details *machineDetails) (err error) {
 
 	details.logger().
 		Warningln("Stopping machine")
-	err = m.machine.Stop(details.Name, machineStopCommandTimeout)
+	err = machine.Stop(details.Name, machineStopCommandTimeout)
 	if err != nil {
 		details.logger().
 			WithError(err).
@@ -175,7 +222,7 @@ func (m *machineProvider) removeMachine(details *machineDetails) (err error) {
 
 	details.logger().
 		Warningln("Removing machine")
-	err = m.machine.Remove(details.Name)
+	err = machine.Remove(details.Name)
 	if err != nil {
 		details.RetryCount++
 		time.Sleep(removeRetryInterval)
@@ -185,9 +232,9 @@ func (m *machineProvider) removeMachine(details *machineDetails) (err error) {
 	return nil
 }
 
-func (m *machineProvider) finalizeRemoval(details *machineDetails) {
+func (m *machineProvider) finalizeRemoval(machine docker.Machine, details *machineDetails) {
 	for {
-		err := m.removeMachine(details)
+		err := m.removeMachine(machine, details)
 		if err == nil {
 			break
 		}
@@ -205,7 +252,7 @@ func (m *machineProvider) finalizeRemoval(details *machineDetails) {
 	m.totalActions.WithLabelValues("removed").Inc()
 }
 
-func (m *machineProvider) remove(machineName string, reason ...interface{}) error {
+func (m *machineProvider) remove(config *common.RunnerConfig, machineName string, reason ...interface{}) error {
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
@@ -225,7 +272,7 @@ func (m *machineProvider) remove(machineName string, reason ...interface{}) erro
 	details.Used = time.Now()
 	details.writeDebugInformation()
 
-	go m.finalizeRemoval(details)
+	go m.finalizeRemoval(m.machineFor(config), details)
 	return nil
 }
 
@@ -233,11 +280,27 @@ func (m *machineProvider) updateMachine(
 	config *common.RunnerConfig,
 	data *machinesData,
 	details *machineDetails,
+	idleCount int,
 ) error {
+	if details.State == machineStateQuarantined {
+		if time.Since(details.Used) > config.Machine.HealthCheck.GetQuarantineTime() {
+			return errors.New("quarantine time elapsed")
+		}
+		return nil
+	}
+
 	if details.State != machineStateIdle {
 		return nil
 	}
 
+	if details.Retired {
+		return errors.New("retired")
+	}
+
+	if details.Interrupted {
+		return errors.New("interrupted")
+	}
+
 	if config.Machine.MaxBuilds > 0 && details.UsedCount >= config.Machine.MaxBuilds {
 		// Limit number of builds
 		return errors.New("too many builds")
@@ -249,7 +312,7 @@ func (m *machineProvider) updateMachine(
 	}
 
 	if time.Since(details.Used) > time.Second*time.Duration(config.Machine.GetIdleTime()) {
-		if data.Idle >= config.Machine.GetIdleCount() {
+		if data.Idle >= idleCount {
 			// Remove machine that are way over the idle time
 			return errors.New("too many idle machines")
 		}
@@ -260,6 +323,7 @@ func (m *machineProvider) updateMachine(
 func (m *machineProvider) updateMachines(
 	machines []string,
 	config *common.RunnerConfig,
+	idleCount int,
 ) (data machinesData, validMachines []string) {
 	data.Runner = config.ShortDescription()
 	validMachines = make([]string, 0, len(machines))
@@ -268,11 +332,11 @@ func (m *machineProvider) updateMachines(
 		details := m.machineDetails(name, false)
 		details.LastSeen = time.Now()
 
-		err := m.updateMachine(config, &data, details)
+		err := m.updateMachine(config, &data, details, idleCount)
 		if err == nil {
 			validMachines = append(validMachines, name)
 		} else {
-			_ = m.remove(details.Name, err)
+			_ = m.remove(config, details.Name, err)
 		}
 
 		data.Add(details)
@@ -280,10 +344,10 @@ func (m *machineProvider) updateMachines(
 	return
 }
 
-func (m *machineProvider) createMachines(config *common.RunnerConfig, data *machinesData) {
+func (m *machineProvider) createMachines(config *common.RunnerConfig, data *machinesData, idleCount int) {
 	// Create a new machines and mark them as Idle
 	for {
-		if data.Available() >= config.Machine.GetIdleCount() {
+		if data.Available() >= idleCount {
 			// Limit maximum number of idle machines
 			break
 		}
@@ -332,7 +396,7 @@ func (m *machineProvider) intermediateMachineList(excludedMachines []string) []s
 }
 
 func (m *machineProvider) loadMachines(config *common.RunnerConfig) (machines []string, err error) {
-	machines, err = m.machine.List()
+	machines, err = m.machineFor(config).List()
 	if err != nil {
 		return nil, err
 	}
@@ -356,28 +420,38 @@ func (m *machineProvider) Acquire(config *common.RunnerConfig) (common.ExecutorD
 		return nil, err
 	}
 
+	m.restoreState(config, machines)
+	defer m.saveState(config)
+
+	idleCount := m.idleCount(config, m.usedCount(machines))
+
 	// Update a list of currently configured machines
-	machinesData, validMachines := m.updateMachines(machines, config)
+	machinesData, validMachines := m.updateMachines(machines, config, idleCount)
 
 	// Pre-create machines
-	m.createMachines(config, &machinesData)
+	m.createMachines(config, &machinesData, idleCount)
 
 	logrus.WithFields(machinesData.Fields()).
 		WithField("runner", config.ShortDescription()).
-		WithField("minIdleCount", config.Machine.GetIdleCount()).
+		WithField("minIdleCount", idleCount).
 		WithField("maxMachines", config.Limit).
 		WithField("time", time.Now()).
 		Debugln("Docker Machine Details")
 	machinesData.writeDebugInformation()
 
 	// Try to find a free machine
-	details := m.findFreeMachine(false, validMachines...)
+	details := m.findFreeMachine(config, false, validMachines...)
+
+	// Check the health and the interruption notices of the machines left idle
+	m.checkMachinesHealth(config, validMachines)
+	m.checkMachinesInterruption(config, validMachines)
+
 	if details != nil {
 		return details, nil
 	}
 
 	// If we have a free machines we can process a build
-	if config.Machine.GetIdleCount() != 0 && machinesData.Idle == 0 {
+	if idleCount != 0 && machinesData.Idle == 0 {
 		err = errors.New("no free machines that can process builds")
 	}
 	return nil, err
@@ -390,7 +464,7 @@ func (m *machineProvider) Use(
 ) (newConfig common.RunnerConfig, newData common.ExecutorData, err error) {
 	// Find a new machine
 	details, _ := data.(*machineDetails)
-	if details == nil || !details.canBeUsed() || !m.machine.CanConnect(details.Name, true) {
+	if details == nil || !details.canBeUsed() || !m.machineFor(config).CanConnect(details.Name, true) {
 		details, err = m.retryUseMachine(config)
 		if err != nil {
 			return
@@ -401,7 +475,7 @@ func (m *machineProvider) Use(
 	}
 
 	// Get machine credentials
-	dc, err := m.machine.Credentials(details.Name)
+	dc, err := m.machineFor(config).Credentials(details.Name)
 	if err != nil {
 		if newData != nil {
 			m.Release(config, newData)
@@ -423,6 +497,7 @@ func (m *machineProvider) Use(
 	details.Used = time.Now()
 	details.UsedCount++
 	m.totalActions.WithLabelValues("used").Inc()
+	m.saveState(config)
 	return
 }
 
@@ -430,6 +505,8 @@ func (m *machineProvider) Release(config *common.RunnerConfig, data common.Execu
 	// Release machine
 	details, ok := data.(*machineDetails)
 	if ok {
+		defer m.saveState(config)
+
 		// Mark last used time when is Used
 		if details.State == machineStateUsed {
 			details.Used = time.Now()
@@ -438,11 +515,33 @@ func (m *machineProvider) Release(config *common.RunnerConfig, data common.Execu
 		// Remove machine if we already used it
 		if config != nil && config.Machine != nil &&
 			config.Machine.MaxBuilds > 0 && details.UsedCount >= config.Machine.MaxBuilds {
-			err := m.remove(details.Name, "Too many builds")
+			err := m.remove(config, details.Name, "Too many builds")
+			if err == nil {
+				return
+			}
+		}
+
+		// Remove machine retired while running the job
+		if details.Retired {
+			err := m.remove(config, details.Name, "Retired")
 			if err == nil {
 				return
 			}
 		}
+
+		// Remove machine interrupted while running the job
+		if details.Interrupted {
+			err := m.remove(config, details.Name, details.Reason)
+			if err == nil {
+				return
+			}
+		}
+
+		// Take the machine out of the rotation if its jobs keep failing
+		if hasTooManySystemFailures(config, details) {
+			m.handleUnhealthyMachine(config, details, fmt.Sprintf("%d system failures in a row", details.SystemFailures))
+			return
+		}
 		details.State = machineStateIdle
 	}
 }
@@ -475,7 +574,18 @@ func newMachineProvider(name, executor string) *machineProvider {
 		name:     name,
 		details:  make(machinesDetails),
 		machine:  docker.NewMachineCommand(),
+		plugins:  make(map[string]docker.Machine),
 		provider: provider,
+		jobRates: newJobRates(),
+
+		healthChecker:       newDockerHealthChecker(),
+		interruptionChecker: &urlInterruptionChecker{client: &http.Client{}},
+
+		restoredStates: make(map[string]bool),
+		savedStates:    make(map[string][]byte),
+		newPluginMachine: func(path string, args ...string) docker.Machine {
+			return autoscaler.NewMachine(autoscaler.NewPlugin(path, args...))
+		},
 		totalActions: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "gitlab_runner_autoscaling_actions_total",
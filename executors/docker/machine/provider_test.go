@@ -261,21 +261,21 @@ func TestMachineDetails(t *testing.T) {
 
 func TestMachineFindFree(t *testing.T) {
 	p, tm := testMachineProvider("no-can-connect")
-	d1 := p.findFreeMachine(false)
+	d1 := p.findFreeMachine(machineDefaultConfig, false)
 	assert.Nil(t, d1, "no machines, return nil")
 
-	d2 := p.findFreeMachine(false, "machine1")
+	d2 := p.findFreeMachine(machineDefaultConfig, false, "machine1")
 	assert.NotNil(t, d2, "acquire one machine")
 
-	d3 := p.findFreeMachine(false, "machine1")
+	d3 := p.findFreeMachine(machineDefaultConfig, false, "machine1")
 	assert.Nil(t, d3, "fail to acquire that machine")
 
-	d4 := p.findFreeMachine(false, "machine1", "machine2")
+	d4 := p.findFreeMachine(machineDefaultConfig, false, "machine1", "machine2")
 	assert.NotNil(t, d4, "acquire a new machine")
 	assert.NotEqual(t, d2, d4, "and it's a different machine")
 
 	assert.Len(t, tm.machines, 1, "has one machine")
-	d5 := p.findFreeMachine(false, "machine1", "no-can-connect")
+	d5 := p.findFreeMachine(machineDefaultConfig, false, "machine1", "no-can-connect")
 	assert.Nil(t, d5, "fails to acquire machine to which he can't connect")
 }
 
@@ -300,7 +300,7 @@ func TestMachineCreationAndRemoval(t *testing.T) {
 	assert.NoError(t, <-errCh)
 	assert.Equal(t, machineStateUsed, d3.State)
 
-	err := p.remove(d.Name)
+	err := p.remove(machineDefaultConfig, d.Name)
 	assert.NoError(t, err)
 	assert.Equal(t, machineStateRemoving, d.State)
 }
@@ -553,3 +553,61 @@ func TestIntermediateMachineList(t *testing.T) {
 	intermediateMachine := p.intermediateMachineList([]string{"machine1", "machine2"})
 	assert.Equal(t, expectedIntermediateMachines, intermediateMachine)
 }
+
+func TestMachineForPlugin(t *testing.T) {
+	p, dm := testMachineProvider()
+
+	var created []string
+	p.newPluginMachine = func(path string, args ...string) docker.Machine {
+		created = append(created, path)
+		return &testMachine{}
+	}
+
+	pluginConfig := func(plugin string, args ...string) *common.RunnerConfig {
+		return &common.RunnerConfig{
+			RunnerSettings: common.RunnerSettings{
+				Machine: &common.DockerMachine{
+					MachineName: "%s",
+					Plugin:      plugin,
+					PluginArgs:  args,
+				},
+			},
+		}
+	}
+
+	assert.Equal(t, dm, p.machineFor(nil), "uses docker-machine without config")
+	assert.Equal(t, dm, p.machineFor(machineDefaultConfig), "uses docker-machine without plugin")
+
+	m1 := p.machineFor(pluginConfig("/usr/bin/cloud-plugin", "--region", "eu"))
+	assert.NotEqual(t, dm, m1, "uses the plugin")
+	assert.True(t, m1 == p.machineFor(pluginConfig("/usr/bin/cloud-plugin", "--region", "eu")),
+		"reuses the plugin machine for the same command")
+
+	m2 := p.machineFor(pluginConfig("/usr/bin/cloud-plugin", "--region", "us"))
+	assert.True(t, m1 != m2, "uses a separate plugin machine for other arguments")
+
+	assert.Equal(t, []string{"/usr/bin/cloud-plugin", "/usr/bin/cloud-plugin"}, created)
+}
+
+func TestMachineAcquireWithPlugin(t *testing.T) {
+	p, dm := testMachineProvider("test-machine-docker-machine")
+	pm := &testMachine{
+		machines: []string{"test-machine-plugin"},
+		Created:  make(chan bool, 10),
+		Removed:  make(chan bool, 10),
+		Stopped:  make(chan bool, 10),
+	}
+	p.newPluginMachine = func(path string, args ...string) docker.Machine {
+		return pm
+	}
+
+	config := createMachineConfig(t, 0, 5)
+	config.Machine.Plugin = "/usr/bin/cloud-plugin"
+
+	d, err := p.Acquire(config)
+	require.NoError(t, err)
+	require.NotNil(t, d)
+	assert.Equal(t, "test-machine-plugin", d.(*machineDetails).Name, "acquires the machine listed by the plugin")
+
+	assert.Len(t, dm.machines, 1, "doesn't touch the docker-machine machines")
+}
@@ -0,0 +1,110 @@
+package machine
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+// jobRates stores the times of the jobs received by each runner, to measure
+// the rate of jobs within the IdleRateWindow
+type jobRates struct {
+	jobs map[string][]time.Time
+	lock sync.Mutex
+}
+
+func newJobRates() *jobRates {
+	return &jobRates{
+		jobs: make(map[string][]time.Time),
+	}
+}
+
+func (r *jobRates) add(runner string, window time.Duration, now time.Time) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.jobs[runner] = append(r.prune(runner, window, now), now)
+}
+
+func (r *jobRates) count(runner string, window time.Duration, now time.Time) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	jobs := r.prune(runner, window, now)
+	r.jobs[runner] = jobs
+
+	return len(jobs)
+}
+
+// prune returns the jobs of the runner received within the window
+func (r *jobRates) prune(runner string, window time.Duration, now time.Time) []time.Time {
+	jobs := r.jobs[runner]
+
+	idx := 0
+	for idx < len(jobs) && now.Sub(jobs[idx]) > window {
+		idx++
+	}
+
+	return jobs[idx:]
+}
+
+func idleRateWindow(config *common.RunnerConfig) time.Duration {
+	return time.Duration(config.Machine.IdleRateWindow) * time.Second
+}
+
+// idleCount returns the number of idle machines to keep for the runner. It's
+// IdleCount, unless IdleScaleFactor or IdleRateWindow is set, in which case it
+// follows the load of the runner, between IdleCountMin and IdleCount
+func (m *machineProvider) idleCount(config *common.RunnerConfig, usedCount int) int {
+	maxIdleCount := config.Machine.GetIdleCount()
+	scaleFactor := config.Machine.GetIdleScaleFactor()
+	rateWindow := idleRateWindow(config)
+
+	if scaleFactor <= 0 && rateWindow <= 0 {
+		return maxIdleCount
+	}
+
+	idleCount := int(math.Ceil(float64(usedCount) * scaleFactor))
+
+	if rateWindow > 0 {
+		jobsCount := m.jobRates.count(config.UniqueID(), rateWindow, time.Now())
+		if jobsCount > idleCount {
+			idleCount = jobsCount
+		}
+	}
+
+	if minIdleCount := config.Machine.GetIdleCountMin(); idleCount < minIdleCount {
+		idleCount = minIdleCount
+	}
+
+	if idleCount > maxIdleCount {
+		idleCount = maxIdleCount
+	}
+
+	return idleCount
+}
+
+// usedCount returns how many of the machines are running jobs
+func (m *machineProvider) usedCount(machines []string) (count int) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	for _, name := range machines {
+		details := m.details[name]
+		if details != nil && details.State == machineStateUsed {
+			count++
+		}
+	}
+
+	return count
+}
+
+func (m *machineProvider) ObserveJobRequest(config *common.RunnerConfig) {
+	if config.Machine == nil || config.Machine.IdleRateWindow <= 0 {
+		return
+	}
+
+	m.jobRates.add(config.UniqueID(), idleRateWindow(config), time.Now())
+}
@@ -0,0 +1,133 @@
+package machine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+func TestJobRates(t *testing.T) {
+	r := newJobRates()
+	now := time.Now()
+	window := time.Minute
+
+	r.add("runner1", window, now.Add(-3*time.Minute))
+	r.add("runner1", window, now.Add(-30*time.Second))
+	r.add("runner1", window, now.Add(-10*time.Second))
+	r.add("runner2", window, now)
+
+	assert.Equal(t, 2, r.count("runner1", window, now))
+	assert.Equal(t, 1, r.count("runner2", window, now))
+	assert.Equal(t, 0, r.count("runner3", window, now))
+	assert.Equal(t, 0, r.count("runner1", window, now.Add(time.Minute)), "jobs out of the window are pruned")
+}
+
+func TestIdleCount(t *testing.T) {
+	tests := map[string]struct {
+		machine           common.DockerMachine
+		usedCount         int
+		jobs              int
+		expectedIdleCount int
+	}{
+		"fixed idle count": {
+			machine:           common.DockerMachine{IdleCount: 5},
+			usedCount:         100,
+			expectedIdleCount: 5,
+		},
+		"scale factor": {
+			machine:           common.DockerMachine{IdleCount: 50, IdleScaleFactor: 0.5},
+			usedCount:         9,
+			expectedIdleCount: 5,
+		},
+		"scale factor capped by idle count": {
+			machine:           common.DockerMachine{IdleCount: 10, IdleScaleFactor: 1.5},
+			usedCount:         20,
+			expectedIdleCount: 10,
+		},
+		"scale factor with minimum": {
+			machine:           common.DockerMachine{IdleCount: 10, IdleCountMin: 2, IdleScaleFactor: 0.5},
+			usedCount:         0,
+			expectedIdleCount: 2,
+		},
+		"minimum above idle count": {
+			machine:           common.DockerMachine{IdleCount: 3, IdleCountMin: 5, IdleScaleFactor: 0.5},
+			expectedIdleCount: 3,
+		},
+		"job rate above scale factor": {
+			machine:           common.DockerMachine{IdleCount: 10, IdleScaleFactor: 0.1, IdleRateWindow: 300},
+			usedCount:         10,
+			jobs:              4,
+			expectedIdleCount: 4,
+		},
+		"job rate below scale factor": {
+			machine:           common.DockerMachine{IdleCount: 10, IdleScaleFactor: 1, IdleRateWindow: 300},
+			usedCount:         6,
+			jobs:              4,
+			expectedIdleCount: 6,
+		},
+		"job rate without scale factor": {
+			machine:           common.DockerMachine{IdleCount: 10, IdleCountMin: 1, IdleRateWindow: 300},
+			usedCount:         6,
+			jobs:              3,
+			expectedIdleCount: 3,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			p, _ := testMachineProvider()
+
+			machine := tt.machine
+			config := &common.RunnerConfig{
+				RunnerCredentials: common.RunnerCredentials{Token: "token"},
+				RunnerSettings:    common.RunnerSettings{Machine: &machine},
+			}
+			require.NoError(t, config.Machine.CompilePeriods())
+
+			for i := 0; i < tt.jobs; i++ {
+				p.ObserveJobRequest(config)
+			}
+
+			assert.Equal(t, tt.expectedIdleCount, p.idleCount(config, tt.usedCount))
+		})
+	}
+}
+
+func TestObserveJobRequestWithoutRateWindow(t *testing.T) {
+	p, _ := testMachineProvider()
+
+	config := createMachineConfig(t, 1, 5)
+	p.ObserveJobRequest(config)
+
+	assert.Empty(t, p.jobRates.jobs)
+}
+
+func TestMachineIdleScaleFactor(t *testing.T) {
+	p, m := testMachineProvider("test-machine-1", "test-machine-2", "test-machine-3", "test-machine-4")
+
+	config := createMachineConfig(t, 10, 1000)
+	config.Machine.IdleScaleFactor = 0.5
+	config.Machine.IdleCountMin = 1
+
+	for _, name := range m.machines {
+		p.machineDetails(name, false).State = machineStateUsed
+	}
+
+	_, err := p.Acquire(config)
+	assert.Error(t, err, "no free machines")
+
+	for i := 0; i < 2; i++ {
+		<-m.Created
+	}
+
+	// the creation goroutines still update the details of the machines
+	// once they're created, so only the number of machines is checked
+	p.lock.RLock()
+	total := len(p.details)
+	p.lock.RUnlock()
+	assert.Equal(t, 6, total, "pre-creates idle machines for half of the used ones")
+}
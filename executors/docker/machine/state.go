@@ -1,5 +1,7 @@
 package machine
 
+import "fmt"
+
 type machineState int
 
 const (
@@ -8,6 +10,7 @@ const (
 	machineStateCreating
 	machineStateUsed
 	machineStateRemoving
+	machineStateQuarantined
 )
 
 func (t machineState) String() string {
@@ -22,6 +25,8 @@ func (t machineState) String() string {
 		return "Used"
 	case machineStateRemoving:
 		return "Removing"
+	case machineStateQuarantined:
+		return "Quarantined"
 	default:
 		return "Unknown"
 	}
@@ -30,3 +35,14 @@ func (t machineState) String() string {
 func (t machineState) MarshalText() ([]byte, error) {
 	return []byte(t.String()), nil
 }
+
+func (t *machineState) UnmarshalText(text []byte) error {
+	for state := machineStateIdle; state <= machineStateQuarantined; state++ {
+		if state.String() == string(text) {
+			*t = state
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown machine state %q", text)
+}
@@ -0,0 +1,297 @@
+package docker
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/docker/go-units"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+const (
+	// MemoryOverwriteVariableName is the key for the JobVariable containing user overwritten memory limit
+	MemoryOverwriteVariableName = "DOCKER_MEMORY"
+	// CPUSOverwriteVariableName is the key for the JobVariable containing user overwritten number of CPUs
+	CPUSOverwriteVariableName = "DOCKER_CPUS"
+	// ShmSizeOverwriteVariableName is the key for the JobVariable containing user overwritten shared memory size
+	ShmSizeOverwriteVariableName = "DOCKER_SHM_SIZE"
+	// RuntimeOverwriteVariableName is the key for the JobVariable containing user overwritten runtime
+	RuntimeOverwriteVariableName = "DOCKER_RUNTIME"
+	// PrivilegedOverwriteVariableName is the key for the JobVariable containing user overwritten privileged flag
+	PrivilegedOverwriteVariableName = "DOCKER_PRIVILEGED"
+)
+
+type overwriteTooHighError struct {
+	resource  string
+	max       string
+	overwrite string
+}
+
+func (o *overwriteTooHighError) Error() string {
+	return fmt.Sprintf("the resource %q requested %q is higher than limit allowed %q", o.resource, o.overwrite, o.max)
+}
+
+func (o *overwriteTooHighError) Is(err error) bool {
+	_, ok := err.(*overwriteTooHighError)
+	return ok
+}
+
+type overwriteNotAllowedError struct {
+	field     string
+	overwrite string
+}
+
+func (o *overwriteNotAllowedError) Error() string {
+	return fmt.Sprintf("the value %q requested for %q is not allowed", o.overwrite, o.field)
+}
+
+func (o *overwriteNotAllowedError) Is(err error) bool {
+	_, ok := err.(*overwriteNotAllowedError)
+	return ok
+}
+
+type overwrites struct {
+	memory     string
+	cpus       string
+	shmSize    int64
+	runtime    string
+	privileged bool
+}
+
+func createOverwrites(
+	config *common.DockerConfig,
+	variables common.JobVariables,
+	logger common.BuildLogger,
+) (*overwrites, error) {
+	var err error
+	o := &overwrites{}
+
+	variables = variables.Expand()
+
+	o.memory, err = o.evaluateMaxMemoryOverwrite(
+		"Memory",
+		config.Memory,
+		config.MemoryOverwriteMaxAllowed,
+		variables.Get(MemoryOverwriteVariableName),
+		logger,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	o.cpus, err = o.evaluateMaxCPUSOverwrite(
+		"CPUS",
+		config.CPUS,
+		config.CPUSOverwriteMaxAllowed,
+		variables.Get(CPUSOverwriteVariableName),
+		logger,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	o.shmSize, err = o.evaluateMaxShmSizeOverwrite(
+		"ShmSize",
+		config.ShmSize,
+		config.ShmSizeOverwriteMaxAllowed,
+		variables.Get(ShmSizeOverwriteVariableName),
+		logger,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	o.runtime, err = o.evaluateAllowedValueOverwrite(
+		"Runtime",
+		config.Runtime,
+		config.RuntimeOverwriteAllowed,
+		variables.Get(RuntimeOverwriteVariableName),
+		logger,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	o.privileged, err = o.evaluateBoolControlledOverwrite(
+		"Privileged",
+		config.Privileged,
+		config.PrivilegedOverwriteAllowed,
+		variables.Get(PrivilegedOverwriteVariableName),
+		logger,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// apply returns a copy of the provided configuration with the overwritten
+// values set, so that the runner-level configuration is never modified
+func (o *overwrites) apply(config *common.DockerConfig) *common.DockerConfig {
+	overwritten := *config
+	overwritten.Memory = o.memory
+	overwritten.CPUS = o.cpus
+	overwritten.ShmSize = o.shmSize
+	overwritten.Runtime = o.runtime
+	overwritten.Privileged = o.privileged
+
+	return &overwritten
+}
+
+func (o *overwrites) evaluateMaxMemoryOverwrite(
+	fieldName, value, maxValue, overwriteValue string,
+	logger common.BuildLogger,
+) (string, error) {
+	if maxValue == "" {
+		logger.Debugln("setting allowing overrides for", fieldName, "is empty, disabling override.")
+		return value, nil
+	}
+
+	if overwriteValue == "" {
+		return value, nil
+	}
+
+	maxBytes, err := units.RAMInBytes(maxValue)
+	if err != nil {
+		return value, fmt.Errorf("parsing memory limit: %q", err.Error())
+	}
+
+	overwriteBytes, err := units.RAMInBytes(overwriteValue)
+	if err != nil {
+		return value, fmt.Errorf("parsing memory limit: %q", err.Error())
+	}
+
+	if overwriteBytes > maxBytes {
+		return "", &overwriteTooHighError{
+			resource:  fieldName,
+			max:       maxValue,
+			overwrite: overwriteValue,
+		}
+	}
+
+	logger.Println(fmt.Sprintf("%q overwritten with %q", fieldName, overwriteValue))
+
+	return overwriteValue, nil
+}
+
+func (o *overwrites) evaluateMaxCPUSOverwrite(
+	fieldName, value, maxValue, overwriteValue string,
+	logger common.BuildLogger,
+) (string, error) {
+	if maxValue == "" {
+		logger.Debugln("setting allowing overrides for", fieldName, "is empty, disabling override.")
+		return value, nil
+	}
+
+	if overwriteValue == "" {
+		return value, nil
+	}
+
+	maxCPUS, ok := new(big.Rat).SetString(maxValue)
+	if !ok {
+		return value, fmt.Errorf("failed to parse %v as a rational number", maxValue)
+	}
+
+	overwriteCPUS, ok := new(big.Rat).SetString(overwriteValue)
+	if !ok {
+		return value, fmt.Errorf("failed to parse %v as a rational number", overwriteValue)
+	}
+
+	if overwriteCPUS.Cmp(maxCPUS) == 1 {
+		return "", &overwriteTooHighError{
+			resource:  fieldName,
+			max:       maxValue,
+			overwrite: overwriteValue,
+		}
+	}
+
+	logger.Println(fmt.Sprintf("%q overwritten with %q", fieldName, overwriteValue))
+
+	return overwriteValue, nil
+}
+
+func (o *overwrites) evaluateMaxShmSizeOverwrite(
+	fieldName string,
+	value, maxValue int64,
+	overwriteValue string,
+	logger common.BuildLogger,
+) (int64, error) {
+	if maxValue <= 0 {
+		logger.Debugln("setting allowing overrides for", fieldName, "is empty, disabling override.")
+		return value, nil
+	}
+
+	if overwriteValue == "" {
+		return value, nil
+	}
+
+	overwriteBytes, err := units.RAMInBytes(overwriteValue)
+	if err != nil {
+		return value, fmt.Errorf("parsing shared memory size: %q", err.Error())
+	}
+
+	if overwriteBytes > maxValue {
+		return 0, &overwriteTooHighError{
+			resource:  fieldName,
+			max:       strconv.FormatInt(maxValue, 10),
+			overwrite: overwriteValue,
+		}
+	}
+
+	logger.Println(fmt.Sprintf("%q overwritten with %q", fieldName, overwriteValue))
+
+	return overwriteBytes, nil
+}
+
+func (o *overwrites) evaluateAllowedValueOverwrite(
+	fieldName, value string,
+	allowedValues []string,
+	overwriteValue string,
+	logger common.BuildLogger,
+) (string, error) {
+	if len(allowedValues) == 0 {
+		logger.Debugln("List of values allowing overrides for", fieldName, "is empty, disabling override.")
+		return value, nil
+	}
+
+	if overwriteValue == "" {
+		return value, nil
+	}
+
+	for _, allowed := range allowedValues {
+		if overwriteValue == allowed {
+			logger.Println(fmt.Sprintf("%q overwritten with %q", fieldName, overwriteValue))
+			return overwriteValue, nil
+		}
+	}
+
+	return "", &overwriteNotAllowedError{field: fieldName, overwrite: overwriteValue}
+}
+
+func (o *overwrites) evaluateBoolControlledOverwrite(
+	fieldName string,
+	value, canOverride bool,
+	overwriteValue string,
+	logger common.BuildLogger,
+) (bool, error) {
+	if !canOverride {
+		logger.Debugln("Overrides for", fieldName, "are not allowed, disabling override.")
+		return value, nil
+	}
+
+	if overwriteValue == "" {
+		return value, nil
+	}
+
+	overwrite, err := strconv.ParseBool(overwriteValue)
+	if err != nil {
+		return value, fmt.Errorf("parsing %s overwrite: %w", fieldName, err)
+	}
+
+	logger.Println(fmt.Sprintf("%q overwritten with %t", fieldName, overwrite))
+
+	return overwrite, nil
+}
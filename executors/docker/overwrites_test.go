@@ -0,0 +1,201 @@
+package docker
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+func stdoutLogger() common.BuildLogger {
+	return common.NewBuildLogger(&common.Trace{Writer: os.Stdout}, logrus.WithFields(logrus.Fields{}))
+}
+
+func TestOverwrites(t *testing.T) {
+	overwritesAllowedConfig := &common.DockerConfig{
+		Memory:                     "1g",
+		MemoryOverwriteMaxAllowed:  "4g",
+		CPUS:                       "1",
+		CPUSOverwriteMaxAllowed:    "4",
+		ShmSize:                    1024,
+		ShmSizeOverwriteMaxAllowed: 1048576,
+		Runtime:                    "runc",
+		RuntimeOverwriteAllowed:    []string{"runc", "nvidia"},
+		PrivilegedOverwriteAllowed: true,
+	}
+
+	tests := map[string]struct {
+		config        *common.DockerConfig
+		variables     common.JobVariables
+		expected      *overwrites
+		expectedError error
+	}{
+		"empty configuration": {
+			config:   &common.DockerConfig{},
+			expected: &overwrites{},
+		},
+		"overwrites not allowed": {
+			config: &common.DockerConfig{
+				Memory:  "1g",
+				CPUS:    "1",
+				ShmSize: 1024,
+				Runtime: "runc",
+			},
+			variables: common.JobVariables{
+				{Key: MemoryOverwriteVariableName, Value: "2g"},
+				{Key: CPUSOverwriteVariableName, Value: "2"},
+				{Key: ShmSizeOverwriteVariableName, Value: "2048"},
+				{Key: RuntimeOverwriteVariableName, Value: "nvidia"},
+				{Key: PrivilegedOverwriteVariableName, Value: "true"},
+			},
+			expected: &overwrites{
+				memory:  "1g",
+				cpus:    "1",
+				shmSize: 1024,
+				runtime: "runc",
+			},
+		},
+		"no overwrites requested": {
+			config: overwritesAllowedConfig,
+			expected: &overwrites{
+				memory:  "1g",
+				cpus:    "1",
+				shmSize: 1024,
+				runtime: "runc",
+			},
+		},
+		"overwrites within limits": {
+			config: overwritesAllowedConfig,
+			variables: common.JobVariables{
+				{Key: MemoryOverwriteVariableName, Value: "2g"},
+				{Key: CPUSOverwriteVariableName, Value: "1/2"},
+				{Key: ShmSizeOverwriteVariableName, Value: "512k"},
+				{Key: RuntimeOverwriteVariableName, Value: "nvidia"},
+				{Key: PrivilegedOverwriteVariableName, Value: "true"},
+			},
+			expected: &overwrites{
+				memory:     "2g",
+				cpus:       "1/2",
+				shmSize:    524288,
+				runtime:    "nvidia",
+				privileged: true,
+			},
+		},
+		"overwrites expanded from other variables": {
+			config: overwritesAllowedConfig,
+			variables: common.JobVariables{
+				{Key: "JOB_MEMORY", Value: "3g"},
+				{Key: MemoryOverwriteVariableName, Value: "$JOB_MEMORY"},
+			},
+			expected: &overwrites{
+				memory:  "3g",
+				cpus:    "1",
+				shmSize: 1024,
+				runtime: "runc",
+			},
+		},
+		"memory too high": {
+			config: overwritesAllowedConfig,
+			variables: common.JobVariables{
+				{Key: MemoryOverwriteVariableName, Value: "8g"},
+			},
+			expectedError: new(overwriteTooHighError),
+		},
+		"cpus too high": {
+			config: overwritesAllowedConfig,
+			variables: common.JobVariables{
+				{Key: CPUSOverwriteVariableName, Value: "4.5"},
+			},
+			expectedError: new(overwriteTooHighError),
+		},
+		"shm size too high": {
+			config: overwritesAllowedConfig,
+			variables: common.JobVariables{
+				{Key: ShmSizeOverwriteVariableName, Value: "2m"},
+			},
+			expectedError: new(overwriteTooHighError),
+		},
+		"runtime not allowed": {
+			config: overwritesAllowedConfig,
+			variables: common.JobVariables{
+				{Key: RuntimeOverwriteVariableName, Value: "kata"},
+			},
+			expectedError: new(overwriteNotAllowedError),
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			values, err := createOverwrites(tt.config, tt.variables, stdoutLogger())
+			if tt.expectedError != nil {
+				assert.True(t, errors.Is(err, tt.expectedError), "expected %T, got %v", tt.expectedError, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, values)
+		})
+	}
+}
+
+func TestOverwritesMalformedValues(t *testing.T) {
+	config := &common.DockerConfig{
+		MemoryOverwriteMaxAllowed:  "4g",
+		CPUSOverwriteMaxAllowed:    "4",
+		ShmSizeOverwriteMaxAllowed: 1048576,
+		PrivilegedOverwriteAllowed: true,
+	}
+
+	for _, key := range []string{
+		MemoryOverwriteVariableName,
+		CPUSOverwriteVariableName,
+		ShmSizeOverwriteVariableName,
+		PrivilegedOverwriteVariableName,
+	} {
+		t.Run(key, func(t *testing.T) {
+			variables := common.JobVariables{{Key: key, Value: "invalid"}}
+
+			_, err := createOverwrites(config, variables, stdoutLogger())
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestOverwritesApplyDoesNotModifyConfig(t *testing.T) {
+	config := &common.DockerConfig{
+		Memory:     "1g",
+		CPUS:       "1",
+		ShmSize:    1024,
+		Runtime:    "runc",
+		Privileged: false,
+		Image:      "alpine",
+	}
+
+	o := &overwrites{
+		memory:     "2g",
+		cpus:       "2",
+		shmSize:    2048,
+		runtime:    "nvidia",
+		privileged: true,
+	}
+
+	overwritten := o.apply(config)
+
+	assert.Equal(t, "2g", overwritten.Memory)
+	assert.Equal(t, "2", overwritten.CPUS)
+	assert.Equal(t, int64(2048), overwritten.ShmSize)
+	assert.Equal(t, "nvidia", overwritten.Runtime)
+	assert.True(t, overwritten.Privileged)
+	assert.Equal(t, "alpine", overwritten.Image)
+
+	assert.Equal(t, "1g", config.Memory)
+	assert.Equal(t, "1", config.CPUS)
+	assert.Equal(t, int64(1024), config.ShmSize)
+	assert.Equal(t, "runc", config.Runtime)
+	assert.False(t, config.Privileged)
+}
@@ -0,0 +1,88 @@
+package docker
+
+import (
+	"github.com/docker/docker/api/types"
+
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker"
+)
+
+func (e *executor) detectCapabilities() error {
+	capabilities, err := docker.DetectCapabilities(e.Context, e.client)
+	if err != nil {
+		return err
+	}
+
+	e.capabilities = capabilities
+	if !capabilities.Podman {
+		return nil
+	}
+
+	e.Println("Using Podman", capabilities.Version, "through its Docker compatible API ...")
+
+	// Podman doesn't report the OSType, while only running Linux containers
+	if e.info.OSType == "" {
+		e.info.OSType = osTypeLinux
+	}
+
+	return nil
+}
+
+// usesServiceExtraHosts returns true when the services can't be reached
+// through network aliases on the user-defined network, and the build
+// container needs to resolve them through extra hosts instead
+func (e *executor) usesServiceExtraHosts() bool {
+	return e.capabilities.Podman && !e.capabilities.NetworkAliases && e.networkMode.UserDefined() != ""
+}
+
+// skipsVolumePermissions returns true when the engine takes care of the
+// ownership of new volumes by itself
+func (e *executor) skipsVolumePermissions() bool {
+	return e.capabilities.Podman && !e.capabilities.VolumePermissions
+}
+
+func (e *executor) serviceNetworkAliases(aliases []string) []string {
+	if e.usesServiceExtraHosts() {
+		return nil
+	}
+
+	return aliases
+}
+
+func (e *executor) buildServiceExtraHosts(linksMap map[string]*types.Container) []string {
+	var extraHosts []string
+
+	networkName := e.networkMode.NetworkName()
+	for alias, service := range linksMap {
+		serviceContainer, err := e.client.ContainerInspect(e.Context, service.ID)
+		if err != nil {
+			e.Warningln("Unable to resolve the address of service", alias+":", err)
+			continue
+		}
+
+		if serviceContainer.NetworkSettings == nil || serviceContainer.NetworkSettings.Networks[networkName] == nil {
+			e.Warningln("Service", alias, "is not connected to network", networkName)
+			continue
+		}
+
+		ip := serviceContainer.NetworkSettings.Networks[networkName].IPAddress
+		if ip == "" {
+			e.Warningln("Service", alias, "has no address on network", networkName)
+			continue
+		}
+
+		extraHosts = append(extraHosts, alias+":"+ip)
+	}
+
+	return extraHosts
+}
+
+func (e *executor) extraHosts() []string {
+	if len(e.serviceExtraHosts) == 0 {
+		return e.Config.Docker.ExtraHosts
+	}
+
+	extraHosts := make([]string, 0, len(e.Config.Docker.ExtraHosts)+len(e.serviceExtraHosts))
+	extraHosts = append(extraHosts, e.Config.Docker.ExtraHosts...)
+
+	return append(extraHosts, e.serviceExtraHosts...)
+}
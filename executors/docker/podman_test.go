@@ -0,0 +1,149 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker"
+)
+
+func newPodmanTestExecutor(c docker.Client, capabilities docker.Capabilities) *executor {
+	return &executor{
+		AbstractExecutor: executors.AbstractExecutor{
+			Context: context.Background(),
+			Config: common.RunnerConfig{
+				RunnerSettings: common.RunnerSettings{
+					Docker: &common.DockerConfig{
+						ExtraHosts: []string{"gitlab.example.com:10.0.0.1"},
+					},
+				},
+			},
+			Build: &common.Build{
+				Runner: &common.RunnerConfig{},
+			},
+		},
+		client:       c,
+		capabilities: capabilities,
+		networkMode:  container.NetworkMode("runner-net"),
+	}
+}
+
+func TestConnectDockerToFakePodmanServer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response interface{}
+
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/version"):
+			response = types.Version{
+				Version:    "2.2.1",
+				Components: []types.ComponentVersion{{Name: "Podman Engine", Version: "2.2.1"}},
+			}
+		case strings.HasSuffix(r.URL.Path, "/info"):
+			// Podman doesn't report the OSType
+			response = types.Info{Architecture: "x86_64", OperatingSystem: "fedora"}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	e := newPodmanTestExecutor(nil, docker.Capabilities{})
+	e.Config.Docker.Credentials = docker.Credentials{Host: server.URL}
+	e.ExecutorOptions = executors.ExecutorOptions{
+		Metadata: map[string]string{
+			metadataOSType: osTypeLinux,
+		},
+	}
+
+	require.NoError(t, e.connectDocker())
+	assert.Equal(t, docker.Capabilities{Podman: true, Version: "2.2.1"}, e.capabilities)
+	assert.Equal(t, osTypeLinux, e.info.OSType)
+	assert.True(t, e.usesServiceExtraHosts())
+	assert.True(t, e.skipsVolumePermissions())
+}
+
+func TestServiceNetworkAliases(t *testing.T) {
+	aliases := []string{"postgres", "db"}
+
+	tests := map[string]struct {
+		capabilities    docker.Capabilities
+		networkMode     container.NetworkMode
+		expectedAliases []string
+	}{
+		"Docker Engine": {
+			capabilities:    docker.Capabilities{NetworkAliases: true, VolumePermissions: true},
+			networkMode:     "runner-net",
+			expectedAliases: aliases,
+		},
+		"Podman with network aliases": {
+			capabilities:    docker.Capabilities{Podman: true, NetworkAliases: true},
+			networkMode:     "runner-net",
+			expectedAliases: aliases,
+		},
+		"Podman without network aliases": {
+			capabilities: docker.Capabilities{Podman: true},
+			networkMode:  "runner-net",
+		},
+		"Podman without network aliases on the default network": {
+			capabilities:    docker.Capabilities{Podman: true},
+			networkMode:     "bridge",
+			expectedAliases: aliases,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			e := newPodmanTestExecutor(nil, tt.capabilities)
+			e.networkMode = tt.networkMode
+
+			assert.Equal(t, tt.expectedAliases, e.serviceNetworkAliases(aliases))
+		})
+	}
+}
+
+func TestBuildServiceExtraHosts(t *testing.T) {
+	c := new(docker.MockClient)
+	defer c.AssertExpectations(t)
+
+	c.On("ContainerInspect", mock.Anything, "db-id").
+		Return(types.ContainerJSON{
+			NetworkSettings: &types.NetworkSettings{
+				Networks: map[string]*network.EndpointSettings{
+					"runner-net": {IPAddress: "10.88.0.5"},
+				},
+			},
+		}, nil).
+		Once()
+	c.On("ContainerInspect", mock.Anything, "redis-id").
+		Return(types.ContainerJSON{}, errors.New("test error")).
+		Once()
+
+	e := newPodmanTestExecutor(c, docker.Capabilities{Podman: true})
+
+	extraHosts := e.buildServiceExtraHosts(map[string]*types.Container{
+		"db":    {ID: "db-id"},
+		"redis": {ID: "redis-id"},
+	})
+	assert.Equal(t, []string{"db:10.88.0.5"}, extraHosts)
+
+	e.serviceExtraHosts = extraHosts
+	assert.Equal(t, []string{"gitlab.example.com:10.0.0.1", "db:10.88.0.5"}, e.extraHosts())
+}
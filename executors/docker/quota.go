@@ -0,0 +1,67 @@
+package docker
+
+import (
+	"fmt"
+
+	"github.com/docker/docker/api/types"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+const storageOptSize = "size"
+
+// storageOptSizeDrivers lists the storage drivers supporting the size
+// storage option unconditionally. overlay2 supports it only when backed by xfs
+var storageOptSizeDrivers = map[string]bool{
+	"devicemapper":  true,
+	"btrfs":         true,
+	"zfs":           true,
+	"windowsfilter": true,
+}
+
+func isStorageOptSizeSupported(info types.Info) bool {
+	if storageOptSizeDrivers[info.Driver] {
+		return true
+	}
+
+	if info.Driver != "overlay2" {
+		return false
+	}
+
+	for _, status := range info.DriverStatus {
+		if status[0] == "Backing Filesystem" {
+			return status[1] == "xfs"
+		}
+	}
+
+	return false
+}
+
+func (e *executor) prepareStorageOpt() error {
+	storageOpt := e.Config.Docker.StorageOpt
+	if _, ok := storageOpt[storageOptSize]; !ok || isStorageOptSizeSupported(e.info) {
+		e.storageOpt = storageOpt
+		return nil
+	}
+
+	policy, err := e.Config.Docker.DiskQuotaPolicy.Get()
+	if err != nil {
+		return err
+	}
+
+	msg := fmt.Sprintf("the %q storage driver doesn't support limiting the container size", e.info.Driver)
+	if policy == common.DiskQuotaPolicyRefuse {
+		return common.MakeBuildError("%s, refusing to run the job", msg)
+	}
+
+	e.Warningln(msg + ", the build container size will not be limited")
+
+	e.storageOpt = make(map[string]string)
+	for key, value := range storageOpt {
+		if key != storageOptSize {
+			e.storageOpt[key] = value
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,155 @@
+package docker
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors"
+)
+
+func TestIsStorageOptSizeSupported(t *testing.T) {
+	tests := map[string]struct {
+		info     types.Info
+		expected bool
+	}{
+		"devicemapper": {
+			info:     types.Info{Driver: "devicemapper"},
+			expected: true,
+		},
+		"overlay2 on xfs": {
+			info: types.Info{
+				Driver:       "overlay2",
+				DriverStatus: [][2]string{{"Backing Filesystem", "xfs"}, {"Supports d_type", "true"}},
+			},
+			expected: true,
+		},
+		"overlay2 on extfs": {
+			info: types.Info{
+				Driver:       "overlay2",
+				DriverStatus: [][2]string{{"Backing Filesystem", "extfs"}},
+			},
+			expected: false,
+		},
+		"overlay2 without status": {
+			info:     types.Info{Driver: "overlay2"},
+			expected: false,
+		},
+		"vfs": {
+			info:     types.Info{Driver: "vfs"},
+			expected: false,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			assert.Equal(t, tt.expected, isStorageOptSizeSupported(tt.info))
+		})
+	}
+}
+
+func TestPrepareStorageOpt(t *testing.T) {
+	storageOpt := map[string]string{"size": "10G", "other": "value"}
+
+	tests := map[string]struct {
+		storageOpt         map[string]string
+		policy             common.DockerQuotaPolicy
+		driver             string
+		expectedStorageOpt map[string]string
+		expectedBuildError bool
+		expectedError      bool
+	}{
+		"no storage options": {
+			driver: "vfs",
+		},
+		"size supported": {
+			storageOpt:         storageOpt,
+			driver:             "btrfs",
+			expectedStorageOpt: storageOpt,
+		},
+		"size not supported with default policy": {
+			storageOpt:         storageOpt,
+			driver:             "vfs",
+			expectedBuildError: true,
+		},
+		"size not supported with refuse policy": {
+			storageOpt:         storageOpt,
+			policy:             common.DiskQuotaPolicyRefuse,
+			driver:             "vfs",
+			expectedBuildError: true,
+		},
+		"size not supported with warn policy": {
+			storageOpt:         storageOpt,
+			policy:             common.DiskQuotaPolicyWarn,
+			driver:             "vfs",
+			expectedStorageOpt: map[string]string{"other": "value"},
+		},
+		"invalid policy": {
+			storageOpt:    storageOpt,
+			policy:        "invalid",
+			driver:        "vfs",
+			expectedError: true,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			e := &executor{
+				AbstractExecutor: executors.AbstractExecutor{
+					Config: common.RunnerConfig{
+						RunnerSettings: common.RunnerSettings{
+							Docker: &common.DockerConfig{
+								StorageOpt:      tt.storageOpt,
+								DiskQuotaPolicy: tt.policy,
+							},
+						},
+					},
+				},
+				info: types.Info{Driver: tt.driver},
+			}
+
+			err := e.prepareStorageOpt()
+			if tt.expectedBuildError {
+				var buildErr *common.BuildError
+				assert.True(t, errors.As(err, &buildErr), "expected build error, got %v", err)
+				return
+			}
+
+			if tt.expectedError {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedStorageOpt, e.storageOpt)
+		})
+	}
+}
+
+func TestDockerStorageOptSetting(t *testing.T) {
+	dockerConfig := &common.DockerConfig{}
+
+	cce := func(t *testing.T, config *container.Config, hostConfig *container.HostConfig) {
+		assert.Equal(t, map[string]string{"size": "10G"}, hostConfig.StorageOpt)
+	}
+
+	c, e := prepareTestDockerConfiguration(t, dockerConfig, cce)
+	defer c.AssertExpectations(t)
+
+	e.storageOpt = map[string]string{"size": "10G"}
+
+	c.On("ContainerInspect", mock.Anything, "abc").
+		Return(types.ContainerJSON{}, nil).Once()
+
+	err := e.createVolumesManager()
+	require.NoError(t, err)
+
+	_, err = e.createContainer("build", common.Image{Name: "alpine"}, []string{"/bin/sh"}, []string{})
+	assert.NoError(t, err)
+}
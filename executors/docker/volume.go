@@ -1,6 +1,7 @@
 package docker
 
 import (
+	"gitlab.com/gitlab-org/gitlab-runner/common"
 	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/volumes"
 )
 
@@ -12,7 +13,20 @@ var createVolumesManager = func(e *executor) (volumes.Manager, error) {
 		DisableCache: e.Config.Docker.DisableCache,
 	}
 
-	if e.newVolumePermissionSetter != nil {
+	if len(e.Config.Docker.VolumeDriverOps) > 0 {
+		policy, err := e.Config.Docker.DiskQuotaPolicy.Get()
+		if err != nil {
+			return nil, err
+		}
+
+		// the driver is set only together with its options, to keep the
+		// volumes created with the default driver otherwise
+		config.Driver = e.Config.Docker.VolumeDriver
+		config.DriverOpts = e.Config.Docker.VolumeDriverOps
+		config.IgnoreUnsupportedDriverOpts = policy == common.DiskQuotaPolicyWarn
+	}
+
+	if e.newVolumePermissionSetter != nil && !e.skipsVolumePermissions() {
 		setter, err := e.newVolumePermissionSetter()
 		if err != nil {
 			return nil, err
@@ -0,0 +1,182 @@
+package kubernetes
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strings"
+
+	api "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	defaultCacheVolumeSize = "1Gi"
+
+	cacheKeyAnnotation     = "cache.runner.gitlab.com/key"
+	cacheProjectAnnotation = "cache.runner.gitlab.com/project"
+)
+
+// cacheClaim is a persistent volume claim storing the cache of the job,
+// mounted in the helper container running the cache-archiver and the
+// cache-extractor
+type cacheClaim struct {
+	volumeName string
+	claimName  string
+	mountPath  string
+	key        string
+}
+
+// getCacheClaims returns the claim shared by all the jobs, mounted on the
+// cache directory, or the claims of the cache keys of the job, mounted on
+// the directories of the keys
+func (s *executor) getCacheClaims() []cacheClaim {
+	config := s.Config.Kubernetes.CacheVolume
+	if config.ClaimName != "" {
+		return []cacheClaim{
+			{
+				volumeName: "runner-cache-0",
+				claimName:  config.ClaimName,
+				mountPath:  s.CacheDir(),
+			},
+		}
+	}
+
+	if config.StorageClass == "" || s.Build.CacheDir == "" {
+		return nil
+	}
+
+	var claims []cacheClaim
+	keys := make(map[string]bool)
+	for _, cache := range s.Build.Cache {
+		key := s.Build.GetCacheKey(cache.Key)
+		mountPath := path.Join(s.Build.CacheDir, key)
+
+		// the keys escaping the cache directory are ignored by the shells too
+		if key == "" || keys[key] || !strings.HasPrefix(mountPath, s.Build.CacheDir+"/") {
+			continue
+		}
+		keys[key] = true
+
+		sum := sha256.Sum256([]byte(s.Build.ProjectUniqueDir(false) + "/" + key))
+		claims = append(claims, cacheClaim{
+			volumeName: fmt.Sprintf("runner-cache-%d", len(claims)),
+			claimName:  "runner-cache-" + hex.EncodeToString(sum[:10]),
+			mountPath:  mountPath,
+			key:        key,
+		})
+	}
+
+	return claims
+}
+
+// setupCacheClaims provisions the claims of the cache keys of the job that
+// don't exist yet. The claims outlive the job, to be used by the next ones
+func (s *executor) setupCacheClaims() error {
+	s.cacheClaims = s.getCacheClaims()
+
+	config := s.Config.Kubernetes.CacheVolume
+	if config.ClaimName != "" {
+		return nil
+	}
+
+	for _, claim := range s.cacheClaims {
+		err := s.createCacheClaim(claim)
+		if err != nil {
+			return fmt.Errorf("provisioning the cache claim %s for %q: %w", claim.claimName, claim.key, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *executor) createCacheClaim(claim cacheClaim) error {
+	namespace := s.configurationOverwrites.namespace
+	claims := s.kubeClient.CoreV1().PersistentVolumeClaims(namespace)
+
+	_, err := claims.Get(claim.claimName, metav1.GetOptions{})
+	if err == nil {
+		return nil
+	} else if !kubeerrors.IsNotFound(err) {
+		return err
+	}
+
+	config := s.Config.Kubernetes.CacheVolume
+
+	size := config.Size
+	if size == "" {
+		size = defaultCacheVolumeSize
+	}
+	quantity, err := resource.ParseQuantity(size)
+	if err != nil {
+		return fmt.Errorf("invalid size %q: %w", size, err)
+	}
+
+	accessModes := []api.PersistentVolumeAccessMode{api.ReadWriteMany}
+	if len(config.AccessModes) > 0 {
+		accessModes = nil
+		for _, mode := range config.AccessModes {
+			accessModes = append(accessModes, api.PersistentVolumeAccessMode(mode))
+		}
+	}
+
+	s.Debugln("Provisioning cache claim", claim.claimName, "for", claim.key)
+
+	_, err = claims.Create(&api.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      claim.claimName,
+			Namespace: namespace,
+			Labels: map[string]string{
+				runnerTokenHashLabel: runnerTokenHash(s.Config.Token),
+			},
+			Annotations: map[string]string{
+				cacheKeyAnnotation:     claim.key,
+				cacheProjectAnnotation: s.Build.ProjectUniqueDir(false),
+			},
+		},
+		Spec: api.PersistentVolumeClaimSpec{
+			AccessModes:      accessModes,
+			StorageClassName: &config.StorageClass,
+			Resources: api.ResourceRequirements{
+				Requests: api.ResourceList{api.ResourceStorage: quantity},
+			},
+		},
+	})
+	// another job may have provisioned it meanwhile
+	if kubeerrors.IsAlreadyExists(err) {
+		return nil
+	}
+
+	return err
+}
+
+func (s *executor) getCacheVolumes() []api.Volume {
+	var volumes []api.Volume
+	for _, claim := range s.cacheClaims {
+		volumes = append(volumes, api.Volume{
+			Name: claim.volumeName,
+			VolumeSource: api.VolumeSource{
+				PersistentVolumeClaim: &api.PersistentVolumeClaimVolumeSource{
+					ClaimName: claim.claimName,
+				},
+			},
+		})
+	}
+
+	return volumes
+}
+
+func (s *executor) getCacheVolumeMounts() []api.VolumeMount {
+	var mounts []api.VolumeMount
+	for _, claim := range s.cacheClaims {
+		mounts = append(mounts, api.VolumeMount{
+			Name:      claim.volumeName,
+			MountPath: claim.mountPath,
+		})
+	}
+
+	return mounts
+}
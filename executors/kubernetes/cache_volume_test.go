@@ -0,0 +1,213 @@
+package kubernetes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest/fake"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+func newCacheVolumeExecutor(config common.KubernetesCacheVolume, caches ...common.Cache) *executor {
+	e := newExecutor()
+	e.Config.Token = "token"
+	e.Config.CacheDir = "/cache"
+	e.Config.Kubernetes = &common.KubernetesConfig{CacheVolume: config}
+	e.configurationOverwrites = &overwrites{namespace: "ns"}
+	e.Build = &common.Build{
+		JobResponse: common.JobResponse{
+			GitInfo: common.GitInfo{RepoURL: "https://gitlab.example.com/group/project.git", Ref: "master"},
+			JobInfo: common.JobInfo{Name: "test"},
+			Cache:   caches,
+		},
+		CacheDir: "/cache/group/project",
+	}
+
+	return e
+}
+
+func TestGetCacheClaims(t *testing.T) {
+	tests := map[string]struct {
+		config        common.KubernetesCacheVolume
+		caches        []common.Cache
+		expectedPaths []string
+		expectedKeys  []string
+	}{
+		"disabled": {
+			caches: []common.Cache{{Key: "key"}},
+		},
+		"shared claim": {
+			config:        common.KubernetesCacheVolume{ClaimName: "cache", StorageClass: "standard"},
+			caches:        []common.Cache{{Key: "key"}},
+			expectedPaths: []string{"/cache"},
+			expectedKeys:  []string{""},
+		},
+		"claims of the keys": {
+			config:        common.KubernetesCacheVolume{StorageClass: "standard"},
+			caches:        []common.Cache{{Key: "key"}, {}},
+			expectedPaths: []string{"/cache/group/project/key", "/cache/group/project/test/master"},
+			expectedKeys:  []string{"key", "test/master"},
+		},
+		"duplicated keys": {
+			config:        common.KubernetesCacheVolume{StorageClass: "standard"},
+			caches:        []common.Cache{{Key: "key"}, {Key: "key"}},
+			expectedPaths: []string{"/cache/group/project/key"},
+			expectedKeys:  []string{"key"},
+		},
+		"keys escaping the cache directory": {
+			config:        common.KubernetesCacheVolume{StorageClass: "standard"},
+			caches:        []common.Cache{{Key: "../other"}, {Key: ".."}},
+			expectedPaths: nil,
+			expectedKeys:  nil,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			e := newCacheVolumeExecutor(tt.config, tt.caches...)
+
+			var paths, keys []string
+			names := make(map[string]bool)
+			for _, claim := range e.getCacheClaims() {
+				paths = append(paths, claim.mountPath)
+				keys = append(keys, claim.key)
+				names[claim.volumeName] = true
+			}
+
+			assert.Equal(t, tt.expectedPaths, paths)
+			assert.Equal(t, tt.expectedKeys, keys)
+			assert.Len(t, names, len(paths), "volume names must be unique")
+		})
+	}
+}
+
+func TestGetCacheClaimsNameIsStable(t *testing.T) {
+	config := common.KubernetesCacheVolume{StorageClass: "standard"}
+
+	first := newCacheVolumeExecutor(config, common.Cache{Key: "key"}).getCacheClaims()
+	second := newCacheVolumeExecutor(config, common.Cache{Key: "key"}).getCacheClaims()
+	other := newCacheVolumeExecutor(config, common.Cache{Key: "other"}).getCacheClaims()
+
+	require.Len(t, first, 1)
+	assert.Equal(t, first, second)
+	assert.NotEqual(t, first[0].claimName, other[0].claimName)
+}
+
+func TestSetupCacheClaims(t *testing.T) {
+	version, _ := testVersionAndCodec()
+
+	tests := map[string]struct {
+		existing       bool
+		createStatus   int
+		expectedCreate bool
+		expectedError  bool
+	}{
+		"claim exists": {
+			existing: true,
+		},
+		"claim is provisioned": {
+			createStatus:   http.StatusCreated,
+			expectedCreate: true,
+		},
+		"claim is provisioned by another job": {
+			createStatus:   http.StatusConflict,
+			expectedCreate: true,
+		},
+		"provisioning fails": {
+			createStatus:   http.StatusForbidden,
+			expectedCreate: true,
+			expectedError:  true,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			e := newCacheVolumeExecutor(
+				common.KubernetesCacheVolume{StorageClass: "standard", Size: "5Gi"},
+				common.Cache{Key: "key"},
+			)
+
+			var created *api.PersistentVolumeClaim
+			fakeClient := fake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+				status := http.StatusOK
+				var body interface{} = api.PersistentVolumeClaim{
+					TypeMeta: metav1.TypeMeta{Kind: "PersistentVolumeClaim", APIVersion: "v1"},
+				}
+
+				switch req.Method {
+				case http.MethodGet:
+					if !tt.existing {
+						status = http.StatusNotFound
+						body = metav1.Status{
+							TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+							Status:   metav1.StatusFailure,
+							Reason:   metav1.StatusReasonNotFound,
+							Code:     http.StatusNotFound,
+						}
+					}
+				case http.MethodPost:
+					assert.Equal(t, "/api/"+version+"/namespaces/ns/persistentvolumeclaims", req.URL.Path)
+
+					created = &api.PersistentVolumeClaim{}
+					require.NoError(t, json.NewDecoder(req.Body).Decode(created))
+
+					status = tt.createStatus
+					if status != http.StatusCreated {
+						reason := metav1.StatusReasonAlreadyExists
+						if status == http.StatusForbidden {
+							reason = metav1.StatusReasonForbidden
+						}
+						body = metav1.Status{
+							TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+							Status:   metav1.StatusFailure,
+							Reason:   reason,
+							Code:     int32(status),
+						}
+					}
+				default:
+					return nil, fmt.Errorf("unexpected request %s %s", req.Method, req.URL.Path)
+				}
+
+				data, err := json.Marshal(body)
+				require.NoError(t, err)
+
+				return &http.Response{
+					StatusCode: status,
+					Body:       ioutil.NopCloser(bytes.NewReader(data)),
+					Header:     map[string][]string{"Content-Type": {"application/json"}},
+				}, nil
+			})
+			e.kubeClient = testKubernetesClient(version, fakeClient)
+
+			err := e.setupCacheClaims()
+			if tt.expectedError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			if !tt.expectedCreate {
+				assert.Nil(t, created)
+				return
+			}
+
+			require.NotNil(t, created)
+			assert.Equal(t, e.cacheClaims[0].claimName, created.Name)
+			assert.Equal(t, "standard", *created.Spec.StorageClassName)
+			assert.Equal(t, []api.PersistentVolumeAccessMode{api.ReadWriteMany}, created.Spec.AccessModes)
+			storage := created.Spec.Resources.Requests[api.ResourceStorage]
+			assert.Equal(t, "5Gi", storage.String())
+			assert.Equal(t, "key", created.Annotations[cacheKeyAnnotation])
+			assert.Equal(t, runnerTokenHash("token"), created.Labels[runnerTokenHashLabel])
+		})
+	}
+}
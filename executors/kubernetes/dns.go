@@ -0,0 +1,217 @@
+package kubernetes
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	api "k8s.io/api/core/v1"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/dns"
+)
+
+var errDNSPolicyNoneWithoutNameservers = errors.New("the None DNS policy requires at least one DNS nameserver")
+
+// evaluateDNSOverwrites sets the DNS policy, the DNS config and the host
+// aliases of the build pod from the configuration and the variables of the
+// job. The nameservers and search domains of the job replace the configured
+// ones, its resolver options replace the configured options with the same
+// name and its host aliases are added to the configured ones
+func (o *overwrites) evaluateDNSOverwrites(
+	config *common.KubernetesConfig,
+	variables common.JobVariables,
+	logger common.BuildLogger,
+) error {
+	dnsPolicy, err := o.evaluateOverwrite(
+		"DNSPolicy",
+		config.DNSPolicy,
+		config.DNSPolicyOverwriteAllowed,
+		variables.Get(DNSPolicyOverwriteVariableValue),
+		logger,
+	)
+	if err != nil {
+		return err
+	}
+
+	o.dnsPolicy, err = parseDNSPolicy(dnsPolicy)
+	if err != nil {
+		return err
+	}
+
+	o.dnsConfig, err = o.evaluateDNSConfigOverwrite(config, variables, logger)
+	if err != nil {
+		return err
+	}
+
+	if o.dnsPolicy == api.DNSNone && (o.dnsConfig == nil || len(o.dnsConfig.Nameservers) == 0) {
+		return errDNSPolicyNoneWithoutNameservers
+	}
+
+	hostAliases, err := o.evaluateOverwrite(
+		"HostAliases",
+		"",
+		config.HostAliasesOverwriteAllowed,
+		variables.Get(HostAliasesOverwriteVariableValue),
+		logger,
+	)
+	if err != nil {
+		return err
+	}
+
+	jobHostAliases, err := parseHostAliases(hostAliases)
+	if err != nil {
+		return err
+	}
+
+	o.hostAliases = append(config.GetHostAliases(), jobHostAliases...)
+
+	return nil
+}
+
+func (o *overwrites) evaluateDNSConfigOverwrite(
+	config *common.KubernetesConfig,
+	variables common.JobVariables,
+	logger common.BuildLogger,
+) (*api.PodDNSConfig, error) {
+	overwrites := make(map[string]string)
+	for _, name := range []string{
+		DNSNameserversOverwriteVariableValue,
+		DNSSearchesOverwriteVariableValue,
+		DNSOptionsOverwriteVariableValue,
+	} {
+		value, err := o.evaluateOverwrite(
+			name,
+			"",
+			config.DNSConfigOverwriteAllowed,
+			variables.Get(name),
+			logger,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		overwrites[name] = value
+	}
+
+	dnsConfig := config.GetDNSConfig()
+	if overwrites[DNSNameserversOverwriteVariableValue] == "" &&
+		overwrites[DNSSearchesOverwriteVariableValue] == "" &&
+		overwrites[DNSOptionsOverwriteVariableValue] == "" {
+		return dnsConfig, nil
+	}
+
+	if dnsConfig == nil {
+		dnsConfig = &api.PodDNSConfig{}
+	}
+
+	if nameservers := overwrites[DNSNameserversOverwriteVariableValue]; nameservers != "" {
+		dnsConfig.Nameservers = nil
+		for _, nameserver := range splitList(nameservers, ",") {
+			if net.ParseIP(nameserver) == nil {
+				return nil, fmt.Errorf("invalid DNS nameserver %q", nameserver)
+			}
+
+			dnsConfig.Nameservers = append(dnsConfig.Nameservers, nameserver)
+		}
+	}
+
+	if searches := overwrites[DNSSearchesOverwriteVariableValue]; searches != "" {
+		dnsConfig.Searches = splitList(searches, ",")
+	}
+
+	for _, option := range splitList(overwrites[DNSOptionsOverwriteVariableValue], ",") {
+		dnsConfig.Options = setDNSOption(dnsConfig.Options, parseDNSOption(option))
+	}
+
+	return dnsConfig, nil
+}
+
+func parseDNSPolicy(policy string) (api.DNSPolicy, error) {
+	switch dnsPolicy := api.DNSPolicy(policy); dnsPolicy {
+	case "", api.DNSClusterFirst, api.DNSClusterFirstWithHostNet, api.DNSDefault, api.DNSNone:
+		return dnsPolicy, nil
+	default:
+		return "", fmt.Errorf(
+			"unsupported DNS policy %q, use %s, %s, %s or %s",
+			policy,
+			api.DNSClusterFirst,
+			api.DNSClusterFirstWithHostNet,
+			api.DNSDefault,
+			api.DNSNone,
+		)
+	}
+}
+
+// parseDNSOption parses a resolver option, like "ndots:2" or "single-request"
+func parseDNSOption(option string) api.PodDNSConfigOption {
+	split := strings.SplitN(option, ":", 2)
+	if len(split) == 1 {
+		return api.PodDNSConfigOption{Name: split[0]}
+	}
+
+	return api.PodDNSConfigOption{Name: split[0], Value: &split[1]}
+}
+
+func setDNSOption(options []api.PodDNSConfigOption, option api.PodDNSConfigOption) []api.PodDNSConfigOption {
+	var result []api.PodDNSConfigOption
+	for _, o := range options {
+		if o.Name != option.Name {
+			result = append(result, o)
+		}
+	}
+
+	return append(result, option)
+}
+
+// parseHostAliases parses the host aliases separated by semicolons, each one
+// made of an IP address and its comma separated host names, like
+// "10.0.0.1=registry.local,cache.local"
+func parseHostAliases(value string) ([]api.HostAlias, error) {
+	var hostAliases []api.HostAlias
+
+	for _, alias := range splitList(value, ";") {
+		ip, hostnames, err := splitMapOverwrite(alias)
+		if err != nil {
+			return nil, fmt.Errorf("invalid host alias: %w", err)
+		}
+
+		ip = strings.TrimSpace(ip)
+		if net.ParseIP(ip) == nil {
+			return nil, fmt.Errorf("invalid IP address %q of host alias %q", ip, alias)
+		}
+
+		hostAlias := api.HostAlias{IP: ip}
+		for _, hostname := range splitList(hostnames, ",") {
+			err := dns.ValidateDNS1123Subdomain(hostname)
+			if err != nil {
+				return nil, fmt.Errorf("invalid host name %q of host alias %q: %w", hostname, alias, err)
+			}
+
+			hostAlias.Hostnames = append(hostAlias.Hostnames, hostname)
+		}
+
+		if len(hostAlias.Hostnames) == 0 {
+			return nil, fmt.Errorf("host alias %q has no host names", alias)
+		}
+
+		hostAliases = append(hostAliases, hostAlias)
+	}
+
+	return hostAliases, nil
+}
+
+// splitList splits the list with the separator, ignoring the empty items and
+// the spaces around them
+func splitList(list string, separator string) []string {
+	var items []string
+	for _, item := range strings.Split(list, separator) {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
@@ -0,0 +1,178 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	api "k8s.io/api/core/v1"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+func TestEvaluateDNSOverwrites(t *testing.T) {
+	ndots := "5"
+	overwrittenNdots := "2"
+
+	config := common.KubernetesConfig{
+		DNSPolicy: "ClusterFirst",
+		DNSConfig: common.KubernetesDNSConfig{
+			Nameservers: []string{"10.0.0.10"},
+			Searches:    []string{"svc.cluster.local"},
+			Options: []common.KubernetesDNSConfigOption{
+				{Name: "ndots", Value: &ndots},
+				{Name: "edns0"},
+			},
+		},
+		HostAliases: []common.KubernetesHostAliases{
+			{IP: "10.0.0.1", Hostnames: []string{"registry.local"}},
+		},
+	}
+
+	allowed := config
+	allowed.DNSPolicyOverwriteAllowed = ".*"
+	allowed.DNSConfigOverwriteAllowed = ".*"
+	allowed.HostAliasesOverwriteAllowed = ".*"
+
+	configuredDNSConfig := &api.PodDNSConfig{
+		Nameservers: []string{"10.0.0.10"},
+		Searches:    []string{"svc.cluster.local"},
+		Options: []api.PodDNSConfigOption{
+			{Name: "ndots", Value: &ndots},
+			{Name: "edns0"},
+		},
+	}
+	configuredHostAliases := []api.HostAlias{
+		{IP: "10.0.0.1", Hostnames: []string{"registry.local"}},
+	}
+
+	tests := map[string]struct {
+		config              common.KubernetesConfig
+		variables           variableOverwrites
+		expectedDNSPolicy   api.DNSPolicy
+		expectedDNSConfig   *api.PodDNSConfig
+		expectedHostAliases []api.HostAlias
+		expectedErr         string
+	}{
+		"not configured": {},
+		"configured": {
+			config:              config,
+			expectedDNSPolicy:   api.DNSClusterFirst,
+			expectedDNSConfig:   configuredDNSConfig,
+			expectedHostAliases: configuredHostAliases,
+		},
+		"overwrites not allowed": {
+			config: config,
+			variables: variableOverwrites{
+				DNSPolicyOverwriteVariableValue:      "Default",
+				DNSNameserversOverwriteVariableValue: "1.1.1.1",
+				DNSOptionsOverwriteVariableValue:     "ndots:2",
+				HostAliasesOverwriteVariableValue:    "10.0.0.2=cache.local",
+			},
+			expectedDNSPolicy:   api.DNSClusterFirst,
+			expectedDNSConfig:   configuredDNSConfig,
+			expectedHostAliases: configuredHostAliases,
+		},
+		"overwritten": {
+			config: allowed,
+			variables: variableOverwrites{
+				DNSPolicyOverwriteVariableValue:      "None",
+				DNSNameserversOverwriteVariableValue: "1.1.1.1, 8.8.8.8",
+				DNSSearchesOverwriteVariableValue:    "example.com",
+				DNSOptionsOverwriteVariableValue:     "ndots:2,single-request",
+				HostAliasesOverwriteVariableValue:    "10.0.0.2=cache.local,proxy.local; fd00::1=ipv6.local",
+			},
+			expectedDNSPolicy: api.DNSNone,
+			expectedDNSConfig: &api.PodDNSConfig{
+				Nameservers: []string{"1.1.1.1", "8.8.8.8"},
+				Searches:    []string{"example.com"},
+				Options: []api.PodDNSConfigOption{
+					{Name: "edns0"},
+					{Name: "ndots", Value: &overwrittenNdots},
+					{Name: "single-request"},
+				},
+			},
+			expectedHostAliases: []api.HostAlias{
+				{IP: "10.0.0.1", Hostnames: []string{"registry.local"}},
+				{IP: "10.0.0.2", Hostnames: []string{"cache.local", "proxy.local"}},
+				{IP: "fd00::1", Hostnames: []string{"ipv6.local"}},
+			},
+		},
+		"options overwritten without configured DNS config": {
+			config: common.KubernetesConfig{DNSConfigOverwriteAllowed: ".*"},
+			variables: variableOverwrites{
+				DNSOptionsOverwriteVariableValue: "ndots:2",
+			},
+			expectedDNSConfig: &api.PodDNSConfig{
+				Options: []api.PodDNSConfigOption{{Name: "ndots", Value: &overwrittenNdots}},
+			},
+		},
+		"overwrite not matching the regex": {
+			config: common.KubernetesConfig{DNSPolicyOverwriteAllowed: "^Default$"},
+			variables: variableOverwrites{
+				DNSPolicyOverwriteVariableValue: "ClusterFirst",
+			},
+			expectedErr: `provided value "ClusterFirst" does not match "^Default$"`,
+		},
+		"unsupported DNS policy": {
+			config:      common.KubernetesConfig{DNSPolicy: "Everything"},
+			expectedErr: `unsupported DNS policy "Everything"`,
+		},
+		"None DNS policy without nameservers": {
+			config:      common.KubernetesConfig{DNSPolicy: "None"},
+			expectedErr: errDNSPolicyNoneWithoutNameservers.Error(),
+		},
+		"invalid nameserver": {
+			config: common.KubernetesConfig{DNSConfigOverwriteAllowed: ".*"},
+			variables: variableOverwrites{
+				DNSNameserversOverwriteVariableValue: "dns.example.com",
+			},
+			expectedErr: `invalid DNS nameserver "dns.example.com"`,
+		},
+		"invalid host alias": {
+			config: common.KubernetesConfig{HostAliasesOverwriteAllowed: ".*"},
+			variables: variableOverwrites{
+				HostAliasesOverwriteVariableValue: "cache.local",
+			},
+			expectedErr: "invalid host alias",
+		},
+		"invalid host alias IP": {
+			config: common.KubernetesConfig{HostAliasesOverwriteAllowed: ".*"},
+			variables: variableOverwrites{
+				HostAliasesOverwriteVariableValue: "cache=cache.local",
+			},
+			expectedErr: `invalid IP address "cache"`,
+		},
+		"invalid host alias host name": {
+			config: common.KubernetesConfig{HostAliasesOverwriteAllowed: ".*"},
+			variables: variableOverwrites{
+				HostAliasesOverwriteVariableValue: "10.0.0.2=Cache_Local",
+			},
+			expectedErr: `invalid host name "Cache_Local"`,
+		},
+		"host alias without host names": {
+			config: common.KubernetesConfig{HostAliasesOverwriteAllowed: ".*"},
+			variables: variableOverwrites{
+				HostAliasesOverwriteVariableValue: "10.0.0.2=",
+			},
+			expectedErr: "has no host names",
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			o := &overwrites{}
+			err := o.evaluateDNSOverwrites(&tt.config, buildOverwriteVariables(tt.variables, nil), stdoutLogger())
+			if tt.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedDNSPolicy, o.dnsPolicy)
+			assert.Equal(t, tt.expectedDNSConfig, o.dnsConfig)
+			assert.Equal(t, tt.expectedHostAliases, o.hostAliases)
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/shells"
+)
+
+var (
+	// exitStatusFilePollInterval is how often the status file of the running
+	// stage is read, in case its exit status is lost from the log
+	exitStatusFilePollInterval = 30 * time.Second
+	// logCatchUpTimeout is how long the log is waited for, once the exit
+	// status of the stage is read from its status file
+	logCatchUpTimeout = 10 * time.Second
+)
+
+// waitForExitStatus waits for the exit status of the stage written to the log.
+// When the status is lost, e.g. with the log rotated, it's read from the status
+// file of the stage written by the trap shell
+func (s *executor) waitForExitStatus(
+	ctx context.Context,
+	stage common.BuildStage,
+) (shells.TrapCommandExitStatus, error) {
+	t := time.NewTicker(exitStatusFilePollInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case status := <-s.remoteProcessTerminated:
+			if s.isStageExitStatus(stage, status) {
+				return status, nil
+			}
+		case <-t.C:
+			status, ok := s.readExitStatusFile(ctx, stage)
+			if ok {
+				return s.waitForLoggedExitStatus(ctx, stage, status), nil
+			}
+		case <-ctx.Done():
+			return shells.TrapCommandExitStatus{}, ctx.Err()
+		}
+	}
+}
+
+// waitForLoggedExitStatus gives the log some time to catch up with the status
+// file, so that the trace of the stage is complete when it's over
+func (s *executor) waitForLoggedExitStatus(
+	ctx context.Context,
+	stage common.BuildStage,
+	status shells.TrapCommandExitStatus,
+) shells.TrapCommandExitStatus {
+	timeout := time.NewTimer(logCatchUpTimeout)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case logged := <-s.remoteProcessTerminated:
+			if s.isStageExitStatus(stage, logged) {
+				return logged
+			}
+		case <-timeout.C:
+			s.Warningln(fmt.Sprintf(
+				"The exit status of the %s stage was read from its status file, the job log may be incomplete",
+				stage,
+			))
+			s.addUnloggedExitStatus(stage)
+			return status
+		case <-ctx.Done():
+			s.addUnloggedExitStatus(stage)
+			return status
+		}
+	}
+}
+
+// addUnloggedExitStatus records that the exit status of the stage was read
+// from its status file, and may still be logged
+func (s *executor) addUnloggedExitStatus(stage common.BuildStage) {
+	if s.unloggedExitStatuses == nil {
+		s.unloggedExitStatuses = make(map[common.BuildStage]int)
+	}
+
+	s.unloggedExitStatuses[stage]++
+}
+
+// isStageExitStatus filters out the statuses of the previous stages and of
+// the previous attempts of the stage, logged after their status was read from
+// their status file
+func (s *executor) isStageExitStatus(stage common.BuildStage, status shells.TrapCommandExitStatus) bool {
+	if path.Base(*status.Script) != string(stage) {
+		s.Debugln(fmt.Sprintf("Ignoring the exit status of %s while waiting for %s", *status.Script, stage))
+		return false
+	}
+
+	// the statuses are logged in order, so the first one logged is the one of
+	// the earliest attempt. If that status was lost from the log, the status
+	// of the current attempt is read from its status file instead
+	if s.unloggedExitStatuses[stage] > 0 {
+		s.unloggedExitStatuses[stage]--
+		s.Debugln(fmt.Sprintf("Ignoring the exit status of a previous attempt of %s", stage))
+		return false
+	}
+
+	return true
+}
+
+// readExitStatusFile reads the status file of the stage from the helper
+// container, sharing the logs volume with the build container. The file
+// doesn't exist until the stage is over
+func (s *executor) readExitStatusFile(
+	ctx context.Context,
+	stage common.BuildStage,
+) (shells.TrapCommandExitStatus, bool) {
+	var status shells.TrapCommandExitStatus
+	var out bytes.Buffer
+
+	exec := ExecOptions{
+		Namespace:     s.pod.Namespace,
+		PodName:       s.pod.Name,
+		ContainerName: helperContainerName,
+		Command:       []string{"cat", s.exitStatusFile(stage)},
+		Out:           &out,
+		Executor:      s.remoteExecutor,
+		Client:        s.kubeClient,
+		Config:        s.kubeConfig,
+	}
+
+	err := exec.executeRequest(ctx)
+	if err != nil {
+		s.Debugln(fmt.Sprintf("Reading the status file of the %s stage: %v", stage, err))
+		return status, false
+	}
+
+	return status, status.TryUnmarshal(strings.TrimSpace(out.String()))
+}
+
+func (s *executor) exitStatusFile(stage common.BuildStage) string {
+	return shells.TrapShellStatusFile(s.logsDir(), stage)
+}
@@ -0,0 +1,442 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jpillora/backoff"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/rest/fake"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/shells"
+)
+
+// fakeRemoteAPI emulates the attach and exec requests of the attach strategy
+// against the logs volume of the pod. The attached stage appends its output
+// and its exit status to the log, which is streamed back by read-logs, and
+// the log streams are dropped every few lines
+type fakeRemoteAPI struct {
+	mu          sync.Mutex
+	log         []byte
+	statusFiles map[string]string
+
+	stage           common.BuildStage
+	scriptPath      string
+	statusFile      string
+	output          []string
+	exitCode        int
+	loseExitStatus  bool
+	exitStatusDelay time.Duration
+	lineDelay       time.Duration
+	disconnectEvery int
+	disconnects     int
+}
+
+func (f *fakeRemoteAPI) Execute(
+	method string,
+	u *url.URL,
+	config *restclient.Config,
+	stdin io.Reader,
+	stdout, stderr io.Writer,
+	tty bool,
+) error {
+	switch path.Base(u.Path) {
+	case "attach":
+		_, err := ioutil.ReadAll(stdin)
+		if err != nil {
+			return err
+		}
+
+		go f.runStage()
+		return nil
+	case "exec":
+		command := u.Query()["command"]
+		switch command[0] {
+		case "gitlab-runner-helper":
+			return f.readLogs(command, stdout)
+		case "cat":
+			return f.cat(command[1], stdout)
+		}
+	}
+
+	return fmt.Errorf("unexpected request %s", u)
+}
+
+func (f *fakeRemoteAPI) appendLog(line string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.log = append(f.log, line+"\n"...)
+}
+
+func (f *fakeRemoteAPI) runStage() {
+	// like the trap shell, remove the status file of a previous attempt
+	f.mu.Lock()
+	delete(f.statusFiles, f.statusFile)
+	f.mu.Unlock()
+
+	lineDelay := f.lineDelay
+	if lineDelay == 0 {
+		lineDelay = time.Millisecond
+	}
+
+	for _, line := range f.output {
+		f.appendLog(line)
+		time.Sleep(lineDelay)
+	}
+
+	status := fmt.Sprintf(`{"command_exit_code": %d, "script": %q}`, f.exitCode, f.scriptPath)
+	switch {
+	case f.loseExitStatus:
+	case f.exitStatusDelay > 0:
+		go func(delay time.Duration) {
+			time.Sleep(delay)
+			f.appendLog(status)
+		}(f.exitStatusDelay)
+	default:
+		f.appendLog(status)
+	}
+
+	f.mu.Lock()
+	f.statusFiles[f.statusFile] = status + "\n"
+	f.mu.Unlock()
+}
+
+func (f *fakeRemoteAPI) readLogs(command []string, stdout io.Writer) error {
+	var offset int
+	for i, arg := range command {
+		if arg == "--offset" {
+			offset, _ = strconv.Atoi(command[i+1])
+		}
+	}
+
+	var lines, idle int
+	for {
+		f.mu.Lock()
+		data := f.log[offset:]
+		f.mu.Unlock()
+
+		end := bytes.IndexByte(data, '\n')
+		if end == -1 {
+			// the stream ends when no more lines are written, like with the
+			// idle connections closed by the API server
+			idle++
+			if idle > 5 {
+				return nil
+			}
+
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+
+		offset += end + 1
+		_, _ = fmt.Fprintf(stdout, "%d %s\n", offset, data[:end])
+
+		lines++
+		if f.disconnectEvery > 0 && lines == f.disconnectEvery {
+			f.mu.Lock()
+			f.disconnects++
+			f.mu.Unlock()
+
+			return errors.New("connection reset by peer")
+		}
+	}
+}
+
+func (f *fakeRemoteAPI) disconnected() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.disconnects
+}
+
+func (f *fakeRemoteAPI) cat(file string, stdout io.Writer) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	contents, ok := f.statusFiles[file]
+	if !ok {
+		return fmt.Errorf("cat: %s: No such file or directory", file)
+	}
+
+	_, err := io.WriteString(stdout, contents)
+	return err
+}
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
+
+func TestRunInContainerExitStatus(t *testing.T) {
+	defer func(pollInterval, catchUpTimeout time.Duration) {
+		exitStatusFilePollInterval = pollInterval
+		logCatchUpTimeout = catchUpTimeout
+	}(exitStatusFilePollInterval, logCatchUpTimeout)
+	exitStatusFilePollInterval = 50 * time.Millisecond
+	logCatchUpTimeout = 100 * time.Millisecond
+
+	version, codec := testVersionAndCodec()
+
+	var output []string
+	for i := 1; i <= 20; i++ {
+		output = append(output, fmt.Sprintf("line %d", i))
+	}
+
+	tests := map[string]struct {
+		exitCode        int
+		loseExitStatus  bool
+		disconnectEvery int
+		expectedErr     error
+		expectedWarning bool
+	}{
+		"succeeded": {},
+		"failed": {
+			exitCode:    1,
+			expectedErr: &commandTerminatedError{exitCode: 1},
+		},
+		"log streams disconnected": {
+			disconnectEvery: 3,
+		},
+		"failed with log streams disconnected": {
+			exitCode:        2,
+			disconnectEvery: 3,
+			expectedErr:     &commandTerminatedError{exitCode: 2},
+		},
+		"exit status lost from the log": {
+			exitCode:        3,
+			loseExitStatus:  true,
+			disconnectEvery: 3,
+			expectedErr:     &commandTerminatedError{exitCode: 3},
+			expectedWarning: true,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			fakeClient := fake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+				if req.Method != http.MethodGet {
+					return nil, fmt.Errorf("unexpected request %s %s", req.Method, req.URL.Path)
+				}
+
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       objBody(codec, execPod()),
+					Header:     map[string][]string{"Content-Type": {"application/json"}},
+				}, nil
+			})
+
+			trace := &syncBuffer{}
+
+			e := newExecutor()
+			e.Config.Kubernetes = &common.KubernetesConfig{}
+			e.Build = &common.Build{BuildDir: "/builds/project"}
+			e.Trace = &common.Trace{Writer: trace}
+			e.BuildLogger = common.NewBuildLogger(e.Trace, logrus.WithFields(logrus.Fields{}))
+			e.kubeClient = testKubernetesClient(version, fakeClient)
+			e.kubeConfig = &restclient.Config{}
+			e.pod = execPod()
+
+			stage := common.BuildStageGetSources
+			remote := &fakeRemoteAPI{
+				statusFiles:     make(map[string]string),
+				stage:           stage,
+				scriptPath:      e.scriptPath(stage),
+				statusFile:      e.exitStatusFile(stage),
+				output:          output,
+				exitCode:        tt.exitCode,
+				loseExitStatus:  tt.loseExitStatus,
+				disconnectEvery: tt.disconnectEvery,
+			}
+			e.remoteExecutor = remote
+			e.newLogProcessor = func() logProcessor {
+				return &kubernetesLogProcessor{
+					backoff: &backoff.Backoff{Min: time.Millisecond, Max: 10 * time.Millisecond},
+					logger:  logrus.StandardLogger(),
+					logStreamer: &kubernetesLogStreamer{
+						kubernetesLogProcessorPodConfig: kubernetesLogProcessorPodConfig{
+							namespace: e.pod.Namespace,
+							pod:       e.pod.Name,
+							container: helperContainerName,
+							logPath:   e.logFile(),
+						},
+						client:       e.kubeClient,
+						clientConfig: e.kubeConfig,
+						executor:     remote,
+					},
+				}
+			}
+
+			go e.processLogs(ctx)
+
+			err := <-e.runInContainer(ctx, buildContainerName, stage, []string{"script"})
+			if tt.expectedErr != nil {
+				assert.Equal(t, tt.expectedErr, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			if tt.disconnectEvery > 0 {
+				assert.NotZero(t, remote.disconnected())
+			}
+
+			var traced []string
+			for _, line := range strings.Split(trace.String(), "\n") {
+				if strings.HasPrefix(line, "line ") {
+					traced = append(traced, line)
+				}
+			}
+			require.Equal(t, output, traced, "every line must be traced once and in order")
+
+			if tt.expectedWarning {
+				assert.Contains(t, trace.String(), "the job log may be incomplete")
+			} else {
+				assert.NotContains(t, trace.String(), "the job log may be incomplete")
+			}
+		})
+	}
+}
+
+func TestWaitForExitStatusIgnoresPreviousStages(t *testing.T) {
+	e := newExecutor()
+	e.Build = &common.Build{BuildDir: "/builds/project"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	go func() {
+		for _, stage := range []common.BuildStage{common.BuildStagePrepare, common.BuildStageGetSources} {
+			exitCode := 0
+			if stage == common.BuildStageGetSources {
+				exitCode = 1
+			}
+			script := e.scriptPath(stage)
+
+			status := shells.TrapCommandExitStatus{CommandExitCode: &exitCode, Script: &script}
+			select {
+			case e.remoteProcessTerminated <- status:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	status, err := e.waitForExitStatus(ctx, common.BuildStageGetSources)
+	require.NoError(t, err)
+	assert.Equal(t, 1, *status.CommandExitCode)
+	assert.Equal(t, e.scriptPath(common.BuildStageGetSources), *status.Script)
+}
+
+func TestRunInContainerRetriedStage(t *testing.T) {
+	defer func(pollInterval, catchUpTimeout time.Duration) {
+		exitStatusFilePollInterval = pollInterval
+		logCatchUpTimeout = catchUpTimeout
+	}(exitStatusFilePollInterval, logCatchUpTimeout)
+	exitStatusFilePollInterval = 50 * time.Millisecond
+	logCatchUpTimeout = 100 * time.Millisecond
+
+	version, codec := testVersionAndCodec()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	fakeClient := fake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       objBody(codec, execPod()),
+			Header:     map[string][]string{"Content-Type": {"application/json"}},
+		}, nil
+	})
+
+	trace := &syncBuffer{}
+
+	e := newExecutor()
+	e.Config.Kubernetes = &common.KubernetesConfig{}
+	e.Build = &common.Build{BuildDir: "/builds/project"}
+	e.Trace = &common.Trace{Writer: trace}
+	e.BuildLogger = common.NewBuildLogger(e.Trace, logrus.WithFields(logrus.Fields{}))
+	e.kubeClient = testKubernetesClient(version, fakeClient)
+	e.kubeConfig = &restclient.Config{}
+	e.pod = execPod()
+
+	stage := common.BuildStageGetSources
+	// the first attempt fails, its exit status is logged after being read
+	// from its status file
+	remote := &fakeRemoteAPI{
+		statusFiles:     make(map[string]string),
+		stage:           stage,
+		scriptPath:      e.scriptPath(stage),
+		statusFile:      e.exitStatusFile(stage),
+		output:          []string{"attempt 1"},
+		exitCode:        1,
+		exitStatusDelay: 300 * time.Millisecond,
+	}
+	e.remoteExecutor = remote
+	e.newLogProcessor = func() logProcessor {
+		return &kubernetesLogProcessor{
+			backoff: &backoff.Backoff{Min: time.Millisecond, Max: 10 * time.Millisecond},
+			logger:  logrus.StandardLogger(),
+			logStreamer: &kubernetesLogStreamer{
+				kubernetesLogProcessorPodConfig: kubernetesLogProcessorPodConfig{
+					namespace: e.pod.Namespace,
+					pod:       e.pod.Name,
+					container: helperContainerName,
+					logPath:   e.logFile(),
+				},
+				client:       e.kubeClient,
+				clientConfig: e.kubeConfig,
+				executor:     remote,
+			},
+		}
+	}
+
+	go e.processLogs(ctx)
+
+	err := <-e.runInContainer(ctx, buildContainerName, stage, []string{"script"})
+	assert.Equal(t, &commandTerminatedError{exitCode: 1}, err)
+
+	// the retry outlasts the status file poll interval, with the status file
+	// and the late logged exit status of the first attempt left behind
+	remote.mu.Lock()
+	remote.output = []string{"attempt 2", "attempt 2", "attempt 2"}
+	remote.lineDelay = 200 * time.Millisecond
+	remote.exitCode = 0
+	remote.exitStatusDelay = 0
+	remote.mu.Unlock()
+
+	err = <-e.runInContainer(ctx, buildContainerName, stage, []string{"script"})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, strings.Count(trace.String(), "attempt 2"))
+}
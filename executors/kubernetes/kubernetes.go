@@ -41,6 +41,8 @@ const (
 	detectShellScriptName = "detect_shell_script"
 
 	waitLogFileTimeout = time.Minute
+
+	appArmorContainerAnnotationKeyPrefix = "container.apparmor.security.beta.kubernetes.io/"
 )
 
 var (
@@ -97,6 +99,7 @@ type executor struct {
 	credentials *api.Secret
 	options     *kubernetesOptions
 	services    []api.Service
+	cacheClaims []cacheClaim
 
 	configurationOverwrites *overwrites
 	buildLimits             api.ResourceList
@@ -112,8 +115,17 @@ type executor struct {
 	featureChecker featureChecker
 
 	newLogProcessor func() logProcessor
+	remoteExecutor  RemoteExecutor
 
 	remoteProcessTerminated chan shells.TrapCommandExitStatus
+	// unloggedExitStatuses counts, per stage, the exit statuses read from the
+	// status files whose log line wasn't received yet
+	unloggedExitStatuses map[common.BuildStage]int
+
+	// reportedOOMKills are the OOMKills of the service containers already
+	// printed to the job log
+	reportedOOMKills     map[string]bool
+	reportedOOMKillsLock sync.Mutex
 }
 
 type serviceDeleteResponse struct {
@@ -129,32 +141,56 @@ type serviceCreateResponse struct {
 func (s *executor) setupResources() error {
 	var err error
 
-	s.buildLimits, err = limits(s.configurationOverwrites.cpuLimit, s.configurationOverwrites.memoryLimit)
+	s.buildLimits, err = limits(
+		s.configurationOverwrites.cpuLimit,
+		s.configurationOverwrites.memoryLimit,
+		s.configurationOverwrites.ephemeralStorageLimit,
+	)
 	if err != nil {
 		return fmt.Errorf("invalid build limits specified: %w", err)
 	}
 
-	s.buildRequests, err = limits(s.configurationOverwrites.cpuRequest, s.configurationOverwrites.memoryRequest)
+	s.buildRequests, err = limits(
+		s.configurationOverwrites.cpuRequest,
+		s.configurationOverwrites.memoryRequest,
+		s.configurationOverwrites.ephemeralStorageRequest,
+	)
 	if err != nil {
 		return fmt.Errorf("invalid build requests specified: %w", err)
 	}
 
-	s.serviceLimits, err = limits(s.Config.Kubernetes.ServiceCPULimit, s.Config.Kubernetes.ServiceMemoryLimit)
+	s.serviceLimits, err = limits(
+		s.Config.Kubernetes.ServiceCPULimit,
+		s.Config.Kubernetes.ServiceMemoryLimit,
+		s.Config.Kubernetes.ServiceEphemeralStorageLimit,
+	)
 	if err != nil {
 		return fmt.Errorf("invalid service limits specified: %w", err)
 	}
 
-	s.serviceRequests, err = limits(s.Config.Kubernetes.ServiceCPURequest, s.Config.Kubernetes.ServiceMemoryRequest)
+	s.serviceRequests, err = limits(
+		s.Config.Kubernetes.ServiceCPURequest,
+		s.Config.Kubernetes.ServiceMemoryRequest,
+		s.Config.Kubernetes.ServiceEphemeralStorageRequest,
+	)
 	if err != nil {
 		return fmt.Errorf("invalid service requests specified: %w", err)
 	}
 
-	s.helperLimits, err = limits(s.Config.Kubernetes.HelperCPULimit, s.Config.Kubernetes.HelperMemoryLimit)
+	s.helperLimits, err = limits(
+		s.Config.Kubernetes.HelperCPULimit,
+		s.Config.Kubernetes.HelperMemoryLimit,
+		s.Config.Kubernetes.HelperEphemeralStorageLimit,
+	)
 	if err != nil {
 		return fmt.Errorf("invalid helper limits specified: %w", err)
 	}
 
-	s.helperRequests, err = limits(s.Config.Kubernetes.HelperCPURequest, s.Config.Kubernetes.HelperMemoryRequest)
+	s.helperRequests, err = limits(
+		s.Config.Kubernetes.HelperCPURequest,
+		s.Config.Kubernetes.HelperMemoryRequest,
+		s.Config.Kubernetes.HelperEphemeralStorageRequest,
+	)
 	if err != nil {
 		return fmt.Errorf("invalid helper requests specified: %w", err)
 	}
@@ -302,14 +338,27 @@ func (s *executor) runWithAttach(cmd common.ExecutorCommand) error {
 	podStatusCh := s.watchPodStatus(ctx)
 
 	select {
-	case err := <-s.runInContainer(containerName, containerCommand):
+	case err := <-s.runInContainer(ctx, containerName, cmd.Stage, containerCommand):
 		s.Debugln(fmt.Sprintf("Container %q exited with error: %v", containerName, err))
 		if err != nil && errors.Is(err, new(commandTerminatedError)) {
+			// the command may have been killed with its container
+			if podErr := s.checkPodFailure(); podErr != nil {
+				s.logPodWarningEvents()
+				return podErr
+			}
+
 			return &common.BuildError{Inner: err}
 		}
 
 		return err
 	case err := <-podStatusCh:
+		s.logPodWarningEvents()
+
+		var buildErr *common.BuildError
+		if errors.As(err, &buildErr) {
+			return buildErr
+		}
+
 		return &common.BuildError{Inner: err}
 	case <-ctx.Done():
 		return fmt.Errorf("build aborted")
@@ -338,6 +387,13 @@ func (s *executor) ensurePodsConfigured(ctx context.Context) error {
 
 	status, err := waitForPodRunning(ctx, s.kubeClient, s.pod, s.Trace, s.Config.Kubernetes)
 	if err != nil {
+		s.logPodWarningEvents()
+
+		var buildErr *common.BuildError
+		if errors.As(err, &buildErr) {
+			return buildErr
+		}
+
 		return fmt.Errorf("waiting for pod running: %w", err)
 	}
 
@@ -361,7 +417,10 @@ func (s *executor) processLogs(ctx context.Context) {
 	for line := range logsCh {
 		var status shells.TrapCommandExitStatus
 		if status.TryUnmarshal(line) {
-			s.remoteProcessTerminated <- status
+			select {
+			case s.remoteProcessTerminated <- status:
+			case <-ctx.Done():
+			}
 			continue
 		}
 
@@ -383,7 +442,7 @@ func (s *executor) setupScriptsConfigMap() error {
 		return fmt.Errorf("kubernetes executor incorrect shell type")
 	}
 
-	trapShell := &shells.BashTrapShell{BashShell: bashShell, LogFile: s.logFile()}
+	trapShell := &shells.BashTrapShell{BashShell: bashShell, LogFile: s.logFile(), StatusDir: s.logsDir()}
 	scripts, err := s.generateScripts(trapShell)
 	if err != nil {
 		return err
@@ -393,6 +452,7 @@ func (s *executor) setupScriptsConfigMap() error {
 		ObjectMeta: metav1.ObjectMeta{
 			GenerateName: fmt.Sprintf("%s-scripts", s.Build.ProjectUniqueName()),
 			Namespace:    s.configurationOverwrites.namespace,
+			Labels:       s.resourceLabels(),
 		},
 		Data: scripts,
 	}
@@ -491,7 +551,6 @@ func (s *executor) buildContainer(
 	requests, limits api.ResourceList,
 	containerCommand ...string,
 ) api.Container {
-	privileged := false
 	containerPorts := make([]api.ContainerPort, len(imageDefinition.Ports))
 	proxyPorts := make([]proxy.Port, len(imageDefinition.Ports))
 
@@ -513,8 +572,9 @@ func (s *executor) buildContainer(
 		s.ProxyPool[serviceName] = s.newProxy(serviceName, proxyPorts)
 	}
 
+	securityContext := &api.SecurityContext{Privileged: new(bool)}
 	if s.Config.Kubernetes != nil {
-		privileged = s.Config.Kubernetes.Privileged
+		securityContext = s.Config.Kubernetes.GetContainerSecurityContext(s.containerSecurityContext(name))
 	}
 
 	command, args := s.getCommandAndArgs(imageDefinition, containerCommand...)
@@ -530,12 +590,43 @@ func (s *executor) buildContainer(
 			Limits:   limits,
 			Requests: requests,
 		},
-		Ports:        containerPorts,
-		VolumeMounts: s.getVolumeMounts(),
-		SecurityContext: &api.SecurityContext{
-			Privileged: &privileged,
-		},
-		Stdin: true,
+		Ports:           containerPorts,
+		VolumeMounts:    s.getVolumeMounts(),
+		SecurityContext: securityContext,
+		Stdin:           true,
+	}
+}
+
+// containerSecurityContext returns the configured security context of the
+// build, helper or service container
+func (s *executor) containerSecurityContext(name string) common.KubernetesContainerSecurityContext {
+	switch name {
+	case buildContainerName:
+		return s.Config.Kubernetes.BuildContainerSecurityContext
+	case helperContainerName:
+		return s.Config.Kubernetes.HelperContainerSecurityContext
+	default:
+		return s.Config.Kubernetes.ServiceContainerSecurityContext
+	}
+}
+
+// setSecurityProfileAnnotations sets the annotations selecting the seccomp
+// and AppArmor profiles of the containers
+func (s *executor) setSecurityProfileAnnotations(pod *api.Pod) {
+	for _, container := range pod.Spec.Containers {
+		securityContext := s.containerSecurityContext(container.Name)
+
+		if pod.Annotations == nil && (securityContext.SeccompProfile != "" || securityContext.AppArmorProfile != "") {
+			pod.Annotations = make(map[string]string)
+		}
+
+		if securityContext.SeccompProfile != "" {
+			pod.Annotations[api.SeccompContainerAnnotationKeyPrefix+container.Name] = securityContext.SeccompProfile
+		}
+
+		if securityContext.AppArmorProfile != "" {
+			pod.Annotations[appArmorContainerAnnotationKeyPrefix+container.Name] = securityContext.AppArmorProfile
+		}
 	}
 }
 
@@ -642,6 +733,7 @@ func (s *executor) getVolumeMountsForConfig() []api.VolumeMount {
 
 func (s *executor) getVolumes() []api.Volume {
 	volumes := s.getVolumesForConfig()
+	volumes = append(volumes, s.getCacheVolumes()...)
 	volumes = append(volumes, api.Volume{
 		Name: "repo",
 		VolumeSource: api.VolumeSource{
@@ -819,6 +911,7 @@ func (s *executor) setupCredentials() error {
 	secret := api.Secret{}
 	secret.GenerateName = s.Build.ProjectUniqueName()
 	secret.Namespace = s.configurationOverwrites.namespace
+	secret.Labels = s.resourceLabels()
 	secret.Type = api.SecretTypeDockercfg
 	secret.Data = map[string][]byte{}
 	secret.Data[api.DockerConfigKey] = dockerCfgContent
@@ -907,14 +1000,12 @@ func (s *executor) setupBuildPod() error {
 	podServices := make([]api.Container, len(s.options.Services))
 
 	for i, service := range s.options.Services {
-		resolvedImage := s.Build.GetAllVariables().ExpandValue(service.Name)
-		podServices[i] = s.buildContainer(
-			fmt.Sprintf("svc-%d", i),
-			resolvedImage,
-			service,
-			s.serviceRequests,
-			s.serviceLimits,
-		)
+		container, err := s.buildServiceContainer(fmt.Sprintf("svc-%d", i), service)
+		if err != nil {
+			return err
+		}
+
+		podServices[i] = container
 	}
 
 	// We set a default label to the pod. This label will be used later
@@ -923,6 +1014,9 @@ func (s *executor) setupBuildPod() error {
 	for k, v := range s.Build.Runner.Kubernetes.PodLabels {
 		labels[k] = s.Build.Variables.ExpandValue(v)
 	}
+	for k, v := range s.resourceLabels() {
+		labels[k] = v
+	}
 
 	annotations := make(map[string]string)
 	for key, val := range s.configurationOverwrites.podAnnotations {
@@ -943,8 +1037,18 @@ func (s *executor) setupBuildPod() error {
 		return err
 	}
 
+	err = s.setupCacheClaims()
+	if err != nil {
+		return err
+	}
+
 	podConfig := s.preparePodConfig(labels, annotations, podServices, imagePullSecrets, hostAlias)
 
+	err = s.applyPodSpecPatches(&podConfig)
+	if err != nil {
+		return err
+	}
+
 	s.Debugln("Creating build pod")
 	pod, err := s.kubeClient.CoreV1().Pods(s.configurationOverwrites.namespace).Create(&podConfig)
 	if err != nil {
@@ -952,6 +1056,8 @@ func (s *executor) setupBuildPod() error {
 	}
 
 	s.pod = pod
+	s.setOwnerReferences()
+
 	s.services, err = s.makePodProxyServices()
 	if err != nil {
 		return err
@@ -968,6 +1074,17 @@ func (s *executor) preparePodConfig(
 ) api.Pod {
 	buildImage := s.Build.GetAllVariables().ExpandValue(s.options.Image.Name)
 
+	// the cache is restored and saved by the helper container only
+	helperContainer := s.buildContainer(
+		helperContainerName,
+		s.getHelperImage(),
+		common.Image{},
+		s.helperRequests,
+		s.helperLimits,
+		s.BuildShell.DockerCommand...,
+	)
+	helperContainer.VolumeMounts = append(helperContainer.VolumeMounts, s.getCacheVolumeMounts()...)
+
 	pod := api.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			GenerateName: s.Build.ProjectUniqueName(),
@@ -976,11 +1093,13 @@ func (s *executor) preparePodConfig(
 			Annotations:  annotations,
 		},
 		Spec: api.PodSpec{
-			Volumes:            s.getVolumes(),
-			ServiceAccountName: s.configurationOverwrites.serviceAccount,
-			RestartPolicy:      api.RestartPolicyNever,
-			NodeSelector:       s.Config.Kubernetes.NodeSelector,
-			Tolerations:        s.Config.Kubernetes.GetNodeTolerations(),
+			Volumes:                   s.getVolumes(),
+			ServiceAccountName:        s.configurationOverwrites.serviceAccount,
+			RestartPolicy:             api.RestartPolicyNever,
+			NodeSelector:              s.Config.Kubernetes.NodeSelector,
+			Tolerations:               s.Config.Kubernetes.GetNodeTolerations(),
+			Affinity:                  s.Config.Kubernetes.GetAffinity(),
+			TopologySpreadConstraints: s.Config.Kubernetes.GetTopologySpreadConstraints(),
 			Containers: append([]api.Container{
 				// TODO use the build and helper template here
 				s.buildContainer(
@@ -991,25 +1110,23 @@ func (s *executor) preparePodConfig(
 					s.buildLimits,
 					s.BuildShell.DockerCommand...,
 				),
-				s.buildContainer(
-					helperContainerName,
-					s.getHelperImage(),
-					common.Image{},
-					s.helperRequests,
-					s.helperLimits,
-					s.BuildShell.DockerCommand...,
-				),
+				helperContainer,
 			}, services...),
 			TerminationGracePeriodSeconds: &s.Config.Kubernetes.TerminationGracePeriodSeconds,
 			ImagePullSecrets:              imagePullSecrets,
 			SecurityContext:               s.Config.Kubernetes.GetPodSecurityContext(),
+			DNSPolicy:                     s.configurationOverwrites.dnsPolicy,
+			DNSConfig:                     s.configurationOverwrites.dnsConfig,
+			HostAliases:                   s.configurationOverwrites.hostAliases,
 		},
 	}
 
 	if hostAlias != nil {
-		pod.Spec.HostAliases = []api.HostAlias{*hostAlias}
+		pod.Spec.HostAliases = append(pod.Spec.HostAliases, *hostAlias)
 	}
 
+	s.setSecurityProfileAnnotations(&pod)
+
 	return pod
 }
 
@@ -1068,8 +1185,10 @@ func (s *executor) makePodProxyServices() ([]api.Service, error) {
 func (s *executor) prepareServiceConfig(name string, ports []api.ServicePort) api.Service {
 	return api.Service{
 		ObjectMeta: metav1.ObjectMeta{
-			GenerateName: name,
-			Namespace:    s.configurationOverwrites.namespace,
+			GenerateName:    name,
+			Namespace:       s.configurationOverwrites.namespace,
+			Labels:          s.resourceLabels(),
+			OwnerReferences: s.ownerReferences(),
 		},
 		Spec: api.ServiceSpec{
 			Ports:    ports,
@@ -1137,6 +1256,12 @@ func (s *executor) checkPodStatus() error {
 		return nil
 	}
 
+	if err := podFailure(pod); err != nil {
+		return err
+	}
+
+	s.logOOMKilledServices(pod)
+
 	if pod.Status.Phase != api.PodRunning {
 		return &podPhaseError{
 			name:  s.pod.Name,
@@ -1147,7 +1272,12 @@ func (s *executor) checkPodStatus() error {
 	return nil
 }
 
-func (s *executor) runInContainer(name string, command []string) <-chan error {
+func (s *executor) runInContainer(
+	ctx context.Context,
+	name string,
+	stage common.BuildStage,
+	command []string,
+) <-chan error {
 	errCh := make(chan error, 1)
 	go func() {
 		defer close(errCh)
@@ -1160,16 +1290,22 @@ func (s *executor) runInContainer(name string, command []string) <-chan error {
 
 			Config:   s.kubeConfig,
 			Client:   s.kubeClient,
-			Executor: &DefaultRemoteExecutor{},
+			Executor: s.remoteExecutor,
 		}
 
 		retryable := retry.New(retry.WithBuildLog(&attach, &s.BuildLogger))
 		err := retryable.Run()
 		if err != nil {
 			errCh <- err
+			return
+		}
+
+		exitStatus, err := s.waitForExitStatus(ctx, stage)
+		if err != nil {
+			errCh <- err
+			return
 		}
 
-		exitStatus := <-s.remoteProcessTerminated
 		if *exitStatus.CommandExitCode == 0 {
 			errCh <- nil
 			return
@@ -1293,6 +1429,7 @@ func newExecutor() *executor {
 			ExecutorOptions: executorOptions,
 		},
 		helperImageInfo:         helperImageInfo,
+		remoteExecutor:          &DefaultRemoteExecutor{},
 		remoteProcessTerminated: make(chan shells.TrapCommandExitStatus),
 	}
 
@@ -1324,14 +1461,18 @@ func featuresFn(features *common.FeaturesInfo) {
 	features.Session = true
 	features.Terminal = true
 	features.Proxy = true
+	features.ServiceVariables = true
 }
 
 func init() {
-	common.RegisterExecutorProvider("kubernetes", executors.DefaultExecutorProvider{
-		Creator: func() common.Executor {
-			return newExecutor()
+	common.RegisterExecutorProvider("kubernetes", &executorProvider{
+		DefaultExecutorProvider: executors.DefaultExecutorProvider{
+			Creator: func() common.Executor {
+				return newExecutor()
+			},
+			FeaturesUpdater:  featuresFn,
+			DefaultShellName: executorOptions.Shell.Shell,
 		},
-		FeaturesUpdater:  featuresFn,
-		DefaultShellName: executorOptions.Shell.Shell,
+		newKubeClient: newKubeClient,
 	})
 }
@@ -1131,6 +1131,67 @@ func TestPrepare(t *testing.T) {
 		Expected *executor
 		Error    bool
 	}{
+		{
+			GlobalConfig: &common.Config{},
+			RunnerConfig: &common.RunnerConfig{
+				RunnerSettings: common.RunnerSettings{
+					Kubernetes: &common.KubernetesConfig{
+						Host:                                     "test-server",
+						EphemeralStorageLimit:                    "10Gi",
+						EphemeralStorageRequest:                  "2Gi",
+						EphemeralStorageLimitOverwriteMaxAllowed: "20Gi",
+						ServiceEphemeralStorageLimit:             "1Gi",
+						ServiceEphemeralStorageRequest:           "500Mi",
+						HelperEphemeralStorageLimit:              "2Gi",
+						HelperEphemeralStorageRequest:            "1Gi",
+					},
+				},
+			},
+			Build: &common.Build{
+				JobResponse: common.JobResponse{
+					GitInfo: common.GitInfo{
+						Sha: "1234567890",
+					},
+					Image: common.Image{
+						Name: "test-image",
+					},
+					Variables: []common.JobVariable{
+						{Key: EphemeralStorageLimitOverwriteVariableValue, Value: "15Gi"},
+					},
+				},
+				Runner: &common.RunnerConfig{},
+			},
+			Expected: &executor{
+				options: &kubernetesOptions{
+					Image: common.Image{
+						Name: "test-image",
+					},
+				},
+				configurationOverwrites: &overwrites{
+					namespace:               "default",
+					ephemeralStorageLimit:   "15Gi",
+					ephemeralStorageRequest: "2Gi",
+				},
+				serviceLimits: api.ResourceList{
+					api.ResourceEphemeralStorage: resource.MustParse("1Gi"),
+				},
+				buildLimits: api.ResourceList{
+					api.ResourceEphemeralStorage: resource.MustParse("15Gi"),
+				},
+				helperLimits: api.ResourceList{
+					api.ResourceEphemeralStorage: resource.MustParse("2Gi"),
+				},
+				serviceRequests: api.ResourceList{
+					api.ResourceEphemeralStorage: resource.MustParse("500Mi"),
+				},
+				buildRequests: api.ResourceList{
+					api.ResourceEphemeralStorage: resource.MustParse("2Gi"),
+				},
+				helperRequests: api.ResourceList{
+					api.ResourceEphemeralStorage: resource.MustParse("1Gi"),
+				},
+			},
+		},
 		{
 			GlobalConfig: &common.Config{},
 			RunnerConfig: &common.RunnerConfig{
@@ -2010,6 +2071,9 @@ func TestSetupBuildPod(t *testing.T) {
 					"another": "label",
 					"var":     "sometestvar",
 					"pod":     pod.GenerateName,
+
+					"runner.gitlab.com/token-hash": "e3b0c44298fc1c149afbf4c8996fb924",
+					"job.runner.gitlab.com/id":     "0",
 				}, pod.ObjectMeta.Labels)
 			},
 			Variables: []common.JobVariable{
@@ -2100,6 +2164,168 @@ func TestSetupBuildPod(t *testing.T) {
 				assert.ElementsMatch(t, expectedTolerations, pod.Spec.Tolerations)
 			},
 		},
+		"supports kubernetes pod tolerations with operators and toleration seconds": {
+			RunnerConfig: common.RunnerConfig{
+				RunnerSettings: common.RunnerSettings{
+					Kubernetes: &common.KubernetesConfig{
+						Namespace: "default",
+						NodeTolerations: map[string]string{
+							"custom.toleration=value": "NoSchedule",
+						},
+						Tolerations: []common.KubernetesToleration{
+							{
+								Key:               "node.kubernetes.io/unreachable",
+								Operator:          "Exists",
+								Effect:            "NoExecute",
+								TolerationSeconds: func() *int64 { i := int64(60); return &i }(),
+							},
+							{
+								Key:   "dedicated",
+								Value: "ci",
+							},
+						},
+					},
+				},
+			},
+			VerifyFn: func(t *testing.T, test setupBuildPodTestDef, pod *api.Pod) {
+				expectedTolerations := []api.Toleration{
+					{
+						Key:      "custom.toleration",
+						Operator: api.TolerationOpEqual,
+						Value:    "value",
+						Effect:   api.TaintEffectNoSchedule,
+					},
+					{
+						Key:               "node.kubernetes.io/unreachable",
+						Operator:          api.TolerationOpExists,
+						Effect:            api.TaintEffectNoExecute,
+						TolerationSeconds: func() *int64 { i := int64(60); return &i }(),
+					},
+					{
+						Key:      "dedicated",
+						Operator: api.TolerationOpEqual,
+						Value:    "ci",
+					},
+				}
+				assert.Equal(t, expectedTolerations, pod.Spec.Tolerations)
+			},
+		},
+		"supports affinity and topology spread constraints": {
+			RunnerConfig: common.RunnerConfig{
+				RunnerSettings: common.RunnerSettings{
+					Kubernetes: &common.KubernetesConfig{
+						Namespace: "default",
+						Affinity: common.KubernetesAffinity{
+							NodeAffinity: &common.KubernetesNodeAffinity{
+								RequiredDuringSchedulingIgnoredDuringExecution: &common.KubernetesNodeSelector{
+									NodeSelectorTerms: []common.KubernetesNodeSelectorTerm{
+										{
+											MatchExpressions: []common.KubernetesSelectorRequirement{
+												{Key: "kubernetes.io/os", Operator: "In", Values: []string{"linux"}},
+											},
+										},
+									},
+								},
+								PreferredDuringSchedulingIgnoredDuringExecution: []common.KubernetesPreferredSchedulingTerm{
+									{
+										Weight: 10,
+										Preference: common.KubernetesNodeSelectorTerm{
+											MatchFields: []common.KubernetesSelectorRequirement{
+												{Key: "metadata.name", Operator: "NotIn", Values: []string{"node-1"}},
+											},
+										},
+									},
+								},
+							},
+							PodAntiAffinity: &common.KubernetesPodAffinity{
+								RequiredDuringSchedulingIgnoredDuringExecution: []common.KubernetesPodAffinityTerm{
+									{
+										LabelSelector: &common.KubernetesLabelSelector{
+											MatchLabels: map[string]string{"app": "latency-sensitive"},
+										},
+										TopologyKey: "kubernetes.io/hostname",
+									},
+								},
+							},
+						},
+						TopologySpreadConstraints: []common.KubernetesTopologySpread{
+							{
+								MaxSkew:     1,
+								TopologyKey: "topology.kubernetes.io/zone",
+								LabelSelector: &common.KubernetesLabelSelector{
+									MatchExpressions: []common.KubernetesSelectorRequirement{
+										{Key: "pod", Operator: "Exists"},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			VerifyFn: func(t *testing.T, test setupBuildPodTestDef, pod *api.Pod) {
+				expectedAffinity := &api.Affinity{
+					NodeAffinity: &api.NodeAffinity{
+						RequiredDuringSchedulingIgnoredDuringExecution: &api.NodeSelector{
+							NodeSelectorTerms: []api.NodeSelectorTerm{
+								{
+									MatchExpressions: []api.NodeSelectorRequirement{
+										{Key: "kubernetes.io/os", Operator: api.NodeSelectorOpIn, Values: []string{"linux"}},
+									},
+								},
+							},
+						},
+						PreferredDuringSchedulingIgnoredDuringExecution: []api.PreferredSchedulingTerm{
+							{
+								Weight: 10,
+								Preference: api.NodeSelectorTerm{
+									MatchFields: []api.NodeSelectorRequirement{
+										{Key: "metadata.name", Operator: api.NodeSelectorOpNotIn, Values: []string{"node-1"}},
+									},
+								},
+							},
+						},
+					},
+					PodAntiAffinity: &api.PodAntiAffinity{
+						RequiredDuringSchedulingIgnoredDuringExecution: []api.PodAffinityTerm{
+							{
+								LabelSelector: &metav1.LabelSelector{
+									MatchLabels: map[string]string{"app": "latency-sensitive"},
+								},
+								TopologyKey: "kubernetes.io/hostname",
+							},
+						},
+					},
+				}
+				assert.Equal(t, expectedAffinity, pod.Spec.Affinity)
+
+				expectedConstraints := []api.TopologySpreadConstraint{
+					{
+						MaxSkew:           1,
+						TopologyKey:       "topology.kubernetes.io/zone",
+						WhenUnsatisfiable: api.DoNotSchedule,
+						LabelSelector: &metav1.LabelSelector{
+							MatchExpressions: []metav1.LabelSelectorRequirement{
+								{Key: "pod", Operator: metav1.LabelSelectorOpExists},
+							},
+						},
+					},
+				}
+				assert.Equal(t, expectedConstraints, pod.Spec.TopologySpreadConstraints)
+			},
+		},
+		"no affinity when unspecified": {
+			RunnerConfig: common.RunnerConfig{
+				RunnerSettings: common.RunnerSettings{
+					Kubernetes: &common.KubernetesConfig{
+						Namespace: "default",
+					},
+				},
+			},
+			VerifyFn: func(t *testing.T, test setupBuildPodTestDef, pod *api.Pod) {
+				assert.Nil(t, pod.Spec.Affinity)
+				assert.Empty(t, pod.Spec.TopologySpreadConstraints)
+			},
+		},
 		"supports extended docker configuration for image and services": {
 			RunnerConfig: common.RunnerConfig{
 				RunnerSettings: common.RunnerSettings{
@@ -2197,8 +2423,10 @@ func TestSetupBuildPod(t *testing.T) {
 				expectedServices := []api.Service{
 					{
 						ObjectMeta: metav1.ObjectMeta{
-							GenerateName: "build",
-							Namespace:    "default",
+							GenerateName:    "build",
+							Namespace:       "default",
+							Labels:          e.resourceLabels(),
+							OwnerReferences: e.ownerReferences(),
 						},
 						Spec: api.ServiceSpec{
 							Ports: []api.ServicePort{
@@ -2214,8 +2442,10 @@ func TestSetupBuildPod(t *testing.T) {
 					},
 					{
 						ObjectMeta: metav1.ObjectMeta{
-							GenerateName: "proxy-svc-0",
-							Namespace:    "default",
+							GenerateName:    "proxy-svc-0",
+							Namespace:       "default",
+							Labels:          e.resourceLabels(),
+							OwnerReferences: e.ownerReferences(),
 						},
 						Spec: api.ServiceSpec{
 							Ports: []api.ServicePort{
@@ -2236,8 +2466,10 @@ func TestSetupBuildPod(t *testing.T) {
 					},
 					{
 						ObjectMeta: metav1.ObjectMeta{
-							GenerateName: "proxy-svc-1",
-							Namespace:    "default",
+							GenerateName:    "proxy-svc-1",
+							Namespace:       "default",
+							Labels:          e.resourceLabels(),
+							OwnerReferences: e.ownerReferences(),
 						},
 						Spec: api.ServiceSpec{
 							Ports: []api.ServicePort{
@@ -2535,6 +2767,69 @@ func TestSetupBuildPod(t *testing.T) {
 				assert.Equal(t, []int64{200}, pod.Spec.SecurityContext.SupplementalGroups)
 			},
 		},
+		"supports container security contexts": {
+			RunnerConfig: common.RunnerConfig{
+				RunnerSettings: common.RunnerSettings{
+					Kubernetes: &common.KubernetesConfig{
+						Namespace:  "default",
+						Privileged: true,
+						BuildContainerSecurityContext: common.KubernetesContainerSecurityContext{
+							Capabilities: &common.KubernetesContainerCapabilities{
+								Add:  []string{"NET_ADMIN"},
+								Drop: []string{"ALL"},
+							},
+							Privileged:               func() *bool { b := false; return &b }(),
+							RunAsUser:                func() *int64 { i := int64(1000); return &i }(),
+							AllowPrivilegeEscalation: func() *bool { b := false; return &b }(),
+							SeccompProfile:           "runtime/default",
+							AppArmorProfile:          "runtime/default",
+						},
+						HelperContainerSecurityContext: common.KubernetesContainerSecurityContext{
+							ReadOnlyRootFilesystem: func() *bool { b := true; return &b }(),
+							SeccompProfile:         "localhost/helper",
+						},
+						ServiceContainerSecurityContext: common.KubernetesContainerSecurityContext{
+							Capabilities: &common.KubernetesContainerCapabilities{
+								Drop: []string{"ALL"},
+							},
+						},
+					},
+				},
+			},
+			Options: &kubernetesOptions{
+				Services: common.Services{
+					{Name: "postgres:latest"},
+				},
+			},
+			VerifyFn: func(t *testing.T, test setupBuildPodTestDef, pod *api.Pod) {
+				require.Len(t, pod.Spec.Containers, 3)
+
+				build := pod.Spec.Containers[0].SecurityContext
+				expectedCapabilities := &api.Capabilities{
+					Add:  []api.Capability{"NET_ADMIN"},
+					Drop: []api.Capability{"ALL"},
+				}
+				assert.Equal(t, expectedCapabilities, build.Capabilities)
+				assert.False(t, *build.Privileged, "overrides the privileged setting of the runner")
+				assert.Equal(t, int64(1000), *build.RunAsUser)
+				assert.False(t, *build.AllowPrivilegeEscalation)
+				assert.Nil(t, build.ReadOnlyRootFilesystem)
+
+				helper := pod.Spec.Containers[1].SecurityContext
+				assert.True(t, *helper.Privileged)
+				assert.True(t, *helper.ReadOnlyRootFilesystem)
+				assert.Nil(t, helper.Capabilities)
+
+				service := pod.Spec.Containers[2].SecurityContext
+				assert.Equal(t, &api.Capabilities{Drop: []api.Capability{"ALL"}}, service.Capabilities)
+
+				assert.Equal(t, "runtime/default", pod.Annotations["container.seccomp.security.alpha.kubernetes.io/build"])
+				assert.Equal(t, "runtime/default", pod.Annotations["container.apparmor.security.beta.kubernetes.io/build"])
+				assert.Equal(t, "localhost/helper", pod.Annotations["container.seccomp.security.alpha.kubernetes.io/helper"])
+				assert.NotContains(t, pod.Annotations, "container.apparmor.security.beta.kubernetes.io/helper")
+				assert.NotContains(t, pod.Annotations, "container.seccomp.security.alpha.kubernetes.io/svc-0")
+			},
+		},
 		"uses default security context when unspecified": {
 			RunnerConfig: common.RunnerConfig{
 				RunnerSettings: common.RunnerSettings{
@@ -2668,6 +2963,52 @@ func TestSetupBuildPod(t *testing.T) {
 				assert.Equal(t, []string{"test-service", "alias"}, pod.Spec.HostAliases[0].Hostnames)
 			},
 		},
+		"supports DNS policy, DNS config and host aliases": {
+			RunnerConfig: common.RunnerConfig{
+				RunnerSettings: common.RunnerSettings{
+					Kubernetes: &common.KubernetesConfig{
+						Namespace: "default",
+						DNSPolicy: "None",
+						DNSConfig: common.KubernetesDNSConfig{
+							Nameservers: []string{"10.0.0.10"},
+							Searches:    []string{"svc.cluster.local"},
+							Options: []common.KubernetesDNSConfigOption{
+								{Name: "ndots", Value: &[]string{"2"}[0]},
+							},
+						},
+						HostAliases: []common.KubernetesHostAliases{
+							{IP: "10.0.0.1", Hostnames: []string{"registry.local"}},
+						},
+					},
+				},
+			},
+			Options: &kubernetesOptions{
+				Services: common.Services{
+					{
+						Name:  "test-service",
+						Alias: "alias",
+					},
+				},
+			},
+			VerifyFn: func(t *testing.T, test setupBuildPodTestDef, pod *api.Pod) {
+				if pod.Kind == "Service" {
+					return
+				}
+
+				assert.Equal(t, api.DNSNone, pod.Spec.DNSPolicy)
+				require.NotNil(t, pod.Spec.DNSConfig)
+				assert.Equal(t, []string{"10.0.0.10"}, pod.Spec.DNSConfig.Nameservers)
+				assert.Equal(t, []string{"svc.cluster.local"}, pod.Spec.DNSConfig.Searches)
+				require.Len(t, pod.Spec.DNSConfig.Options, 1)
+				assert.Equal(t, "ndots", pod.Spec.DNSConfig.Options[0].Name)
+				assert.Equal(t, "2", *pod.Spec.DNSConfig.Options[0].Value)
+
+				assert.Equal(t, []api.HostAlias{
+					{IP: "10.0.0.1", Hostnames: []string{"registry.local"}},
+					{IP: "127.0.0.1", Hostnames: []string{"test-service", "alias"}},
+				}, pod.Spec.HostAliases)
+			},
+		},
 		"no host aliases when feature is not supported": {
 			RunnerConfig: common.RunnerConfig{
 				RunnerSettings: common.RunnerSettings{
@@ -2996,9 +3337,10 @@ func TestRunAttachCheckPodStatus(t *testing.T) {
 
 func TestLimits(t *testing.T) {
 	tests := []struct {
-		CPU, Memory string
-		Expected    api.ResourceList
-		ExpectedErr error
+		CPU, Memory      string
+		EphemeralStorage string
+		Expected         api.ResourceList
+		ExpectedErr      error
 	}{
 		{
 			CPU:    "100m",
@@ -3033,6 +3375,20 @@ func TestLimits(t *testing.T) {
 			Expected:    api.ResourceList{},
 			ExpectedErr: resource.ErrFormatWrong,
 		},
+		{
+			CPU:              "100m",
+			EphemeralStorage: "1Gi",
+			Expected: api.ResourceList{
+				api.ResourceCPU:              resource.MustParse("100m"),
+				api.ResourceEphemeralStorage: resource.MustParse("1Gi"),
+			},
+			ExpectedErr: nil,
+		},
+		{
+			EphemeralStorage: "1j",
+			Expected:         api.ResourceList{},
+			ExpectedErr:      resource.ErrFormatWrong,
+		},
 		{
 			Expected:    api.ResourceList{},
 			ExpectedErr: nil,
@@ -3040,8 +3396,9 @@ func TestLimits(t *testing.T) {
 	}
 
 	for _, tc := range tests {
-		t.Run(fmt.Sprintf("CPU=%s/Memory=%s", tc.CPU, tc.Memory), func(t *testing.T) {
-			res, err := limits(tc.CPU, tc.Memory)
+		name := fmt.Sprintf("CPU=%s/Memory=%s/EphemeralStorage=%s", tc.CPU, tc.Memory, tc.EphemeralStorage)
+		t.Run(name, func(t *testing.T) {
+			res, err := limits(tc.CPU, tc.Memory, tc.EphemeralStorage)
 			assert.True(
 				t,
 				errors.Is(err, tc.ExpectedErr),
@@ -0,0 +1,248 @@
+package kubernetes
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors"
+)
+
+const (
+	runnerTokenHashLabel = "runner.gitlab.com/token-hash"
+	jobIDLabel           = "job.runner.gitlab.com/id"
+)
+
+// runnerTokenHash identifies the resources of a runner without exposing its
+// token. It's short enough to be used as a label value
+func runnerTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:16])
+}
+
+// resourceLabels returns the labels set on every resource created for the
+// job, used to find the resources left behind by the jobs of the runner
+func (s *executor) resourceLabels() map[string]string {
+	return map[string]string{
+		runnerTokenHashLabel: runnerTokenHash(s.Config.Token),
+		jobIDLabel:           strconv.Itoa(s.Build.ID),
+	}
+}
+
+// ownerReferences makes the resources created for the job dependents of the
+// build pod, to have them garbage collected along with it
+func (s *executor) ownerReferences() []metav1.OwnerReference {
+	if s.pod == nil {
+		return nil
+	}
+
+	return []metav1.OwnerReference{
+		{
+			APIVersion: "v1",
+			Kind:       "Pod",
+			Name:       s.pod.Name,
+			UID:        s.pod.UID,
+		},
+	}
+}
+
+// setOwnerReferences makes the credentials and the scripts config map created
+// before the build pod dependents of it. They're still deleted in Cleanup, so
+// failing to update them isn't fatal
+func (s *executor) setOwnerReferences() {
+	refs := s.ownerReferences()
+
+	if s.credentials != nil {
+		s.credentials.OwnerReferences = refs
+		credentials, err := s.kubeClient.CoreV1().Secrets(s.credentials.Namespace).Update(s.credentials)
+		if err != nil {
+			s.Debugln("Setting the owner of the credentials secret", err)
+		} else {
+			s.credentials = credentials
+		}
+	}
+
+	if s.configMap != nil {
+		s.configMap.OwnerReferences = refs
+		configMap, err := s.kubeClient.CoreV1().ConfigMaps(s.configMap.Namespace).Update(s.configMap)
+		if err != nil {
+			s.Debugln("Setting the owner of the scripts config map", err)
+		} else {
+			s.configMap = configMap
+		}
+	}
+}
+
+// orphanedResources lists and deletes one kind of the resources created for
+// the jobs
+type orphanedResources struct {
+	kind   string
+	list   func(namespace string, options metav1.ListOptions) ([]metav1.ObjectMeta, error)
+	delete func(namespace string, name string) error
+}
+
+func kubernetesOrphanedResources(client *kubernetes.Clientset) []orphanedResources {
+	core := client.CoreV1()
+	deleteOptions := &metav1.DeleteOptions{}
+
+	return []orphanedResources{
+		{
+			kind: "pod",
+			list: func(namespace string, options metav1.ListOptions) ([]metav1.ObjectMeta, error) {
+				list, err := core.Pods(namespace).List(options)
+				if err != nil {
+					return nil, err
+				}
+
+				objects := make([]metav1.ObjectMeta, 0, len(list.Items))
+				for _, item := range list.Items {
+					objects = append(objects, item.ObjectMeta)
+				}
+				return objects, nil
+			},
+			delete: func(namespace string, name string) error {
+				return core.Pods(namespace).Delete(name, deleteOptions)
+			},
+		},
+		{
+			kind: "secret",
+			list: func(namespace string, options metav1.ListOptions) ([]metav1.ObjectMeta, error) {
+				list, err := core.Secrets(namespace).List(options)
+				if err != nil {
+					return nil, err
+				}
+
+				objects := make([]metav1.ObjectMeta, 0, len(list.Items))
+				for _, item := range list.Items {
+					objects = append(objects, item.ObjectMeta)
+				}
+				return objects, nil
+			},
+			delete: func(namespace string, name string) error {
+				return core.Secrets(namespace).Delete(name, deleteOptions)
+			},
+		},
+		{
+			kind: "config map",
+			list: func(namespace string, options metav1.ListOptions) ([]metav1.ObjectMeta, error) {
+				list, err := core.ConfigMaps(namespace).List(options)
+				if err != nil {
+					return nil, err
+				}
+
+				objects := make([]metav1.ObjectMeta, 0, len(list.Items))
+				for _, item := range list.Items {
+					objects = append(objects, item.ObjectMeta)
+				}
+				return objects, nil
+			},
+			delete: func(namespace string, name string) error {
+				return core.ConfigMaps(namespace).Delete(name, deleteOptions)
+			},
+		},
+		{
+			kind: "service",
+			list: func(namespace string, options metav1.ListOptions) ([]metav1.ObjectMeta, error) {
+				list, err := core.Services(namespace).List(options)
+				if err != nil {
+					return nil, err
+				}
+
+				objects := make([]metav1.ObjectMeta, 0, len(list.Items))
+				for _, item := range list.Items {
+					objects = append(objects, item.ObjectMeta)
+				}
+				return objects, nil
+			},
+			delete: func(namespace string, name string) error {
+				return core.Services(namespace).Delete(name, deleteOptions)
+			},
+		},
+	}
+}
+
+// executorProvider adds the cleanup of the orphaned resources to the default
+// executor provider
+type executorProvider struct {
+	executors.DefaultExecutorProvider
+
+	newKubeClient func(config *common.KubernetesConfig) (*kubernetes.Clientset, error)
+}
+
+func newKubeClient(config *common.KubernetesConfig) (*kubernetes.Clientset, error) {
+	kubeConfig, err := getKubeClientConfig(config, &overwrites{})
+	if err != nil {
+		return nil, err
+	}
+
+	return kubernetes.NewForConfig(kubeConfig)
+}
+
+// CleanupOrphanedResources deletes the resources labelled with the token hash
+// of the runner belonging to the jobs that aren't running anymore. The
+// resources are listed before checking the jobs, so that the resources of a
+// job starting meanwhile are never seen as orphaned
+func (p *executorProvider) CleanupOrphanedResources(config *common.RunnerConfig, running func(jobID int) bool) error {
+	if config.Kubernetes == nil || !config.Kubernetes.CleanupOrphanedResources {
+		return nil
+	}
+
+	client, err := p.newKubeClient(config.Kubernetes)
+	if err != nil {
+		return fmt.Errorf("creating the kubernetes client: %w", err)
+	}
+	defer closeKubeClient(client)
+
+	// the jobs can run in any namespace when they are allowed to overwrite it
+	namespace := config.Kubernetes.Namespace
+	if config.Kubernetes.NamespaceOverwriteAllowed != "" {
+		namespace = metav1.NamespaceAll
+	}
+
+	options := metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{
+			runnerTokenHashLabel: runnerTokenHash(config.Token),
+		}).String(),
+	}
+
+	var lastErr error
+	for _, resources := range kubernetesOrphanedResources(client) {
+		objects, err := resources.list(namespace, options)
+		if err != nil {
+			lastErr = fmt.Errorf("listing the %ss: %w", resources.kind, err)
+			continue
+		}
+
+		for _, object := range objects {
+			jobID, err := strconv.Atoi(object.Labels[jobIDLabel])
+			if err != nil || running(jobID) {
+				continue
+			}
+
+			logger := logrus.WithFields(logrus.Fields{
+				"runner":    config.ShortDescription(),
+				"job":       jobID,
+				"namespace": object.Namespace,
+				"name":      object.Name,
+			})
+
+			err = resources.delete(object.Namespace, object.Name)
+			if err != nil {
+				logger.WithError(err).Warningln("Failed to delete orphaned", resources.kind)
+				lastErr = err
+				continue
+			}
+
+			logger.Infoln("Deleted orphaned", resources.kind)
+		}
+	}
+
+	return lastErr
+}
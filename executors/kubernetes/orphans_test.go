@@ -0,0 +1,171 @@
+package kubernetes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest/fake"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+func TestResourceLabels(t *testing.T) {
+	e := newExecutor()
+	e.Config.Token = "token"
+	e.Build = &common.Build{JobResponse: common.JobResponse{ID: 123}}
+
+	labels := e.resourceLabels()
+	assert.Equal(t, "123", labels[jobIDLabel])
+	assert.Len(t, labels[runnerTokenHashLabel], 32)
+	assert.NotContains(t, labels[runnerTokenHashLabel], "token")
+}
+
+func orphanedResourcesMeta(namespace string, name string, jobID string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Namespace: namespace,
+		Name:      name,
+		Labels: map[string]string{
+			runnerTokenHashLabel: runnerTokenHash("token"),
+			jobIDLabel:           jobID,
+		},
+	}
+}
+
+func TestCleanupOrphanedResources(t *testing.T) {
+	version, _ := testVersionAndCodec()
+
+	lists := map[string]interface{}{
+		"pods": api.PodList{
+			TypeMeta: metav1.TypeMeta{Kind: "PodList", APIVersion: "v1"},
+			Items: []api.Pod{
+				{ObjectMeta: orphanedResourcesMeta("ns", "pod-running", "1")},
+				{ObjectMeta: orphanedResourcesMeta("ns", "pod-orphaned", "2")},
+			},
+		},
+		"secrets": api.SecretList{
+			TypeMeta: metav1.TypeMeta{Kind: "SecretList", APIVersion: "v1"},
+			Items: []api.Secret{
+				{ObjectMeta: orphanedResourcesMeta("ns", "secret-orphaned", "2")},
+				{ObjectMeta: orphanedResourcesMeta("ns", "secret-unknown", "not-a-job")},
+			},
+		},
+		"configmaps": api.ConfigMapList{
+			TypeMeta: metav1.TypeMeta{Kind: "ConfigMapList", APIVersion: "v1"},
+			Items: []api.ConfigMap{
+				{ObjectMeta: orphanedResourcesMeta("ns", "configmap-orphaned", "2")},
+			},
+		},
+		"services": api.ServiceList{
+			TypeMeta: metav1.TypeMeta{Kind: "ServiceList", APIVersion: "v1"},
+			Items: []api.Service{
+				{ObjectMeta: orphanedResourcesMeta("ns", "service-running", "1")},
+			},
+		},
+	}
+
+	tests := map[string]struct {
+		config            common.KubernetesConfig
+		expectedNamespace string
+		expectedDeleted   []string
+	}{
+		"disabled": {
+			config: common.KubernetesConfig{Namespace: "ns"},
+		},
+		"enabled": {
+			config:            common.KubernetesConfig{Namespace: "ns", CleanupOrphanedResources: true},
+			expectedNamespace: "/namespaces/ns",
+			expectedDeleted: []string{
+				"/api/v1/namespaces/ns/configmaps/configmap-orphaned",
+				"/api/v1/namespaces/ns/pods/pod-orphaned",
+				"/api/v1/namespaces/ns/secrets/secret-orphaned",
+			},
+		},
+		"namespace overwrite allowed": {
+			config: common.KubernetesConfig{
+				Namespace:                 "ns",
+				NamespaceOverwriteAllowed: ".*",
+				CleanupOrphanedResources:  true,
+			},
+			expectedDeleted: []string{
+				"/api/v1/namespaces/ns/configmaps/configmap-orphaned",
+				"/api/v1/namespaces/ns/pods/pod-orphaned",
+				"/api/v1/namespaces/ns/secrets/secret-orphaned",
+			},
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			var lock sync.Mutex
+			var deleted []string
+
+			fakeClient := fake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+				var body []byte
+
+				switch req.Method {
+				case http.MethodGet:
+					assert.Equal(
+						t,
+						runnerTokenHashLabel+"="+runnerTokenHash("token"),
+						req.URL.Query().Get("labelSelector"),
+					)
+
+					for resource, list := range lists {
+						if req.URL.Path == "/api/"+version+tt.expectedNamespace+"/"+resource {
+							var err error
+							body, err = json.Marshal(list)
+							require.NoError(t, err)
+						}
+					}
+					if body == nil {
+						return nil, fmt.Errorf("unexpected request %s", req.URL.Path)
+					}
+				case http.MethodDelete:
+					lock.Lock()
+					deleted = append(deleted, req.URL.Path)
+					lock.Unlock()
+
+					body, _ = json.Marshal(metav1.Status{Status: metav1.StatusSuccess})
+				default:
+					return nil, fmt.Errorf("unexpected request %s %s", req.Method, req.URL.Path)
+				}
+
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       ioutil.NopCloser(bytes.NewReader(body)),
+					Header:     map[string][]string{"Content-Type": {"application/json"}},
+				}, nil
+			})
+
+			p := &executorProvider{
+				newKubeClient: func(config *common.KubernetesConfig) (*kubernetes.Clientset, error) {
+					return testKubernetesClient(version, fakeClient), nil
+				},
+			}
+
+			config := &common.RunnerConfig{
+				RunnerCredentials: common.RunnerCredentials{Token: "token"},
+				RunnerSettings:    common.RunnerSettings{Kubernetes: &tt.config},
+			}
+
+			err := p.CleanupOrphanedResources(config, func(jobID int) bool {
+				return jobID == 1
+			})
+			require.NoError(t, err)
+
+			sort.Strings(deleted)
+			assert.Equal(t, tt.expectedDeleted, deleted)
+		})
+	}
+}
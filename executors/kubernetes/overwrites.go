@@ -5,6 +5,7 @@ import (
 	"regexp"
 	"strings"
 
+	api "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 
 	"gitlab.com/gitlab-org/gitlab-runner/common"
@@ -28,6 +29,56 @@ const (
 	MemoryLimitOverwriteVariableValue = "KUBERNETES_MEMORY_LIMIT"
 	// MemoryRequestOverwriteVariableValue is the key for the JobVariable containing user overwritten memory limit
 	MemoryRequestOverwriteVariableValue = "KUBERNETES_MEMORY_REQUEST"
+	// EphemeralStorageLimitOverwriteVariableValue is the key for the JobVariable containing user overwritten
+	// ephemeral storage limit
+	EphemeralStorageLimitOverwriteVariableValue = "KUBERNETES_EPHEMERAL_STORAGE_LIMIT"
+	// EphemeralStorageRequestOverwriteVariableValue is the key for the JobVariable containing user overwritten
+	// ephemeral storage request
+	EphemeralStorageRequestOverwriteVariableValue = "KUBERNETES_EPHEMERAL_STORAGE_REQUEST"
+	// PodSpecPatchOverwriteVariableValue is the key for the JobVariable containing the user provided
+	// pod spec patch
+	PodSpecPatchOverwriteVariableValue = "KUBERNETES_POD_SPEC_PATCH"
+	// PodSpecPatchTypeOverwriteVariableValue is the key for the JobVariable containing the type of the
+	// user provided pod spec patch
+	PodSpecPatchTypeOverwriteVariableValue = "KUBERNETES_POD_SPEC_PATCH_TYPE"
+	// ServiceCPULimitOverwriteVariableValue is the key for the JobVariable containing user overwritten
+	// service cpu limit
+	ServiceCPULimitOverwriteVariableValue = "KUBERNETES_SERVICE_CPU_LIMIT"
+	// ServiceCPURequestOverwriteVariableValue is the key for the JobVariable containing user overwritten
+	// service cpu request
+	ServiceCPURequestOverwriteVariableValue = "KUBERNETES_SERVICE_CPU_REQUEST"
+	// ServiceMemoryLimitOverwriteVariableValue is the key for the JobVariable containing user overwritten
+	// service memory limit
+	ServiceMemoryLimitOverwriteVariableValue = "KUBERNETES_SERVICE_MEMORY_LIMIT"
+	// ServiceMemoryRequestOverwriteVariableValue is the key for the JobVariable containing user overwritten
+	// service memory request
+	ServiceMemoryRequestOverwriteVariableValue = "KUBERNETES_SERVICE_MEMORY_REQUEST"
+	// ServiceEphemeralStorageLimitOverwriteVariableValue is the key for the JobVariable containing user
+	// overwritten service ephemeral storage limit
+	ServiceEphemeralStorageLimitOverwriteVariableValue = "KUBERNETES_SERVICE_EPHEMERAL_STORAGE_LIMIT"
+	// ServiceEphemeralStorageRequestOverwriteVariableValue is the key for the JobVariable containing user
+	// overwritten service ephemeral storage request
+	ServiceEphemeralStorageRequestOverwriteVariableValue = "KUBERNETES_SERVICE_EPHEMERAL_STORAGE_REQUEST"
+	// ServiceReadinessProbePortVariableValue is the key for the JobVariable containing the port checked
+	// by the readiness probe of a service
+	ServiceReadinessProbePortVariableValue = "KUBERNETES_SERVICE_READINESS_PROBE_PORT"
+	// ServiceReadinessProbePathVariableValue is the key for the JobVariable containing the path requested
+	// by the HTTP readiness probe of a service
+	ServiceReadinessProbePathVariableValue = "KUBERNETES_SERVICE_READINESS_PROBE_PATH"
+	// DNSPolicyOverwriteVariableValue is the key for the JobVariable containing user overwritten DNS policy
+	DNSPolicyOverwriteVariableValue = "KUBERNETES_DNS_POLICY"
+	// DNSNameserversOverwriteVariableValue is the key for the JobVariable containing the comma separated
+	// list of user overwritten DNS nameservers
+	DNSNameserversOverwriteVariableValue = "KUBERNETES_DNS_NAMESERVERS"
+	// DNSSearchesOverwriteVariableValue is the key for the JobVariable containing the comma separated
+	// list of user overwritten DNS search domains
+	DNSSearchesOverwriteVariableValue = "KUBERNETES_DNS_SEARCHES"
+	// DNSOptionsOverwriteVariableValue is the key for the JobVariable containing the comma separated
+	// list of user overwritten resolver options, like "ndots:2"
+	DNSOptionsOverwriteVariableValue = "KUBERNETES_DNS_OPTIONS"
+	// HostAliasesOverwriteVariableValue is the key for the JobVariable containing the semicolon separated
+	// list of user provided host aliases, like "10.0.0.1=registry.local,cache.local"
+	HostAliasesOverwriteVariableValue = "KUBERNETES_HOST_ALIASES"
 )
 
 type overwriteTooHighError struct {
@@ -68,6 +119,15 @@ type overwrites struct {
 	cpuRequest     string
 	memoryLimit    string
 	memoryRequest  string
+
+	ephemeralStorageLimit   string
+	ephemeralStorageRequest string
+
+	podSpecPatch *podSpecPatch
+
+	dnsPolicy   api.DNSPolicy
+	dnsConfig   *api.PodDNSConfig
+	hostAliases []api.HostAlias
 }
 
 //nolint:funlen
@@ -177,6 +237,131 @@ func createOverwrites(
 		return nil, err
 	}
 
+	ephemeralStorageLimitOverwrite := variables.Get(EphemeralStorageLimitOverwriteVariableValue)
+	o.ephemeralStorageLimit, err = o.evaluateMaxResourceOverwrite(
+		"EphemeralStorageLimit",
+		config.EphemeralStorageLimit,
+		config.EphemeralStorageLimitOverwriteMaxAllowed,
+		ephemeralStorageLimitOverwrite,
+		logger,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ephemeralStorageRequestOverwrite := variables.Get(EphemeralStorageRequestOverwriteVariableValue)
+	o.ephemeralStorageRequest, err = o.evaluateMaxResourceOverwrite(
+		"EphemeralStorageRequest",
+		config.EphemeralStorageRequest,
+		config.EphemeralStorageRequestOverwriteMaxAllowed,
+		ephemeralStorageRequestOverwrite,
+		logger,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	o.podSpecPatch, err = o.evaluatePodSpecPatchOverwrite(
+		config.PodSpecPatchAllowedFields,
+		variables.Get(PodSpecPatchOverwriteVariableValue),
+		variables.Get(PodSpecPatchTypeOverwriteVariableValue),
+		logger,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = o.evaluateDNSOverwrites(config, variables, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// serviceOverwrites are the resources of a service container overwritten by
+// the variables of the job or of the service. The resources that aren't
+// overwritten are empty
+type serviceOverwrites struct {
+	cpuLimit                string
+	cpuRequest              string
+	memoryLimit             string
+	memoryRequest           string
+	ephemeralStorageLimit   string
+	ephemeralStorageRequest string
+}
+
+func createServiceOverwrites(
+	name string,
+	config *common.KubernetesConfig,
+	variables common.JobVariables,
+	logger common.BuildLogger,
+) (*serviceOverwrites, error) {
+	o := &serviceOverwrites{}
+
+	variables = variables.Expand()
+
+	resources := []struct {
+		fieldName   string
+		maxResource string
+		variable    string
+		value       *string
+	}{
+		{
+			"ServiceCPULimit",
+			config.ServiceCPULimitOverwriteMaxAllowed,
+			ServiceCPULimitOverwriteVariableValue,
+			&o.cpuLimit,
+		},
+		{
+			"ServiceCPURequest",
+			config.ServiceCPURequestOverwriteMaxAllowed,
+			ServiceCPURequestOverwriteVariableValue,
+			&o.cpuRequest,
+		},
+		{
+			"ServiceMemoryLimit",
+			config.ServiceMemoryLimitOverwriteMaxAllowed,
+			ServiceMemoryLimitOverwriteVariableValue,
+			&o.memoryLimit,
+		},
+		{
+			"ServiceMemoryRequest",
+			config.ServiceMemoryRequestOverwriteMaxAllowed,
+			ServiceMemoryRequestOverwriteVariableValue,
+			&o.memoryRequest,
+		},
+		{
+			"ServiceEphemeralStorageLimit",
+			config.ServiceEphemeralStorageLimitOverwriteMaxAllowed,
+			ServiceEphemeralStorageLimitOverwriteVariableValue,
+			&o.ephemeralStorageLimit,
+		},
+		{
+			"ServiceEphemeralStorageRequest",
+			config.ServiceEphemeralStorageRequestOverwriteMaxAllowed,
+			ServiceEphemeralStorageRequestOverwriteVariableValue,
+			&o.ephemeralStorageRequest,
+		},
+	}
+
+	// the checks of the overwrites don't depend on the overwrites of the job
+	evaluator := &overwrites{}
+
+	var err error
+	for _, r := range resources {
+		*r.value, err = evaluator.evaluateMaxResourceOverwrite(
+			fmt.Sprintf("%s of %s", r.fieldName, name),
+			"",
+			r.maxResource,
+			variables.Get(r.variable),
+			logger,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return o, nil
 }
 
@@ -316,3 +501,35 @@ func (o *overwrites) evaluateMaxResourceOverwrite(
 
 	return overwriteValue, nil
 }
+
+func (o *overwrites) evaluatePodSpecPatchOverwrite(
+	allowedFields []string,
+	overwriteValue, patchType string,
+	logger common.BuildLogger,
+) (*podSpecPatch, error) {
+	if len(allowedFields) == 0 {
+		logger.Debugln("List of fields allowing pod spec patches is empty, disabling override.")
+		return nil, nil
+	}
+
+	if overwriteValue == "" {
+		return nil, nil
+	}
+
+	data, kind, err := common.ParsePodSpecPatch(
+		[]byte(overwriteValue),
+		common.KubernetesPodSpecPatchType(patchType),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", PodSpecPatchOverwriteVariableValue, err)
+	}
+
+	logger.Println("Pod spec patch provided by the job, allowed fields:", strings.Join(allowedFields, ", "))
+
+	return &podSpecPatch{
+		name:          PodSpecPatchOverwriteVariableValue,
+		patch:         data,
+		patchType:     kind,
+		allowedFields: allowedFields,
+	}, nil
+}
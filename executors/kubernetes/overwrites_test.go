@@ -57,22 +57,29 @@ func TestOverwrites(t *testing.T) {
 		MemoryRequest:                    "2Gi",
 		MemoryLimitOverwriteMaxAllowed:   "15Gi",
 		MemoryRequestOverwriteMaxAllowed: "10Gi",
+
+		EphemeralStorageLimit:                      "10Gi",
+		EphemeralStorageRequest:                    "5Gi",
+		EphemeralStorageLimitOverwriteMaxAllowed:   "50Gi",
+		EphemeralStorageRequestOverwriteMaxAllowed: "20Gi",
 	}
 
 	//nolint:lll
 	tests := []struct {
-		Name                                 string
-		Config                               *common.KubernetesConfig
-		NamespaceOverwriteVariableValue      string
-		ServiceAccountOverwriteVariableValue string
-		BearerTokenOverwriteVariableValue    string
-		PodAnnotationsOverwriteValues        map[string]string
-		CPULimitOverwriteVariableValue       string
-		CPURequestOverwriteVariableValue     string
-		MemoryLimitOverwriteVariableValue    string
-		MemoryRequestOverwriteVariableValue  string
-		Expected                             *overwrites
-		Error                                error
+		Name                                  string
+		Config                                *common.KubernetesConfig
+		NamespaceOverwriteVariableValue       string
+		ServiceAccountOverwriteVariableValue  string
+		BearerTokenOverwriteVariableValue     string
+		PodAnnotationsOverwriteValues         map[string]string
+		CPULimitOverwriteVariableValue        string
+		CPURequestOverwriteVariableValue      string
+		MemoryLimitOverwriteVariableValue     string
+		MemoryRequestOverwriteVariableValue   string
+		EphemeralStorageLimitOverwriteValue   string
+		EphemeralStorageRequestOverwriteValue string
+		Expected                              *overwrites
+		Error                                 error
 	}{
 		{
 			Name:     "Empty Configuration",
@@ -91,10 +98,12 @@ func TestOverwrites(t *testing.T) {
 				"KUBERNETES_POD_ANNOTATIONS_gilabversion": "org.gitlab/runner-version=v10.4.0-override",
 				"KUBERNETES_POD_ANNOTATIONS_kube2iam":     "iam.amazonaws.com/role=arn:aws:iam::kjcbs;dkjbck=jxzweopiu:role/",
 			},
-			CPULimitOverwriteVariableValue:      "10",
-			CPURequestOverwriteVariableValue:    "8",
-			MemoryLimitOverwriteVariableValue:   "15Gi",
-			MemoryRequestOverwriteVariableValue: "10Gi",
+			CPULimitOverwriteVariableValue:        "10",
+			CPURequestOverwriteVariableValue:      "8",
+			MemoryLimitOverwriteVariableValue:     "15Gi",
+			MemoryRequestOverwriteVariableValue:   "10Gi",
+			EphemeralStorageLimitOverwriteValue:   "50Gi",
+			EphemeralStorageRequestOverwriteValue: "20Gi",
 			Expected: &overwrites{
 				namespace:      "my_namespace",
 				serviceAccount: "my_service_account",
@@ -112,6 +121,9 @@ func TestOverwrites(t *testing.T) {
 				cpuRequest:    "8",
 				memoryLimit:   "15Gi",
 				memoryRequest: "10Gi",
+
+				ephemeralStorageLimit:   "50Gi",
+				ephemeralStorageRequest: "20Gi",
 			},
 		},
 		{
@@ -128,6 +140,9 @@ func TestOverwrites(t *testing.T) {
 				CPURequest:    "1",
 				MemoryLimit:   "2Gi",
 				MemoryRequest: "2Gi",
+
+				EphemeralStorageLimit:   "10Gi",
+				EphemeralStorageRequest: "5Gi",
 			},
 			NamespaceOverwriteVariableValue:      "another_namespace",
 			ServiceAccountOverwriteVariableValue: "another_service_account",
@@ -136,10 +151,12 @@ func TestOverwrites(t *testing.T) {
 				"KUBERNETES_POD_ANNOTATIONS_1": "test3=test3",
 				"KUBERNETES_POD_ANNOTATIONS_2": "test4=test4",
 			},
-			CPULimitOverwriteVariableValue:      "10",
-			CPURequestOverwriteVariableValue:    "8",
-			MemoryLimitOverwriteVariableValue:   "15Gi",
-			MemoryRequestOverwriteVariableValue: "10Gi",
+			CPULimitOverwriteVariableValue:        "10",
+			CPURequestOverwriteVariableValue:      "8",
+			MemoryLimitOverwriteVariableValue:     "15Gi",
+			MemoryRequestOverwriteVariableValue:   "10Gi",
+			EphemeralStorageLimitOverwriteValue:   "50Gi",
+			EphemeralStorageRequestOverwriteValue: "20Gi",
 			Expected: &overwrites{
 				namespace:      "my_namespace",
 				serviceAccount: "my_service_account",
@@ -152,6 +169,9 @@ func TestOverwrites(t *testing.T) {
 				cpuRequest:    "1",
 				memoryLimit:   "2Gi",
 				memoryRequest: "2Gi",
+
+				ephemeralStorageLimit:   "10Gi",
+				ephemeralStorageRequest: "5Gi",
 			},
 		},
 		{
@@ -281,6 +301,22 @@ func TestOverwrites(t *testing.T) {
 			MemoryRequestOverwriteVariableValue: "5000Mi",
 			Error:                               new(overwriteTooHighError),
 		},
+		{
+			Name: "EphemeralStorageLimit too high",
+			Config: &common.KubernetesConfig{
+				EphemeralStorageLimitOverwriteMaxAllowed: "20Gi",
+			},
+			EphemeralStorageLimitOverwriteValue: "30Gi",
+			Error:                               new(overwriteTooHighError),
+		},
+		{
+			Name: "EphemeralStorageRequest too high different suffix",
+			Config: &common.KubernetesConfig{
+				EphemeralStorageRequestOverwriteMaxAllowed: "1Gi",
+			},
+			EphemeralStorageRequestOverwriteValue: "2000Mi",
+			Error:                                 new(overwriteTooHighError),
+		},
 	}
 
 	for _, test := range tests {
@@ -294,6 +330,9 @@ func TestOverwrites(t *testing.T) {
 					CPURequestOverwriteVariableValue:    test.CPURequestOverwriteVariableValue,
 					MemoryLimitOverwriteVariableValue:   test.MemoryLimitOverwriteVariableValue,
 					MemoryRequestOverwriteVariableValue: test.MemoryRequestOverwriteVariableValue,
+
+					EphemeralStorageLimitOverwriteVariableValue:   test.EphemeralStorageLimitOverwriteValue,
+					EphemeralStorageRequestOverwriteVariableValue: test.EphemeralStorageRequestOverwriteValue,
 				},
 				test.PodAnnotationsOverwriteValues,
 			)
@@ -0,0 +1,158 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+type podSpecFieldNotAllowedError struct {
+	field string
+}
+
+func (e *podSpecFieldNotAllowedError) Error() string {
+	return fmt.Sprintf("the pod spec patch changes the field %q, which isn't allowed", e.field)
+}
+
+func (e *podSpecFieldNotAllowedError) Is(err error) bool {
+	_, ok := err.(*podSpecFieldNotAllowedError)
+	return ok
+}
+
+// podSpecPatch is a JSON document patching the spec of the build pod.
+// When allowedFields is set, only these top-level fields can be changed
+type podSpecPatch struct {
+	name          string
+	patch         []byte
+	patchType     common.KubernetesPodSpecPatchType
+	allowedFields []string
+}
+
+func (s *executor) podSpecPatches() ([]podSpecPatch, error) {
+	var patches []podSpecPatch
+
+	for _, spec := range s.Config.Kubernetes.PodSpec {
+		patch, patchType, err := spec.PatchAttrs()
+		if err != nil {
+			return nil, fmt.Errorf("invalid pod spec patch %q: %w", spec.Name, err)
+		}
+
+		patches = append(patches, podSpecPatch{name: spec.Name, patch: patch, patchType: patchType})
+	}
+
+	if s.configurationOverwrites.podSpecPatch != nil {
+		patches = append(patches, *s.configurationOverwrites.podSpecPatch)
+	}
+
+	return patches, nil
+}
+
+// applyPodSpecPatches applies the patches, in order, to the spec of the pod
+func (s *executor) applyPodSpecPatches(pod *api.Pod) error {
+	patches, err := s.podSpecPatches()
+	if err != nil {
+		return err
+	}
+
+	for _, patch := range patches {
+		s.Debugln("Applying pod spec patch", patch.name)
+
+		spec, err := patch.apply(pod.Spec)
+		if err != nil {
+			return fmt.Errorf("applying pod spec patch %q: %w", patch.name, err)
+		}
+
+		pod.Spec = spec
+	}
+
+	return nil
+}
+
+func (p *podSpecPatch) apply(spec api.PodSpec) (api.PodSpec, error) {
+	original, err := json.Marshal(spec)
+	if err != nil {
+		return spec, err
+	}
+
+	var patched []byte
+	switch p.patchType {
+	case common.PatchTypeJSONPatchType:
+		var patch jsonpatch.Patch
+		patch, err = jsonpatch.DecodePatch(p.patch)
+		if err == nil {
+			patched, err = patch.Apply(original)
+		}
+	case common.PatchTypeMergePatchType:
+		patched, err = jsonpatch.MergePatch(original, p.patch)
+	case common.PatchTypeStrategicMergePatchType:
+		patched, err = strategicpatch.StrategicMergePatch(original, p.patch, api.PodSpec{})
+	default:
+		err = fmt.Errorf("unsupported patch type %q", p.patchType)
+	}
+	if err != nil {
+		return spec, err
+	}
+
+	var result api.PodSpec
+	if err := json.Unmarshal(patched, &result); err != nil {
+		return spec, err
+	}
+
+	if len(p.allowedFields) > 0 {
+		if err := checkPodSpecChangedFields(original, patched, p.allowedFields); err != nil {
+			return spec, err
+		}
+	}
+
+	return result, nil
+}
+
+// checkPodSpecChangedFields returns an error when a top-level field of the
+// pod spec that isn't allowed was changed by the patch
+func checkPodSpecChangedFields(original, patched []byte, allowedFields []string) error {
+	var before, after map[string]json.RawMessage
+	if err := json.Unmarshal(original, &before); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(patched, &after); err != nil {
+		return err
+	}
+
+	allowed := make(map[string]bool, len(allowedFields))
+	for _, field := range allowedFields {
+		allowed[field] = true
+	}
+
+	fields := make(map[string]bool)
+	for field := range before {
+		fields[field] = true
+	}
+	for field := range after {
+		fields[field] = true
+	}
+
+	for field := range fields {
+		if allowed[field] || reflect.DeepEqual(jsonValue(before[field]), jsonValue(after[field])) {
+			continue
+		}
+
+		return &podSpecFieldNotAllowedError{field: field}
+	}
+
+	return nil
+}
+
+func jsonValue(data json.RawMessage) interface{} {
+	var value interface{}
+	if len(data) > 0 {
+		_ = json.Unmarshal(data, &value)
+	}
+
+	return value
+}
@@ -0,0 +1,222 @@
+package kubernetes
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	api "k8s.io/api/core/v1"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors"
+)
+
+func testPodSpecPod() api.Pod {
+	return api.Pod{
+		Spec: api.PodSpec{
+			ServiceAccountName: "default",
+			NodeSelector:       map[string]string{"os": "linux"},
+			Containers: []api.Container{
+				{Name: "build", Image: "alpine"},
+				{Name: "helper", Image: "helper"},
+			},
+		},
+	}
+}
+
+func TestApplyPodSpecPatches(t *testing.T) {
+	tests := map[string]struct {
+		podSpec         []common.KubernetesPodSpec
+		jobPatch        *podSpecPatch
+		validatePodSpec func(t *testing.T, spec api.PodSpec)
+		expectedErr     bool
+		expectedErrIs   error
+	}{
+		"no patches": {
+			validatePodSpec: func(t *testing.T, spec api.PodSpec) {
+				assert.Equal(t, testPodSpecPod().Spec, spec)
+			},
+		},
+		"strategic merge patch": {
+			podSpec: []common.KubernetesPodSpec{
+				{
+					Name: "runtime",
+					Patch: `
+priorityClassName: high
+runtimeClassName: gvisor
+containers:
+- name: build
+  workingDir: /builds
+`,
+				},
+			},
+			validatePodSpec: func(t *testing.T, spec api.PodSpec) {
+				assert.Equal(t, "high", spec.PriorityClassName)
+				require.NotNil(t, spec.RuntimeClassName)
+				assert.Equal(t, "gvisor", *spec.RuntimeClassName)
+				require.Len(t, spec.Containers, 2, "merges the containers by name")
+				assert.Equal(t, "alpine", spec.Containers[0].Image)
+				assert.Equal(t, "/builds", spec.Containers[0].WorkingDir)
+			},
+		},
+		"merge patch replaces lists": {
+			podSpec: []common.KubernetesPodSpec{
+				{
+					Name:      "containers",
+					Patch:     `{"containers": [{"name": "build", "image": "ubuntu"}], "nodeSelector": {"os": null}}`,
+					PatchType: common.PatchTypeMergePatchType,
+				},
+			},
+			validatePodSpec: func(t *testing.T, spec api.PodSpec) {
+				require.Len(t, spec.Containers, 1)
+				assert.Equal(t, "ubuntu", spec.Containers[0].Image)
+				assert.Empty(t, spec.NodeSelector)
+			},
+		},
+		"JSON patch": {
+			podSpec: []common.KubernetesPodSpec{
+				{
+					Name:      "hostname",
+					Patch:     `[{"op": "add", "path": "/hostname", "value": "build"}]`,
+					PatchType: common.PatchTypeJSONPatchType,
+				},
+			},
+			validatePodSpec: func(t *testing.T, spec api.PodSpec) {
+				assert.Equal(t, "build", spec.Hostname)
+			},
+		},
+		"patches applied in order": {
+			podSpec: []common.KubernetesPodSpec{
+				{Name: "first", Patch: "hostname: first"},
+				{Name: "second", Patch: "hostname: second"},
+			},
+			validatePodSpec: func(t *testing.T, spec api.PodSpec) {
+				assert.Equal(t, "second", spec.Hostname)
+			},
+		},
+		"failing JSON patch": {
+			podSpec: []common.KubernetesPodSpec{
+				{
+					Name:      "missing",
+					Patch:     `[{"op": "replace", "path": "/hostname/missing", "value": "build"}]`,
+					PatchType: common.PatchTypeJSONPatchType,
+				},
+			},
+			expectedErr: true,
+		},
+		"job patch changing allowed fields": {
+			jobPatch: &podSpecPatch{
+				name:          PodSpecPatchOverwriteVariableValue,
+				patch:         []byte(`{"priorityClassName": "low"}`),
+				patchType:     common.PatchTypeStrategicMergePatchType,
+				allowedFields: []string{"priorityClassName"},
+			},
+			validatePodSpec: func(t *testing.T, spec api.PodSpec) {
+				assert.Equal(t, "low", spec.PriorityClassName)
+			},
+		},
+		"job patch changing other fields": {
+			jobPatch: &podSpecPatch{
+				name:          PodSpecPatchOverwriteVariableValue,
+				patch:         []byte(`{"serviceAccountName": "admin"}`),
+				patchType:     common.PatchTypeStrategicMergePatchType,
+				allowedFields: []string{"priorityClassName"},
+			},
+			expectedErr:   true,
+			expectedErrIs: new(podSpecFieldNotAllowedError),
+		},
+		"job patch removing other fields": {
+			jobPatch: &podSpecPatch{
+				name:          PodSpecPatchOverwriteVariableValue,
+				patch:         []byte(`[{"op": "remove", "path": "/nodeSelector"}]`),
+				patchType:     common.PatchTypeJSONPatchType,
+				allowedFields: []string{"priorityClassName"},
+			},
+			expectedErr:   true,
+			expectedErrIs: new(podSpecFieldNotAllowedError),
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			e := &executor{
+				AbstractExecutor: executors.AbstractExecutor{
+					Config: common.RunnerConfig{
+						RunnerSettings: common.RunnerSettings{
+							Kubernetes: &common.KubernetesConfig{PodSpec: tt.podSpec},
+						},
+					},
+				},
+				configurationOverwrites: &overwrites{podSpecPatch: tt.jobPatch},
+			}
+
+			pod := testPodSpecPod()
+			err := e.applyPodSpecPatches(&pod)
+			if tt.expectedErr {
+				require.Error(t, err)
+				if tt.expectedErrIs != nil {
+					assert.True(t, errors.Is(err, tt.expectedErrIs))
+				}
+				assert.Equal(t, testPodSpecPod().Spec, pod.Spec, "leaves the pod unchanged")
+				return
+			}
+
+			require.NoError(t, err)
+			tt.validatePodSpec(t, pod.Spec)
+		})
+	}
+}
+
+func TestPodSpecPatchOverwrite(t *testing.T) {
+	tests := map[string]struct {
+		allowedFields []string
+		variables     variableOverwrites
+		expectedPatch *podSpecPatch
+		expectedErr   bool
+	}{
+		"no allowed fields": {
+			variables: variableOverwrites{PodSpecPatchOverwriteVariableValue: "hostname: build"},
+		},
+		"no job patch": {
+			allowedFields: []string{"hostname"},
+		},
+		"job patch": {
+			allowedFields: []string{"hostname"},
+			variables: variableOverwrites{
+				PodSpecPatchOverwriteVariableValue:     "hostname: build",
+				PodSpecPatchTypeOverwriteVariableValue: "merge",
+			},
+			expectedPatch: &podSpecPatch{
+				name:          PodSpecPatchOverwriteVariableValue,
+				patch:         []byte(`{"hostname":"build"}`),
+				patchType:     common.PatchTypeMergePatchType,
+				allowedFields: []string{"hostname"},
+			},
+		},
+		"invalid job patch": {
+			allowedFields: []string{"hostname"},
+			variables: variableOverwrites{
+				PodSpecPatchOverwriteVariableValue:     "hostname: build",
+				PodSpecPatchTypeOverwriteVariableValue: "json",
+			},
+			expectedErr: true,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			config := &common.KubernetesConfig{PodSpecPatchAllowedFields: tt.allowedFields}
+			variables := buildOverwriteVariables(tt.variables, nil)
+
+			o, err := createOverwrites(config, variables, stdoutLogger())
+			if tt.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedPatch, o.podSpecPatch)
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package kubernetes
+
+import (
+	"fmt"
+	"strings"
+
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+const (
+	podEvictedReason = "Evicted"
+	oomKilledReason  = "OOMKilled"
+)
+
+// imagePullFailureReasons are the reasons of the waiting containers whose
+// image can't be pulled
+var imagePullFailureReasons = map[string]bool{
+	"ErrImagePull":      true,
+	"ImagePullBackOff":  true,
+	"InvalidImageName":  true,
+	"ErrImageNeverPull": true,
+}
+
+// podFailure returns a build error explaining the failure when the pod was
+// evicted, the build or helper container was OOMKilled or the image of a
+// container can't be pulled. GitLab rejects the failure reasons it doesn't
+// know, so the cause is told by the message of the error, printed to the job
+// log, rather than by the failure reason
+func podFailure(pod *api.Pod) error {
+	if pod.Status.Phase == api.PodFailed && pod.Status.Reason == podEvictedReason {
+		return &common.BuildError{
+			Inner:         fmt.Errorf("pod %s/%s was evicted: %s", pod.Namespace, pod.Name, pod.Status.Message),
+			FailureReason: common.RunnerSystemFailure,
+		}
+	}
+
+	statuses := append(
+		append([]api.ContainerStatus{}, pod.Status.InitContainerStatuses...),
+		pod.Status.ContainerStatuses...,
+	)
+
+	for _, status := range statuses {
+		if waiting := status.State.Waiting; waiting != nil && imagePullFailureReasons[waiting.Reason] {
+			return &common.BuildError{
+				Inner: fmt.Errorf(
+					"image pull failed for container %q (%s): %s",
+					status.Name,
+					waiting.Reason,
+					waiting.Message,
+				),
+				FailureReason: common.RunnerSystemFailure,
+			}
+		}
+
+		if isJobContainer(status.Name) && oomKilledState(status) != nil {
+			return &common.BuildError{
+				Inner:         fmt.Errorf("job container %q was OOMKilled%s", status.Name, memoryLimitOf(pod, status.Name)),
+				FailureReason: common.ScriptFailure,
+			}
+		}
+	}
+
+	return nil
+}
+
+// isJobContainer checks whether the container runs the job scripts. The
+// OOMKills of the other containers, like the services, don't fail the job
+func isJobContainer(name string) bool {
+	return name == buildContainerName || name == helperContainerName
+}
+
+// oomKilledState returns the termination state of the container when it was
+// OOMKilled, nil otherwise
+func oomKilledState(status api.ContainerStatus) *api.ContainerStateTerminated {
+	if status.State.Terminated != nil && status.State.Terminated.Reason == oomKilledReason {
+		return status.State.Terminated
+	}
+
+	if status.LastTerminationState.Terminated != nil &&
+		status.LastTerminationState.Terminated.Reason == oomKilledReason {
+		return status.LastTerminationState.Terminated
+	}
+
+	return nil
+}
+
+func memoryLimitOf(pod *api.Pod, name string) string {
+	containers := append(append([]api.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, container := range containers {
+		if container.Name != name {
+			continue
+		}
+
+		if limit, ok := container.Resources.Limits[api.ResourceMemory]; ok {
+			return fmt.Sprintf(" (memory limit %s)", limit.String())
+		}
+	}
+
+	return ""
+}
+
+// logOOMKilledServices prints the OOMKills of the service containers to the
+// job log, once per kill
+func (s *executor) logOOMKilledServices(pod *api.Pod) {
+	s.reportedOOMKillsLock.Lock()
+	defer s.reportedOOMKillsLock.Unlock()
+
+	for _, status := range pod.Status.ContainerStatuses {
+		if isJobContainer(status.Name) {
+			continue
+		}
+
+		terminated := oomKilledState(status)
+		if terminated == nil {
+			continue
+		}
+
+		// a kill is reported as the current state of the container, and as
+		// its last state once restarted
+		kill := fmt.Sprintf("%s/%s", status.Name, terminated.FinishedAt.UTC())
+		if s.reportedOOMKills[kill] {
+			continue
+		}
+
+		if s.reportedOOMKills == nil {
+			s.reportedOOMKills = make(map[string]bool)
+		}
+		s.reportedOOMKills[kill] = true
+
+		s.Warningln(fmt.Sprintf("Service container %q was OOMKilled%s", status.Name, memoryLimitOf(pod, status.Name)))
+	}
+}
+
+// checkPodFailure gets the current status of the pod and returns the reason
+// of its failure, if any
+func (s *executor) checkPodFailure() error {
+	pod, err := s.kubeClient.CoreV1().Pods(s.pod.Namespace).Get(s.pod.Name, metav1.GetOptions{})
+	if err != nil {
+		s.Debugln("Getting job pod status", err)
+		return nil
+	}
+
+	return podFailure(pod)
+}
+
+// logPodWarningEvents prints the warning events of the pod to the job log, to
+// explain why the pod failed
+func (s *executor) logPodWarningEvents() {
+	if s.pod == nil {
+		return
+	}
+
+	selector := fields.AndSelectors(
+		fields.OneTermEqualSelector("involvedObject.name", s.pod.Name),
+		fields.OneTermEqualSelector("type", api.EventTypeWarning),
+	)
+
+	events, err := s.kubeClient.CoreV1().Events(s.pod.Namespace).List(metav1.ListOptions{
+		FieldSelector: selector.String(),
+	})
+	if err != nil {
+		s.Debugln("Listing job pod events", err)
+		return
+	}
+
+	for _, event := range events.Items {
+		object := "pod"
+		path := event.InvolvedObject.FieldPath
+		if i := strings.Index(path, "{"); i >= 0 && strings.HasSuffix(path, "}") {
+			object = fmt.Sprintf("container %q", path[i+1:len(path)-1])
+		}
+
+		s.Warningln(fmt.Sprintf("Event %s for %s: %s", event.Reason, object, event.Message))
+	}
+}
@@ -0,0 +1,240 @@
+package kubernetes
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest/fake"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors"
+)
+
+func TestPodFailure(t *testing.T) {
+	tests := map[string]struct {
+		pod                   *api.Pod
+		expectedFailureReason common.JobFailureReason
+		expectedMessage       string
+	}{
+		"running pod": {
+			pod: execPod(),
+		},
+		"evicted pod": {
+			pod: &api.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "namespace"},
+				Status: api.PodStatus{
+					Phase:   api.PodFailed,
+					Reason:  "Evicted",
+					Message: "The node was low on resource: ephemeral-storage.",
+				},
+			},
+			expectedFailureReason: common.RunnerSystemFailure,
+			expectedMessage:       "pod namespace/pod was evicted: The node was low on resource: ephemeral-storage.",
+		},
+		"image pull back-off": {
+			pod: &api.Pod{
+				Status: api.PodStatus{
+					Phase: api.PodPending,
+					ContainerStatuses: []api.ContainerStatus{
+						{Name: "helper", Ready: true},
+						{
+							Name: "build",
+							State: api.ContainerState{
+								Waiting: &api.ContainerStateWaiting{
+									Reason:  "ImagePullBackOff",
+									Message: `Back-off pulling image "alpine:missing"`,
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedFailureReason: common.RunnerSystemFailure,
+			expectedMessage:       `image pull failed for container "build" (ImagePullBackOff): Back-off pulling image "alpine:missing"`,
+		},
+		"OOMKilled container": {
+			pod: &api.Pod{
+				Spec: api.PodSpec{
+					Containers: []api.Container{
+						{
+							Name: "build",
+							Resources: api.ResourceRequirements{
+								Limits: api.ResourceList{api.ResourceMemory: resource.MustParse("128Mi")},
+							},
+						},
+					},
+				},
+				Status: api.PodStatus{
+					Phase: api.PodRunning,
+					ContainerStatuses: []api.ContainerStatus{
+						{
+							Name: "build",
+							State: api.ContainerState{
+								Terminated: &api.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137},
+							},
+						},
+					},
+				},
+			},
+			expectedFailureReason: common.ScriptFailure,
+			expectedMessage:       `job container "build" was OOMKilled (memory limit 128Mi)`,
+		},
+		"OOMKilled and restarted helper": {
+			pod: &api.Pod{
+				Status: api.PodStatus{
+					Phase: api.PodRunning,
+					ContainerStatuses: []api.ContainerStatus{
+						{
+							Name:  "helper",
+							State: api.ContainerState{Running: &api.ContainerStateRunning{}},
+							LastTerminationState: api.ContainerState{
+								Terminated: &api.ContainerStateTerminated{Reason: "OOMKilled"},
+							},
+						},
+					},
+				},
+			},
+			expectedFailureReason: common.ScriptFailure,
+			expectedMessage:       `job container "helper" was OOMKilled`,
+		},
+		"OOMKilled service": {
+			pod: oomKilledServicePod(),
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			err := podFailure(tt.pod)
+			if tt.expectedFailureReason == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			var buildErr *common.BuildError
+			require.True(t, errors.As(err, &buildErr))
+			assert.Equal(t, tt.expectedFailureReason, buildErr.FailureReason)
+			assert.EqualError(t, err, tt.expectedMessage)
+		})
+	}
+}
+
+func oomKilledServicePod() *api.Pod {
+	return &api.Pod{
+		Spec: api.PodSpec{
+			Containers: []api.Container{
+				{
+					Name: "svc-0",
+					Resources: api.ResourceRequirements{
+						Limits: api.ResourceList{api.ResourceMemory: resource.MustParse("64Mi")},
+					},
+				},
+			},
+		},
+		Status: api.PodStatus{
+			Phase: api.PodRunning,
+			ContainerStatuses: []api.ContainerStatus{
+				{Name: "build", Ready: true},
+				{
+					Name:  "svc-0",
+					State: api.ContainerState{Running: &api.ContainerStateRunning{}},
+					LastTerminationState: api.ContainerState{
+						Terminated: &api.ContainerStateTerminated{
+							Reason:     "OOMKilled",
+							FinishedAt: metav1.NewTime(time.Date(2020, 9, 18, 8, 22, 0, 0, time.UTC)),
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestLogOOMKilledServices(t *testing.T) {
+	trace := new(bytes.Buffer)
+	e := &executor{
+		AbstractExecutor: executors.AbstractExecutor{
+			BuildShell: &common.ShellConfiguration{},
+		},
+	}
+	e.Trace = &common.Trace{Writer: trace}
+	e.BuildLogger = common.NewBuildLogger(e.Trace, logrus.WithFields(logrus.Fields{}))
+
+	pod := oomKilledServicePod()
+	e.logOOMKilledServices(pod)
+	e.logOOMKilledServices(pod)
+
+	message := `Service container "svc-0" was OOMKilled (memory limit 64Mi)`
+	assert.Equal(t, 1, strings.Count(trace.String(), message), "reports the kill once")
+
+	// the container is OOMKilled again after its restart
+	pod.Status.ContainerStatuses[1].LastTerminationState.Terminated.FinishedAt =
+		metav1.NewTime(time.Date(2020, 9, 18, 8, 25, 0, 0, time.UTC))
+	e.logOOMKilledServices(pod)
+
+	assert.Equal(t, 2, strings.Count(trace.String(), message))
+}
+
+func TestLogPodWarningEvents(t *testing.T) {
+	version, _ := testVersionAndCodec()
+
+	events := api.EventList{
+		TypeMeta: metav1.TypeMeta{Kind: "EventList", APIVersion: "v1"},
+		Items: []api.Event{
+			{
+				Reason:  "FailedScheduling",
+				Message: "0/3 nodes are available: 3 Insufficient memory.",
+			},
+			{
+				InvolvedObject: api.ObjectReference{FieldPath: "spec.containers{build}"},
+				Reason:         "Failed",
+				Message:        "Error: ErrImagePull",
+			},
+		},
+	}
+
+	fakeClient := fake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path != "/api/"+version+"/namespaces/namespace/events" || req.Method != http.MethodGet {
+			return nil, fmt.Errorf("unexpected request")
+		}
+
+		assert.Equal(t, "involvedObject.name=pod,type=Warning", req.URL.Query().Get("fieldSelector"))
+
+		body, err := json.Marshal(events)
+		require.NoError(t, err)
+
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+			Header:     map[string][]string{"Content-Type": {"application/json"}},
+		}, nil
+	})
+
+	trace := new(bytes.Buffer)
+	e := &executor{
+		AbstractExecutor: executors.AbstractExecutor{
+			BuildShell: &common.ShellConfiguration{},
+		},
+		kubeClient: testKubernetesClient(version, fakeClient),
+		pod:        &api.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "namespace"}},
+	}
+	e.Trace = &common.Trace{Writer: trace}
+	e.BuildLogger = common.NewBuildLogger(e.Trace, logrus.WithFields(logrus.Fields{}))
+
+	e.logPodWarningEvents()
+
+	assert.Contains(t, trace.String(), "Event FailedScheduling for pod: 0/3 nodes are available: 3 Insufficient memory.")
+	assert.Contains(t, trace.String(), `Event Failed for container "build": Error: ErrImagePull`)
+}
@@ -0,0 +1,123 @@
+package kubernetes
+
+import (
+	"fmt"
+	"strconv"
+
+	api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+// buildServiceContainer creates the container of a service, with the
+// resources and environment set by the variables of the job and of the
+// service, and the readiness probe set by the variables of the service
+func (s *executor) buildServiceContainer(name string, service common.Image) (api.Container, error) {
+	jobVariables := s.Build.GetAllVariables()
+
+	// the variables of the service take precedence over the ones of the job
+	variables := make(common.JobVariables, 0, len(jobVariables)+len(service.Variables))
+	variables = append(variables, jobVariables...)
+	variables = append(variables, service.Variables...)
+
+	o, err := createServiceOverwrites(name, s.Config.Kubernetes, variables, s.BuildLogger)
+	if err != nil {
+		return api.Container{}, fmt.Errorf("service %s: %w", name, err)
+	}
+
+	requests, err := mergeResources(s.serviceRequests, o.cpuRequest, o.memoryRequest, o.ephemeralStorageRequest)
+	if err != nil {
+		return api.Container{}, fmt.Errorf("invalid requests of service %s: %w", name, err)
+	}
+
+	limits, err := mergeResources(s.serviceLimits, o.cpuLimit, o.memoryLimit, o.ephemeralStorageLimit)
+	if err != nil {
+		return api.Container{}, fmt.Errorf("invalid limits of service %s: %w", name, err)
+	}
+
+	// the readiness probe is specific to each service, so it's only read from
+	// the variables of the service
+	probe, err := readinessProbe(service.Variables.Expand())
+	if err != nil {
+		return api.Container{}, fmt.Errorf("invalid readiness probe of service %s: %w", name, err)
+	}
+
+	container := s.buildContainer(
+		name,
+		jobVariables.ExpandValue(service.Name),
+		service,
+		requests,
+		limits,
+	)
+	container.Env = serviceEnv(jobVariables, service.Variables)
+	container.ReadinessProbe = probe
+
+	return container, nil
+}
+
+// mergeResources overwrites the resources of the list with the ones given
+func mergeResources(resources api.ResourceList, cpu, memory, ephemeralStorage string) (api.ResourceList, error) {
+	overwritten, err := limits(cpu, memory, ephemeralStorage)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := make(api.ResourceList, len(resources)+len(overwritten))
+	for name, quantity := range resources {
+		merged[name] = quantity
+	}
+	for name, quantity := range overwritten {
+		merged[name] = quantity
+	}
+
+	return merged, nil
+}
+
+// serviceEnv returns the environment of a service container, the variables of
+// the service replacing the variables of the job with the same name
+func serviceEnv(jobVariables common.JobVariables, serviceVariables common.JobVariables) []api.EnvVar {
+	overwritten := make(map[string]bool, len(serviceVariables))
+	for _, variable := range serviceVariables {
+		overwritten[variable.Key] = true
+	}
+
+	var variables common.JobVariables
+	for _, variable := range jobVariables.PublicOrInternal() {
+		if !overwritten[variable.Key] {
+			variables = append(variables, variable)
+		}
+	}
+	variables = append(variables, serviceVariables...)
+
+	return buildVariables(variables)
+}
+
+// readinessProbe returns the TCP probe of the port set for the service, or
+// its HTTP probe when a path is set too
+func readinessProbe(variables common.JobVariables) (*api.Probe, error) {
+	port := variables.Get(ServiceReadinessProbePortVariableValue)
+	path := variables.Get(ServiceReadinessProbePathVariableValue)
+
+	if port == "" {
+		if path != "" {
+			return nil, fmt.Errorf("%s requires %s", ServiceReadinessProbePathVariableValue, ServiceReadinessProbePortVariableValue)
+		}
+
+		return nil, nil
+	}
+
+	number, err := strconv.Atoi(port)
+	if err != nil || number <= 0 || number > 65535 {
+		return nil, fmt.Errorf("%s %q isn't a valid port", ServiceReadinessProbePortVariableValue, port)
+	}
+
+	probe := &api.Probe{}
+	if path != "" {
+		probe.HTTPGet = &api.HTTPGetAction{Path: path, Port: intstr.FromInt(number)}
+	} else {
+		probe.TCPSocket = &api.TCPSocketAction{Port: intstr.FromInt(number)}
+	}
+
+	return probe, nil
+}
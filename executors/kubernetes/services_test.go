@@ -0,0 +1,200 @@
+package kubernetes
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors"
+	"gitlab.com/gitlab-org/gitlab-runner/session/proxy"
+)
+
+func TestBuildServiceContainer(t *testing.T) {
+	tests := map[string]struct {
+		config           common.KubernetesConfig
+		jobVariables     common.JobVariables
+		service          common.Image
+		expectedRequests api.ResourceList
+		expectedLimits   api.ResourceList
+		expectedEnv      map[string]string
+		expectedProbe    *api.Probe
+		expectedErr      error
+	}{
+		"uses the service resources of the runner": {
+			config: common.KubernetesConfig{
+				ServiceCPULimit:      "1",
+				ServiceMemoryRequest: "128Mi",
+			},
+			service: common.Image{
+				Name:      "kafka",
+				Variables: common.JobVariables{{Key: ServiceCPULimitOverwriteVariableValue, Value: "2"}},
+			},
+			expectedRequests: api.ResourceList{api.ResourceMemory: resource.MustParse("128Mi")},
+			expectedLimits:   api.ResourceList{api.ResourceCPU: resource.MustParse("1")},
+		},
+		"overwrites the resources with the variables of the service": {
+			config: common.KubernetesConfig{
+				ServiceCPULimit:                         "1",
+				ServiceMemoryRequest:                    "128Mi",
+				ServiceCPULimitOverwriteMaxAllowed:      "4",
+				ServiceMemoryRequestOverwriteMaxAllowed: "4Gi",
+			},
+			jobVariables: common.JobVariables{{Key: ServiceCPULimitOverwriteVariableValue, Value: "3"}},
+			service: common.Image{
+				Name: "kafka",
+				Variables: common.JobVariables{
+					{Key: ServiceCPULimitOverwriteVariableValue, Value: "2"},
+					{Key: ServiceMemoryRequestOverwriteVariableValue, Value: "2Gi"},
+				},
+			},
+			expectedRequests: api.ResourceList{api.ResourceMemory: resource.MustParse("2Gi")},
+			expectedLimits:   api.ResourceList{api.ResourceCPU: resource.MustParse("2")},
+		},
+		"overwrites the resources with the variables of the job": {
+			config: common.KubernetesConfig{
+				ServiceEphemeralStorageLimitOverwriteMaxAllowed: "10Gi",
+			},
+			jobVariables: common.JobVariables{{Key: ServiceEphemeralStorageLimitOverwriteVariableValue, Value: "5Gi"}},
+			service:      common.Image{Name: "postgres"},
+			expectedLimits: api.ResourceList{
+				api.ResourceEphemeralStorage: resource.MustParse("5Gi"),
+			},
+		},
+		"resource above the maximum": {
+			config: common.KubernetesConfig{
+				ServiceMemoryLimitOverwriteMaxAllowed: "1Gi",
+			},
+			service: common.Image{
+				Name:      "kafka",
+				Variables: common.JobVariables{{Key: ServiceMemoryLimitOverwriteVariableValue, Value: "2Gi"}},
+			},
+			expectedErr: new(overwriteTooHighError),
+		},
+		"environment of the service": {
+			jobVariables: common.JobVariables{
+				{Key: "SHARED", Value: "job", Public: true},
+				{Key: "JOB_ONLY", Value: "job", Public: true},
+				{Key: "SECRET", Value: "secret"},
+			},
+			service: common.Image{
+				Name: "postgres",
+				Variables: common.JobVariables{
+					{Key: "SHARED", Value: "service"},
+					{Key: "POSTGRES_DB", Value: "test"},
+				},
+			},
+			expectedEnv: map[string]string{
+				"SHARED":      "service",
+				"JOB_ONLY":    "job",
+				"POSTGRES_DB": "test",
+			},
+		},
+		"TCP readiness probe": {
+			service: common.Image{
+				Name:      "postgres",
+				Variables: common.JobVariables{{Key: ServiceReadinessProbePortVariableValue, Value: "5432"}},
+			},
+			expectedProbe: &api.Probe{
+				Handler: api.Handler{TCPSocket: &api.TCPSocketAction{Port: intstr.FromInt(5432)}},
+			},
+		},
+		"HTTP readiness probe": {
+			service: common.Image{
+				Name: "elasticsearch",
+				Variables: common.JobVariables{
+					{Key: ServiceReadinessProbePortVariableValue, Value: "9200"},
+					{Key: ServiceReadinessProbePathVariableValue, Value: "/_cluster/health"},
+				},
+			},
+			expectedProbe: &api.Probe{
+				Handler: api.Handler{
+					HTTPGet: &api.HTTPGetAction{Path: "/_cluster/health", Port: intstr.FromInt(9200)},
+				},
+			},
+		},
+		"readiness probe of the job ignored": {
+			jobVariables: common.JobVariables{
+				{Key: ServiceReadinessProbePortVariableValue, Value: "5432"},
+				{Key: ServiceReadinessProbePathVariableValue, Value: "/health"},
+			},
+			service: common.Image{Name: "redis"},
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			e := newExecutor()
+			e.AbstractExecutor = executors.AbstractExecutor{
+				Config: common.RunnerConfig{
+					RunnerSettings: common.RunnerSettings{Kubernetes: &tt.config},
+				},
+				Build: &common.Build{
+					JobResponse: common.JobResponse{Variables: tt.jobVariables},
+					Runner:      &common.RunnerConfig{},
+				},
+				BuildShell: &common.ShellConfiguration{},
+				ProxyPool:  proxy.NewPool(),
+			}
+			e.configurationOverwrites = &overwrites{}
+
+			require.NoError(t, e.setupResources())
+
+			container, err := e.buildServiceContainer("svc-0", tt.service)
+			if tt.expectedErr != nil {
+				assert.True(t, errors.Is(err, tt.expectedErr), "expected %v, got %v", tt.expectedErr, err)
+				return
+			}
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.service.Name, container.Image)
+			assertResourceList(t, tt.expectedRequests, container.Resources.Requests)
+			assertResourceList(t, tt.expectedLimits, container.Resources.Limits)
+			assert.Equal(t, tt.expectedProbe, container.ReadinessProbe)
+
+			env := make(map[string]string)
+			for _, variable := range container.Env {
+				_, ok := env[variable.Name]
+				assert.False(t, ok, "duplicated variable %s", variable.Name)
+				env[variable.Name] = variable.Value
+			}
+			for key, value := range tt.expectedEnv {
+				assert.Equal(t, value, env[key], key)
+			}
+			assert.NotContains(t, env, "SECRET")
+		})
+	}
+}
+
+func assertResourceList(t *testing.T, expected api.ResourceList, actual api.ResourceList) {
+	require.Len(t, actual, len(expected))
+	for name, quantity := range expected {
+		assert.Zero(t, quantity.Cmp(actual[name]), "%s: expected %s, got %s", name, quantity.String(), actual[name])
+	}
+}
+
+func TestReadinessProbeErrors(t *testing.T) {
+	tests := map[string]common.JobVariables{
+		"path without port": {
+			{Key: ServiceReadinessProbePathVariableValue, Value: "/health"},
+		},
+		"invalid port": {
+			{Key: ServiceReadinessProbePortVariableValue, Value: "http"},
+		},
+		"port out of range": {
+			{Key: ServiceReadinessProbePortVariableValue, Value: "70000"},
+		},
+	}
+
+	for tn, variables := range tests {
+		t.Run(tn, func(t *testing.T) {
+			_, err := readinessProbe(variables)
+			assert.Error(t, err)
+		})
+	}
+}
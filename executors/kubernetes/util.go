@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	"golang.org/x/net/context"
@@ -125,12 +126,37 @@ type podPhaseResponse struct {
 	err   error
 }
 
+// unreadyContainers returns the containers with a readiness probe that
+// aren't ready yet
+func unreadyContainers(pod *api.Pod) []string {
+	probed := make(map[string]bool)
+	for _, container := range pod.Spec.Containers {
+		if container.ReadinessProbe != nil {
+			probed[container.Name] = true
+		}
+	}
+
+	var unready []string
+	for _, status := range pod.Status.ContainerStatuses {
+		if probed[status.Name] && !status.Ready {
+			unready = append(unready, status.Name)
+		}
+	}
+
+	return unready
+}
+
 func getPodPhase(c *kubernetes.Clientset, pod *api.Pod, out io.Writer) podPhaseResponse {
 	pod, err := c.CoreV1().Pods(pod.Namespace).Get(pod.Name, metav1.GetOptions{})
 	if err != nil {
 		return podPhaseResponse{true, api.PodUnknown, err}
 	}
 
+	// check status of the pod and its containers
+	if err = podFailure(pod); err != nil {
+		return podPhaseResponse{true, api.PodUnknown, err}
+	}
+
 	ready, err := isRunning(pod)
 
 	if err != nil {
@@ -138,24 +164,19 @@ func getPodPhase(c *kubernetes.Clientset, pod *api.Pod, out io.Writer) podPhaseR
 	}
 
 	if ready {
-		return podPhaseResponse{true, pod.Status.Phase, nil}
-	}
-
-	// check status of containers
-	for _, container := range pod.Status.ContainerStatuses {
-		if container.Ready {
-			continue
-		}
-		if container.State.Waiting == nil {
-			continue
+		unready := unreadyContainers(pod)
+		if len(unready) == 0 {
+			return podPhaseResponse{true, pod.Status.Phase, nil}
 		}
 
-		switch container.State.Waiting.Reason {
-		case "ErrImagePull", "ImagePullBackOff", "InvalidImageName":
-			err = fmt.Errorf("image pull failed: %s", container.State.Waiting.Message)
-			err = &common.BuildError{Inner: err}
-			return podPhaseResponse{true, api.PodUnknown, err}
-		}
+		_, _ = fmt.Fprintf(
+			out,
+			"Waiting for pod %s/%s to be ready, containers not ready: %s\n",
+			pod.Namespace,
+			pod.Name,
+			strings.Join(unready, ", "),
+		)
+		return podPhaseResponse{false, pod.Status.Phase, nil}
 	}
 
 	_, _ = fmt.Fprintf(
@@ -212,9 +233,9 @@ func waitForPodRunning(
 // limits takes a string representing CPU & memory limits,
 // and returns a ResourceList with appropriately scaled Quantity
 // values for Kubernetes. This allows users to write "500m" for CPU,
-// and "50Mi" for memory (etc.)
-func limits(cpu, memory string) (api.ResourceList, error) {
-	var rCPU, rMem resource.Quantity
+// and "50Mi" for memory or ephemeral storage (etc.)
+func limits(cpu, memory, ephemeralStorage string) (api.ResourceList, error) {
+	var rCPU, rMem, rStorage resource.Quantity
 	var err error
 
 	parse := func(s string) (resource.Quantity, error) {
@@ -236,6 +257,10 @@ func limits(cpu, memory string) (api.ResourceList, error) {
 		return api.ResourceList{}, err
 	}
 
+	if rStorage, err = parse(ephemeralStorage); err != nil {
+		return api.ResourceList{}, err
+	}
+
 	l := make(api.ResourceList)
 
 	q := resource.Quantity{}
@@ -245,6 +270,9 @@ func limits(cpu, memory string) (api.ResourceList, error) {
 	if rMem != q {
 		l[api.ResourceMemory] = rMem
 	}
+	if rStorage != q {
+		l[api.ResourceEphemeralStorage] = rStorage
+	}
 
 	return l, nil
 }
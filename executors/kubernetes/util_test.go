@@ -233,6 +233,53 @@ func TestWaitForPodRunning(t *testing.T) {
 			PodEndPhase: api.PodRunning,
 			Retries:     2,
 		},
+		{
+			Name: "ensure function waits for the containers with a readiness probe",
+			Pod: &api.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-pod",
+					Namespace: "test-ns",
+				},
+			},
+			Config: &common.KubernetesConfig{},
+			ClientFunc: func(req *http.Request) (*http.Response, error) {
+				switch p, m := req.URL.Path, req.Method; {
+				case p == "/api/"+version+"/namespaces/test-ns/pods/test-pod" && m == http.MethodGet:
+					pod := &api.Pod{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "test-pod",
+							Namespace: "test-ns",
+						},
+						Spec: api.PodSpec{
+							Containers: []api.Container{
+								{Name: "build"},
+								{Name: "svc-0", ReadinessProbe: &api.Probe{}},
+							},
+						},
+						Status: api.PodStatus{
+							Phase: api.PodRunning,
+							ContainerStatuses: []api.ContainerStatus{
+								{Name: "build", Ready: true},
+								{Name: "svc-0", Ready: retries > 1},
+							},
+						},
+					}
+
+					retries++
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       objBody(codec, pod),
+						Header:     map[string][]string{"Content-Type": {"application/json"}},
+					}, nil
+				default:
+					t.Errorf("unexpected request: %s %#v\n%#v", req.Method, req.URL, req)
+					return nil, fmt.Errorf("unexpected request")
+				}
+			},
+			PodEndPhase:  api.PodRunning,
+			Retries:      2,
+			ExactRetries: true,
+		},
 		{
 			Name: "ensure function errors if pod already succeeded",
 			Pod: &api.Pod{
@@ -0,0 +1,50 @@
+package autoscaler
+
+// ProtocolVersion is the version of the protocol spoken with the plugins. It's
+// sent with every request so that plugins can refuse requests they don't understand
+const ProtocolVersion = 1
+
+// Operation names the action requested from an autoscaler plugin
+type Operation string
+
+const (
+	// OperationCreate creates and provisions the instance. Plugins must handle
+	// it idempotently, as it's retried for instances that failed to provision
+	OperationCreate Operation = "create"
+	// OperationDelete stops and deletes the instance
+	OperationDelete Operation = "delete"
+	// OperationList lists the names of all the instances managed by the plugin
+	OperationList Operation = "list"
+	// OperationConnectInfo returns the details needed to connect to the
+	// Docker Engine of the instance
+	OperationConnectInfo Operation = "connect_info"
+	// OperationHealth checks whether the instance is up and can run jobs
+	OperationHealth Operation = "health"
+)
+
+// Request is written as a single JSON document to the standard input of the
+// plugin, which is started once per request
+type Request struct {
+	Version   int       `json:"version"`
+	Operation Operation `json:"operation"`
+	Name      string    `json:"name,omitempty"`
+	Driver    string    `json:"driver,omitempty"`
+	Options   []string  `json:"options,omitempty"`
+}
+
+// Response is read as a single JSON document from the standard output of the
+// plugin. A non-empty Error marks the operation as failed, the same as a
+// non-zero exit code does. The standard error of the plugin is only logged
+type Response struct {
+	Error       string       `json:"error,omitempty"`
+	Instances   []string     `json:"instances,omitempty"`
+	ConnectInfo *ConnectInfo `json:"connect_info,omitempty"`
+}
+
+// ConnectInfo holds the details needed to connect to the Docker Engine of
+// an instance
+type ConnectInfo struct {
+	Host      string `json:"host"`
+	CertPath  string `json:"cert_path,omitempty"`
+	TLSVerify bool   `json:"tls_verify,omitempty"`
+}
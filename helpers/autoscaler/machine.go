@@ -0,0 +1,120 @@
+package autoscaler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker"
+)
+
+var canConnectCacheExpiry = 5 * time.Minute
+
+// machine exposes a Provider as a docker.Machine, so that the instances it
+// manages can be autoscaled the same way as the docker-machine ones
+type machine struct {
+	provider Provider
+
+	cache     map[string]time.Time
+	cacheLock sync.RWMutex
+}
+
+// NewMachine returns a docker.Machine managing its machines with provider
+func NewMachine(provider Provider) docker.Machine {
+	return &machine{
+		provider: provider,
+		cache:    make(map[string]time.Time),
+	}
+}
+
+func (m *machine) Create(driver, name string, opts ...string) error {
+	logrus.WithFields(logrus.Fields{
+		"operation": OperationCreate,
+		"driver":    driver,
+		"name":      name,
+	}).Debugln("Creating instance")
+
+	return m.provider.Create(context.Background(), name, driver, opts)
+}
+
+// Provision retries the creation of an instance that failed to be provisioned,
+// which plugins handle as part of the idempotent create operation
+func (m *machine) Provision(name string) error {
+	return m.provider.Create(context.Background(), name, "", nil)
+}
+
+// Stop doesn't do anything, as the delete operation takes care of stopping
+// the instance
+func (m *machine) Stop(name string, timeout time.Duration) error {
+	return nil
+}
+
+func (m *machine) Remove(name string) error {
+	err := m.provider.Delete(context.Background(), name)
+	if err != nil {
+		return err
+	}
+
+	m.cacheLock.Lock()
+	delete(m.cache, name)
+	m.cacheLock.Unlock()
+
+	return nil
+}
+
+func (m *machine) List() ([]string, error) {
+	return m.provider.List(context.Background())
+}
+
+func (m *machine) Exist(name string) bool {
+	instances, err := m.List()
+	if err != nil {
+		logrus.WithField("name", name).WithError(err).Warningln("Failed to list instances")
+		return false
+	}
+
+	for _, instance := range instances {
+		if instance == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *machine) CanConnect(name string, skipCache bool) bool {
+	m.cacheLock.RLock()
+	expires, ok := m.cache[name]
+	m.cacheLock.RUnlock()
+
+	if ok && !skipCache && time.Now().Before(expires) {
+		return true
+	}
+
+	err := m.provider.Health(context.Background(), name)
+	if err != nil {
+		logrus.WithField("name", name).WithError(err).Debugln("Instance is not healthy")
+		return false // we only cache positive hits, the same as for docker-machine
+	}
+
+	m.cacheLock.Lock()
+	m.cache[name] = time.Now().Add(canConnectCacheExpiry)
+	m.cacheLock.Unlock()
+
+	return true
+}
+
+func (m *machine) Credentials(name string) (docker.Credentials, error) {
+	info, err := m.provider.ConnectInfo(context.Background(), name)
+	if err != nil {
+		return docker.Credentials{}, err
+	}
+
+	return docker.Credentials{
+		Host:      info.Host,
+		CertPath:  info.CertPath,
+		TLSVerify: info.TLSVerify,
+	}, nil
+}
@@ -0,0 +1,164 @@
+package autoscaler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var defaultOperationTimeout = time.Minute
+
+// operationTimeouts lists the operations that usually take longer than
+// defaultOperationTimeout to complete
+var operationTimeouts = map[Operation]time.Duration{
+	OperationCreate: 15 * time.Minute,
+	OperationDelete: 10 * time.Minute,
+}
+
+// OperationError is returned when the plugin fails to execute an operation
+type OperationError struct {
+	Operation Operation
+	Name      string
+	Inner     error
+}
+
+func (e *OperationError) Error() string {
+	if e.Name == "" {
+		return fmt.Sprintf("autoscaler plugin %s: %v", e.Operation, e.Inner)
+	}
+
+	return fmt.Sprintf("autoscaler plugin %s %q: %v", e.Operation, e.Name, e.Inner)
+}
+
+func (e *OperationError) Unwrap() error {
+	return e.Inner
+}
+
+type plugin struct {
+	path string
+	args []string
+}
+
+// NewPlugin returns a Provider backed by the plugin binary found at path
+func NewPlugin(path string, args ...string) Provider {
+	return &plugin{
+		path: path,
+		args: args,
+	}
+}
+
+func (p *plugin) Create(ctx context.Context, name, driver string, options []string) error {
+	_, err := p.call(ctx, Request{
+		Operation: OperationCreate,
+		Name:      name,
+		Driver:    driver,
+		Options:   options,
+	})
+
+	return err
+}
+
+func (p *plugin) Delete(ctx context.Context, name string) error {
+	_, err := p.call(ctx, Request{Operation: OperationDelete, Name: name})
+
+	return err
+}
+
+func (p *plugin) List(ctx context.Context) ([]string, error) {
+	response, err := p.call(ctx, Request{Operation: OperationList})
+	if err != nil {
+		return nil, err
+	}
+
+	return response.Instances, nil
+}
+
+func (p *plugin) ConnectInfo(ctx context.Context, name string) (ConnectInfo, error) {
+	request := Request{Operation: OperationConnectInfo, Name: name}
+
+	response, err := p.call(ctx, request)
+	if err != nil {
+		return ConnectInfo{}, err
+	}
+
+	if response.ConnectInfo == nil || response.ConnectInfo.Host == "" {
+		return ConnectInfo{}, p.operationError(request, errors.New("missing connect info"))
+	}
+
+	return *response.ConnectInfo, nil
+}
+
+func (p *plugin) Health(ctx context.Context, name string) error {
+	_, err := p.call(ctx, Request{Operation: OperationHealth, Name: name})
+
+	return err
+}
+
+func (p *plugin) call(ctx context.Context, request Request) (Response, error) {
+	request.Version = ProtocolVersion
+
+	input, err := json.Marshal(request)
+	if err != nil {
+		return Response{}, p.operationError(request, err)
+	}
+
+	timeout, ok := operationTimeouts[request.Operation]
+	if !ok {
+		timeout = defaultOperationTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, p.path, p.args...)
+	cmd.Env = os.Environ()
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	logrus.Debugln("Executing", cmd.Path, cmd.Args, "with operation", request.Operation)
+	runErr := cmd.Run()
+
+	if stderr.Len() > 0 {
+		logrus.WithFields(logrus.Fields{
+			"operation": request.Operation,
+			"name":      request.Name,
+		}).Debugln(strings.TrimSpace(stderr.String()))
+	}
+
+	var response Response
+	if stdout.Len() > 0 {
+		err = json.Unmarshal(stdout.Bytes(), &response)
+		if err != nil && runErr == nil {
+			return Response{}, p.operationError(request, fmt.Errorf("decoding response: %w", err))
+		}
+	}
+
+	if response.Error != "" {
+		return Response{}, p.operationError(request, errors.New(response.Error))
+	}
+
+	if runErr != nil {
+		return Response{}, p.operationError(request, runErr)
+	}
+
+	return response, nil
+}
+
+func (p *plugin) operationError(request Request, err error) error {
+	return &OperationError{
+		Operation: request.Operation,
+		Name:      request.Name,
+		Inner:     err,
+	}
+}
@@ -0,0 +1,190 @@
+package autoscaler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker"
+)
+
+var fakePluginFile string
+
+func TestMain(m *testing.M) {
+	targetDir, err := ioutil.TempDir("", "fake_plugin")
+	if err != nil {
+		panic("Error on preparing tmp directory for fake plugin binary")
+	}
+
+	fakePluginFile = filepath.Join(targetDir, "fake_plugin")
+	if runtime.GOOS == "windows" {
+		fakePluginFile += ".exe"
+	}
+
+	cmd := exec.Command("go", "build", "-o", fakePluginFile, filepath.Join("testdata", "fake_plugin", "main.go"))
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err = cmd.Run()
+	if err != nil {
+		panic(fmt.Sprintf("Error on executing go build to prepare fake plugin: %v", err))
+	}
+
+	code := m.Run()
+
+	_ = os.RemoveAll(targetDir)
+	os.Exit(code)
+}
+
+func newFakePlugin(t *testing.T) (Provider, func()) {
+	dir, err := ioutil.TempDir("", "fake_plugin_state")
+	require.NoError(t, err)
+
+	plugin := NewPlugin(fakePluginFile, filepath.Join(dir, "state.json"))
+
+	return plugin, func() {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestPluginLifecycle(t *testing.T) {
+	plugin, cleanup := newFakePlugin(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	require.NoError(t, plugin.Create(ctx, "instance-1", "cloud", []string{"size=small"}))
+	require.NoError(t, plugin.Create(ctx, "instance-2", "cloud", nil))
+
+	instances, err := plugin.List(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"instance-1", "instance-2"}, instances)
+
+	assert.NoError(t, plugin.Health(ctx, "instance-1"))
+
+	info, err := plugin.ConnectInfo(ctx, "instance-1")
+	require.NoError(t, err)
+	assert.Equal(t, ConnectInfo{
+		Host:      "tcp://instance-1.example.com:2376",
+		CertPath:  "/certs/instance-1",
+		TLSVerify: true,
+	}, info)
+
+	require.NoError(t, plugin.Delete(ctx, "instance-1"))
+
+	instances, err = plugin.List(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"instance-2"}, instances)
+}
+
+func TestPluginErrors(t *testing.T) {
+	plugin, cleanup := newFakePlugin(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	tests := map[string]struct {
+		run               func() error
+		expectedOperation Operation
+		expectedMessage   string
+	}{
+		"create failure": {
+			run: func() error {
+				return plugin.Create(ctx, "instance", "cloud", []string{"fail"})
+			},
+			expectedOperation: OperationCreate,
+			expectedMessage:   `autoscaler plugin create "instance": quota exceeded`,
+		},
+		"delete of unknown instance": {
+			run: func() error {
+				return plugin.Delete(ctx, "unknown")
+			},
+			expectedOperation: OperationDelete,
+			expectedMessage:   `autoscaler plugin delete "unknown": instance not found`,
+		},
+		"health of unknown instance": {
+			run: func() error {
+				return plugin.Health(ctx, "unknown")
+			},
+			expectedOperation: OperationHealth,
+			expectedMessage:   `autoscaler plugin health "unknown": instance is not healthy`,
+		},
+		"connect info of unknown instance": {
+			run: func() error {
+				_, err := plugin.ConnectInfo(ctx, "unknown")
+				return err
+			},
+			expectedOperation: OperationConnectInfo,
+			expectedMessage:   `autoscaler plugin connect_info "unknown": instance not found`,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			err := tt.run()
+
+			var opErr *OperationError
+			require.True(t, errors.As(err, &opErr), "expected operation error, got %v", err)
+			assert.Equal(t, tt.expectedOperation, opErr.Operation)
+			assert.EqualError(t, err, tt.expectedMessage)
+		})
+	}
+}
+
+func TestPluginExecutionFailure(t *testing.T) {
+	plugin := NewPlugin(fakePluginFile)
+
+	_, err := plugin.List(context.Background())
+
+	var exitErr *exec.ExitError
+	assert.True(t, errors.As(err, &exitErr), "expected exit error, got %v", err)
+}
+
+func TestPluginMissingBinary(t *testing.T) {
+	plugin := NewPlugin(filepath.Join("testdata", "missing_plugin"))
+
+	_, err := plugin.List(context.Background())
+	assert.Error(t, err)
+}
+
+func TestPluginMachine(t *testing.T) {
+	plugin, cleanup := newFakePlugin(t)
+	defer cleanup()
+
+	m := NewMachine(plugin)
+
+	require.NoError(t, m.Create("cloud", "instance-1"))
+	require.NoError(t, m.Create("cloud", "instance-2", "unhealthy"))
+	require.Error(t, m.Create("cloud", "instance-3", "fail"))
+
+	instances, err := m.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"instance-1", "instance-2"}, instances)
+
+	assert.True(t, m.Exist("instance-1"))
+	assert.False(t, m.Exist("instance-3"))
+
+	assert.True(t, m.CanConnect("instance-1", true))
+	assert.False(t, m.CanConnect("instance-2", true))
+
+	credentials, err := m.Credentials("instance-1")
+	require.NoError(t, err)
+	assert.Equal(t, docker.Credentials{
+		Host:      "tcp://instance-1.example.com:2376",
+		CertPath:  "/certs/instance-1",
+		TLSVerify: true,
+	}, credentials)
+
+	assert.NoError(t, m.Stop("instance-1", 0))
+	require.NoError(t, m.Remove("instance-1"))
+	assert.False(t, m.Exist("instance-1"))
+}
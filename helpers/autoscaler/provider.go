@@ -0,0 +1,14 @@
+package autoscaler
+
+import (
+	"context"
+)
+
+// Provider manages the instances of an instance group
+type Provider interface {
+	Create(ctx context.Context, name, driver string, options []string) error
+	Delete(ctx context.Context, name string) error
+	List(ctx context.Context) ([]string, error)
+	ConnectInfo(ctx context.Context, name string) (ConnectInfo, error)
+	Health(ctx context.Context, name string) error
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/autoscaler"
+)
+
+// The fake plugin keeps its instances in the JSON state file passed as its
+// only argument. Instances created with the "fail" option fail to be created
+// and the ones created with the "unhealthy" option fail the health checks
+type instance struct {
+	Driver  string   `json:"driver"`
+	Options []string `json:"options"`
+}
+
+type state map[string]instance
+
+func main() {
+	if len(os.Args) != 2 {
+		exit("usage: %s <state file>", os.Args[0])
+	}
+	stateFile := os.Args[1]
+
+	var request autoscaler.Request
+	err := json.NewDecoder(os.Stdin).Decode(&request)
+	if err != nil {
+		exit("decoding request: %v", err)
+	}
+
+	if request.Version != autoscaler.ProtocolVersion {
+		exit("unsupported protocol version %d", request.Version)
+	}
+
+	instances := loadState(stateFile)
+	response := handle(request, instances)
+	saveState(stateFile, instances)
+
+	_ = json.NewEncoder(os.Stdout).Encode(response)
+}
+
+func handle(request autoscaler.Request, instances state) autoscaler.Response {
+	inst, exists := instances[request.Name]
+
+	switch request.Operation {
+	case autoscaler.OperationCreate:
+		if exists {
+			return autoscaler.Response{}
+		}
+		if hasOption(request.Options, "fail") {
+			return autoscaler.Response{Error: "quota exceeded"}
+		}
+		instances[request.Name] = instance{Driver: request.Driver, Options: request.Options}
+
+	case autoscaler.OperationDelete:
+		if !exists {
+			return autoscaler.Response{Error: "instance not found"}
+		}
+		delete(instances, request.Name)
+
+	case autoscaler.OperationList:
+		response := autoscaler.Response{Instances: []string{}}
+		for name := range instances {
+			response.Instances = append(response.Instances, name)
+		}
+		sort.Strings(response.Instances)
+		return response
+
+	case autoscaler.OperationConnectInfo:
+		if !exists {
+			return autoscaler.Response{Error: "instance not found"}
+		}
+		return autoscaler.Response{
+			ConnectInfo: &autoscaler.ConnectInfo{
+				Host:      "tcp://" + request.Name + ".example.com:2376",
+				CertPath:  "/certs/" + request.Name,
+				TLSVerify: true,
+			},
+		}
+
+	case autoscaler.OperationHealth:
+		if !exists || hasOption(inst.Options, "unhealthy") {
+			return autoscaler.Response{Error: "instance is not healthy"}
+		}
+
+	default:
+		exit("unknown operation %q", request.Operation)
+	}
+
+	return autoscaler.Response{}
+}
+
+func hasOption(options []string, option string) bool {
+	for _, o := range options {
+		if o == option {
+			return true
+		}
+	}
+
+	return false
+}
+
+func loadState(file string) state {
+	instances := make(state)
+
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return instances
+	}
+	if err != nil {
+		exit("reading state: %v", err)
+	}
+
+	err = json.Unmarshal(data, &instances)
+	if err != nil {
+		exit("decoding state: %v", err)
+	}
+
+	return instances
+}
+
+func saveState(file string, instances state) {
+	data, err := json.Marshal(instances)
+	if err != nil {
+		exit("encoding state: %v", err)
+	}
+
+	err = ioutil.WriteFile(file, data, 0600)
+	if err != nil {
+		exit("writing state: %v", err)
+	}
+}
+
+func exit(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,71 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const podmanComponentName = "Podman Engine"
+
+// podmanNetworkAliasesMajorVersion is the first major version of Podman
+// supporting network aliases through its Docker compatible API
+const podmanNetworkAliasesMajorVersion = 3
+
+// Capabilities describes the behaviour of the container engine behind
+// the Docker API that differs between the supported engines
+type Capabilities struct {
+	// Podman is set when the API is served by Podman instead of Docker Engine
+	Podman bool
+	// Version is the version of the engine
+	Version string
+	// NetworkAliases is set when containers can be given aliases on user-defined networks
+	NetworkAliases bool
+	// VolumePermissions is set when the volumes need their permissions to be
+	// updated so that non-root users of the containers can write to them
+	VolumePermissions bool
+}
+
+// DetectCapabilities asks the engine for its version and returns the
+// capabilities matching it
+func DetectCapabilities(ctx context.Context, c Client) (Capabilities, error) {
+	version, err := c.ServerVersion(ctx)
+	if err != nil {
+		return Capabilities{}, fmt.Errorf("detecting container engine version: %w", err)
+	}
+
+	for _, component := range version.Components {
+		if component.Name == podmanComponentName {
+			return podmanCapabilities(component.Version), nil
+		}
+	}
+
+	return Capabilities{
+		Version:           version.Version,
+		NetworkAliases:    true,
+		VolumePermissions: true,
+	}, nil
+}
+
+func podmanCapabilities(version string) Capabilities {
+	return Capabilities{
+		Podman:         true,
+		Version:        version,
+		NetworkAliases: majorVersion(version) >= podmanNetworkAliasesMajorVersion,
+		// Podman changes the ownership of a new volume to the user of the
+		// first container mounting it, so there's nothing to update
+		VolumePermissions: false,
+	}
+}
+
+func majorVersion(version string) int {
+	major := strings.SplitN(strings.TrimPrefix(version, "v"), ".", 2)[0]
+
+	value, err := strconv.Atoi(major)
+	if err != nil {
+		return 0
+	}
+
+	return value
+}
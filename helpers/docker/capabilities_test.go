@@ -0,0 +1,98 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectCapabilities(t *testing.T) {
+	tests := map[string]struct {
+		version              types.Version
+		expectedCapabilities Capabilities
+	}{
+		"Docker Engine": {
+			version: types.Version{
+				Version:    "19.03.12",
+				Components: []types.ComponentVersion{{Name: "Engine", Version: "19.03.12"}},
+			},
+			expectedCapabilities: Capabilities{
+				Version:           "19.03.12",
+				NetworkAliases:    true,
+				VolumePermissions: true,
+			},
+		},
+		"Podman 2": {
+			version: types.Version{
+				Version:    "2.2.1",
+				Components: []types.ComponentVersion{{Name: "Podman Engine", Version: "2.2.1"}},
+			},
+			expectedCapabilities: Capabilities{
+				Podman:  true,
+				Version: "2.2.1",
+			},
+		},
+		"Podman 3": {
+			version: types.Version{
+				Version:    "3.0.1",
+				Components: []types.ComponentVersion{{Name: "Podman Engine", Version: "3.0.1"}},
+			},
+			expectedCapabilities: Capabilities{
+				Podman:         true,
+				Version:        "3.0.1",
+				NetworkAliases: true,
+			},
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			client, server := prepareDockerClientAndFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+				if !strings.HasSuffix(r.URL.Path, "/version") {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(w).Encode(tt.version)
+			})
+			defer server.Close()
+
+			capabilities, err := DetectCapabilities(context.Background(), client)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedCapabilities, capabilities)
+		})
+	}
+}
+
+func TestDetectCapabilitiesError(t *testing.T) {
+	client, server := prepareDockerClientAndFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	defer server.Close()
+
+	_, err := DetectCapabilities(context.Background(), client)
+	assert.Error(t, err)
+}
+
+func TestMajorVersion(t *testing.T) {
+	tests := map[string]int{
+		"3.0.1":   3,
+		"v2.2.1":  2,
+		"4":       4,
+		"":        0,
+		"invalid": 0,
+	}
+
+	for version, expected := range tests {
+		t.Run(version, func(t *testing.T) {
+			assert.Equal(t, expected, majorVersion(version))
+		})
+	}
+}
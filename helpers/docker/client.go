@@ -60,6 +60,7 @@ type Client interface {
 	VolumeRemove(ctx context.Context, volumeID string, force bool) error
 
 	Info(ctx context.Context) (types.Info, error)
+	ServerVersion(ctx context.Context) (types.Version, error)
 
 	Close() error
 }
@@ -245,6 +245,12 @@ func (c *officialDockerClient) Info(ctx context.Context) (types.Info, error) {
 	return info, wrapError("Info", err, started)
 }
 
+func (c *officialDockerClient) ServerVersion(ctx context.Context) (types.Version, error) {
+	started := time.Now()
+	version, err := c.client.ServerVersion(ctx)
+	return version, wrapError("ServerVersion", err, started)
+}
+
 func (c *officialDockerClient) ImageImportBlocking(
 	ctx context.Context,
 	source types.ImageImportSource,
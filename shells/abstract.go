@@ -38,11 +38,7 @@ func (b *AbstractShell) cacheFile(build *common.Build, userKey string) (key, fil
 		return
 	}
 
-	// Deduce cache key
-	key = path.Join(build.JobInfo.Name, build.GitInfo.Ref)
-	if userKey != "" {
-		key = build.GetAllVariables().ExpandValue(userKey)
-	}
+	key = build.GetCacheKey(userKey)
 
 	// Ignore cache without the key
 	if key == "" {
@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"path"
 
 	"gitlab.com/gitlab-org/gitlab-runner/common"
 )
@@ -13,10 +14,13 @@ import (
 // with exit code of 0 this can be useful in container environments where exiting with an exit code different from 0
 // would kill the container.
 // At the same time it writes to a file the actual exit code of the script as well as the filename
-// of the script as json.
+// of the script as json. The json is written to a status file too, since the log can be lost,
+// e.g. when it's rotated. The status file left by a previous attempt of the stage is
+// removed before the script runs.
 const bashTrapShellScript = `runner_script_trap() {
 	exit_code=$?
 	log_file=%s
+	status_file=%s
 	out_json="{\"command_exit_code\": $exit_code, \"script\": \"$0\"}"
 
 	# Make sure the command status will always be printed on a new line 
@@ -25,10 +29,14 @@ const bashTrapShellScript = `runner_script_trap() {
 	else 
 		printf "\n$out_json\n" >> $log_file
 	fi
+
+	printf "$out_json\n" > $status_file.tmp && mv $status_file.tmp $status_file
 	
 	exit 0
 }
 
+rm -f %s
+
 trap runner_script_trap EXIT
 
 `
@@ -36,7 +44,8 @@ trap runner_script_trap EXIT
 type BashTrapShellWriter struct {
 	*BashWriter
 
-	logFile string
+	logFile    string
+	statusFile string
 }
 
 func (b *BashTrapShellWriter) Finish(trace bool) string {
@@ -53,13 +62,22 @@ func (b *BashTrapShellWriter) Finish(trace bool) string {
 }
 
 func (b *BashTrapShellWriter) writeTrap(w io.Writer) {
-	_, _ = fmt.Fprintf(w, bashTrapShellScript, b.logFile)
+	_, _ = fmt.Fprintf(w, bashTrapShellScript, b.logFile, b.statusFile, b.statusFile)
 }
 
 type BashTrapShell struct {
 	*BashShell
 
 	LogFile string
+	// StatusDir is the directory where the exit status of each stage is
+	// written, to the file returned by TrapShellStatusFile
+	StatusDir string
+}
+
+// TrapShellStatusFile returns the file of the status directory where the exit
+// status of the stage is written
+func TrapShellStatusFile(statusDir string, buildStage common.BuildStage) string {
+	return path.Join(statusDir, string(buildStage)+".status")
 }
 
 func (b *BashTrapShell) GenerateScript(buildStage common.BuildStage, info common.ShellScriptInfo) (string, error) {
@@ -68,7 +86,8 @@ func (b *BashTrapShell) GenerateScript(buildStage common.BuildStage, info common
 			TemporaryPath: info.Build.TmpProjectDir(),
 			Shell:         b.Shell,
 		},
-		logFile: b.LogFile,
+		logFile:    b.LogFile,
+		statusFile: TrapShellStatusFile(b.StatusDir, buildStage),
 	}
 
 	return b.generateScript(w, buildStage, info)
@@ -0,0 +1,50 @@
+package shells
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+func TestBashTrapShellWriter_RemovesPreviousStatusFile(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+
+	dir, err := ioutil.TempDir("", "bash-trap")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	logFile := filepath.Join(dir, "output.log")
+	statusFile := TrapShellStatusFile(dir, common.BuildStageGetSources)
+
+	// the status of a failed previous attempt of the stage
+	require.NoError(t, ioutil.WriteFile(statusFile, []byte(`{"command_exit_code": 1, "script": "get_sources"}`), 0600))
+
+	w := &BashTrapShellWriter{
+		BashWriter: &BashWriter{Shell: "bash"},
+		logFile:    logFile,
+		statusFile: statusFile,
+	}
+	w.Line("test ! -e " + statusFile)
+
+	script := filepath.Join(dir, string(common.BuildStageGetSources))
+	require.NoError(t, ioutil.WriteFile(script, []byte(w.Finish(false)), 0700))
+	require.NoError(t, exec.Command("bash", script).Run())
+
+	data, err := ioutil.ReadFile(statusFile)
+	require.NoError(t, err)
+
+	var status TrapCommandExitStatus
+	require.True(t, status.TryUnmarshal(strings.TrimSpace(string(data))))
+	assert.Equal(t, 0, *status.CommandExitCode, "the status file must be removed before the stage runs")
+	assert.Equal(t, script, *status.Script)
+}